@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"html"
+	"strings"
+
+	"github.com/go-echarts/go-echarts/v2/components"
+)
+
+const overviewChartID = "overview"
+
+type navLink struct {
+	chartID string
+	title   string
+}
+
+// addAccountCharts adds one chart per account to the page, largest account first, and returns the links
+// to navigate between the overview and the accounts. Nothing is added for a single account.
+func addAccountCharts(page *components.Page) []navLink {
+	accounts := sortedChildren("all")
+	if len(accounts) < 2 {
+		return nil
+	}
+
+	nav := []navLink{{overviewChartID, "Overview"}}
+	for i, account := range accounts {
+		chartID := fmt.Sprintf("account-%d", i+1)
+		seriesName := fmt.Sprintf("%s %s-%s %s > %s", account.name, globalConfig.StartDate, globalConfig.EndDate, globalConfig.Metric, formatCost(globalConfig.Threshold, 0))
+		page.AddCharts(newChart(chartID, fmt.Sprintf("%s (%s)", chartTitle(), account.name), seriesName, accountData(account.name)))
+		nav = append(nav, navLink{chartID, account.name})
+	}
+	return nav
+}
+
+// accountData returns the costs of the given account. Costs fetched per account are exact,
+// otherwise the part of the diagram reachable from the account is used, which also includes
+// the costs of other accounts flowing through shared nodes such as services.
+func accountData(account string) map[string]map[string]float64 {
+	for _, data := range accountResults {
+		if _, ok := data["all"][account]; ok {
+			return data
+		}
+	}
+
+	data := make(map[string]map[string]float64)
+	addCost(data, "all", account, results["all"][account])
+	visited := map[string]bool{account: true}
+	queue := []string{account}
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		for child, cost := range results[parent] {
+			addCost(data, parent, child, cost)
+			if !visited[child] {
+				visited[child] = true
+				queue = append(queue, child)
+			}
+		}
+	}
+	return data
+}
+
+// navBar returns a bar of links to the charts that stays at the top of the page while scrolling
+func navBar(links []navLink) string {
+	var sb strings.Builder
+	sb.WriteString(`<nav style="position:sticky;top:0;z-index:10;display:flex;flex-wrap:wrap;gap:4px;padding:8px;background:#fff;border-bottom:1px solid #ddd;font-family:sans-serif;">`)
+	for _, link := range links {
+		fmt.Fprintf(&sb, `<a href="#%s" style="padding:4px 12px;border:1px solid #ddd;border-radius:4px;text-decoration:none;color:#333;">%s</a>`,
+			link.chartID, html.EscapeString(link.title))
+	}
+	sb.WriteString("</nav>\n")
+	return sb.String()
+}
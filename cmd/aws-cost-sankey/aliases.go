@@ -0,0 +1,42 @@
+package main
+
+import "aws-costexplorer/pkg/costgraph"
+
+// applyAliases renames nodes to the configured aliases, e.g. "Amazon Elastic Compute Cloud - Compute" to "EC2".
+// Nodes with the same alias are merged. Anomalies and budgets follow their nodes so highlighting still applies.
+func applyAliases() {
+	if len(globalConfig.Aliases) == 0 {
+		return
+	}
+	renameNodes(globalConfig.Aliases)
+}
+
+// renameNodes renames nodes of the results, of each bucket and account, and their anomalies and budgets
+func renameNodes(names map[string]string) {
+	rename := func(node string) string {
+		if name, ok := names[node]; ok && name != "" {
+			return name
+		}
+		return node
+	}
+
+	results.Rename(names)
+	for _, data := range bucketResults {
+		costgraph.Flows(data).Rename(names)
+	}
+	for _, data := range accountResults {
+		costgraph.Flows(data).Rename(names)
+	}
+
+	anomalies := make(map[string]bool)
+	for node := range anomalousNodes {
+		anomalies[rename(node)] = true
+	}
+	anomalousNodes = anomalies
+
+	budgets := make(map[string]budgetStatus)
+	for node, status := range nodeBudgets {
+		budgets[rename(node)] = status
+	}
+	nodeBudgets = budgets
+}
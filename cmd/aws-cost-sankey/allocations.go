@@ -0,0 +1,158 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// AllocationRule splits the cost of a shared node, e.g. "Support" or "acct1/unknown", across target nodes.
+// Shares are fixed percentages per target. Without shares, the cost is split across the targets, or the nodes of a level,
+// in proportion to their own cost.
+type AllocationRule struct {
+	Node    string             `yaml:"node"`
+	Targets []string           `yaml:"targets"`
+	Level   string             `yaml:"level"`
+	Shares  map[string]float64 `yaml:"shares"`
+}
+
+// Describes how shared nodes were allocated, for the text report
+var allocationReport []string
+
+// validateAllocations checks the allocation rules before any cost is fetched
+func validateAllocations() error {
+	for _, rule := range globalConfig.Allocations {
+		if rule.Node == "" {
+			return fmt.Errorf("allocation rule without node")
+		}
+		if len(rule.Shares) == 0 && len(rule.Targets) == 0 && rule.Level == "" {
+			return fmt.Errorf("allocation of %s needs shares, targets or a level", rule.Node)
+		}
+		var total float64
+		for target, share := range rule.Shares {
+			if share < 0 {
+				return fmt.Errorf("allocation of %s to %s can't be negative: %g", rule.Node, target, share)
+			}
+			total += share
+		}
+		if len(rule.Shares) > 0 && math.Abs(total-100) > 0.01 {
+			return fmt.Errorf("allocation shares of %s must add up to 100: %g", rule.Node, total)
+		}
+	}
+	return nil
+}
+
+// applyAllocations moves the cost of each shared node to its targets, in the order of the rules, so that the
+// diagram is fully allocated. Targets take over the children of the shared node, or the shared node itself if it
+// has none, e.g. "Support" then appears below each environment it is allocated to.
+func applyAllocations() {
+	for _, rule := range globalConfig.Allocations {
+		if line := allocate(results, rule); line != "" {
+			allocationReport = append(allocationReport, line)
+		}
+		for _, data := range bucketResults {
+			allocate(data, rule)
+		}
+		for _, data := range accountResults {
+			allocate(data, rule)
+		}
+	}
+}
+
+// allocate applies a rule to the data and describes the allocation, or returns an empty string if nothing was allocated
+func allocate(data map[string]map[string]float64, rule AllocationRule) string {
+	incoming, total := incomingLinks(data, rule.Node)
+	if total == 0 {
+		return ""
+	}
+	shares := allocationShares(data, rule)
+	if len(shares) == 0 {
+		warnf("No targets to allocate %s to", rule.Node)
+		return ""
+	}
+
+	children := data[rule.Node]
+	if len(children) == 0 {
+		children = map[string]float64{rule.Node: total}
+	}
+	for parent, cost := range incoming {
+		subtractUp(data, parent, rule.Node, cost)
+	}
+	delete(data, rule.Node)
+
+	targets := make([]string, 0, len(shares))
+	for target := range shares {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	parts := make([]string, 0, len(targets))
+	for _, target := range targets {
+		share := shares[target]
+		addUp(data, target, total*share)
+		for child, cost := range children {
+			addCost(data, target, child, cost*share)
+		}
+		parts = append(parts, fmt.Sprintf("%s %s (%.0f%%)", target, formatCost(total*share, 2), share*100))
+	}
+	return fmt.Sprintf("Allocated %s %s to %s", rule.Node, formatCost(total, 2), strings.Join(parts, ", "))
+}
+
+// allocationShares returns the share of each target present in the data, adding up to 1
+func allocationShares(data map[string]map[string]float64, rule AllocationRule) map[string]float64 {
+	weights := make(map[string]float64)
+	switch {
+	case len(rule.Shares) > 0:
+		for target, share := range rule.Shares {
+			if _, total := incomingLinks(data, target); total != 0 || len(data[target]) > 0 {
+				weights[target] = share
+			} else {
+				warnf("Allocation target %s of %s not found, sharing among the other targets", target, rule.Node)
+			}
+		}
+	case len(rule.Targets) > 0:
+		for _, target := range rule.Targets {
+			if _, total := incomingLinks(data, target); total > 0 {
+				weights[target] = total
+			}
+		}
+	default:
+		for node, depth := range costgraph.Flows(data).Depths() {
+			if depth == 0 || node == rule.Node || (levelName(depth) != rule.Level && levelTitle(depth) != rule.Level) {
+				continue
+			}
+			if _, total := incomingLinks(data, node); total > 0 {
+				weights[node] = total
+			}
+		}
+	}
+	delete(weights, rule.Node)
+
+	var sum float64
+	for _, weight := range weights {
+		sum += weight
+	}
+	shares := make(map[string]float64)
+	for target, weight := range weights {
+		if sum > 0 && weight > 0 {
+			shares[target] = weight / sum
+		}
+	}
+	return shares
+}
+
+// addUp raises the links into the node by the cost, and the links into its parents by the same amount,
+// sharing it in proportion to the links of nodes with several parents
+func addUp(data map[string]map[string]float64, node string, cost float64) {
+	incoming, total := incomingLinks(data, node)
+	if total == 0 {
+		return
+	}
+	for parent, value := range incoming {
+		share := cost * value / total
+		addCost(data, parent, node, share)
+		addUp(data, parent, share)
+	}
+}
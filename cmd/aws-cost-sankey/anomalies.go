@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+const anomalyColor = "#d62728"
+
+var anomalies []types.Anomaly
+var monitorNames = make(map[string]string)
+
+// Nodes affected by an anomaly, highlighted in the chart
+var anomalousNodes = make(map[string]bool)
+
+// fetchAnomalies collects the anomalies detected by Cost Anomaly Detection during the selected period.
+// Anomalies are deduplicated since multiple accounts may share the same monitors.
+func fetchAnomalies(accountName string, svc costExplorerAPI) error {
+	infof("Fetching anomalies for %s", accountName)
+
+	var monitors []types.AnomalyMonitor
+	monitorsInput := &costexplorer.GetAnomalyMonitorsInput{}
+	for {
+		result, err := svc.GetAnomalyMonitors(runContext, monitorsInput)
+		if err != nil {
+			return fmt.Errorf("failed to get anomaly monitors: %w", err)
+		}
+		monitors = append(monitors, result.AnomalyMonitors...)
+		if result.NextPageToken == nil || *result.NextPageToken == "" {
+			break
+		}
+		monitorsInput.NextPageToken = result.NextPageToken
+	}
+
+	var detected []types.Anomaly
+	input := &costexplorer.GetAnomaliesInput{
+		DateInterval: &types.AnomalyDateInterval{
+			StartDate: aws.String(globalConfig.StartDate),
+			EndDate:   aws.String(globalConfig.EndDate),
+		},
+	}
+	for {
+		result, err := svc.GetAnomalies(runContext, input)
+		if err != nil {
+			return fmt.Errorf("failed to get anomalies: %w", err)
+		}
+		detected = append(detected, result.Anomalies...)
+		if result.NextPageToken == nil || *result.NextPageToken == "" {
+			break
+		}
+		input.NextPageToken = result.NextPageToken
+	}
+
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+
+	for _, monitor := range monitors {
+		monitorNames[aws.ToString(monitor.MonitorArn)] = aws.ToString(monitor.MonitorName)
+	}
+
+	seen := make(map[string]bool)
+	for _, anomaly := range anomalies {
+		seen[aws.ToString(anomaly.AnomalyId)] = true
+	}
+	for _, anomaly := range detected {
+		if seen[aws.ToString(anomaly.AnomalyId)] {
+			continue
+		}
+		seen[aws.ToString(anomaly.AnomalyId)] = true
+		anomalies = append(anomalies, anomaly)
+
+		for _, rootCause := range anomaly.RootCauses {
+			if rootCause.Service != nil {
+				anomalousNodes[*rootCause.Service] = true
+			}
+			if rootCause.UsageType != nil {
+				anomalousNodes[*rootCause.UsageType] = true
+			}
+		}
+	}
+	return nil
+}
+
+// anomalyReport describes each anomaly on a separate line
+func anomalyReport() []string {
+	lines := make([]string, 0, len(anomalies))
+	for _, anomaly := range anomalies {
+		var impact float64
+		if anomaly.Impact != nil {
+			impact = anomaly.Impact.TotalImpact
+		}
+
+		causes := make([]string, 0, len(anomaly.RootCauses))
+		for _, rootCause := range anomaly.RootCauses {
+			parts := make([]string, 0, 4)
+			for _, part := range []*string{rootCause.LinkedAccountName, rootCause.Service, rootCause.Region, rootCause.UsageType} {
+				if part != nil && *part != "" {
+					parts = append(parts, *part)
+				}
+			}
+			causes = append(causes, strings.Join(parts, "/"))
+		}
+
+		lines = append(lines, fmt.Sprintf("Anomaly %s to %s impact %s monitor %s root causes: %s",
+			aws.ToString(anomaly.AnomalyStartDate), aws.ToString(anomaly.AnomalyEndDate), formatCost(impact, 2),
+			monitorNames[aws.ToString(anomaly.MonitorArn)], strings.Join(causes, ", ")))
+	}
+	return lines
+}
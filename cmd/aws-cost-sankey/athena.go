@@ -0,0 +1,155 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/athena"
+	athenatypes "github.com/aws/aws-sdk-go-v2/service/athena/types"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/fetch"
+)
+
+// AthenaConfig describes a query against a CUR or Data Exports table.
+// Each result row is a path through the sankey diagram: the level columns in order, followed by the cost.
+type AthenaConfig struct {
+	Database       string   `yaml:"database"`
+	Workgroup      string   `yaml:"workgroup"`
+	OutputLocation string   `yaml:"outputLocation"`
+	Region         string   `yaml:"region"`
+	Query          string   `yaml:"query"`
+	Columns        []string `yaml:"columns"`
+	CostColumn     string   `yaml:"costColumn"`
+}
+
+const athenaPollInterval = 2 * time.Second
+
+// athenaProvider provides the costs of the rows of an Athena query against a CUR or Data Exports table
+type athenaProvider struct {
+	cfg aws.Config
+}
+
+// Fetch runs the configured query and aggregates its rows along the level columns.
+// {start} and {end} in the query are replaced by the dates of the period.
+func (p athenaProvider) Fetch(ctx context.Context, period costgraph.Period, _ []fetch.Level) (costgraph.Flows, error) {
+	athenaConfig := globalConfig.Athena
+	cfg := p.cfg
+	if athenaConfig.Region != "" {
+		cfg.Region = athenaConfig.Region
+	}
+	svc := athena.NewFromConfig(cfg)
+
+	query := strings.NewReplacer("{start}", period.Start, "{end}", period.End).Replace(athenaConfig.Query)
+	input := &athena.StartQueryExecutionInput{
+		QueryString:           aws.String(query),
+		QueryExecutionContext: &athenatypes.QueryExecutionContext{Database: aws.String(athenaConfig.Database)},
+	}
+	if athenaConfig.Workgroup != "" {
+		input.WorkGroup = aws.String(athenaConfig.Workgroup)
+	}
+	if athenaConfig.OutputLocation != "" {
+		input.ResultConfiguration = &athenatypes.ResultConfiguration{OutputLocation: aws.String(athenaConfig.OutputLocation)}
+	}
+
+	infof("Running Athena query on %s", athenaConfig.Database)
+	execution, err := svc.StartQueryExecution(ctx, input)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start Athena query: %w", err)
+	}
+	if err := waitForQuery(ctx, svc, execution.QueryExecutionId); err != nil {
+		return nil, err
+	}
+
+	costColumn := athenaConfig.CostColumn
+	if costColumn == "" {
+		costColumn = "cost"
+	}
+
+	flows := make(costgraph.Flows)
+	var header []string
+	paginator := athena.NewGetQueryResultsPaginator(svc, &athena.GetQueryResultsInput{QueryExecutionId: execution.QueryExecutionId})
+	for paginator.HasMorePages() {
+		page, err := paginator.NextPage(ctx)
+		if err != nil {
+			return flows, fmt.Errorf("failed to get Athena query results: %w", err)
+		}
+
+		for _, resultRow := range page.ResultSet.Rows {
+			values := make([]string, len(resultRow.Data))
+			for i, datum := range resultRow.Data {
+				values[i] = aws.ToString(datum.VarCharValue)
+			}
+
+			// The first row of the first page holds the column names
+			if header == nil {
+				header = values
+				continue
+			}
+
+			row := make(map[string]string, len(header))
+			for i, column := range header {
+				if i < len(values) {
+					row[column] = values[i]
+				}
+			}
+			if err := addAthenaRow(flows, row, header, costColumn); err != nil {
+				return flows, err
+			}
+		}
+	}
+	return flows, nil
+}
+
+func addAthenaRow(flows costgraph.Flows, row map[string]string, header []string, costColumn string) error {
+	if row[costColumn] == "" {
+		return nil
+	}
+	cost, err := strconv.ParseFloat(row[costColumn], 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse cost: %w", err)
+	}
+
+	// Without explicit columns, every column except the cost is a level
+	columns := globalConfig.Athena.Columns
+	if len(columns) == 0 {
+		for _, column := range header {
+			if column != costColumn {
+				columns = append(columns, column)
+			}
+		}
+	}
+
+	nodes := make([]string, len(columns))
+	for i, column := range columns {
+		nodes[i] = row[column]
+	}
+	addPath(flows, nodes, roundCost(cost))
+	return nil
+}
+
+func waitForQuery(ctx context.Context, svc *athena.Client, queryExecutionID *string) error {
+	for {
+		result, err := svc.GetQueryExecution(ctx, &athena.GetQueryExecutionInput{QueryExecutionId: queryExecutionID})
+		if err != nil {
+			return fmt.Errorf("failed to get Athena query status: %w", err)
+		}
+
+		status := result.QueryExecution.Status
+		switch status.State {
+		case athenatypes.QueryExecutionStateSucceeded:
+			return nil
+		case athenatypes.QueryExecutionStateFailed, athenatypes.QueryExecutionStateCancelled:
+			return fmt.Errorf("Athena query %s: %s", status.State, aws.ToString(status.StateChangeReason))
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(athenaPollInterval):
+		}
+	}
+}
@@ -0,0 +1,185 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/fetch"
+)
+
+const (
+	ProviderAWS   = "aws"
+	ProviderAzure = "azure"
+)
+
+const azureCostQueryAPIVersion = "2023-03-01"
+
+// azureProvider provides the cost of an Azure subscription by resource group and service,
+// added below the "Azure" node as subscription, resource group and service levels
+type azureProvider struct {
+	account Account
+}
+
+// Fetch queries the Cost Management API of the subscription
+func (p azureProvider) Fetch(ctx context.Context, period costgraph.Period, _ []fetch.Level) (costgraph.Flows, error) {
+	account := p.account
+	infof("Fetching Azure data for %s", account.Name)
+
+	token, err := azureAccessToken(ctx, account)
+	if err != nil {
+		return nil, err
+	}
+
+	// Azure time periods are inclusive while Cost Explorer end dates are exclusive
+	end, err := time.Parse(time.DateOnly, period.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse end date: %v", err)
+	}
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"type":      "ActualCost",
+		"timeframe": "Custom",
+		"timePeriod": map[string]string{
+			"from": period.Start + "T00:00:00Z",
+			"to":   end.Add(-time.Second).Format(time.RFC3339),
+		},
+		"dataset": map[string]interface{}{
+			"granularity": "None",
+			"aggregation": map[string]interface{}{
+				"totalCost": map[string]string{"name": "Cost", "function": "Sum"},
+			},
+			"grouping": []map[string]string{
+				{"type": "Dimension", "name": "ResourceGroupName"},
+				{"type": "Dimension", "name": "ServiceName"},
+			},
+		},
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	endpoint := fmt.Sprintf("https://management.azure.com/subscriptions/%s/providers/Microsoft.CostManagement/query?api-version=%s",
+		account.SubscriptionID, azureCostQueryAPIVersion)
+	// Costs are added once all pages are read, so that a failed subscription adds nothing
+	type azureCost struct {
+		resourceGroup, service, unit string
+		cost                         float64
+	}
+	var costs []azureCost
+	for endpoint != "" {
+		response, err := azureRequest(ctx, endpoint, token, requestBody)
+		if err != nil {
+			return nil, err
+		}
+		properties, _ := response["properties"].(map[string]interface{})
+
+		// Locate the columns by name since their order is not guaranteed
+		index := make(map[string]int)
+		columns, _ := properties["columns"].([]interface{})
+		for i, column := range columns {
+			name, _ := column.(map[string]interface{})["name"].(string)
+			index[name] = i
+		}
+		for _, name := range []string{"Cost", "ResourceGroupName", "ServiceName"} {
+			if _, ok := index[name]; !ok {
+				return nil, fmt.Errorf("no %s column in the Azure cost query response", name)
+			}
+		}
+
+		rows, _ := properties["rows"].([]interface{})
+		for i, r := range rows {
+			row, _ := r.([]interface{})
+			if len(row) < len(columns) {
+				return nil, fmt.Errorf("row %d of the Azure cost query response has %d values for %d columns", i, len(row), len(columns))
+			}
+			var c azureCost
+			c.cost, _ = row[index["Cost"]].(float64)
+			if i, ok := index["Currency"]; ok {
+				c.unit, _ = row[i].(string)
+			}
+			c.resourceGroup, _ = row[index["ResourceGroupName"]].(string)
+			c.service, _ = row[index["ServiceName"]].(string)
+			costs = append(costs, c)
+		}
+
+		endpoint, _ = properties["nextLink"].(string)
+	}
+	flows := make(costgraph.Flows)
+	for _, c := range costs {
+		cost := c.cost
+		if c.unit != "" {
+			var err error
+			if cost, err = convertCost(cost, c.unit); err != nil {
+				return nil, err
+			}
+		}
+		addPath(flows, []string{"Azure", account.Name, c.resourceGroup, c.service}, roundCost(cost))
+	}
+	return flows, nil
+}
+
+func azureRequest(ctx context.Context, endpoint string, token string, requestBody []byte) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, "POST", endpoint, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Azure request failed with %s: %s", resp.Status, body)
+	}
+
+	var responseBody map[string]interface{}
+	if err := json.Unmarshal(body, &responseBody); err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %v", err)
+	}
+	return responseBody, nil
+}
+
+// azureAccessToken obtains a token for the Azure Resource Manager API with the client credentials of a service principal
+func azureAccessToken(ctx context.Context, account Account) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "client_credentials")
+	form.Set("client_id", account.ClientID)
+	form.Set("client_secret", account.ClientSecret)
+	form.Set("scope", "https://management.azure.com/.default")
+
+	endpoint := fmt.Sprintf("https://login.microsoftonline.com/%s/oauth2/v2.0/token", account.TenantID)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to request Azure access token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil || tokenResponse.AccessToken == "" {
+		return "", fmt.Errorf("failed to obtain Azure access token: %s", resp.Status)
+	}
+	return tokenResponse.AccessToken, nil
+}
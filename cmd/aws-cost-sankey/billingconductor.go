@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/billingconductor"
+	"github.com/aws/aws-sdk-go-v2/service/billingconductor/types"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/fetch"
+)
+
+// Billing Conductor is a global API served from us-east-1
+const billingConductorRegion = "us-east-1"
+
+type BillingConductorConfig struct {
+	BillingGroups []string `yaml:"billingGroups"`
+}
+
+// billingConductorProvider provides the pro forma cost of each Billing Conductor billing group by service,
+// so that resellers can render the marked-up costs billed to their customers instead of the payer account actuals
+type billingConductorProvider struct {
+	cfg aws.Config
+}
+
+// Fetch returns the pro forma costs of the billing periods of the months of the period
+func (p billingConductorProvider) Fetch(ctx context.Context, period costgraph.Period, _ []fetch.Level) (costgraph.Flows, error) {
+	infof("Fetching pro forma costs from Billing Conductor")
+	svc := billingconductor.NewFromConfig(p.cfg, func(o *billingconductor.Options) {
+		o.Region = billingConductorRegion
+	})
+
+	// Billing periods are whole months, the end date is exclusive
+	start, err := time.Parse(time.DateOnly, period.Start)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse start date: %w", err)
+	}
+	end, err := time.Parse(time.DateOnly, period.End)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse end date: %w", err)
+	}
+	billingPeriodRange := &types.BillingPeriodRange{
+		InclusiveStartBillingPeriod: aws.String(start.Format("2006-01")),
+		ExclusiveEndBillingPeriod:   aws.String(exclusiveEndBillingPeriod(end)),
+	}
+
+	groups, err := listBillingGroups(ctx, svc)
+	if err != nil {
+		return nil, err
+	}
+	flows := make(costgraph.Flows)
+	for arn, name := range groups {
+		infof("Fetching pro forma costs for billing group %s", name)
+
+		paginator := billingconductor.NewGetBillingGroupCostReportPaginator(svc, &billingconductor.GetBillingGroupCostReportInput{
+			Arn:                aws.String(arn),
+			BillingPeriodRange: billingPeriodRange,
+			GroupBy:            []types.GroupByAttributeName{types.GroupByAttributeNameProductName},
+		})
+		for paginator.HasMorePages() {
+			output, err := paginator.NextPage(ctx)
+			if err != nil {
+				return flows, fmt.Errorf("failed to get the cost report of billing group %s: %w", name, err)
+			}
+			for _, report := range output.BillingGroupCostReportResults {
+				cost, err := strconv.ParseFloat(aws.ToString(report.ProformaCost), 64)
+				if err != nil {
+					return flows, fmt.Errorf("failed to parse pro forma cost: %w", err)
+				}
+				if c := aws.ToString(report.Currency); c != "" {
+					if globalConfig.Exchange.Currency == "" {
+						currency = c
+					}
+					if cost, err = convertCost(cost, c); err != nil {
+						return flows, err
+					}
+				}
+
+				var product string
+				for _, attribute := range report.Attributes {
+					if aws.ToString(attribute.Key) == string(types.GroupByAttributeNameProductName) {
+						product = aws.ToString(attribute.Value)
+					}
+				}
+				addPath(flows, []string{name, product}, roundCost(cost))
+			}
+		}
+	}
+	return flows, nil
+}
+
+// exclusiveEndBillingPeriod returns the month following the one of the last day before the exclusive end date
+func exclusiveEndBillingPeriod(end time.Time) string {
+	last := end.AddDate(0, 0, -1)
+	return time.Date(last.Year(), last.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, 1, 0).Format("2006-01")
+}
+
+// listBillingGroups returns the names of billing groups keyed by ARN, restricted to the configured ones if any
+func listBillingGroups(ctx context.Context, svc *billingconductor.Client) (map[string]string, error) {
+	groups := make(map[string]string)
+	input := &billingconductor.ListBillingGroupsInput{}
+	if len(globalConfig.BillingConductor.BillingGroups) > 0 {
+		input.Filters = &types.ListBillingGroupsFilter{Arns: globalConfig.BillingConductor.BillingGroups}
+	}
+	paginator := billingconductor.NewListBillingGroupsPaginator(svc, input)
+	for paginator.HasMorePages() {
+		output, err := paginator.NextPage(ctx)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list billing groups: %w", err)
+		}
+		for _, group := range output.BillingGroups {
+			groups[aws.ToString(group.Arn)] = aws.ToString(group.Name)
+		}
+	}
+	return groups, nil
+}
@@ -0,0 +1,15 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestExclusiveEndBillingPeriod(t *testing.T) {
+	for end, want := range map[string]string{"2024-02-01": "2024-02", "2024-03-31": "2024-04", "2024-11-01": "2024-11"} {
+		date, _ := time.Parse(time.DateOnly, end)
+		if got := exclusiveEndBillingPeriod(date); got != want {
+			t.Errorf("exclusiveEndBillingPeriod(%s) = %s, want %s", end, got, want)
+		}
+	}
+}
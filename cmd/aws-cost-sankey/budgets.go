@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/budgets"
+	budgettypes "github.com/aws/aws-sdk-go-v2/service/budgets/types"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const overBudgetColor = "#ff7f0e"
+
+// Budget vs. actual of a node for the current budget period
+type budgetStatus struct {
+	Name     string
+	Limit    float64
+	Actual   float64
+	Forecast float64
+}
+
+// Budgets keyed by the node they apply to
+var nodeBudgets = make(map[string]budgetStatus)
+
+// fetchBudgets reads the cost budgets of the account and attaches them to nodes of the diagram.
+// Budgets without filters apply to defaultNode, budgets filtered to a single linked account apply to
+// that account's node as named by accountNames, and budgets filtered to a single tag value apply to the tag node.
+func fetchBudgets(accountName string, cfg aws.Config, defaultNode string, accountNames map[string]string) error {
+	infof("Fetching budgets for %s", accountName)
+
+	identity, err := sts.NewFromConfig(cfg).GetCallerIdentity(runContext, &sts.GetCallerIdentityInput{})
+	if err != nil {
+		return fmt.Errorf("failed to get caller identity: %w", err)
+	}
+
+	svc := budgets.NewFromConfig(cfg)
+	input := &budgets.DescribeBudgetsInput{AccountId: identity.Account}
+	for {
+		result, err := svc.DescribeBudgets(runContext, input)
+		if err != nil {
+			return fmt.Errorf("failed to describe budgets: %w", err)
+		}
+
+		for _, budget := range result.Budgets {
+			if budget.BudgetType != budgettypes.BudgetTypeCost || budget.BudgetLimit == nil || budget.CalculatedSpend == nil {
+				continue
+			}
+			node := budgetNode(budget.CostFilters, defaultNode, accountNames)
+			if node == "" {
+				warnf("Skipping budget %s, its filters don't match a single node", aws.ToString(budget.BudgetName))
+				continue
+			}
+
+			status := budgetStatus{Name: aws.ToString(budget.BudgetName)}
+			if status.Limit, err = parseBudgetAmount(budget.BudgetLimit); err != nil {
+				return err
+			}
+			if status.Actual, err = parseBudgetAmount(budget.CalculatedSpend.ActualSpend); err != nil {
+				return err
+			}
+			if status.Forecast, err = parseBudgetAmount(budget.CalculatedSpend.ForecastedSpend); err != nil {
+				return err
+			}
+
+			resultsMu.Lock()
+			nodeBudgets[node] = status
+			resultsMu.Unlock()
+		}
+
+		if result.NextToken == nil || *result.NextToken == "" {
+			break
+		}
+		input.NextToken = result.NextToken
+	}
+	return nil
+}
+
+// budgetNode returns the node a budget applies to, or an empty string if it can't be mapped to a single node
+func budgetNode(filters map[string][]string, defaultNode string, accountNames map[string]string) string {
+	switch len(filters) {
+	case 0:
+		return defaultNode
+	case 1:
+		if ids := filters["LinkedAccount"]; len(ids) == 1 {
+			return accountNames[ids[0]]
+		}
+		// Tags are filtered as "user:key$value", matching the names of tag nodes of the account
+		if values := filters["TagKeyValue"]; len(values) == 1 {
+			if defaultNode == "all" {
+				return tagValue(values[0])
+			}
+			return accountNode(defaultNode, tagValue(values[0]))
+		}
+	}
+	return ""
+}
+
+func parseBudgetAmount(spend *budgettypes.Spend) (float64, error) {
+	if spend == nil || spend.Amount == nil {
+		return 0, nil
+	}
+	amount, err := strconv.ParseFloat(*spend.Amount, 64)
+	if err != nil {
+		return 0, fmt.Errorf("failed to parse budget amount: %w", err)
+	}
+	return amount, nil
+}
+
+func isOverBudget(node string) bool {
+	status, ok := nodeBudgets[node]
+	return ok && status.Limit > 0 && status.Actual > status.Limit
+}
+
+// budgetReport lists the budgets that are exceeded
+func budgetReport() []string {
+	nodes := make([]string, 0, len(nodeBudgets))
+	for node := range nodeBudgets {
+		if isOverBudget(node) {
+			nodes = append(nodes, node)
+		}
+	}
+	sort.Strings(nodes)
+
+	lines := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		status := nodeBudgets[node]
+		lines = append(lines, fmt.Sprintf("Budget %s of %s exceeded: limit %s actual %s forecast %s (%.0f%%)",
+			status.Name, node, formatCost(status.Limit, 2), formatCost(status.Actual, 2), formatCost(status.Forecast, 2), status.Actual/status.Limit*100))
+	}
+	return lines
+}
@@ -0,0 +1,121 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"log"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+// Cached responses expire after a day unless configured otherwise
+const defaultCacheTTL = 24
+
+type CacheConfig struct {
+	Dir string `yaml:"dir"`
+	TTL int    `yaml:"ttl"`
+}
+
+// Set by the -no-cache flag to always query Cost Explorer and refresh the cache
+var refreshCache bool
+
+// cacheDir returns the directory of cached responses, defaulting to the user cache directory
+func cacheDir() string {
+	if globalConfig.Cache.Dir != "" {
+		return globalConfig.Cache.Dir
+	}
+	dir, err := os.UserCacheDir()
+	if err != nil {
+		dir = os.TempDir()
+	}
+	return filepath.Join(dir, "aws-cost-sankey")
+}
+
+// cacheKey identifies a request of an account. The input carries the date range, grouping, filters, metric and page.
+func cacheKey(accountName string, input *costexplorer.GetCostAndUsageInput) string {
+	data, err := json.Marshal(struct {
+		Account string
+		Input   *costexplorer.GetCostAndUsageInput
+	}{accountName, input})
+	if err != nil {
+		log.Fatalf("failed to build cache key: %v", err)
+	}
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:])
+}
+
+// Days after the end of a month during which its costs still change, e.g. by late usage, credits and refunds
+const cacheGraceDays = 5
+
+// settledTime returns when the costs of the period no longer change, a few days after the end of its month.
+// Periods are split per month, so they end within the month they cover or on the first day of the next one.
+func settledTime(period *types.DateInterval) (time.Time, bool) {
+	end, err := time.Parse(time.DateOnly, aws.ToString(period.End))
+	if err != nil {
+		return time.Time{}, false
+	}
+	last := end.AddDate(0, 0, -1)
+	return time.Date(last.Year(), last.Month()+1, 1, 0, 0, 0, 0, time.UTC).AddDate(0, 0, cacheGraceDays), true
+}
+
+// cacheFile returns the file caching the response of the request
+func cacheFile(accountName string, input *costexplorer.GetCostAndUsageInput) string {
+	return filepath.Join(cacheDir(), cacheKey(accountName, input)+".json")
+}
+
+// cacheFresh reports whether the cached response of a period can be used instead of querying Cost Explorer
+func cacheFresh(filename string, period *types.DateInterval) bool {
+	info, err := os.Stat(filename)
+	if err != nil || refreshCache {
+		return false
+	}
+	// Responses cached once the period settled never expire
+	if settled, ok := settledTime(period); ok && info.ModTime().After(settled) {
+		return true
+	}
+	ttl := time.Duration(globalConfig.Cache.TTL) * time.Hour
+	return time.Since(info.ModTime()) < ttl
+}
+
+// cachedCostAndUsage returns the cached response of the request if it is still fresh,
+// otherwise queries Cost Explorer and stores the response. Each request is billed by AWS,
+// so repeated runs over the same period are served from disk.
+// Responses of completed months never change and don't expire.
+func cachedCostAndUsage(accountName string, svc costExplorerAPI, input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error) {
+	filename := cacheFile(accountName, input)
+	if cacheFresh(filename, input.TimePeriod) {
+		data, err := os.ReadFile(filename)
+		if err == nil {
+			var output costexplorer.GetCostAndUsageOutput
+			if err := json.Unmarshal(data, &output); err == nil {
+				debugf("Using cached response for %s", accountName)
+				return &output, nil
+			}
+		}
+		warnf("Ignoring unreadable cache entry %s", filename)
+	}
+
+	output, err := svc.GetCostAndUsage(runContext, input)
+	if err != nil {
+		return nil, err
+	}
+
+	// Failing to cache is not fatal, the response is simply fetched again next time
+	data, err := json.Marshal(output)
+	if err == nil {
+		err = os.MkdirAll(filepath.Dir(filename), 0o700)
+	}
+	if err == nil {
+		err = os.WriteFile(filename, data, 0o600)
+	}
+	if err != nil {
+		warnf("Failed to cache response for %s: %v", accountName, err)
+	}
+	return output, nil
+}
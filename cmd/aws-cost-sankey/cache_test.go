@@ -0,0 +1,35 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+func TestCacheFreshAfterGracePeriod(t *testing.T) {
+	setupFetchTest(t, Config{Cache: CacheConfig{TTL: 1}})
+	filename := filepath.Join(t.TempDir(), "response.json")
+	if err := os.WriteFile(filename, []byte("{}"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	period := &types.DateInterval{Start: aws.String("2024-10-01"), End: aws.String("2024-11-01")}
+	for _, tt := range []struct {
+		cached string
+		want   bool
+	}{
+		{"2024-11-02", false}, // Cached before the October invoice settled
+		{"2024-11-07", true},
+	} {
+		cached, _ := time.Parse(time.DateOnly, tt.cached)
+		if err := os.Chtimes(filename, cached, cached); err != nil {
+			t.Fatal(err)
+		}
+		if got := cacheFresh(filename, period); got != tt.want {
+			t.Errorf("cacheFresh() of a response cached on %s = %v, want %v", tt.cached, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,103 @@
+package main
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch"
+	"github.com/aws/aws-sdk-go-v2/service/cloudwatch/types"
+)
+
+// Namespace of the metrics, unless configured otherwise
+const defaultCloudWatchNamespace = "AWSCostSankey"
+
+// Metrics sent per PutMetricData request, which takes up to 1000
+const cloudWatchBatchSize = 500
+
+// CloudWatchConfig puts the costs as custom metrics, e.g. for alarms on the cost of an account. Each node is a Cost
+// metric with its level and name as dimensions, e.g. Level=service and Node=AWS Lambda, next to a TotalCost metric.
+// Every dimension value is billed as a custom metric, so levels can be limited, e.g. to ["account", "environment"].
+type CloudWatchConfig struct {
+	Namespace string   `yaml:"namespace"`
+	Region    string   `yaml:"region"`
+	Levels    []string `yaml:"levels"`
+	Endpoint  string   `yaml:"endpoint"`
+}
+
+// cloudWatchMetric is a value put to CloudWatch, with dimensions in order
+type cloudWatchMetric struct {
+	name       string
+	dimensions [][2]string
+	value      float64
+}
+
+// checkCloudWatch fails when the levels of the metrics aren't levels of the hierarchy
+func checkCloudWatch(enabled bool) error {
+	if !enabled {
+		return nil
+	}
+	var levels []string
+	for depth := 1; depth <= len(hierarchyLevels); depth++ {
+		levels = append(levels, metricsLevel(depth))
+	}
+	for _, level := range globalConfig.CloudWatch.Levels {
+		if !slices.Contains(levels, level) {
+			return fmt.Errorf("unknown cloudwatch level %s, use one of %s", level, strings.Join(levels, ", "))
+		}
+	}
+	return nil
+}
+
+// cloudWatchMetrics returns the total and the cost of each node of the selected levels, named like the Prometheus metrics
+func cloudWatchMetrics() []cloudWatchMetric {
+	graph := buildGraph()
+	levels := globalConfig.CloudWatch.Levels
+	metrics := []cloudWatchMetric{{name: "TotalCost", value: graph.Total}}
+	for _, node := range graph.Nodes {
+		level := metricsLevel(node.Depth)
+		if node.Depth == 0 || (len(levels) > 0 && !slices.Contains(levels, level)) {
+			continue
+		}
+		metrics = append(metrics, cloudWatchMetric{name: "Cost", dimensions: [][2]string{{"Level", level}, {"Node", node.Name}}, value: node.Value})
+	}
+	return metrics
+}
+
+// putCloudWatchMetrics puts the costs with the default credentials. The metrics are timestamped with the time of the
+// run, as CloudWatch rejects older periods.
+func putCloudWatchMetrics() error {
+	config := globalConfig.CloudWatch
+	namespace := config.Namespace
+	if namespace == "" {
+		namespace = defaultCloudWatchNamespace
+	}
+	cfg := loadBaseConfig()
+	cfg.Region = config.Region
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion()
+	}
+	svc := cloudwatch.NewFromConfig(cfg, func(o *cloudwatch.Options) {
+		if config.Endpoint != "" {
+			o.BaseEndpoint = aws.String(config.Endpoint)
+		}
+	})
+
+	metrics := cloudWatchMetrics()
+	infof("Putting %d metrics to CloudWatch namespace %s", len(metrics), namespace)
+	for start := 0; start < len(metrics); start += cloudWatchBatchSize {
+		input := &cloudwatch.PutMetricDataInput{Namespace: aws.String(namespace)}
+		for _, metric := range metrics[start:min(start+cloudWatchBatchSize, len(metrics))] {
+			datum := types.MetricDatum{MetricName: aws.String(metric.name), Value: aws.Float64(metric.value), Unit: types.StandardUnitNone}
+			for _, dimension := range metric.dimensions {
+				datum.Dimensions = append(datum.Dimensions, types.Dimension{Name: aws.String(dimension[0]), Value: aws.String(dimension[1])})
+			}
+			input.MetricData = append(input.MetricData, datum)
+		}
+		if _, err := svc.PutMetricData(runContext, input); err != nil {
+			return fmt.Errorf("failed to put metrics to CloudWatch: %v", err)
+		}
+	}
+	return nil
+}
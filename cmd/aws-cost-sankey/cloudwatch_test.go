@@ -0,0 +1,47 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestPutCloudWatchMetrics(t *testing.T) {
+	var form map[string][]string
+	var authorization string
+	url := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		form = r.PostForm
+		authorization = r.Header.Get("Authorization")
+	})
+
+	setupRunTest(t, Config{CloudWatch: CloudWatchConfig{Region: "eu-west-1", Levels: []string{"account"}, Endpoint: url}}, twoAccounts())
+	if err := checkCloudWatch(true); err != nil {
+		t.Fatalf("checkCloudWatch() = %v", err)
+	}
+
+	if err := putCloudWatchMetrics(); err != nil {
+		t.Fatalf("putCloudWatchMetrics() = %v", err)
+	}
+	if !strings.Contains(authorization, "/eu-west-1/monitoring/aws4_request") {
+		t.Errorf("Authorization = %q, want signed for monitoring in eu-west-1", authorization)
+	}
+	want := map[string]string{
+		"Namespace":                                     defaultCloudWatchNamespace,
+		"MetricData.member.1.MetricName":                "TotalCost",
+		"MetricData.member.1.Value":                     "120",
+		"MetricData.member.2.MetricName":                "Cost",
+		"MetricData.member.2.Dimensions.member.1.Value": "account",
+		"MetricData.member.2.Dimensions.member.2.Value": "acct1",
+		"MetricData.member.2.Value":                     "100",
+		"MetricData.member.3.Dimensions.member.2.Value": "acct2",
+	}
+	for key, value := range want {
+		if got := strings.Join(form[key], ","); got != value {
+			t.Errorf("%s = %q, want %q", key, got, value)
+		}
+	}
+	if _, ok := form["MetricData.member.4.MetricName"]; ok {
+		t.Errorf("services put, want only the accounts")
+	}
+}
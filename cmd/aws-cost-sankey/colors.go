@@ -0,0 +1,61 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+)
+
+var hexColorPattern = regexp.MustCompile(`^#[0-9a-fA-F]{6}$`)
+
+// ColorConfig assigns a fixed color to a category of nodes, e.g. all compute services.
+// Nodes are matched by exact name or by a regular expression on the name.
+type ColorConfig struct {
+	Color string   `yaml:"color"`
+	Nodes []string `yaml:"nodes"`
+	Match string   `yaml:"match"`
+}
+
+// Compiled patterns of the color categories, in the order of the config
+var colorPatterns []*regexp.Regexp
+
+// compileColors validates the color categories so that a typo fails before any cost is fetched
+func compileColors() error {
+	colorPatterns = make([]*regexp.Regexp, len(globalConfig.Colors))
+	for i, category := range globalConfig.Colors {
+		if !hexColorPattern.MatchString(category.Color) {
+			return fmt.Errorf("invalid color %q: expected #rrggbb", category.Color)
+		}
+		if category.Match == "" {
+			continue
+		}
+		pattern, err := regexp.Compile(category.Match)
+		if err != nil {
+			return fmt.Errorf("invalid color match %q: %v", category.Match, err)
+		}
+		colorPatterns[i] = pattern
+	}
+	return nil
+}
+
+// categoryColor returns the color of the first category containing the node, or an empty string if there is none
+func categoryColor(name string) string {
+	for i, category := range globalConfig.Colors {
+		for _, node := range category.Nodes {
+			if node == name {
+				return category.Color
+			}
+		}
+		if i < len(colorPatterns) && colorPatterns[i] != nil && colorPatterns[i].MatchString(name) {
+			return category.Color
+		}
+	}
+	return ""
+}
+
+// nodeColor returns the color of a node, highlighting nodes that need attention over their category
+func nodeColor(name string) string {
+	if color := highlightColor(name); color != "" {
+		return color
+	}
+	return categoryColor(name)
+}
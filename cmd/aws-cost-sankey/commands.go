@@ -0,0 +1,364 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+// runOptions are the command line options of a run, shared by the subcommands
+type runOptions struct {
+	configFile      string
+	outputFile      string
+	format          string
+	devMode         bool
+	regionMode      string
+	trackBudgets    bool
+	commitments     bool
+	detectAnomalies bool
+	forecast        bool
+	negative        string
+	granularity     string
+	resources       string
+	inputFile       string
+	compare         string
+	metricsFile     string
+	period          string
+	logLevel        string
+	logFormat       string
+	dryRun          bool
+	quiet           bool
+	record          string
+	replay          string
+	timeout         time.Duration
+	notify          string
+	publish         bool
+	cloudWatch      bool
+}
+
+var options runOptions
+
+// command is a subcommand such as "render", with the flags it accepts and the positional arguments it expects
+type command struct {
+	name    string
+	args    string
+	summary string
+	flags   func(fs *flag.FlagSet)
+	run     func(args []string)
+}
+
+// subcommands returns the subcommands in the order they are listed in the usage
+func subcommands() []command {
+	return []command{
+		{
+			name:    "fetch",
+			summary: "Fetch the costs, caching the responses, and write them as a JSON graph to render later",
+			flags: func(fs *flag.FlagSet) {
+				configFlags(fs)
+				fetchFlags(fs)
+				fs.StringVar(&options.outputFile, "o", "output", "(Optional) Name of output file, \".json\" is appended. Takes placeholders like -o, or \"-\" to write to stdout")
+				fs.StringVar(&options.metricsFile, "metrics-file", "", "(Optional) Also write the costs as Prometheus metrics to this file, e.g. for the node exporter textfile collector")
+				cloudWatchFlag(fs)
+			},
+			run: func(args []string) {
+				options.format = "json"
+				run()
+			},
+		},
+		{
+			name:    "render",
+			summary: "Render the costs of a text, CSV or JSON graph file, e.g. written by fetch",
+			flags: func(fs *flag.FlagSet) {
+				configFlags(fs)
+				inputFlag(fs)
+				outputFlags(fs, "chart")
+			},
+			run: func(args []string) {
+				if options.inputFile == "" {
+					log.Fatalf("render needs an input file, e.g. -i output.json")
+				}
+				run()
+			},
+		},
+		{
+			name:    "analyze",
+			summary: "Write a text or PDF report with OpenAI analysis of the costs",
+			flags: func(fs *flag.FlagSet) {
+				configFlags(fs)
+				fetchFlags(fs)
+				inputFlag(fs)
+				fs.StringVar(&options.outputFile, "o", "output", "(Optional) Name of output file. Suffix will be determined by output format. Takes placeholders like -o of render")
+				fs.StringVar(&options.format, "f", "text", "(Optional) Output format: \"text\", \"pdf\" or both as \"text,pdf\"")
+				notifyFlag(fs)
+			},
+			run: func(args []string) {
+				formats := outputFormatList(options.format)
+				for i, format := range formats {
+					if format != "text" && format != "pdf" {
+						log.Fatalf("analyze writes \"text\" or \"pdf\" reports, not %s", format)
+					}
+					formats[i] = format + "+ai"
+				}
+				options.format = strings.Join(formats, ",")
+				run()
+			},
+		},
+		{
+			name:    "diff",
+			args:    "<previous|file>",
+			summary: "Compare the costs with the preceding period or an earlier output, coloring links by growth",
+			flags: func(fs *flag.FlagSet) {
+				configFlags(fs)
+				fetchFlags(fs)
+				inputFlag(fs)
+				outputFlags(fs, "chart")
+			},
+			run: func(args []string) {
+				if len(args) != 1 {
+					log.Fatalf("diff needs what to compare with: %q or an earlier output file", comparePrevious)
+				}
+				options.compare = args[0]
+				run()
+			},
+		},
+		{
+			name:    "serve",
+			summary: "Serve the chart at /chart and the JSON graph at /data.json, fetching the costs on each request, and refresh the outputs on a schedule",
+			flags: func(fs *flag.FlagSet) {
+				configFlags(fs)
+				fetchFlags(fs)
+				inputFlag(fs)
+				fs.StringVar(&serveAddr, "addr", ":8080", "(Optional) Address to listen on, e.g. \"127.0.0.1:8080\"")
+				fs.BoolVar(&offlineMode, "offline", false, "(Optional) Inline the echarts library into the chart so it renders without internet access")
+			},
+			run: func(args []string) {
+				serve()
+			},
+		},
+		{
+			name:    "lambda",
+			summary: "Run as an AWS Lambda function, refreshing the outputs like the schedule of serve on each invocation, e.g. by EventBridge",
+			flags: func(fs *flag.FlagSet) {
+				configFlags(fs)
+				fetchFlags(fs)
+				fs.BoolVar(&offlineMode, "offline", false, "(Optional) Inline the echarts library into the chart so it renders without internet access")
+			},
+			run: func(args []string) {
+				runLambda()
+			},
+		},
+		{
+			name:    "config",
+			args:    "<validate|init>",
+			summary: "Validate the config file, listing all problems, or write a starter config answering a few questions",
+			flags: func(fs *flag.FlagSet) {
+				configFlags(fs)
+				inputFlag(fs)
+				outputFlags(fs, "chart")
+			},
+			run: func(args []string) {
+				if len(args) != 1 {
+					log.Fatalf("config needs a command: validate or init")
+				}
+				switch args[0] {
+				case "validate":
+					if err := readConfig(options.configFile); err != nil {
+						log.Fatalf("%v", err)
+					}
+					if err := resolvePeriod(); err != nil {
+						log.Fatalf("%v", err)
+					}
+					if options.negative != "" {
+						globalConfig.NegativeCosts = options.negative
+					}
+					validateConfig()
+				case "init":
+					initConfig()
+				default:
+					log.Fatalf("unknown config command %q, use validate or init", args[0])
+				}
+			},
+		},
+		{
+			name:    "completion",
+			args:    "<bash|zsh>",
+			summary: "Print the shell completion script, e.g. source <(aws-cost-sankey completion bash)",
+			flags:   func(fs *flag.FlagSet) {},
+			run: func(args []string) {
+				if len(args) != 1 {
+					log.Fatalf("completion needs the shell: bash or zsh")
+				}
+				printCompletion(args[0])
+			},
+		},
+	}
+}
+
+// configFlags are the flags of all subcommands, selecting the config and how the costs are grouped
+func configFlags(fs *flag.FlagSet) {
+	fs.StringVar(&options.configFile, "c", "configs/configs.yaml", "(Optional) Path to the config file")
+	fs.StringVar(&options.period, "period", "", "(Optional) Relative period replacing the dates of the config file: \"last-month\", \"mtd\", \"last-<n>d\" e.g. \"last-30d\", \"last-quarter\" or a month \"YYYY-MM\"")
+	overrideFlags(fs)
+	fs.StringVar(&options.granularity, "g", "", "(Optional) Granularity of the cost data: \"MONTHLY\", \"DAILY\" or \"HOURLY\". Overrides the config file")
+	fs.BoolVar(&options.devMode, "d", false, "(Optional) Show UsageType instead of Service")
+	fs.StringVar(&options.regionMode, "r", "", "(Optional) Group by region: \"level\" adds Region above Service, \"replace\" shows Region instead of Service")
+	fs.StringVar(&options.negative, "negative", "", "(Optional) Render negative costs such as credits: \"branch\" moves them to a separate Credits branch, \"net\" nets them with their siblings. Overrides the config file")
+	fs.BoolVar(&refreshCache, "no-cache", false, "(Optional) Ignore cached Cost Explorer responses and fetch fresh data")
+	fs.StringVar(&options.logLevel, "log-level", "info", "(Optional) Least severe log messages to write: \"debug\", \"info\", \"warn\" or \"error\"")
+	fs.BoolVar(&options.quiet, "quiet", false, "(Optional) Leave out the progress and info messages, e.g. in CI. Warnings and errors are still written")
+	fs.StringVar(&options.logFormat, "log-format", LogFormatText, "(Optional) Format of the log messages on stderr: \"text\" or \"json\" with one object per line")
+	fs.DurationVar(&options.timeout, "timeout", 0, "(Optional) Stop the run after this long, e.g. \"10m\", canceling the requests in flight without writing outputs. No limit by default")
+}
+
+// fetchFlags add optional data fetched from AWS along with the costs
+func fetchFlags(fs *flag.FlagSet) {
+	fs.BoolVar(&options.trackBudgets, "budgets", false, "(Optional) Compare costs against AWS Budgets and highlight nodes over budget")
+	fs.BoolVar(&options.commitments, "commitments", false, "(Optional) Break services down into Savings Plans, Reserved Instances and On-demand spend")
+	fs.BoolVar(&options.detectAnomalies, "anomalies", false, "(Optional) List anomalies from Cost Anomaly Detection and highlight affected services")
+	fs.BoolVar(&options.forecast, "forecast", false, fmt.Sprintf("(Optional) Add the projected cost of the next %d days to the diagram", forecastDays))
+	fs.StringVar(&options.record, "record", "", "(Optional) Also write the raw Cost Explorer responses to this directory, e.g. to replay them or attach them to a bug report")
+	fs.StringVar(&options.replay, "replay", "", "(Optional) Read the Cost Explorer responses from a directory written by -record instead of calling AWS")
+	fs.BoolVar(&options.dryRun, "dry-run", false, "(Optional) Print the Cost Explorer requests that would be made and their estimated charge without calling AWS")
+	fs.StringVar(&options.resources, "resources", "", fmt.Sprintf("(Optional) Break the given service down to individual resources, e.g. \"Amazon Simple Storage Service\".\nLimited to the last %d days", resourceLookbackDays))
+}
+
+func inputFlag(fs *flag.FlagSet) {
+	fs.StringVar(&options.inputFile, "i", "", "(Optional) Input text, CSV or JSON graph file from which the cost data will be read, or \"-\" to read it from stdin.\nIf not provided, data will be fetched from AWS Cost Explorer API")
+}
+
+func outputFlags(fs *flag.FlagSet, format string) {
+	fs.StringVar(&options.outputFile, "o", "output", "(Optional) Name of output file. Suffix will be determined by output format. Use \"-\" to write text, JSON or Mermaid to stdout.\nPlaceholders {start}, {end}, {month}, {date} (of the run) and {account} (the only account, or \"all\") are filled in, e.g. \"reports/{account}-{month}\"")
+	fs.StringVar(&options.format, "f", format, "(Optional) Output format, or several separated by commas, e.g. \"chart,text,json\": \"text\", \"chart\", \"json\", \"csv\", \"xlsx\", \"svg\", \"png\", \"pdf\", \"markdown\", \"mermaid\", \"tui\" (interactive terminal view), \"text+ai\" (plaintext with OpenAI analysis) or \"pdf+ai\" (PDF report with OpenAI analysis)")
+	fs.StringVar(&options.metricsFile, "metrics-file", "", "(Optional) Also write the costs as Prometheus metrics to this file, e.g. for the node exporter textfile collector")
+	cloudWatchFlag(fs)
+	fs.BoolVar(&offlineMode, "offline", false, "(Optional) Inline the echarts library into the chart output so it renders without internet access")
+	fs.BoolVar(&options.publish, "publish", false, "(Optional) Upload the written files to the S3 bucket of publish in the config file, under dated keys")
+	notifyFlag(fs)
+}
+
+func cloudWatchFlag(fs *flag.FlagSet) {
+	fs.BoolVar(&options.cloudWatch, "cloudwatch", false, "(Optional) Also put the total and the cost of each node as CloudWatch custom metrics, e.g. for alarms. Configured in the config file")
+}
+
+func notifyFlag(fs *flag.FlagSet) {
+	fs.StringVar(&options.notify, "notify", "", "(Optional) Send a summary of the run once the outputs are written: \"slack\", \"email\", \"msteams\", \"webhook\" or several separated by commas. Configured in the config file")
+}
+
+// allFlags are the flags accepted without a subcommand, which fetches or reads the costs and renders them in one run
+func allFlags(fs *flag.FlagSet) {
+	configFlags(fs)
+	fetchFlags(fs)
+	inputFlag(fs)
+	outputFlags(fs, "chart")
+	fs.StringVar(&options.compare, "compare", "", "(Optional) Compare with \"previous\", the preceding period of the same length, or with an earlier output read like -i.\nLinks of the chart are colored by growth and the reports list the largest changes")
+}
+
+// runCommand runs the subcommand named by the first argument. Without a subcommand, the flags of all subcommands
+// are accepted as before subcommands were added.
+func runCommand(args []string) {
+	commands := subcommands()
+	program := filepath.Base(os.Args[0])
+	if len(args) > 0 && (args[0] == "help" || args[0] == "-h" || args[0] == "--help") {
+		if len(args) > 1 {
+			args = []string{args[1], "-h"}
+		} else {
+			args = []string{"-h"}
+		}
+	}
+
+	if len(args) == 0 || strings.HasPrefix(args[0], "-") {
+		fs := flag.NewFlagSet(program, flag.ExitOnError)
+		allFlags(fs)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: %s [command] [flags]\n\nCommands:\n", program)
+			for _, cmd := range commands {
+				fmt.Fprintf(fs.Output(), "  %-12s %s\n", cmd.name, cmd.summary)
+			}
+			fmt.Fprintf(fs.Output(), "\nRun \"%s help <command>\" for the flags of a command. Without a command, costs are fetched or read and rendered in one run:\n", program)
+			fs.PrintDefaults()
+		}
+		fs.Parse(args)
+		setupLogging()
+		run()
+		return
+	}
+
+	for _, cmd := range commands {
+		if cmd.name != args[0] {
+			continue
+		}
+		fs := flag.NewFlagSet(fmt.Sprintf("%s %s", program, cmd.name), flag.ExitOnError)
+		cmd.flags(fs)
+		fs.Usage = func() {
+			fmt.Fprintf(fs.Output(), "Usage: %s [flags] %s\n\n%s\n\n", fs.Name(), cmd.args, cmd.summary)
+			fs.PrintDefaults()
+		}
+		// Flags may follow the arguments, e.g. "config validate -c configs.yaml"
+		var positional []string
+		for rest := args[1:]; ; rest = fs.Args()[1:] {
+			fs.Parse(rest)
+			if fs.NArg() == 0 {
+				break
+			}
+			positional = append(positional, fs.Arg(0))
+		}
+		setupLogging()
+		cmd.run(positional)
+		return
+	}
+	log.Fatalf("unknown command: %s, run \"%s help\" for the list of commands", args[0], program)
+}
+
+// printCompletion prints a completion script of the commands and their flags for bash, or for zsh through bashcompinit
+func printCompletion(shell string) {
+	program := filepath.Base(os.Args[0])
+	function := "_" + strings.NewReplacer("-", "_", ".", "_").Replace(program)
+
+	var sb strings.Builder
+	switch shell {
+	case "bash":
+	case "zsh":
+		sb.WriteString("autoload -U +X bashcompinit && bashcompinit\n")
+	default:
+		log.Fatalf("unknown shell: %s", shell)
+	}
+
+	commands := subcommands()
+	names := make([]string, 0, len(commands))
+	for _, cmd := range commands {
+		names = append(names, cmd.name)
+	}
+	fmt.Fprintf(&sb, "%s() {\n", function)
+	sb.WriteString("\tlocal cur=${COMP_WORDS[COMP_CWORD]} prev=${COMP_WORDS[COMP_CWORD-1]}\n")
+	sb.WriteString("\tcase \"$prev\" in\n")
+	sb.WriteString("\t-c|-i|-o|-metrics-file) COMPREPLY=($(compgen -f -- \"$cur\")); return ;;\n")
+	sb.WriteString("\t-record|-replay) COMPREPLY=($(compgen -d -- \"$cur\")); return ;;\n")
+	sb.WriteString("\tesac\n")
+	sb.WriteString("\tcase \"${COMP_WORDS[1]}\" in\n")
+	for _, cmd := range commands {
+		fs := flag.NewFlagSet(cmd.name, flag.ContinueOnError)
+		cmd.flags(fs)
+		fmt.Fprintf(&sb, "\t%s) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", cmd.name, strings.Join(flagNames(fs), " "))
+	}
+	fs := flag.NewFlagSet(program, flag.ContinueOnError)
+	allFlags(fs)
+	fmt.Fprintf(&sb, "\t*) COMPREPLY=($(compgen -W %q -- \"$cur\")) ;;\n", strings.Join(append(names, flagNames(fs)...), " "))
+	sb.WriteString("\tesac\n}\n")
+	fmt.Fprintf(&sb, "complete -F %s %s\n", function, program)
+	fmt.Print(sb.String())
+}
+
+// flagNames returns the flags of a flag set with their dash, sorted by name
+func flagNames(fs *flag.FlagSet) []string {
+	var names []string
+	fs.VisitAll(func(f *flag.Flag) {
+		names = append(names, "-"+f.Name)
+	})
+	sort.Strings(names)
+	return names
+}
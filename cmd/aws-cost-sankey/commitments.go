@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+// Services that can be covered by Reserved Instances
+var reservableServices = []string{
+	"Amazon Elastic Compute Cloud - Compute",
+	"Amazon Relational Database Service",
+	"Amazon ElastiCache",
+	"Amazon Redshift",
+	"Amazon OpenSearch Service",
+}
+
+// Savings Plans utilization per account, written as comments of the text report
+var commitmentReport []string
+
+// fetchCommitments breaks each eligible service down into Savings Plans covered, Reserved Instances covered
+// and On-demand spend, rendered as "<service> SP-covered", "<service> RI-covered" and "<service> On-demand"
+func fetchCommitments(accountName string, linkedAccountID string, svc costExplorerAPI) error {
+	infof("Fetching commitment coverage for %s", accountName)
+
+	timePeriod := &types.DateInterval{
+		Start: aws.String(globalConfig.StartDate),
+		End:   aws.String(globalConfig.EndDate),
+	}
+	filters := linkedAccountFilters(linkedAccountID)
+	onDemand := make(map[string]float64)
+	var amounts commitmentAmounts
+
+	// Savings Plans coverage is reported in spend per service
+	spInput := &costexplorer.GetSavingsPlansCoverageInput{
+		TimePeriod:  timePeriod,
+		Granularity: types.GranularityMonthly,
+		GroupBy:     []types.GroupDefinition{{Type: types.GroupDefinitionTypeDimension, Key: aws.String(string(types.DimensionService))}},
+		Filter:      combineFilters(filters),
+	}
+	for {
+		result, err := svc.GetSavingsPlansCoverage(runContext, spInput)
+		if err != nil {
+			return fmt.Errorf("failed to get savings plans coverage: %w", err)
+		}
+		for _, coverage := range result.SavingsPlansCoverages {
+			service := coverage.Attributes[string(types.DimensionService)]
+			if service == "" || coverage.Coverage == nil {
+				continue
+			}
+			addResult(service, fmt.Sprintf("%s SP-covered", service), roundCost(amounts.parse(coverage.Coverage.SpendCoveredBySavingsPlans)))
+			onDemand[service] += amounts.parse(coverage.Coverage.OnDemandCost)
+		}
+		if amounts.err != nil {
+			return amounts.err
+		}
+		if result.NextToken == nil || *result.NextToken == "" {
+			break
+		}
+		spInput.NextToken = result.NextToken
+	}
+
+	// Reserved Instance coverage is reported in hours, so the covered spend is estimated at On-demand rates
+	for _, service := range reservableServices {
+		serviceFilter := types.Expression{Dimensions: &types.DimensionValues{Key: types.DimensionService, Values: []string{service}}}
+		result, err := svc.GetReservationCoverage(runContext, &costexplorer.GetReservationCoverageInput{
+			TimePeriod: timePeriod,
+			Filter:     combineFilters(append(append([]types.Expression{}, filters...), serviceFilter)),
+		})
+		if err != nil {
+			return fmt.Errorf("failed to get reservation coverage for %s: %w", service, err)
+		}
+		if result.Total == nil || result.Total.CoverageCost == nil || result.Total.CoverageHours == nil {
+			continue
+		}
+
+		riOnDemandCost := amounts.parse(result.Total.CoverageCost.OnDemandCost)
+		reservedHours := amounts.parse(result.Total.CoverageHours.ReservedHours)
+		onDemandHours := amounts.parse(result.Total.CoverageHours.OnDemandHours)
+		if amounts.err != nil {
+			return amounts.err
+		}
+		if reservedHours > 0 && onDemandHours > 0 {
+			addResult(service, fmt.Sprintf("%s RI-covered", service), roundCost(riOnDemandCost*reservedHours/onDemandHours))
+		}
+
+		// Services without Savings Plans coverage only have their On-demand spend reported here
+		if _, ok := onDemand[service]; !ok {
+			onDemand[service] = riOnDemandCost
+		}
+	}
+
+	for service, cost := range onDemand {
+		addResult(service, fmt.Sprintf("%s On-demand", service), roundCost(cost))
+	}
+
+	// Accounts without Savings Plans have no utilization data
+	utilization, err := svc.GetSavingsPlansUtilization(runContext, &costexplorer.GetSavingsPlansUtilizationInput{
+		TimePeriod: timePeriod,
+		Filter:     combineFilters(filters),
+	})
+	var dataUnavailable *types.DataUnavailableException
+	if errors.As(err, &dataUnavailable) {
+		warnf("No savings plans utilization data for %s", accountName)
+		return nil
+	}
+	if err != nil {
+		return fmt.Errorf("failed to get savings plans utilization: %w", err)
+	}
+	if utilization.Total != nil && utilization.Total.Utilization != nil {
+		u := utilization.Total.Utilization
+		line := fmt.Sprintf("Savings Plans %s commitment %s used %s unused %s utilization %s%%",
+			accountName, formatCost(amounts.parse(u.TotalCommitment), 2), formatCost(amounts.parse(u.UsedCommitment), 2),
+			formatCost(amounts.parse(u.UnusedCommitment), 2), aws.ToString(u.UtilizationPercentage))
+		if amounts.err != nil {
+			return amounts.err
+		}
+		resultsMu.Lock()
+		defer resultsMu.Unlock()
+		commitmentReport = append(commitmentReport, line)
+	}
+	return nil
+}
+
+// commitmentAmounts parses the amounts of coverage and utilization responses, keeping the first that failed to parse
+type commitmentAmounts struct {
+	err error
+}
+
+func (a *commitmentAmounts) parse(amount *string) float64 {
+	if amount == nil || *amount == "" {
+		return 0
+	}
+	value, err := strconv.ParseFloat(*amount, 64)
+	if err != nil && a.err == nil {
+		a.err = fmt.Errorf("failed to parse amount: %w", err)
+	}
+	return value
+}
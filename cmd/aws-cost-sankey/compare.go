@@ -0,0 +1,218 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Compares with the preceding period of the same length instead of an input file
+const comparePrevious = "previous"
+
+// Colors of links that grew or shrank since the compared period
+const (
+	increaseColor = "#e15759"
+	decreaseColor = "#59a14f"
+)
+
+// Costs of the compared period and its description, e.g. "2024-09-01-2024-10-01". Only populated with -compare
+var (
+	previousResults costgraph.Flows
+	previousPeriod  string
+)
+
+// loadComparison loads the costs to compare with, either by loading the preceding period or by reading a file,
+// and resets the aggregated data so that the current period can be loaded
+func loadComparison(compare string, load func() error) error {
+	start, end := globalConfig.StartDate, globalConfig.EndDate
+	if compare == comparePrevious {
+		globalConfig.StartDate, globalConfig.EndDate = precedingPeriod(start, end)
+		infof("Loading %s to %s to compare with", globalConfig.StartDate, globalConfig.EndDate)
+		if err := load(); err != nil {
+			return err
+		}
+	} else {
+		if err := readInput(compare); err != nil {
+			return err
+		}
+		applyAliases()
+		applyTeams()
+		applyAllocations()
+		if err := applyFilters(); err != nil {
+			return err
+		}
+		applyNegativeCosts()
+	}
+	previousPeriod = fmt.Sprintf("%s-%s", globalConfig.StartDate, globalConfig.EndDate)
+	if compare != comparePrevious {
+		previousPeriod = compare
+	}
+	globalConfig.StartDate, globalConfig.EndDate = start, end
+
+	previousResults = results
+	resetResults()
+	return nil
+}
+
+// precedingPeriod returns the period of the same length right before the given one.
+// Whole months are shifted by months, e.g. October to September, other periods by days.
+func precedingPeriod(start string, end string) (string, string) {
+	startDate, err := time.Parse(time.DateOnly, start)
+	if err != nil {
+		log.Fatalf("failed to parse start date %s: %v", start, err)
+	}
+	endDate, err := time.Parse(time.DateOnly, end)
+	if err != nil {
+		log.Fatalf("failed to parse end date %s: %v", end, err)
+	}
+
+	if startDate.Day() == 1 && endDate.Day() == 1 {
+		months := (endDate.Year()-startDate.Year())*12 + int(endDate.Month()-startDate.Month())
+		return startDate.AddDate(0, -months, 0).Format(time.DateOnly), start
+	}
+	return startDate.Add(-endDate.Sub(startDate)).Format(time.DateOnly), start
+}
+
+// resetResults clears the costs and the data collected along with them
+func resetResults() {
+	results = make(costgraph.Flows)
+	bucketResults = make(map[string]map[string]map[string]float64)
+	accountResults = make(map[string]map[string]map[string]float64)
+	recordTypeTotals = make(map[string]float64)
+	sourceCurrencies = make(map[string]float64)
+	anomalies = nil
+	anomalousNodes = make(map[string]bool)
+	nodeBudgets = make(map[string]budgetStatus)
+	commitmentReport = nil
+	allocationReport = nil
+	negativeCosts = make(map[string]float64)
+}
+
+// comparisonMovers returns the nodes with the largest increase and the largest decrease since the compared period
+func comparisonMovers() ([]mover, []mover) {
+	previous := incomingCosts(previousResults)
+	current := incomingCosts(results)
+
+	var increases, decreases []mover
+	for name := range mergeKeys(previous, current) {
+		m := mover{name, previous[name], current[name]}
+		if m.last > m.first {
+			increases = append(increases, m)
+		} else if m.last < m.first {
+			decreases = append(decreases, m)
+		}
+	}
+	sortMovers(increases)
+	sortMovers(decreases)
+	if len(increases) > reportTopN {
+		increases = increases[:reportTopN]
+	}
+	if len(decreases) > reportTopN {
+		decreases = decreases[:reportTopN]
+	}
+	return increases, decreases
+}
+
+func incomingCosts(data map[string]map[string]float64) map[string]float64 {
+	totals := make(map[string]float64)
+	for _, children := range data {
+		for child, cost := range children {
+			totals[child] += cost
+		}
+	}
+	return totals
+}
+
+func mergeKeys(a map[string]float64, b map[string]float64) map[string]bool {
+	keys := make(map[string]bool)
+	for key := range a {
+		keys[key] = true
+	}
+	for key := range b {
+		keys[key] = true
+	}
+	return keys
+}
+
+// sortMovers orders movers by the size of their change, largest first
+func sortMovers(movers []mover) {
+	sort.Slice(movers, func(i, j int) bool {
+		di, dj := math.Abs(movers[i].last-movers[i].first), math.Abs(movers[j].last-movers[j].first)
+		if di != dj {
+			return di > dj
+		}
+		return movers[i].name < movers[j].name
+	})
+}
+
+// compareReport lists the largest increases and decreases for the text report
+func compareReport() []string {
+	if previousResults == nil {
+		return nil
+	}
+	increases, decreases := comparisonMovers()
+	lines := []string{fmt.Sprintf("Compared with %s", previousPeriod)}
+	for _, m := range increases {
+		lines = append(lines, fmt.Sprintf("Increase %s: %s to %s (+%s)", m.name, formatCost(m.first, 2), formatCost(m.last, 2), formatCost(m.last-m.first, 2)))
+	}
+	for _, m := range decreases {
+		lines = append(lines, fmt.Sprintf("Decrease %s: %s to %s (%s)", m.name, formatCost(m.first, 2), formatCost(m.last, 2), formatCost(m.last-m.first, 2)))
+	}
+	return lines
+}
+
+// graphComparison lists the largest changes of the JSON graph since the compared period
+func graphComparison() *costgraph.Comparison {
+	if previousResults == nil {
+		return nil
+	}
+	changes := func(movers []mover) []costgraph.Change {
+		result := make([]costgraph.Change, 0, len(movers))
+		for _, m := range movers {
+			result = append(result, costgraph.Change{Name: m.name, Previous: m.first, Current: m.last, Delta: m.last - m.first})
+		}
+		return result
+	}
+	increases, decreases := comparisonMovers()
+	return &costgraph.Comparison{Period: previousPeriod, Increases: changes(increases), Decreases: changes(decreases)}
+}
+
+// deltaLink is a sankey link colored by its change since the compared period
+type deltaLink struct {
+	opts.SankeyLink
+	LineStyle *opts.LineStyle `json:"lineStyle,omitempty"`
+}
+
+// deltaLinks colors the links of the overview that grew or shrank since the compared period.
+// go-echarts links have no style, so the links of the series are replaced.
+func deltaLinks(links []opts.SankeyLink) charts.SeriesOpts {
+	// Other nodes only exist among the visible links of the compared period
+	previousLinks := withTotalRoot(previousResults)
+	previousVisible := withTotalRoot(visibleLinks(previousResults))
+
+	colored := make([]deltaLink, 0, len(links))
+	for _, link := range links {
+		colored = append(colored, deltaLink{SankeyLink: link})
+		source, target := link.Source.(string), link.Target.(string)
+		previous, ok := previousLinks[source][target]
+		if !ok {
+			previous = previousVisible[source][target]
+		}
+		current := float64(link.Value)
+		if math.Round(current) > math.Round(previous) {
+			colored[len(colored)-1].LineStyle = &opts.LineStyle{Color: increaseColor, Opacity: staticLinkOpacity}
+		} else if math.Round(current) < math.Round(previous) {
+			colored[len(colored)-1].LineStyle = &opts.LineStyle{Color: decreaseColor, Opacity: staticLinkOpacity}
+		}
+	}
+	return charts.WithSeriesOpts(func(s *charts.SingleSeries) {
+		s.Links = colored
+	})
+}
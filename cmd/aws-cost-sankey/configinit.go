@@ -0,0 +1,228 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"slices"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// awsProfile is a profile or an SSO session of the shared AWS config file
+type awsProfile struct {
+	name       string
+	session    bool
+	ssoURL     string
+	ssoRegion  string
+	ssoSession string
+}
+
+// wizard asks questions on the terminal, offering a default answer
+type wizard struct {
+	in  *bufio.Reader
+	out io.Writer
+}
+
+// ask returns the answer to a question, or the default if the answer is empty
+func (w *wizard) ask(question string, defaultAnswer string) string {
+	if defaultAnswer != "" {
+		fmt.Fprintf(w.out, "%s [%s]: ", question, defaultAnswer)
+	} else {
+		fmt.Fprintf(w.out, "%s: ", question)
+	}
+	answer, err := w.in.ReadString('\n')
+	if err != nil && answer == "" {
+		if err == io.EOF {
+			return defaultAnswer
+		}
+		log.Fatalf("failed to read answer: %v", err)
+	}
+	if answer = strings.TrimSpace(answer); answer == "" {
+		return defaultAnswer
+	}
+	return answer
+}
+
+// choose returns the index of the chosen answer, asking again until a listed answer is chosen
+func (w *wizard) choose(question string, choices []string) int {
+	fmt.Fprintln(w.out, question)
+	for i, choice := range choices {
+		fmt.Fprintf(w.out, "  %d) %s\n", i+1, choice)
+	}
+	for {
+		answer := w.ask("Choice", "1")
+		if i, err := strconv.Atoi(answer); err == nil && i >= 1 && i <= len(choices) {
+			return i - 1
+		}
+		fmt.Fprintf(w.out, "Choose a number from 1 to %d\n", len(choices))
+	}
+}
+
+// askDate returns a date YYYY-MM-DD, asking again until the answer is a date
+func (w *wizard) askDate(question string, defaultAnswer string) string {
+	for {
+		answer := w.ask(question, defaultAnswer)
+		if _, err := time.Parse(time.DateOnly, answer); err == nil {
+			return answer
+		}
+		fmt.Fprintln(w.out, "Enter a date YYYY-MM-DD")
+	}
+}
+
+// initConfig guides through the credentials, hierarchy, period and output options and writes a starter config
+func initConfig() {
+	w := &wizard{in: bufio.NewReader(os.Stdin), out: os.Stdout}
+	file := options.configFile
+	if _, err := os.Stat(file); err == nil {
+		if answer := w.ask(fmt.Sprintf("%s exists, overwrite it? (y/N)", file), "N"); !strings.EqualFold(answer, "y") {
+			log.Fatalf("%s left as it is", file)
+		}
+	}
+
+	// Credentials, from a detected profile or SSO session if any
+	profiles := awsProfiles()
+	choices := []string{"Default credential chain, e.g. environment variables or an instance role"}
+	for _, profile := range profiles {
+		switch {
+		case profile.session:
+			choices = append(choices, fmt.Sprintf("SSO session %s (%s)", profile.name, profile.ssoURL))
+		case profile.ssoURL != "" || profile.ssoSession != "":
+			choices = append(choices, fmt.Sprintf("Profile %s (SSO)", profile.name))
+		default:
+			choices = append(choices, fmt.Sprintf("Profile %s", profile.name))
+		}
+	}
+	choices = append(choices, "Access key and secret")
+	var account strings.Builder
+	accountName := w.ask("Name of the account in the diagram", "main")
+	fmt.Fprintf(&account, "  - name: %q\n", accountName)
+	switch choice := w.choose("Credentials to read the costs with:", choices); {
+	case choice == 0:
+	case choice == len(choices)-1:
+		fmt.Fprintf(&account, "    keyFrom: %q\n", "env:AWS_ACCESS_KEY_ID")
+		fmt.Fprintf(&account, "    secretFrom: %q\n", "env:AWS_SECRET_ACCESS_KEY")
+		fmt.Fprintln(w.out, "The keys are read from AWS_ACCESS_KEY_ID and AWS_SECRET_ACCESS_KEY, see keyFrom and secretFrom to read them from elsewhere")
+	case profiles[choice-1].session:
+		profile := profiles[choice-1]
+		fmt.Fprintf(&account, "    ssoStartUrl: %q\n", profile.ssoURL)
+		fmt.Fprintf(&account, "    ssoRegion: %q\n", profile.ssoRegion)
+		fmt.Fprintf(&account, "    ssoAccountId: %q\n", w.ask("Account ID to sign in to", ""))
+		fmt.Fprintf(&account, "    ssoRoleName: %q\n", w.ask("Role name to sign in with", "ReadOnlyAccess"))
+		fmt.Fprintf(&account, "    ssoSession: %q\n", profile.name)
+	default:
+		fmt.Fprintf(&account, "    profile: %q\n", profiles[choice-1].name)
+	}
+
+	// Hierarchy
+	hierarchy := []string{LevelAccount}
+	if tag := w.ask("Tag key of environments or teams, empty to skip", "environment"); tag != "" {
+		hierarchy = append(hierarchy, fmt.Sprintf("%s:%s", LevelTag, tag))
+	}
+	hierarchy = append(hierarchy, fmt.Sprintf("%s:SERVICE", LevelDimension))
+
+	// Period, relative so that scheduled runs don't need the dates rewritten
+	var dates strings.Builder
+	periods := []string{"last-month", "mtd", "last-30d", "last-quarter"}
+	switch choice := w.choose("Period of the costs:", append(slices.Clone(periods), "Fixed dates")); {
+	case choice < len(periods):
+		fmt.Fprintf(&dates, "period: %q\n", periods[choice])
+	default:
+		start, end, _ := periodDates("last-month", time.Now().UTC())
+		fmt.Fprintf(&dates, "startDate: %q\n", w.askDate("Start date", start.Format(time.DateOnly)))
+		fmt.Fprintf(&dates, "endDate: %q\n", w.askDate("End date, exclusive", end.Format(time.DateOnly)))
+	}
+
+	// Output
+	threshold := w.ask("Hide links below this cost", "10")
+	for _, err := strconv.ParseFloat(threshold, 64); err != nil; _, err = strconv.ParseFloat(threshold, 64) {
+		threshold = w.ask("Enter a number", "10")
+	}
+	chartTypes := []string{ChartTypeSankey, ChartTypeTreemap, ChartTypeSunburst}
+	chartType := chartTypes[w.choose("Chart type:", chartTypes)]
+	title := w.ask("Title of charts and reports", "AWS Cost Analysis")
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# Written by \"config init\" on %s, see configs/configs.example.yaml for all options\n\n", time.Now().Format(time.DateOnly))
+	sb.WriteString("accounts:\n")
+	sb.WriteString(account.String())
+	sb.WriteString("\nhierarchy:\n")
+	for _, level := range hierarchy {
+		fmt.Fprintf(&sb, "  - %q\n", level)
+	}
+	sb.WriteString("\n")
+	sb.WriteString(dates.String())
+	sb.WriteString("granularity: \"MONTHLY\"\n")
+	fmt.Fprintf(&sb, "threshold: %s\n", threshold)
+	fmt.Fprintf(&sb, "chartType: %q\n", chartType)
+	fmt.Fprintf(&sb, "title: %q\n", title)
+	sb.WriteString("height: \"1300px\"\n")
+	sb.WriteString("width: \"1500px\"\n")
+
+	if dir := filepath.Dir(file); dir != "" {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatalf("failed to create config directory: %v", err)
+		}
+	}
+	if err := os.WriteFile(file, []byte(sb.String()), 0o644); err != nil {
+		log.Fatalf("failed to write config: %v", err)
+	}
+	fmt.Fprintf(w.out, "Wrote %s, check it with \"config validate -c %s\"\n", file, file)
+}
+
+// awsProfiles returns the profiles and SSO sessions of the shared AWS config file, e.g. ~/.aws/config
+func awsProfiles() []awsProfile {
+	file := os.Getenv("AWS_CONFIG_FILE")
+	if file == "" {
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return nil
+		}
+		file = filepath.Join(home, ".aws", "config")
+	}
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return nil
+	}
+
+	var profiles []awsProfile
+	var current *awsProfile
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.HasPrefix(line, ";") {
+			continue
+		}
+		if strings.HasPrefix(line, "[") && strings.HasSuffix(line, "]") {
+			section := strings.TrimSpace(strings.Trim(line, "[]"))
+			current = nil
+			if name, ok := strings.CutPrefix(section, "profile "); ok {
+				profiles = append(profiles, awsProfile{name: strings.TrimSpace(name)})
+			} else if name, ok := strings.CutPrefix(section, "sso-session "); ok {
+				profiles = append(profiles, awsProfile{name: strings.TrimSpace(name), session: true})
+			} else if section == "default" {
+				profiles = append(profiles, awsProfile{name: section})
+			} else {
+				continue
+			}
+			current = &profiles[len(profiles)-1]
+			continue
+		}
+		key, value, ok := strings.Cut(line, "=")
+		if !ok || current == nil {
+			continue
+		}
+		switch strings.TrimSpace(key) {
+		case "sso_start_url":
+			current.ssoURL = strings.TrimSpace(value)
+		case "sso_region":
+			current.ssoRegion = strings.TrimSpace(value)
+		case "sso_session":
+			current.ssoSession = strings.TrimSpace(value)
+		}
+	}
+	return profiles
+}
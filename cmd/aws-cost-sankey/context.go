@@ -0,0 +1,97 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// Exit code of interrupted runs, as shells report for SIGINT
+const exitInterrupted = 130
+
+var errInterrupted = errors.New("interrupted")
+
+// runContext is canceled when the run is interrupted or exceeds -timeout, canceling the requests in flight
+var runContext = context.Background()
+
+// Output file being written, removed when the run is stopped before it is complete
+var (
+	partialFileMu sync.Mutex
+	partialFile   string
+)
+
+// startRunContext cancels the run after -timeout or on the first SIGINT or SIGTERM, so that fetching stops and no
+// output is written from incomplete costs. A second signal exits right away.
+func startRunContext() {
+	ctx, cancel := context.WithCancelCause(context.Background())
+	if options.timeout > 0 {
+		time.AfterFunc(options.timeout, func() {
+			cancel(fmt.Errorf("timed out after %s", options.timeout))
+		})
+	}
+
+	signals := make(chan os.Signal, 2)
+	signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+	go func() {
+		<-signals
+		warnf("Interrupted, stopping. Press Ctrl-C again to exit now")
+		cancel(errInterrupted)
+		<-signals
+		removePartialFile()
+		os.Exit(exitInterrupted)
+	}()
+
+	runContext = ctx
+}
+
+// checkCanceled exits if the run was interrupted or timed out, removing the output file being written
+func checkCanceled() {
+	if runContext.Err() == nil {
+		return
+	}
+	stopProgress()
+	removePartialFile()
+	cause := context.Cause(runContext)
+	errorf("Stopped before all outputs were written: %v", cause)
+	if errors.Is(cause, errInterrupted) {
+		os.Exit(exitInterrupted)
+	}
+	os.Exit(1)
+}
+
+// partialFilename returns the hidden file an output is written to before it is renamed, keeping the extension that
+// some formats are checked by, e.g. reports/.partial-output.xlsx
+func partialFilename(filename string) string {
+	return filepath.Join(filepath.Dir(filename), ".partial-"+filepath.Base(filename))
+}
+
+func setPartialFile(filename string) {
+	partialFileMu.Lock()
+	defer partialFileMu.Unlock()
+	partialFile = filename
+}
+
+func removePartialFile() {
+	partialFileMu.Lock()
+	defer partialFileMu.Unlock()
+	if partialFile != "" {
+		os.Remove(partialFile)
+		partialFile = ""
+	}
+}
+
+// httpGet is http.Get canceled along with the run
+func httpGet(url string) (*http.Response, error) {
+	req, err := http.NewRequestWithContext(runContext, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	return http.DefaultClient.Do(req)
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/aws/ratelimit"
+	"github.com/aws/aws-sdk-go-v2/aws/retry"
+	"github.com/aws/aws-sdk-go-v2/config"
+	"github.com/aws/aws-sdk-go-v2/credentials"
+	"github.com/aws/aws-sdk-go-v2/credentials/stscreds"
+	"github.com/aws/aws-sdk-go-v2/service/sts"
+)
+
+const defaultSessionName = "aws-cost-sankey"
+
+// Cost Explorer throttles aggressively, so throttled requests are retried more patiently than the SDK default
+const (
+	defaultMaxAttempts = 10
+	defaultMaxBackoff  = 30
+)
+
+var baseConfig *aws.Config
+var stsClient *sts.Client
+
+// Region of the environment or shared config, resolved once by defaultRegion
+var sharedRegion string
+
+// Assumed role credentials are cached by role and external ID so that accounts
+// sharing a role reuse the same STS session until it expires
+var roleCredentials = make(map[string]*aws.CredentialsCache)
+
+// Guards the shared base config and credential caches, and serializes interactive SSO logins
+var credentialsMu sync.Mutex
+
+func loadConfig(optFns ...func(*config.LoadOptions) error) aws.Config {
+	cfg, err := newConfig(optFns...)
+	if err != nil {
+		log.Fatalf("unable to load SDK config, %v", err)
+	}
+	return cfg
+}
+
+func newConfig(optFns ...func(*config.LoadOptions) error) (aws.Config, error) {
+	// Region doesn't matter for cost explorer since its a global service
+	optFns = append([]func(*config.LoadOptions) error{config.WithRegion("us-east-1"), config.WithRetryer(newRetryer)}, optFns...)
+	return config.LoadDefaultConfig(runContext, optFns...)
+}
+
+// newRetryer retries throttling and transient errors with jittered exponential backoff.
+// Client side rate limiting is disabled so that concurrent accounts don't exhaust the shared retry quota.
+func newRetryer() aws.Retryer {
+	return retry.NewStandard(func(o *retry.StandardOptions) {
+		o.MaxAttempts = globalConfig.MaxAttempts
+		o.MaxBackoff = time.Duration(globalConfig.MaxBackoff) * time.Second
+		o.RateLimiter = ratelimit.None
+	})
+}
+
+func loadBaseConfig() aws.Config {
+	if baseConfig == nil {
+		cfg := loadConfig()
+		baseConfig = &cfg
+		stsClient = sts.NewFromConfig(cfg)
+	}
+	return *baseConfig
+}
+
+// defaultRegion returns the region of the environment or shared config, e.g. AWS_REGION, for regional services such as
+// Secrets Manager, since the base config is pinned to us-east-1 for Cost Explorer
+func defaultRegion() string {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+	if sharedRegion == "" {
+		sharedRegion = "us-east-1"
+		if cfg, err := config.LoadDefaultConfig(runContext); err == nil && cfg.Region != "" {
+			sharedRegion = cfg.Region
+		}
+	}
+	return sharedRegion
+}
+
+// accountConfig returns an SDK config carrying the credentials of the given account.
+// Static keys take precedence, then shared config profile, assuming the role if any with either of them, then SSO,
+// then role assumption, then the default credential chain.
+func accountConfig(account Account) (aws.Config, error) {
+	credentialsMu.Lock()
+	defer credentialsMu.Unlock()
+
+	// Replayed responses need no credentials, e.g. to reproduce a bug report
+	if options.replay != "" {
+		return aws.Config{}, nil
+	}
+
+	if account.Key == "" && account.Profile != "" {
+		debugf("Using shared config profile %s for %s", account.Profile, account.Name)
+		cfg, err := newConfig(config.WithSharedConfigProfile(account.Profile))
+		if err != nil {
+			return cfg, fmt.Errorf("failed to load profile %s: %w", account.Profile, err)
+		}
+		if account.RoleARN != "" {
+			debugf("Assuming role %s with profile %s for %s", account.RoleARN, account.Profile, account.Name)
+			cfg.Credentials = assumeRole(account, sts.NewFromConfig(cfg))
+		}
+		return cfg, nil
+	}
+
+	cfg := loadBaseConfig()
+
+	if account.Key != "" {
+		debugf("Using static credentials for %s", account.Name)
+		cfg.Credentials = credentials.NewStaticCredentialsProvider(account.Key, account.Secret, account.Token)
+		if account.RoleARN != "" {
+			debugf("Assuming role %s with static credentials for %s", account.RoleARN, account.Name)
+			cfg.Credentials = assumeRole(account, sts.NewFromConfig(cfg))
+		}
+	} else if account.SSOStartURL != "" {
+		debugf("Using SSO role %s in %s for %s", account.SSORoleName, account.SSOAccountID, account.Name)
+		provider, err := ssoCredentials(account, cfg)
+		if err != nil {
+			return cfg, err
+		}
+		cfg.Credentials = provider
+	} else if account.RoleARN != "" {
+		debugf("Assuming role %s for %s", account.RoleARN, account.Name)
+		cfg.Credentials = assumeRole(account, stsClient)
+	} else {
+		debugf("Using default credential chain for %s", account.Name)
+	}
+
+	return cfg, nil
+}
+
+// assumeRole returns the credentials of the role of the account, assumed with the credentials of the STS client
+func assumeRole(account Account, client *sts.Client) aws.CredentialsProvider {
+	cacheKey := account.Key + "|" + account.Profile + "|" + account.RoleARN + "|" + account.ExternalID
+	if provider, ok := roleCredentials[cacheKey]; ok {
+		return provider
+	}
+
+	sessionName := account.SessionName
+	if sessionName == "" {
+		sessionName = defaultSessionName
+	}
+	provider := aws.NewCredentialsCache(stscreds.NewAssumeRoleProvider(client, account.RoleARN, func(o *stscreds.AssumeRoleOptions) {
+		o.RoleSessionName = sessionName
+		if account.ExternalID != "" {
+			o.ExternalID = aws.String(account.ExternalID)
+		}
+	}))
+	roleCredentials[cacheKey] = provider
+	return provider
+}
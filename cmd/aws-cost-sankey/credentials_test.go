@@ -0,0 +1,29 @@
+package main
+
+import (
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+)
+
+func TestAccountConfigAssumesRoleWithStaticKeys(t *testing.T) {
+	setupRunTest(t, Config{}, nil)
+	t.Setenv("AWS_REGION", "us-east-1")
+	setGlobal(t, &roleCredentials, make(map[string]*aws.CredentialsCache))
+
+	role := "arn:aws:iam::123456789012:role/billing-read"
+	providers := make(map[string]aws.CredentialsProvider)
+	for _, key := range []string{"key1", "key2"} {
+		cfg, err := accountConfig(Account{Name: key, Key: key, Secret: "secret", RoleARN: role})
+		if err != nil {
+			t.Fatalf("accountConfig() = %v", err)
+		}
+		if _, ok := cfg.Credentials.(*aws.CredentialsCache); !ok {
+			t.Errorf("%s: credentials = %T, want the assumed role", key, cfg.Credentials)
+		}
+		providers[key] = cfg.Credentials
+	}
+	if providers["key1"] == providers["key2"] {
+		t.Errorf("the role assumed with different keys shares its credentials")
+	}
+}
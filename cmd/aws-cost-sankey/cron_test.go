@@ -0,0 +1,42 @@
+package main
+
+import (
+	"testing"
+	"time"
+)
+
+func TestCronNext(t *testing.T) {
+	// A Tuesday
+	now := time.Date(2024, 10, 15, 6, 30, 0, 0, time.UTC)
+	for _, tt := range []struct {
+		expr string
+		want time.Time
+	}{
+		{"0 6 * * *", time.Date(2024, 10, 16, 6, 0, 0, 0, time.UTC)},
+		{"@hourly", time.Date(2024, 10, 15, 7, 0, 0, 0, time.UTC)},
+		{"*/20 * * * *", time.Date(2024, 10, 15, 6, 40, 0, 0, time.UTC)},
+		{"0 6 * * 1-5", time.Date(2024, 10, 16, 6, 0, 0, 0, time.UTC)},
+		{"0 6 * * 7", time.Date(2024, 10, 20, 6, 0, 0, 0, time.UTC)},
+		{"0 0 1 * *", time.Date(2024, 11, 1, 0, 0, 0, 0, time.UTC)},
+		// Either the day of month or the day of week
+		{"0 0 1 * 5", time.Date(2024, 10, 18, 0, 0, 0, 0, time.UTC)},
+		{"0 0 29 2 *", time.Date(2028, 2, 29, 0, 0, 0, 0, time.UTC)},
+	} {
+		schedule, err := parseCron(tt.expr)
+		if err != nil {
+			t.Errorf("parseCron(%q) = %v", tt.expr, err)
+			continue
+		}
+		if got := schedule.next(now); !got.Equal(tt.want) {
+			t.Errorf("next of %q = %s, want %s", tt.expr, got, tt.want)
+		}
+	}
+}
+
+func TestParseCronErrors(t *testing.T) {
+	for _, expr := range []string{"", "0 6 * *", "60 * * * *", "0 6 * * 8", "*/0 * * * *", "5-1 * * * *", "a * * * *"} {
+		if _, err := parseCron(expr); err == nil {
+			t.Errorf("parseCron(%q) succeeded, want an error", expr)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// CSVConfig maps the columns of a CSV input file to sankey links
+type CSVConfig struct {
+	Source   string `yaml:"source"`
+	Target   string `yaml:"target"`
+	Amount   string `yaml:"amount"`
+	Period   string `yaml:"period"`
+	Currency string `yaml:"currency"`
+}
+
+func isCSVInput(inputFile string) bool {
+	return strings.HasSuffix(inputFile, ".csv") || strings.HasSuffix(inputFile, ".csv.gz") || (inputFile == stdioName && stdinFormat() == "csv")
+}
+
+// readCSVData reads links from a CSV file using the configured column mapping.
+// Rows with a period are also added to the time bucket of that period when timeBuckets is enabled.
+func readCSVData(inputFile string) error {
+	infof("Reading CSV data from %s", inputFile)
+
+	mapping := globalConfig.CSV
+	if mapping.Source == "" {
+		mapping.Source = "source"
+	}
+	if mapping.Target == "" {
+		mapping.Target = "target"
+	}
+	if mapping.Amount == "" {
+		mapping.Amount = "amount"
+	}
+
+	// Links are kept per currency until all rows are read, then converted to the reporting currency
+	links := make(map[string]map[string]map[string]float64)
+	err := readTable(inputFile, func(row map[string]string) error {
+		parent := row[mapping.Source]
+		child := row[mapping.Target]
+		if parent == "" || child == "" {
+			return fmt.Errorf("missing %s or %s column in row: %v", mapping.Source, mapping.Target, row)
+		}
+		cost, err := strconv.ParseFloat(row[mapping.Amount], 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse cost: %w", err)
+		}
+
+		unit := row[mapping.Currency]
+		if _, ok := links[unit]; !ok {
+			links[unit] = make(map[string]map[string]float64)
+		}
+		addCost(links[unit], parent, child, cost)
+
+		if period := row[mapping.Period]; mapping.Period != "" && period != "" && collectBuckets() {
+			if _, ok := bucketResults[period]; !ok {
+				bucketResults[period] = make(map[string]map[string]float64)
+			}
+			rate, err := conversionRate(unit)
+			if err != nil {
+				return err
+			}
+			addCost(bucketResults[period], parent, child, cost*rate)
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+	if err := convertLinks(links); err != nil {
+		return err
+	}
+
+	if len(links) > 1 && globalConfig.Exchange.Currency == "" {
+		warnf("Input contains multiple currencies which are summed as is")
+	}
+	return nil
+}
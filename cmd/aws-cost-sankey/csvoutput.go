@@ -0,0 +1,82 @@
+package main
+
+import (
+	"encoding/csv"
+	"fmt"
+	"os"
+	"sort"
+	"strconv"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// generateCSV writes the links as an edge list that can be read back as CSV input,
+// and a summary of the total of each node per level, e.g. per account and per environment
+func generateCSV(outputFile string, summaryFile string) error {
+	infof("Generating CSV output...")
+
+	graph := buildGraph()
+
+	edges := [][]string{{"source", "target", "amount"}}
+	for _, link := range graph.Links {
+		edges = append(edges, []string{link.Source, link.Target, formatAmount(link.Value)})
+	}
+	if err := writeCSV(outputFile, edges); err != nil {
+		return err
+	}
+
+	// Largest nodes first within each level, the root node is left out
+	nodes := append([]costgraph.Node{}, graph.Nodes...)
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if nodes[i].Depth != nodes[j].Depth {
+			return nodes[i].Depth < nodes[j].Depth
+		}
+		return nodes[i].Value > nodes[j].Value
+	})
+	summary := [][]string{{"level", "node", "total", "percent"}}
+	for _, node := range nodes {
+		if node.Depth == 0 {
+			continue
+		}
+		percent := 0.0
+		if graph.Total != 0 {
+			percent = node.Value / graph.Total * 100
+		}
+		summary = append(summary, []string{levelName(node.Depth), node.Name, formatAmount(node.Value), strconv.FormatFloat(percent, 'f', 1, 64)})
+	}
+	return writeCSV(summaryFile, summary)
+}
+
+// levelName returns the hierarchy level of the given depth below the root, e.g. "tag:environment"
+func levelName(depth int) string {
+	if depth >= 1 && depth <= len(hierarchyLevels) {
+		return hierarchyLevels[depth-1].String()
+	}
+	return fmt.Sprintf("level%d", depth)
+}
+
+// levelTitle returns the level name without its type, e.g. "environment" for "tag:environment"
+func levelTitle(depth int) string {
+	if depth >= 1 && depth <= len(hierarchyLevels) {
+		return hierarchyLevels[depth-1].title()
+	}
+	return levelName(depth)
+}
+
+func formatAmount(amount float64) string {
+	return strconv.FormatFloat(amount, 'f', 2, 64)
+}
+
+func writeCSV(outputFile string, records [][]string) error {
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+
+	w := csv.NewWriter(f)
+	if err := w.WriteAll(records); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	return nil
+}
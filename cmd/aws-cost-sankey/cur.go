@@ -0,0 +1,216 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	s3types "github.com/aws/aws-sdk-go-v2/service/s3/types"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/fetch"
+)
+
+// CURConfig locates a Cost and Usage Report in S3 and maps its columns to sankey levels
+type CURConfig struct {
+	Bucket     string   `yaml:"bucket"`
+	Prefix     string   `yaml:"prefix"`
+	ReportName string   `yaml:"reportName"`
+	Region     string   `yaml:"region"`
+	Month      string   `yaml:"month"`
+	Columns    []string `yaml:"columns"`
+	CostColumn string   `yaml:"costColumn"`
+}
+
+// Column names differ between CSV and parquet reports
+var defaultCURColumns = map[bool][]string{
+	false: {"lineItem/UsageAccountId", "resourceTags/user:environment", "product/ProductName"},
+	true:  {"line_item_usage_account_id", "resource_tags_user_environment", "product_product_name"},
+}
+var defaultCURCostColumn = map[bool]string{
+	false: "lineItem/UnblendedCost",
+	true:  "line_item_unblended_cost",
+}
+var curAccountColumn = map[bool]string{
+	false: "lineItem/UsageAccountId",
+	true:  "line_item_usage_account_id",
+}
+var curUsageStartColumn = map[bool]string{
+	false: "lineItem/UsageStartDate",
+	true:  "line_item_usage_start_date",
+}
+
+// curManifest covers both legacy CUR (reportKeys) and CUR 2.0 Data Exports (dataFiles) manifests
+type curManifest struct {
+	ReportKeys []string `json:"reportKeys"`
+	DataFiles  []string `json:"dataFiles"`
+}
+
+// curProvider provides the costs of the line items of a Cost and Usage Report in S3
+type curProvider struct {
+	cfg aws.Config
+}
+
+// Fetch reads the report files listed in the CUR manifest of each month of the period and aggregates the line items
+// used within the period along the configured columns. A configured month is read as a whole.
+func (p curProvider) Fetch(ctx context.Context, period costgraph.Period, _ []fetch.Level) (costgraph.Flows, error) {
+	cur := globalConfig.CUR
+	cfg := p.cfg
+	if cur.Region != "" {
+		cfg.Region = cur.Region
+	}
+	svc := s3.NewFromConfig(cfg)
+
+	months := []string{cur.Month}
+	if cur.Month == "" {
+		months = nil
+		for _, period := range fetch.MonthlyPeriods(period.Start, period.End) {
+			month := aws.ToString(period.Start)
+			if len(month) >= len("2006-01") {
+				month = month[:len("2006-01")]
+			}
+			months = append(months, month)
+		}
+	}
+
+	data := make(map[string]map[string]float64)
+	for _, month := range months {
+		start, err := time.Parse("2006-01", month)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CUR month %s: %w", month, err)
+		}
+		manifest, err := loadCURManifest(ctx, svc, start)
+		if err != nil {
+			return nil, err
+		}
+		keys := manifest.ReportKeys
+		for _, dataFile := range manifest.DataFiles {
+			keys = append(keys, strings.TrimPrefix(dataFile, fmt.Sprintf("s3://%s/", cur.Bucket)))
+		}
+		infof("Found %d report files for %s", len(keys), month)
+
+		for _, key := range keys {
+			if err := readCURFile(ctx, svc, key, period, data); err != nil {
+				return nil, err
+			}
+		}
+	}
+
+	// Line items are aggregated before rounding so that small items are not lost
+	return roundFlows(data), nil
+}
+
+// readCURFile adds the cost of the line items of a report file to data, leaving out the line items used outside the
+// period unless a month is configured
+func readCURFile(ctx context.Context, svc *s3.Client, key string, period costgraph.Period, data map[string]map[string]float64) error {
+	cur := globalConfig.CUR
+	filename, err := downloadS3Object(ctx, svc, cur.Bucket, key)
+	if err != nil {
+		return err
+	}
+	defer os.Remove(filename)
+	parquetFile := strings.HasSuffix(key, ".parquet")
+
+	columns := cur.Columns
+	if len(columns) == 0 {
+		columns = defaultCURColumns[parquetFile]
+	}
+	costColumn := cur.CostColumn
+	if costColumn == "" {
+		costColumn = defaultCURCostColumn[parquetFile]
+	}
+
+	debugf("Processing %s", key)
+	return readTable(filename, func(row map[string]string) error {
+		if row[costColumn] == "" || (cur.Month == "" && !inDateRange(period, row[curUsageStartColumn[parquetFile]])) {
+			return nil
+		}
+		cost, err := strconv.ParseFloat(row[costColumn], 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse cost: %w", err)
+		}
+
+		nodes := make([]string, len(columns))
+		for i, column := range columns {
+			nodes[i] = row[column]
+			if nodes[i] != "" && curTagColumn(column) {
+				nodes[i] = accountNode(row[curAccountColumn[parquetFile]], nodes[i])
+			}
+		}
+		addPath(data, nodes, cost)
+		return nil
+	})
+}
+
+// curTagColumn reports whether a column holds tag or cost category values, which are namespaced per account like
+// those fetched from Cost Explorer
+func curTagColumn(column string) bool {
+	for _, prefix := range []string{"resourceTags/", "resource_tags", "costCategory/", "cost_category"} {
+		if strings.HasPrefix(column, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func loadCURManifest(ctx context.Context, svc *s3.Client, start time.Time) (curManifest, error) {
+	cur := globalConfig.CUR
+	end := start.AddDate(0, 1, 0)
+	candidates := []string{
+		// Legacy CUR
+		path.Join(cur.Prefix, cur.ReportName, fmt.Sprintf("%s-%s", start.Format("20060102"), end.Format("20060102")), cur.ReportName+"-Manifest.json"),
+		// CUR 2.0 Data Exports
+		path.Join(cur.Prefix, cur.ReportName, "metadata", fmt.Sprintf("BILLING_PERIOD=%s", start.Format("2006-01")), cur.ReportName+"-Manifest.json"),
+	}
+
+	for _, key := range candidates {
+		result, err := svc.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(cur.Bucket), Key: aws.String(key)})
+		var noSuchKey *s3types.NoSuchKey
+		if errors.As(err, &noSuchKey) {
+			continue
+		}
+		if err != nil {
+			return curManifest{}, fmt.Errorf("failed to get CUR manifest %s: %w", key, err)
+		}
+		defer result.Body.Close()
+
+		infof("Reading CUR manifest s3://%s/%s", cur.Bucket, key)
+		var manifest curManifest
+		if err := json.NewDecoder(result.Body).Decode(&manifest); err != nil {
+			return curManifest{}, fmt.Errorf("failed to decode CUR manifest: %w", err)
+		}
+		return manifest, nil
+	}
+
+	return curManifest{}, fmt.Errorf("no CUR manifest found for %s in s3://%s/%s", start.Format("2006-01"), cur.Bucket, path.Join(cur.Prefix, cur.ReportName))
+}
+
+// downloadS3Object downloads an object to a temporary file, keeping its suffix so the format can be detected
+func downloadS3Object(ctx context.Context, svc *s3.Client, bucket string, key string) (string, error) {
+	result, err := svc.GetObject(ctx, &s3.GetObjectInput{Bucket: aws.String(bucket), Key: aws.String(key)})
+	if err != nil {
+		return "", fmt.Errorf("failed to get s3://%s/%s: %w", bucket, key, err)
+	}
+	defer result.Body.Close()
+
+	f, err := os.CreateTemp("", "*-"+path.Base(key))
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %w", err)
+	}
+	defer f.Close()
+
+	if _, err := io.Copy(f, result.Body); err != nil {
+		os.Remove(f.Name())
+		return "", fmt.Errorf("failed to download s3://%s/%s: %w", bucket, key, err)
+	}
+	return f.Name(), nil
+}
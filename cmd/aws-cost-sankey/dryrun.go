@@ -0,0 +1,179 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+
+	"aws-costexplorer/pkg/fetch"
+)
+
+// Cost Explorer bills each API request, including each page of paginated results
+const costExplorerRequestFee = 0.01
+
+// fetchPlan counts the Cost Explorer requests of a run. Requests split by the values of a level or paginated can't be
+// counted without calling AWS, so the counts are a minimum.
+type fetchPlan struct {
+	sb       strings.Builder
+	requests int
+	cached   int
+	minimum  bool
+}
+
+func (p *fetchPlan) printf(format string, args ...interface{}) {
+	fmt.Fprintf(&p.sb, format, args...)
+}
+
+// printFetchPlan prints the Cost Explorer requests a run would make, which of them would be served from the cache and
+// the estimated charge, without calling AWS
+func printFetchPlan(hierarchy []Level) {
+	plan := &fetchPlan{}
+	plan.printf("Dry run from %s to %s, no AWS API is called\n", globalConfig.StartDate, globalConfig.EndDate)
+
+	switch {
+	case options.inputFile != "":
+		plan.printf("\nCosts are read from %s, no Cost Explorer requests\n", options.inputFile)
+	case globalConfig.Source == "cur" || globalConfig.Source == "athena" || globalConfig.Source == "billingconductor":
+		plan.printf("\nCosts are read from %s, no Cost Explorer requests\n", globalConfig.Source)
+	case globalConfig.Organization:
+		management := "management"
+		if len(globalConfig.Accounts) > 0 {
+			management = globalConfig.Accounts[0].Name
+		}
+		plan.printf("\nEach member account, listed from Organizations by %s at run time:\n", management)
+		before := plan.requests
+		plan.account("member", hierarchy, false)
+		plan.printf("  The requests above are made for each member account\n")
+		if plan.requests > before {
+			plan.minimum = true
+		}
+		if options.detectAnomalies {
+			plan.printf("\n%s:\n", management)
+			plan.anomalies()
+		}
+	default:
+		for _, account := range globalConfig.Accounts {
+			if account.Provider != "" && account.Provider != ProviderAWS {
+				continue
+			}
+			plan.printf("\n%s:\n", account.Name)
+			plan.account(account.Name, hierarchy, true)
+			if options.detectAnomalies {
+				plan.anomalies()
+			}
+		}
+	}
+
+	// Other sources called by the run, outside Cost Explorer
+	var others []string
+	for _, cluster := range globalConfig.Kubernetes {
+		others = append(others, fmt.Sprintf("Kubernetes allocations of %s from %s", cluster.Environment, cluster.Endpoint))
+	}
+	for _, account := range globalConfig.Accounts {
+		if account.Provider == ProviderAzure {
+			others = append(others, fmt.Sprintf("Azure costs of %s", account.Name))
+		}
+	}
+	if globalConfig.GCP.Table != "" {
+		others = append(others, fmt.Sprintf("BigQuery table %s", globalConfig.GCP.Table))
+	}
+	if options.inputFile == "" && globalConfig.Source == "" && options.trackBudgets {
+		others = append(others, "AWS Budgets")
+	}
+	if len(others) > 0 {
+		plan.printf("\nAlso fetched, not billed by Cost Explorer:\n")
+		for _, other := range others {
+			plan.printf("  %s\n", other)
+		}
+	}
+
+	atLeast := ""
+	if plan.minimum {
+		atLeast = "at least "
+	}
+	billed := plan.requests - plan.cached
+	plan.printf("\nTotal: %s%d Cost Explorer requests, %d of them served from the cache\n", atLeast, plan.requests, plan.cached)
+	plan.printf("Estimated charge: %s$%.2f (%d billed requests at $%.2f)\n", atLeast, float64(billed)*costExplorerRequestFee, billed, costExplorerRequestFee)
+	fmt.Print(plan.sb.String())
+}
+
+// account adds the requests of an account, checking the cache if the requests are known before the run
+func (p *fetchPlan) account(accountName string, hierarchy []Level, checkCache bool) {
+	periods := fetch.MonthlyPeriods(globalConfig.StartDate, globalConfig.EndDate)
+	if options.compare == comparePrevious {
+		start, end := precedingPeriod(globalConfig.StartDate, globalConfig.EndDate)
+		periods = append(fetch.MonthlyPeriods(start, end), periods...)
+	}
+	opts := costExplorerOptions(accountName, fetchLevels(hierarchy))
+	p.groups(opts, periods, opts.GroupLevels(), checkCache, "  ")
+
+	if options.forecast {
+		p.printf("  GetCostForecast of the next %d days: 1 request\n", forecastDays)
+		p.requests++
+	}
+	if options.commitments {
+		requests := 2 + len(reservableServices)
+		p.printf("  GetSavingsPlansCoverage, GetSavingsPlansUtilization and GetReservationCoverage of %d services: %d requests, more if coverage is paginated\n",
+			len(reservableServices), requests)
+		p.requests += requests
+		p.minimum = true
+	}
+	if options.resources != "" {
+		p.printf("  GetCostAndUsageWithResources of %s over the last %d days: 1 request per page\n", options.resources, resourceLookbackDays)
+		p.requests++
+		p.minimum = true
+	}
+}
+
+// groups adds the GetCostAndUsage requests of the periods grouped by the levels. Like fetch.Fetch, levels beyond the
+// group by limit are fetched for each value of the first level, which is only known at run time.
+func (p *fetchPlan) groups(opts fetch.Options, periods []*types.DateInterval, levels []fetch.Level, checkCache bool, indent string) {
+	if len(levels) > fetch.MaxGroupBy {
+		p.printf("%sGetCostAndUsage grouped by %s to list its values:\n", indent, groupByName(levels[:1]))
+		p.requests += p.periods(opts, periods, levels[:1], checkCache, indent+"  ")
+		p.printf("%sthen for each value of %s:\n", indent, groupByName(levels[:1]))
+		count := p.requests
+		p.groups(opts, periods, levels[1:], false, indent+"  ")
+		// Values are unknown, only one request per period is counted below the split
+		if p.requests > count {
+			p.minimum = true
+		}
+		return
+	}
+	p.printf("%sGetCostAndUsage grouped by %s, %s %s:\n", indent, groupByName(levels), globalConfig.Granularity, globalConfig.Metric)
+	p.requests += p.periods(opts, periods, levels, checkCache, indent+"  ")
+}
+
+// periods prints the request of each period, counting the cached ones, and returns the number of requests
+func (p *fetchPlan) periods(opts fetch.Options, periods []*types.DateInterval, levels []fetch.Level, checkCache bool, indent string) int {
+	for _, period := range periods {
+		status := "1 page, more if the results are paginated"
+		if checkCache && cacheFresh(cacheFile(opts.Account, opts.Input(period, levels, nil)), period) {
+			status = "cached"
+			p.cached++
+		} else {
+			p.minimum = true
+		}
+		p.printf("%s%s to %s: %s\n", indent, aws.ToString(period.Start), aws.ToString(period.End), status)
+	}
+	return len(periods)
+}
+
+// anomalies adds the requests of Cost Anomaly Detection
+func (p *fetchPlan) anomalies() {
+	p.printf("  GetAnomalyMonitors and GetAnomalies: 2 requests, more if paginated\n")
+	p.requests += 2
+	p.minimum = true
+}
+
+// groupByName describes the group definitions of levels, e.g. "TAG:environment, DIMENSION:SERVICE"
+func groupByName(levels []fetch.Level) string {
+	names := make([]string, 0, len(levels))
+	for _, level := range levels {
+		definition := level.GroupDefinition()
+		names = append(names, fmt.Sprintf("%s:%s", definition.Type, aws.ToString(definition.Key)))
+	}
+	return strings.Join(names, ", ")
+}
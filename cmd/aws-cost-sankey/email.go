@@ -0,0 +1,265 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"fmt"
+	"html"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2"
+	"github.com/aws/aws-sdk-go-v2/service/sesv2/types"
+)
+
+// Port of SMTP submission with STARTTLS, unless configured otherwise
+const defaultSMTPPort = 587
+
+// Ways the chart is sent by email: the HTML chart attached, or a PNG of the diagram shown in the message
+const (
+	EmailChartAttach = "attach"
+	EmailChartInline = "inline"
+)
+
+// EmailConfig sends the summary of a run and the chart to the recipients, through SES or an SMTP server
+type EmailConfig struct {
+	From      string     `yaml:"from"`
+	To        []string   `yaml:"to"`
+	Subject   string     `yaml:"subject"`
+	Chart     string     `yaml:"chart"`
+	Transport string     `yaml:"transport"`
+	Region    string     `yaml:"region"`
+	SMTP      SMTPConfig `yaml:"smtp"`
+}
+
+type SMTPConfig struct {
+	Host         string `yaml:"host"`
+	Port         int    `yaml:"port"`
+	Username     string `yaml:"username"`
+	Password     string `yaml:"password"`
+	PasswordFrom string `yaml:"passwordFrom"`
+}
+
+func validateEmail() error {
+	email := &globalConfig.Email
+	switch {
+	case email.From == "":
+		return fmt.Errorf("set email from")
+	case len(email.To) == 0:
+		return fmt.Errorf("set email to, the list of recipients")
+	}
+	switch email.Chart {
+	case "", EmailChartAttach, EmailChartInline:
+	default:
+		return fmt.Errorf("unknown email chart %q, use %s or %s", email.Chart, EmailChartAttach, EmailChartInline)
+	}
+	switch email.Transport {
+	case "", "ses":
+	case "smtp":
+		if email.SMTP.Host == "" {
+			return fmt.Errorf("set email smtp host")
+		}
+	default:
+		return fmt.Errorf("unknown email transport %q, use ses or smtp", email.Transport)
+	}
+	return nil
+}
+
+// notifyEmail sends the summary with the chart through the configured transport
+func notifyEmail(summary runSummary) error {
+	message, err := emailMessage(summary)
+	if err != nil {
+		return err
+	}
+	if globalConfig.Email.Transport == "smtp" {
+		return sendSMTP(message)
+	}
+	return sendSES(message)
+}
+
+// emailSubject returns the subject with placeholders like -o filled in, or the title and period
+func emailSubject(summary runSummary) string {
+	if subject := globalConfig.Email.Subject; subject != "" {
+		return expandOutputTemplate(subject, time.Now())
+	}
+	return fmt.Sprintf("%s %s - %s: %s", summary.Title, summary.Start, summary.End, formatCost(summary.Total, 2))
+}
+
+// emailMessage builds a MIME message with the summary as text and HTML. The chart is attached as an HTML page,
+// since mail clients don't run its scripts, or shown in the message as a PNG of the diagram.
+func emailMessage(summary runSummary) ([]byte, error) {
+	email := globalConfig.Email
+	var buf bytes.Buffer
+	fmt.Fprintf(&buf, "From: %s\r\n", email.From)
+	fmt.Fprintf(&buf, "To: %s\r\n", strings.Join(email.To, ", "))
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", emailSubject(summary)))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	buf.WriteString("MIME-Version: 1.0\r\n")
+
+	mixed := multipart.NewWriter(&buf)
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mixed.Boundary())
+
+	related, err := createMultipart(mixed, "multipart/related")
+	if err != nil {
+		return nil, err
+	}
+	alternative, err := createMultipart(related, "multipart/alternative")
+	if err != nil {
+		return nil, err
+	}
+	if err := writeEmailPart(alternative, "text/plain; charset=utf-8", nil, []byte(strings.Join(summary.lines(), "\r\n"))); err != nil {
+		return nil, err
+	}
+	inline := email.Chart == EmailChartInline
+	if err := writeEmailPart(alternative, "text/html; charset=utf-8", nil, []byte(emailHTML(summary, inline))); err != nil {
+		return nil, err
+	}
+	if err := alternative.Close(); err != nil {
+		return nil, err
+	}
+
+	if inline {
+		var image bytes.Buffer
+		if err := writePNG(&image); err != nil {
+			return nil, fmt.Errorf("failed to render diagram: %v", err)
+		}
+		header := textproto.MIMEHeader{"Content-Id": {"<diagram>"}, "Content-Disposition": {`inline; filename="diagram.png"`}}
+		if err := writeEmailPart(related, "image/png", header, image.Bytes()); err != nil {
+			return nil, err
+		}
+	}
+	if err := related.Close(); err != nil {
+		return nil, err
+	}
+
+	if !inline {
+		html, err := chartHTML()
+		if err != nil {
+			return nil, err
+		}
+		header := textproto.MIMEHeader{"Content-Disposition": {`attachment; filename="chart.html"`}}
+		if err := writeEmailPart(mixed, "text/html; charset=utf-8", header, []byte(html)); err != nil {
+			return nil, err
+		}
+	}
+	if err := mixed.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
+
+// createMultipart adds a nested multipart part, e.g. the alternative text and HTML of a message
+func createMultipart(parent *multipart.Writer, contentType string) (*multipart.Writer, error) {
+	boundary := multipart.NewWriter(io.Discard).Boundary()
+	w, err := parent.CreatePart(textproto.MIMEHeader{"Content-Type": {fmt.Sprintf("%s; boundary=%s", contentType, boundary)}})
+	if err != nil {
+		return nil, err
+	}
+	nested := multipart.NewWriter(w)
+	if err := nested.SetBoundary(boundary); err != nil {
+		return nil, err
+	}
+	return nested, nil
+}
+
+// writeEmailPart adds a base64 encoded part with lines of 76 characters
+func writeEmailPart(parent *multipart.Writer, contentType string, header textproto.MIMEHeader, data []byte) error {
+	if header == nil {
+		header = textproto.MIMEHeader{}
+	}
+	header.Set("Content-Type", contentType)
+	header.Set("Content-Transfer-Encoding", "base64")
+	w, err := parent.CreatePart(header)
+	if err != nil {
+		return err
+	}
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		if _, err := io.WriteString(w, encoded[:76]+"\r\n"); err != nil {
+			return err
+		}
+		encoded = encoded[76:]
+	}
+	_, err = io.WriteString(w, encoded+"\r\n")
+	return err
+}
+
+// emailHTML lays out the summary as a simple HTML message, with the diagram shown inline if requested
+func emailHTML(summary runSummary, inline bool) string {
+	var sb strings.Builder
+	sb.WriteString(`<html><body style="font-family: sans-serif">`)
+	fmt.Fprintf(&sb, "<h2>%s</h2>", html.EscapeString(summary.Title))
+	fmt.Fprintf(&sb, "<p><b>%s</b> %s from %s to %s</p>", html.EscapeString(formatCost(summary.Total, 2)), html.EscapeString(summary.Metric), summary.Start, summary.End)
+	if len(summary.Top) > 0 {
+		sb.WriteString("<ul>")
+		for _, node := range summary.Top {
+			fmt.Fprintf(&sb, "<li>%s: %s</li>", html.EscapeString(node.Name), html.EscapeString(formatCost(node.Value, 2)))
+		}
+		sb.WriteString("</ul>")
+	}
+	if summary.Compared != "" {
+		fmt.Fprintf(&sb, "<p><b>Compared with %s</b></p><ul>", html.EscapeString(summary.Compared))
+		for _, m := range append(append([]mover{}, summary.Increases...), summary.Decreases...) {
+			fmt.Fprintf(&sb, "<li>%s: %s to %s (%s)</li>", html.EscapeString(m.name), html.EscapeString(formatCost(m.first, 2)), html.EscapeString(formatCost(m.last, 2)), html.EscapeString(formatChange(m)))
+		}
+		sb.WriteString("</ul>")
+	}
+	if summary.Analysis != "" {
+		fmt.Fprintf(&sb, "<p><b>Analysis</b></p><p style=\"white-space: pre-wrap\">%s</p>", html.EscapeString(summary.Analysis))
+	}
+	if len(summary.Failures) > 0 {
+		fmt.Fprintf(&sb, "<p>Incomplete, failed to fetch %s</p>", html.EscapeString(strings.Join(summary.Failures, ", ")))
+	}
+	if inline {
+		sb.WriteString(`<p><img src="cid:diagram" alt="Cost diagram" style="max-width: 100%"></p>`)
+	}
+	if summary.Link != "" {
+		fmt.Fprintf(&sb, `<p><a href="%s">Open the chart</a></p>`, html.EscapeString(summary.Link))
+	}
+	sb.WriteString("</body></html>")
+	return sb.String()
+}
+
+// sendSMTP sends the message through the SMTP server, upgrading to TLS with STARTTLS if offered
+func sendSMTP(message []byte) error {
+	config := globalConfig.Email.SMTP
+	port := config.Port
+	if port == 0 {
+		port = defaultSMTPPort
+	}
+	var auth smtp.Auth
+	if config.Username != "" {
+		auth = smtp.PlainAuth("", config.Username, config.Password, config.Host)
+	}
+	addr := config.Host + ":" + strconv.Itoa(port)
+	if err := smtp.SendMail(addr, auth, globalConfig.Email.From, globalConfig.Email.To, message); err != nil {
+		return fmt.Errorf("failed to send email through %s: %v", addr, err)
+	}
+	return nil
+}
+
+// sendSES sends the message with the SES v2 API and the default credentials, in the configured region
+func sendSES(message []byte) error {
+	cfg := loadBaseConfig()
+	cfg.Region = globalConfig.Email.Region
+	if cfg.Region == "" {
+		cfg.Region = defaultRegion()
+	}
+	svc := sesv2.NewFromConfig(cfg)
+	_, err := svc.SendEmail(runContext, &sesv2.SendEmailInput{
+		FromEmailAddress: aws.String(globalConfig.Email.From),
+		Destination:      &types.Destination{ToAddresses: globalConfig.Email.To},
+		Content:          &types.EmailContent{Raw: &types.RawMessage{Data: message}},
+	})
+	if err != nil {
+		return fmt.Errorf("failed to send email through SES: %v", err)
+	}
+	return nil
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/mail"
+	"strings"
+	"testing"
+)
+
+// emailParts returns the content type and decoded body of every leaf part of a message
+func emailParts(t *testing.T, message []byte) map[string]string {
+	t.Helper()
+	msg, err := mail.ReadMessage(bytes.NewReader(message))
+	if err != nil {
+		t.Fatalf("failed to read message: %v", err)
+	}
+	parts := make(map[string]string)
+	var walk func(contentType string, body io.Reader, disposition string)
+	walk = func(contentType string, body io.Reader, disposition string) {
+		mediaType, params, err := mime.ParseMediaType(contentType)
+		if err != nil {
+			t.Fatalf("invalid content type %q: %v", contentType, err)
+		}
+		if !strings.HasPrefix(mediaType, "multipart/") {
+			data, err := io.ReadAll(base64.NewDecoder(base64.StdEncoding, body))
+			if err != nil {
+				t.Fatalf("failed to decode %s: %v", mediaType, err)
+			}
+			parts[mediaType+" "+disposition] = string(data)
+			return
+		}
+		reader := multipart.NewReader(body, params["boundary"])
+		for {
+			part, err := reader.NextPart()
+			if err == io.EOF {
+				return
+			}
+			if err != nil {
+				t.Fatalf("failed to read part of %s: %v", mediaType, err)
+			}
+			walk(part.Header.Get("Content-Type"), part, part.Header.Get("Content-Disposition"))
+		}
+	}
+	walk(msg.Header.Get("Content-Type"), msg.Body, "")
+	return parts
+}
+
+func TestEmailMessage(t *testing.T) {
+	for _, chart := range []string{EmailChartAttach, EmailChartInline} {
+		setupRunTest(t, Config{Email: EmailConfig{From: "costs@example.com", To: []string{"finops@example.com"}, Chart: chart}}, twoAccounts())
+
+		message, err := emailMessage(buildSummary(nil))
+		if err != nil {
+			t.Fatalf("emailMessage() = %v", err)
+		}
+		parts := emailParts(t, message)
+		html := parts["text/html "]
+		if parts["text/plain "] == "" || !strings.Contains(html, "acct1") {
+			t.Errorf("%s: parts = %v, want the summary as text and HTML alternatives", chart, keys(parts))
+		}
+		_, attached := parts[`text/html attachment; filename="chart.html"`]
+		_, image := parts[`image/png inline; filename="diagram.png"`]
+		if chart == EmailChartInline && (!image || attached || !strings.Contains(html, "cid:diagram")) {
+			t.Errorf("inline: parts = %v, want the diagram shown in the message", keys(parts))
+		}
+		if chart == EmailChartAttach && (image || !attached) {
+			t.Errorf("attach: parts = %v, want the chart attached", keys(parts))
+		}
+	}
+}
+
+func keys(m map[string]string) []string {
+	var keys []string
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
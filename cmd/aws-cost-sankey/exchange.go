@@ -0,0 +1,195 @@
+package main
+
+import (
+	"encoding/xml"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+)
+
+// Daily euro foreign exchange reference rates of the European Central Bank
+const ecbRatesURL = "https://www.ecb.europa.eu/stats/eurofxref/eurofxref-daily.xml"
+
+// ExchangeConfig converts costs billed in other currencies to a single reporting currency.
+// Rates are the value of one unit of a currency in the reporting currency, e.g. EUR: 1.08 for USD.
+// Currencies without a configured rate are looked up from the ECB when source is "ecb".
+type ExchangeConfig struct {
+	Currency string             `yaml:"currency"`
+	Rates    map[string]float64 `yaml:"rates"`
+	Source   string             `yaml:"source"`
+}
+
+var (
+	exchangeMu sync.Mutex
+	ecbRates   map[string]float64
+
+	// Total amount per source currency before conversion, and the rates that were applied
+	sourceCurrencies = make(map[string]float64)
+	appliedRates     = make(map[string]float64)
+)
+
+// convertCost converts a cost in the given currency to the reporting currency and records the source amount.
+// Amounts are returned as is when no reporting currency is configured or the currency is not reported.
+func convertCost(amount float64, unit string) (float64, error) {
+	rate, err := conversionRate(unit)
+	if err != nil {
+		return 0, err
+	}
+	if rate != 1 {
+		exchangeMu.Lock()
+		sourceCurrencies[strings.ToUpper(unit)] += amount
+		exchangeMu.Unlock()
+	}
+	return amount * rate, nil
+}
+
+// convertLinks converts links read per currency, e.g. from an edge list, and adds them to the results.
+// Only the links leaving root nodes are recorded as source amounts, since costs repeat on every level.
+func convertLinks(links map[string]map[string]map[string]float64) error {
+	for unit, data := range links {
+		rate, err := conversionRate(unit)
+		if err != nil {
+			return err
+		}
+		for parent, children := range data {
+			for child, cost := range children {
+				addCost(results, parent, child, cost*rate)
+			}
+		}
+		if rate == 1 {
+			continue
+		}
+		for root := range data {
+			if !hasParent(data, root) {
+				for _, cost := range data[root] {
+					sourceCurrencies[strings.ToUpper(unit)] += cost
+				}
+			}
+		}
+	}
+	return nil
+}
+
+func hasParent(data map[string]map[string]float64, node string) bool {
+	for _, children := range data {
+		if _, ok := children[node]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// conversionRate returns the rate from the given currency to the reporting currency, or 1 if there is nothing to convert
+func conversionRate(unit string) (float64, error) {
+	reporting := globalConfig.Exchange.Currency
+	if reporting == "" || unit == "" || strings.EqualFold(unit, reporting) {
+		return 1, nil
+	}
+
+	exchangeMu.Lock()
+	defer exchangeMu.Unlock()
+	unit = strings.ToUpper(unit)
+	rate, ok := appliedRates[unit]
+	if !ok {
+		var err error
+		if rate, err = exchangeRate(unit, reporting); err != nil {
+			return 0, err
+		}
+		appliedRates[unit] = rate
+		debugf("Converting %s to %s at %g", unit, reporting, rate)
+	}
+	return rate, nil
+}
+
+// exchangeRate returns the configured rate of the currency, or the cross rate of the ECB reference rates
+func exchangeRate(unit string, reporting string) (float64, error) {
+	for currency, rate := range globalConfig.Exchange.Rates {
+		if strings.EqualFold(currency, unit) {
+			return rate, nil
+		}
+	}
+	if globalConfig.Exchange.Source != "ecb" {
+		return 0, fmt.Errorf("no exchange rate from %s to %s", unit, reporting)
+	}
+
+	if ecbRates == nil {
+		rates, err := fetchECBRates()
+		if err != nil {
+			return 0, err
+		}
+		ecbRates = rates
+	}
+	from, ok := ecbRates[unit]
+	if !ok {
+		return 0, fmt.Errorf("no ECB exchange rate for %s", unit)
+	}
+	to, ok := ecbRates[strings.ToUpper(reporting)]
+	if !ok {
+		return 0, fmt.Errorf("no ECB exchange rate for %s", reporting)
+	}
+	return to / from, nil
+}
+
+// fetchECBRates returns the latest ECB reference rates, i.e. the value of one euro in each currency
+func fetchECBRates() (map[string]float64, error) {
+	infof("Fetching exchange rates from %s", ecbRatesURL)
+
+	resp, err := httpGet(ecbRatesURL)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %w", err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch exchange rates: %s", resp.Status)
+	}
+
+	var envelope struct {
+		Cube struct {
+			Cube struct {
+				Time  string `xml:"time,attr"`
+				Rates []struct {
+					Currency string  `xml:"currency,attr"`
+					Rate     float64 `xml:"rate,attr"`
+				} `xml:"Cube"`
+			} `xml:"Cube"`
+		} `xml:"Cube"`
+	}
+	if err := xml.NewDecoder(resp.Body).Decode(&envelope); err != nil {
+		return nil, fmt.Errorf("failed to decode exchange rates: %w", err)
+	}
+
+	rates := map[string]float64{"EUR": 1}
+	for _, rate := range envelope.Cube.Cube.Rates {
+		rates[rate.Currency] = rate.Rate
+	}
+	infof("Using ECB exchange rates of %s", envelope.Cube.Cube.Time)
+	return rates, nil
+}
+
+// exchangeMetadata returns the source currencies and applied rates, e.g. "EUR 1200.00, JPY 50000.00" and "EUR 1.08, JPY 0.0067"
+func exchangeMetadata() (string, string) {
+	units := make([]string, 0, len(sourceCurrencies))
+	for unit := range sourceCurrencies {
+		units = append(units, unit)
+	}
+	sort.Strings(units)
+
+	amounts := make([]string, 0, len(units))
+	rates := make([]string, 0, len(units))
+	for _, unit := range units {
+		amounts = append(amounts, fmt.Sprintf("%s %s", unit, formatAmount(sourceCurrencies[unit])))
+		rates = append(rates, fmt.Sprintf("%s %g", unit, appliedRates[unit]))
+	}
+	return strings.Join(amounts, ", "), strings.Join(rates, ", ")
+}
+
+// exchangeReport lists the converted amounts for the text report
+func exchangeReport() []string {
+	if len(sourceCurrencies) == 0 {
+		return nil
+	}
+	amounts, rates := exchangeMetadata()
+	return []string{fmt.Sprintf("Converted to %s: %s at %s", globalConfig.Exchange.Currency, amounts, rates)}
+}
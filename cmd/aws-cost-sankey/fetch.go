@@ -0,0 +1,316 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"slices"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/fetch"
+)
+
+// costExplorerAPI is the part of the Cost Explorer client used to fetch the costs and their breakdowns, satisfied by
+// *costexplorer.Client and by fakes serving fixture responses in tests
+type costExplorerAPI interface {
+	fetch.CostExplorerAPI
+	GetCostAndUsageWithResources(ctx context.Context, params *costexplorer.GetCostAndUsageWithResourcesInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageWithResourcesOutput, error)
+	GetCostForecast(ctx context.Context, params *costexplorer.GetCostForecastInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostForecastOutput, error)
+	GetSavingsPlansCoverage(ctx context.Context, params *costexplorer.GetSavingsPlansCoverageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetSavingsPlansCoverageOutput, error)
+	GetSavingsPlansUtilization(ctx context.Context, params *costexplorer.GetSavingsPlansUtilizationInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetSavingsPlansUtilizationOutput, error)
+	GetReservationCoverage(ctx context.Context, params *costexplorer.GetReservationCoverageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetReservationCoverageOutput, error)
+	GetAnomalyMonitors(ctx context.Context, params *costexplorer.GetAnomalyMonitorsInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetAnomalyMonitorsOutput, error)
+	GetAnomalies(ctx context.Context, params *costexplorer.GetAnomaliesInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetAnomaliesOutput, error)
+}
+
+// fetchData fetches cost data for the given account.
+// If linkedAccountID is provided, costs are filtered to that linked account of the organization.
+func fetchData(accountName string, linkedAccountID string, svc costExplorerAPI, hierarchy []Level) error {
+	infof("Fetching data for %s", accountName)
+	return fetchFrom(costExplorerProvider{accountName, linkedAccountID, svc}, hierarchy)
+}
+
+// fetchFrom fetches the costs of the configured period from a provider and adds them to the results. Costs fetched
+// before an error are kept, see handleAccountError.
+func fetchFrom(provider fetch.CostProvider, hierarchy []Level) error {
+	period := costgraph.Period{Start: globalConfig.StartDate, End: globalConfig.EndDate}
+	flows, err := provider.Fetch(runContext, period, fetchLevels(hierarchy))
+
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	results.Merge(flows)
+	return err
+}
+
+// costExplorerProvider provides the costs of an account from -replay, the cache or Cost Explorer, filtered to a
+// linked account of the organization if set
+type costExplorerProvider struct {
+	name            string
+	linkedAccountID string
+	svc             costExplorerAPI
+}
+
+// Fetch also adds the costs of the account to the results per time period and per account
+func (p costExplorerProvider) Fetch(ctx context.Context, period costgraph.Period, hierarchy []fetch.Level) (costgraph.Flows, error) {
+	opts := costExplorerOptions(p.name, hierarchy)
+	opts.Filter = combineFilters(linkedAccountFilters(p.linkedAccountID))
+	if collectBuckets() {
+		opts.Buckets = make(map[string]costgraph.Flows)
+	}
+	flows, err := fetch.CostExplorer{Client: accountClient{p.name, p.svc}, Options: opts}.Fetch(ctx, period, hierarchy)
+
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	for bucket, bucketFlows := range opts.Buckets {
+		if _, ok := bucketResults[bucket]; !ok {
+			bucketResults[bucket] = make(map[string]map[string]float64)
+		}
+		costgraph.Flows(bucketResults[bucket]).Merge(bucketFlows)
+	}
+	if globalConfig.AccountCharts {
+		if _, ok := accountResults[p.name]; !ok {
+			accountResults[p.name] = make(map[string]map[string]float64)
+		}
+		costgraph.Flows(accountResults[p.name]).Merge(flows)
+	}
+	return flows, err
+}
+
+// costExplorerOptions returns the options of the Cost Explorer requests of an account.
+// Costs are converted to the currency and rounded to the precision, and nodes are named like the other sources.
+func costExplorerOptions(accountName string, hierarchy []fetch.Level) fetch.Options {
+	opts := fetch.Options{
+		Granularity: types.Granularity(globalConfig.Granularity),
+		Metric:      globalConfig.Metric,
+		Hierarchy:   hierarchy,
+		Account:     accountName,
+		Node: func(level fetch.Level, depth int, key string, parent string) string {
+			if level.Type != LevelAccount {
+				// Tag values are only prefixed with an account above them
+				account := ""
+				if slices.ContainsFunc(hierarchy[:depth-1], func(l fetch.Level) bool { return l.Type == LevelAccount }) {
+					account = accountName
+				}
+				key = Level(level).nodeName(key, parent, account)
+			}
+			return levelNode(key, depth, Level(level).title())
+		},
+		Convert: func(amount float64, unit string) (float64, error) {
+			if unit != "" {
+				if globalConfig.Exchange.Currency == "" {
+					resultsMu.Lock()
+					currency = unit
+					resultsMu.Unlock()
+				}
+				var err error
+				if amount, err = convertCost(amount, unit); err != nil {
+					return 0, err
+				}
+			}
+			return roundCost(amount), nil
+		},
+	}
+	if globalConfig.RecordTypes != "" {
+		opts.RecordType = func(recordType string, cost float64) string {
+			if !separateRecordTypes[recordType] {
+				return ""
+			}
+			resultsMu.Lock()
+			recordTypeTotals[recordType] += cost
+			resultsMu.Unlock()
+
+			// Render as a separate branch of the account, sankey links can't be negative
+			if globalConfig.RecordTypes == "branch" {
+				return fmt.Sprintf("%s %s", accountName, recordType)
+			}
+			return ""
+		}
+	}
+	return opts
+}
+
+func linkedAccountFilters(linkedAccountID string) []types.Expression {
+	if linkedAccountID == "" {
+		return nil
+	}
+	return []types.Expression{{
+		Dimensions: &types.DimensionValues{
+			Key:    types.DimensionLinkedAccount,
+			Values: []string{linkedAccountID},
+		},
+	}}
+}
+
+// accountClient serves the requests of an account from -replay, the cache or Cost Explorer
+type accountClient struct {
+	name string
+	svc  costExplorerAPI
+}
+
+func (c accountClient) GetCostAndUsage(_ context.Context, input *costexplorer.GetCostAndUsageInput, _ ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	debugf("Fetching costs of %s from %s to %s", c.name, aws.ToString(input.TimePeriod.Start), aws.ToString(input.TimePeriod.End))
+	output, err := costAndUsage(c.name, c.svc, input)
+	if err == nil {
+		pageFetched(c.name)
+	}
+	return output, err
+}
+
+// Record types that are tracked separately when recordTypes is enabled
+var separateRecordTypes = map[string]bool{"Credit": true, "Refund": true, "Tax": true}
+
+// Total cost per separate record type, used to annotate the chart
+var recordTypeTotals = make(map[string]float64)
+
+// Guards results and the other aggregated data while accounts are fetched concurrently
+var resultsMu sync.Mutex
+
+// addResult adds a link to the results, safe for concurrent use
+func addResult(parent string, child string, cost float64) {
+	resultsMu.Lock()
+	defer resultsMu.Unlock()
+	addCost(results, parent, child, cost)
+}
+
+// Exit codes of runs with failed accounts or sources. Other errors exit with 1.
+const (
+	exitFetchFailed = 2 // No output written since continueOnError is disabled
+	exitIncomplete  = 3 // Outputs written without the failed accounts
+)
+
+// fetchFailure is an account or source whose costs couldn't be fetched
+type fetchFailure struct {
+	name string
+	err  error
+}
+
+var (
+	fetchFailures   []fetchFailure
+	fetchFailuresMu sync.Mutex
+)
+
+// handleAccountError records the failure of an account and carries on with the remaining accounts, so that a single
+// bad credential or throttled request doesn't hide the failures of the others. Costs fetched before the failure are
+// kept, so the diagram may be incomplete for that account.
+func handleAccountError(accountName string, err error) {
+	if err == nil {
+		return
+	}
+	// Requests canceled by an interrupt or -timeout are reported once by checkCanceled
+	if runContext.Err() != nil {
+		debugf("Stopped fetching %s: %v", accountName, err)
+	} else {
+		warnf("Failed to fetch %s, continuing with the others: %v", accountName, err)
+	}
+	fetchFailuresMu.Lock()
+	defer fetchFailuresMu.Unlock()
+	fetchFailures = append(fetchFailures, fetchFailure{accountName, err})
+}
+
+// checkFetchFailures summarizes the failed accounts and exits unless continueOnError allows writing the outputs
+// without them, in which case exitOnFetchFailures exits once they are written
+func checkFetchFailures() {
+	if len(fetchFailures) == 0 || globalConfig.ContinueOnError {
+		return
+	}
+	reportFetchFailures()
+	errorf("No output written, set continueOnError to write the outputs without the failed accounts")
+	os.Exit(exitFetchFailed)
+}
+
+// exitOnFetchFailures summarizes the accounts left out of the written outputs and exits with exitIncomplete
+func exitOnFetchFailures() {
+	if len(fetchFailures) == 0 {
+		return
+	}
+	reportFetchFailures()
+	os.Exit(exitIncomplete)
+}
+
+func reportFetchFailures() {
+	errorf("Failed to fetch %d accounts or sources:", len(fetchFailures))
+	for _, failure := range fetchFailures {
+		errorf("  %s: %v", failure.name, failure.err)
+	}
+}
+
+// forEachConcurrently calls fn for each index below count, running at most concurrency calls at a time
+func forEachConcurrently(count int, concurrency int, fn func(i int)) {
+	if concurrency < 1 {
+		concurrency = 1
+	}
+
+	var wg sync.WaitGroup
+	sem := make(chan struct{}, concurrency)
+	for i := 0; i < count; i++ {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			fn(i)
+		}(i)
+	}
+	wg.Wait()
+}
+
+// roundFlows returns the flows of data with their costs rounded to the precision, for sources aggregating their line
+// items before rounding so that small items are not lost
+func roundFlows(data map[string]map[string]float64) costgraph.Flows {
+	flows := make(costgraph.Flows)
+	for parent, children := range data {
+		for child, cost := range children {
+			flows.Add(parent, child, roundCost(cost))
+		}
+	}
+	return flows
+}
+
+// addPath aggregates cost along a path of nodes, starting from the root node.
+// Empty nodes are attributed to "<parent>-unknown", and names are kept apart per level like levelNode.
+func addPath(data map[string]map[string]float64, nodes []string, cost float64) {
+	parent := "all"
+	for i, node := range nodes {
+		if node == "" {
+			node = unknownNode(parent)
+		}
+		node = levelNode(node, i+1, fmt.Sprintf("level %d", i+1))
+		addCost(data, parent, node, cost)
+		parent = node
+	}
+}
+
+func addCost(data map[string]map[string]float64, parent string, child string, cost float64) {
+	costgraph.Flows(data).Add(parent, child, cost)
+}
+
+func mapKeys(m map[string]float64) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	return keys
+}
+
+// nestUnder moves everything below the root node under a new node, e.g. a per cloud node
+func nestUnder(node string) {
+	children, ok := results["all"]
+	if !ok {
+		return
+	}
+
+	var total float64
+	for _, cost := range children {
+		total += cost
+	}
+	delete(results, "all")
+	for child, cost := range children {
+		addCost(results, node, child, cost)
+	}
+	addCost(results, "all", node, total)
+}
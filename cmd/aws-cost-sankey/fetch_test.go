@@ -0,0 +1,159 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// fakeCostExplorer serves the pages of a fixture response in order. Requests other than GetCostAndUsage panic on the
+// nil embedded client.
+type fakeCostExplorer struct {
+	costExplorerAPI
+	t      *testing.T
+	pages  []*costexplorer.GetCostAndUsageOutput
+	inputs []costexplorer.GetCostAndUsageInput
+}
+
+func newFakeCostExplorer(t *testing.T, fixture string) *fakeCostExplorer {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("testdata", "costexplorer", fixture))
+	if err != nil {
+		t.Fatalf("failed to read fixture: %v", err)
+	}
+	fake := &fakeCostExplorer{t: t}
+	if err := json.Unmarshal(data, &fake.pages); err != nil {
+		t.Fatalf("failed to decode fixture %s: %v", fixture, err)
+	}
+	return fake
+}
+
+func (f *fakeCostExplorer) GetCostAndUsage(_ context.Context, input *costexplorer.GetCostAndUsageInput, _ ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	f.inputs = append(f.inputs, *input)
+	if len(f.inputs) > len(f.pages) {
+		f.t.Fatalf("unexpected request %d, the fixture has %d pages", len(f.inputs), len(f.pages))
+	}
+	return f.pages[len(f.inputs)-1], nil
+}
+
+// setupFetchTest replaces the config and clears the results for the duration of a test. Responses are cached in a
+// temporary directory.
+func setupFetchTest(t *testing.T, config Config) {
+	t.Helper()
+	saved := globalConfig
+	config.StartDate, config.EndDate = "2024-10-01", "2024-11-01"
+	config.Granularity = "MONTHLY"
+	config.Metric = "UnblendedCost"
+	config.Cache.Dir = t.TempDir()
+	globalConfig = config
+	savedLevels := hierarchyLevels
+	hierarchy, err := parseHierarchy(config.Hierarchy, false)
+	if err != nil {
+		t.Fatalf("parseHierarchy() = %v", err)
+	}
+	hierarchyLevels = hierarchy
+
+	reset := func() {
+		resetResults()
+		nodeLevels = map[string]map[int]string{"all": {0: "all"}}
+		levelTitles = make(map[int]string)
+	}
+	reset()
+	t.Cleanup(func() {
+		globalConfig = saved
+		hierarchyLevels = savedLevels
+		reset()
+	})
+}
+
+// setupRunTest replaces the config and the results with the given flows for the duration of a test, placing each node
+// on the level of its depth as fetching does. AWS clients use test credentials and a fresh base config.
+func setupRunTest(t *testing.T, config Config, flows costgraph.Flows) {
+	t.Helper()
+	setupFetchTest(t, config)
+	results = flows
+	for node, depth := range flows.Depths() {
+		levelNode(node, depth, levelTitle(depth))
+	}
+
+	t.Setenv("AWS_ACCESS_KEY_ID", "test")
+	t.Setenv("AWS_SECRET_ACCESS_KEY", "test")
+	saved := baseConfig
+	baseConfig = nil
+	t.Cleanup(func() { baseConfig = saved })
+}
+
+func checkResults(t *testing.T, want costgraph.Flows) {
+	t.Helper()
+	if !reflect.DeepEqual(results, want) {
+		t.Errorf("results = %v, want %v", results, want)
+	}
+}
+
+func TestFetchDataFollowsPages(t *testing.T) {
+	setupFetchTest(t, Config{})
+	fake := newFakeCostExplorer(t, "multipage.json")
+
+	if err := fetchData("acct1", "", fake, hierarchyLevels); err != nil {
+		t.Fatalf("fetchData() = %v", err)
+	}
+
+	if len(fake.inputs) != 2 {
+		t.Fatalf("requests = %d, want 2", len(fake.inputs))
+	}
+	if token := aws.ToString(fake.inputs[1].NextPageToken); token != "page-2" {
+		t.Errorf("token of the second request = %q, want page-2", token)
+	}
+	checkResults(t, costgraph.Flows{
+		"all":        {"acct1": 16.5},
+		"acct1":      {"acct1/prod": 12.5, "acct1/dev": 4},
+		"acct1/prod": {"Amazon Elastic Compute Cloud - Compute": 10.5, "Amazon Simple Storage Service": 2},
+		"acct1/dev":  {"Amazon Elastic Compute Cloud - Compute": 4},
+	})
+}
+
+func TestFetchDataMissingTags(t *testing.T) {
+	setupFetchTest(t, Config{})
+	fake := newFakeCostExplorer(t, "missingtags.json")
+
+	if err := fetchData("acct1", "", fake, hierarchyLevels); err != nil {
+		t.Fatalf("fetchData() = %v", err)
+	}
+
+	checkResults(t, costgraph.Flows{
+		"all":           {"acct1": 5},
+		"acct1":         {"acct1/prod": 3, "acct1-unknown": 2},
+		"acct1/prod":    {"AWS Lambda": 3},
+		"acct1-unknown": {"AWS Lambda": 1.5, "Amazon Simple Storage Service": 0.5},
+	})
+}
+
+func TestFetchDataCredits(t *testing.T) {
+	setupFetchTest(t, Config{RecordTypes: "branch", Hierarchy: []string{"account", "dimension:SERVICE"}})
+	fake := newFakeCostExplorer(t, "credits.json")
+
+	if err := fetchData("acct1", "", fake, hierarchyLevels); err != nil {
+		t.Fatalf("fetchData() = %v", err)
+	}
+
+	// Record type is grouped by last, after the service
+	groupBy := fake.inputs[0].GroupBy
+	if len(groupBy) != 2 || aws.ToString(groupBy[1].Key) != "RECORD_TYPE" {
+		t.Errorf("group by = %v, want SERVICE and RECORD_TYPE", groupBy)
+	}
+	checkResults(t, costgraph.Flows{
+		"all":   {"acct1": 22},
+		"acct1": {"Amazon Elastic Compute Cloud - Compute": 20, "acct1 Credit": 5, "acct1 Tax": 2},
+	})
+	if want := map[string]float64{"Credit": -5, "Tax": 2}; !reflect.DeepEqual(recordTypeTotals, want) {
+		t.Errorf("record type totals = %v, want %v", recordTypeTotals, want)
+	}
+}
@@ -0,0 +1,105 @@
+package main
+
+import (
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"aws-costexplorer/pkg/render"
+)
+
+// Placeholders of output file names, e.g. -o "reports/{account}-{month}"
+var (
+	outputPlaceholderPattern = regexp.MustCompile(`\{([a-z]+)\}`)
+	outputPlaceholders       = []string{"start", "end", "month", "date", "account"}
+)
+
+// Extensions of the output formats, left out of output file names so that "-o costs.html -f chart,text" writes
+// costs.html and costs.txt
+var outputExtensions = []string{".txt", ".html", ".json", ".svg", ".png", ".pdf", ".md", ".mmd", ".xlsx", ".csv"}
+
+// outputFilename returns the name of the output file with the extension of the format, or - for stdout
+func outputFilename(extension string) string {
+	if options.outputFile == stdioName {
+		return stdioName
+	}
+	return outputBase() + extension
+}
+
+// registeredExtensions returns the extensions of the formats registered with the render package
+func registeredExtensions() []string {
+	var extensions []string
+	for _, name := range render.Formats() {
+		if renderer, ok := render.Lookup(name); ok {
+			extensions = append(extensions, renderer.Extension())
+		}
+	}
+	return extensions
+}
+
+// outputBase returns the output file name with its placeholders filled in and without the extension of a format,
+// creating its directory if needed:
+//
+//	{start}, {end}  the dates of the period, e.g. 2024-10-01
+//	{month}         the month of the start date, e.g. 2024-10
+//	{date}          the date of the run
+//	{account}       the name of the only account of the config, or "all"
+func outputBase() string {
+	name := expandOutputTemplate(options.outputFile, time.Now())
+	for _, extension := range append(outputExtensions, registeredExtensions()...) {
+		if extension != "" && strings.HasSuffix(name, extension) {
+			name = strings.TrimSuffix(name, extension)
+			break
+		}
+	}
+	if dir := filepath.Dir(name); dir != "." {
+		if err := os.MkdirAll(dir, 0o755); err != nil {
+			log.Fatalf("failed to create output directory: %v", err)
+		}
+	}
+	return name
+}
+
+// expandOutputTemplate fills in the placeholders of an output file name, failing on unknown ones
+func expandOutputTemplate(template string, now time.Time) string {
+	return outputPlaceholderPattern.ReplaceAllStringFunc(template, func(placeholder string) string {
+		var value string
+		switch name := strings.Trim(placeholder, "{}"); name {
+		case "start":
+			value = globalConfig.StartDate
+		case "end":
+			value = globalConfig.EndDate
+		case "month":
+			value = globalConfig.StartDate
+			if len(value) >= len("2006-01") {
+				value = value[:len("2006-01")]
+			}
+		case "date":
+			value = now.Format(time.DateOnly)
+		case "account":
+			value = "all"
+			if len(globalConfig.Accounts) == 1 && !globalConfig.Organization && options.inputFile == "" {
+				value = globalConfig.Accounts[0].Name
+			}
+		default:
+			log.Fatalf("unknown placeholder %s in output file name, use one of {%s}", placeholder, strings.Join(outputPlaceholders, "}, {"))
+		}
+		// Values become part of a file name, so separators are replaced
+		return strings.NewReplacer("/", "-", "\\", "-", " ", "-").Replace(value)
+	})
+}
+
+// unknownPlaceholders returns the placeholders of an output file name that aren't filled in
+func unknownPlaceholders(template string) []string {
+	var unknown []string
+	for _, match := range outputPlaceholderPattern.FindAllStringSubmatch(template, -1) {
+		if !slices.Contains(outputPlaceholders, match[1]) {
+			unknown = append(unknown, match[0])
+		}
+	}
+	return unknown
+}
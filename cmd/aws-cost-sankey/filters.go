@@ -0,0 +1,169 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"path"
+	"regexp"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Links lowered below this amount by a filter are removed
+const filterEpsilon = 0.005
+
+// applyFilters removes the nodes that are not included or are excluded at their level, together with the part
+// of the costs flowing through them, so that the diagram still adds up. Levels are named like in timeSeries.
+func applyFilters() error {
+	if len(globalConfig.Include) == 0 && len(globalConfig.Exclude) == 0 {
+		return nil
+	}
+	include, err := compilePatterns(globalConfig.Include)
+	if err != nil {
+		return err
+	}
+	exclude, err := compilePatterns(globalConfig.Exclude)
+	if err != nil {
+		return err
+	}
+
+	filter := func(data map[string]map[string]float64) {
+		for node, depth := range costgraph.Flows(data).Depths() {
+			if depth > 0 && !keepNode(node, depth, include, exclude) {
+				removeNode(data, node)
+			}
+		}
+	}
+	filter(results)
+	for _, data := range bucketResults {
+		filter(data)
+	}
+	for _, data := range accountResults {
+		filter(data)
+	}
+	return nil
+}
+
+// nodeMatcher reports whether a node name matches a pattern
+type nodeMatcher func(name string) bool
+
+// compilePatterns compiles the patterns per level. Patterns wrapped in slashes, e.g. "/^data-/", are regular expressions,
+// others are globs such as "data-*". Like paths, "*" doesn't match "/", so "acct1/prod" is matched by "*/prod".
+func compilePatterns(levels map[string][]string) (map[string][]nodeMatcher, error) {
+	compiled := make(map[string][]nodeMatcher)
+	for level, patterns := range levels {
+		for _, pattern := range patterns {
+			if err := checkPattern(pattern); err != nil {
+				return nil, fmt.Errorf("invalid pattern %q of level %s: %v", pattern, level, err)
+			}
+			if isRegexPattern(pattern) {
+				re := regexp.MustCompile(pattern[1 : len(pattern)-1])
+				compiled[level] = append(compiled[level], re.MatchString)
+				continue
+			}
+			compiled[level] = append(compiled[level], func(name string) bool {
+				matched, _ := path.Match(pattern, name)
+				return matched
+			})
+		}
+	}
+	return compiled, nil
+}
+
+// isRegexPattern reports whether a pattern is a regular expression wrapped in slashes rather than a glob
+func isRegexPattern(pattern string) bool {
+	return len(pattern) > 1 && strings.HasPrefix(pattern, "/") && strings.HasSuffix(pattern, "/")
+}
+
+// checkPattern returns the syntax error of a glob or regular expression pattern
+func checkPattern(pattern string) error {
+	if isRegexPattern(pattern) {
+		_, err := regexp.Compile(pattern[1 : len(pattern)-1])
+		return err
+	}
+	_, err := path.Match(pattern, "")
+	return err
+}
+
+// keepNode returns whether a node at the given depth passes the include and exclude lists of its level
+func keepNode(node string, depth int, include map[string][]nodeMatcher, exclude map[string][]nodeMatcher) bool {
+	matchers := func(levels map[string][]nodeMatcher) []nodeMatcher {
+		return append(append([]nodeMatcher{}, levels[levelName(depth)]...), levels[levelTitle(depth)]...)
+	}
+	matches := func(matchers []nodeMatcher) bool {
+		for _, match := range matchers {
+			if match(node) {
+				return true
+			}
+		}
+		return false
+	}
+
+	if included := matchers(include); len(included) > 0 && !matches(included) {
+		return false
+	}
+	return !matches(matchers(exclude))
+}
+
+// removeNode removes a node and subtracts the costs flowing through it from the links above and below.
+// Nodes with several parents or children share the subtraction in proportion to their links.
+func removeNode(data map[string]map[string]float64, node string) {
+	for parent, children := range data {
+		if cost, ok := children[node]; ok {
+			subtractUp(data, parent, node, cost)
+		}
+	}
+	for child, cost := range data[node] {
+		subtractDown(data, node, child, cost)
+	}
+	delete(data, node)
+}
+
+// subtractUp lowers the link from parent to child, and the links into the parent by the same amount
+func subtractUp(data map[string]map[string]float64, parent string, child string, cost float64) {
+	incoming, total := incomingLinks(data, parent)
+	lowerLink(data, parent, child, cost)
+	for grandparent, value := range incoming {
+		if total != 0 {
+			subtractUp(data, grandparent, parent, cost*value/total)
+		}
+	}
+}
+
+// subtractDown lowers the link from parent to child, and the links out of the child by the same share
+func subtractDown(data map[string]map[string]float64, parent string, child string, cost float64) {
+	_, total := incomingLinks(data, child)
+	lowerLink(data, parent, child, cost)
+	if total == 0 {
+		return
+	}
+	for grandchild, value := range data[child] {
+		subtractDown(data, child, grandchild, value*cost/total)
+	}
+}
+
+func incomingLinks(data map[string]map[string]float64, node string) (map[string]float64, float64) {
+	incoming := make(map[string]float64)
+	var total float64
+	for parent, children := range data {
+		if cost, ok := children[node]; ok {
+			incoming[parent] = cost
+			total += cost
+		}
+	}
+	return incoming, total
+}
+
+func lowerLink(data map[string]map[string]float64, parent string, child string, cost float64) {
+	if _, ok := data[parent][child]; !ok {
+		return
+	}
+	data[parent][child] -= cost
+	if math.Abs(data[parent][child]) < filterEpsilon {
+		delete(data[parent], child)
+		if len(data[parent]) == 0 {
+			delete(data, parent)
+		}
+	}
+}
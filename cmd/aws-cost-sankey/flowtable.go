@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"html/template"
+	"sort"
+	"strings"
+)
+
+type flowRow struct {
+	Source      string
+	Target      string
+	Level       string
+	Depth       int
+	Cost        float64
+	SourceShare float64
+	TotalShare  float64
+}
+
+// Sortable and filterable table of all flows, with the total of the visible rows of the shallowest level shown in the
+// footer, as the flows of deeper levels split the same costs again
+var flowTableTemplate = template.Must(template.New("flows").Funcs(template.FuncMap{
+	"amount":  func(amount float64) string { return formatCost(amount, 2) },
+	"percent": func(share float64) string { return formatAmount(share * 100) },
+}).Parse(`
+<div class="flows" style="max-width:1200px;margin:24px auto;font-family:sans-serif;font-size:14px;">
+  <h2>Flows, total {{amount .Total}}</h2>
+  <input id="flows-filter" type="search" placeholder="Filter" aria-label="Filter flows" style="width:300px;padding:4px;margin-bottom:8px;">
+  <table id="flows-table" style="width:100%;border-collapse:collapse;">
+    <thead>
+      <tr>
+        <th data-type="text" style="text-align:left;cursor:pointer;">Source</th>
+        <th data-type="text" style="text-align:left;cursor:pointer;">Target</th>
+        <th data-type="text" style="text-align:left;cursor:pointer;">Level</th>
+        <th data-type="number" style="text-align:right;cursor:pointer;">Cost</th>
+        <th data-type="number" style="text-align:right;cursor:pointer;">% of source</th>
+        <th data-type="number" style="text-align:right;cursor:pointer;">% of total</th>
+      </tr>
+    </thead>
+    <tbody>
+      {{- range .Rows}}
+      <tr data-depth="{{.Depth}}">
+        <td>{{.Source}}</td>
+        <td>{{.Target}}</td>
+        <td>{{.Level}}</td>
+        <td style="text-align:right;" data-value="{{.Cost}}">{{amount .Cost}}</td>
+        <td style="text-align:right;" data-value="{{.SourceShare}}">{{percent .SourceShare}}</td>
+        <td style="text-align:right;" data-value="{{.TotalShare}}">{{percent .TotalShare}}</td>
+      </tr>
+      {{- end}}
+    </tbody>
+    <tfoot>
+      <tr style="font-weight:bold;">
+        <td id="flows-level" colspan="3">Shown flows</td>
+        <td id="flows-cost" style="text-align:right;"></td>
+        <td></td>
+        <td id="flows-share" style="text-align:right;"></td>
+      </tr>
+    </tfoot>
+  </table>
+</div>
+<script type="text/javascript">
+  (function () {
+    const table = document.getElementById("flows-table");
+    const body = table.tBodies[0];
+    const total = {{.Total}};
+    const update = function () {
+      let depth = -1, cost = 0, level = "";
+      for (const row of body.rows) {
+        if (row.style.display === "none") {
+          continue;
+        }
+        const rowDepth = parseInt(row.dataset.depth);
+        if (depth < 0 || rowDepth < depth) {
+          depth = rowDepth;
+          cost = 0;
+          level = row.cells[2].textContent;
+        }
+        if (rowDepth === depth) {
+          cost += parseFloat(row.cells[3].dataset.value);
+        }
+      }
+      document.getElementById("flows-level").textContent = level ? "Shown flows of " + level : "Shown flows";
+      document.getElementById("flows-cost").textContent = cost.toFixed(2);
+      document.getElementById("flows-share").textContent = total ? (cost / total * 100).toFixed(2) : "";
+    };
+    document.getElementById("flows-filter").addEventListener("input", function (event) {
+      const filter = event.target.value.toLowerCase();
+      for (const row of body.rows) {
+        row.style.display = row.textContent.toLowerCase().includes(filter) ? "" : "none";
+      }
+      update();
+    });
+    table.tHead.querySelectorAll("th").forEach(function (header, column) {
+      header.addEventListener("click", function () {
+        const ascending = header.dataset.order !== "asc";
+        table.tHead.querySelectorAll("th").forEach(function (th) { delete th.dataset.order; });
+        header.dataset.order = ascending ? "asc" : "desc";
+        const rows = Array.from(body.rows);
+        rows.sort(function (a, b) {
+          const x = a.cells[column], y = b.cells[column];
+          const order = header.dataset.type === "number"
+            ? parseFloat(x.dataset.value) - parseFloat(y.dataset.value)
+            : x.textContent.localeCompare(y.textContent);
+          return ascending ? order : -order;
+        });
+        rows.forEach(function (row) { body.appendChild(row); });
+      });
+    });
+    update();
+  })();
+</script>
+`))
+
+// flowTable returns an HTML table of all flows, largest first, to be shown below the charts
+func flowTable() (string, error) {
+	graph := buildGraph()
+	depths := make(map[string]int)
+	for _, node := range graph.Nodes {
+		depths[node.Name] = node.Depth
+	}
+	outgoing := make(map[string]float64)
+	for _, link := range graph.Links {
+		outgoing[link.Source] += link.Value
+	}
+
+	rows := make([]flowRow, 0, len(graph.Links))
+	for _, link := range graph.Links {
+		rows = append(rows, flowRow{
+			Source:      link.Source,
+			Target:      link.Target,
+			Level:       levelTitle(depths[link.Target]),
+			Depth:       depths[link.Target],
+			Cost:        link.Value,
+			SourceShare: shareOf(link.Value, outgoing[link.Source]),
+			TotalShare:  shareOf(link.Value, graph.Total),
+		})
+	}
+	sort.SliceStable(rows, func(i, j int) bool { return rows[i].Cost > rows[j].Cost })
+
+	var sb strings.Builder
+	if err := flowTableTemplate.Execute(&sb, struct {
+		Total float64
+		Rows  []flowRow
+	}{graph.Total, rows}); err != nil {
+		return "", fmt.Errorf("failed to render flow table: %w", err)
+	}
+	return sb.String(), nil
+}
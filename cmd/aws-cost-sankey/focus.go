@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/fetch"
+)
+
+// FOCUSConfig lists FinOps Open Cost and Usage Specification exports merged into the diagram
+type FOCUSConfig struct {
+	Files      []string `yaml:"files"`
+	Columns    []string `yaml:"columns"`
+	CostColumn string   `yaml:"costColumn"`
+}
+
+var defaultFOCUSColumns = []string{"ProviderName", "SubAccountName", "ServiceName"}
+
+const defaultFOCUSCostColumn = "EffectiveCost"
+
+// focusProvider provides the costs of FOCUS exports of other providers
+type focusProvider struct{}
+
+// Fetch reads the configured FOCUS CSV or parquet files. Rows charged outside of the period are skipped.
+func (focusProvider) Fetch(_ context.Context, period costgraph.Period, _ []fetch.Level) (costgraph.Flows, error) {
+	focus := globalConfig.FOCUS
+	columns := focus.Columns
+	if len(columns) == 0 {
+		columns = defaultFOCUSColumns
+	}
+	costColumn := focus.CostColumn
+	if costColumn == "" {
+		costColumn = defaultFOCUSCostColumn
+	}
+
+	data := make(map[string]map[string]float64)
+	for _, filename := range focus.Files {
+		infof("Reading FOCUS data from %s", filename)
+
+		err := readTable(filename, func(row map[string]string) error {
+			if row[costColumn] == "" || !inDateRange(period, row["ChargePeriodStart"]) {
+				return nil
+			}
+			cost, err := strconv.ParseFloat(row[costColumn], 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse cost: %w", err)
+			}
+			if cost, err = convertCost(cost, row["BillingCurrency"]); err != nil {
+				return err
+			}
+
+			nodes := make([]string, len(columns))
+			for i, column := range columns {
+				nodes[i] = row[column]
+				if nodes[i] != "" && focusTagColumn(column) {
+					nodes[i] = accountNode(row["SubAccountId"], nodes[i])
+				}
+			}
+			addPath(data, nodes, cost)
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return roundFlows(data), nil
+}
+
+// focusTagColumn reports whether a column holds tags or custom values of the provider, prefixed with "x_" by the
+// specification, which are namespaced per sub account like the tags fetched from Cost Explorer
+func focusTagColumn(column string) bool {
+	return strings.HasPrefix(column, "Tags") || strings.HasPrefix(column, "x_")
+}
+
+// inDateRange checks whether a timestamp falls within the dates of the period.
+// Missing timestamps and dates are not filtered.
+func inDateRange(period costgraph.Period, timestamp string) bool {
+	if len(timestamp) < len("2006-01-02") {
+		return true
+	}
+	date := timestamp[:len("2006-01-02")]
+	if period.Start != "" && date < period.Start {
+		return false
+	}
+	if period.End != "" && date >= period.End {
+		return false
+	}
+	return true
+}
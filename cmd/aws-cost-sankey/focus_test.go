@@ -0,0 +1,52 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+func TestReadFOCUSKeepsEnvironmentsOfSubAccountsApart(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "focus.csv")
+	data := "ProviderName,SubAccountId,SubAccountName,x_Environment,ServiceName,EffectiveCost,ChargePeriodStart\n" +
+		"GCP,p1,project1,prod,Compute Engine,10,2024-10-01T00:00:00Z\n" +
+		"GCP,p2,project2,prod,Compute Engine,5,2024-10-02T00:00:00Z\n" +
+		"GCP,p2,project2,,Compute Engine,1,2024-10-03T00:00:00Z\n"
+	if err := os.WriteFile(filename, []byte(data), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, tt := range []struct {
+		merge bool
+		want  costgraph.Flows
+	}{
+		{false, costgraph.Flows{
+			"all":              {"GCP": 16},
+			"GCP":              {"project1": 10, "project2": 6},
+			"project1":         {"p1/prod": 10},
+			"project2":         {"p2/prod": 5, "project2-unknown": 1},
+			"p1/prod":          {"Compute Engine": 10},
+			"p2/prod":          {"Compute Engine": 5},
+			"project2-unknown": {"Compute Engine": 1},
+		}},
+		{true, costgraph.Flows{
+			"all":              {"GCP": 16},
+			"GCP":              {"project1": 10, "project2": 6},
+			"project1":         {"prod": 10},
+			"project2":         {"prod": 5, "project2-unknown": 1},
+			"prod":             {"Compute Engine": 15},
+			"project2-unknown": {"Compute Engine": 1},
+		}},
+	} {
+		setupFetchTest(t, Config{MergeAcrossAccounts: tt.merge, FOCUS: FOCUSConfig{
+			Files:   []string{filename},
+			Columns: []string{"ProviderName", "SubAccountName", "x_Environment", "ServiceName"},
+		}})
+		if err := fetchFrom(focusProvider{}, hierarchyLevels); err != nil {
+			t.Fatalf("fetchFrom() = %v", err)
+		}
+		checkResults(t, tt.want)
+	}
+}
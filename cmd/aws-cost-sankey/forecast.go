@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+const forecastDays = 30
+
+var forecastNode = fmt.Sprintf("Forecast (next %dd)", forecastDays)
+
+// Cost Explorer uses different names for the metrics of forecasts
+var forecastMetrics = map[string]types.Metric{
+	"AmortizedCost":    types.MetricAmortizedCost,
+	"BlendedCost":      types.MetricBlendedCost,
+	"UnblendedCost":    types.MetricUnblendedCost,
+	"NetAmortizedCost": types.MetricNetAmortizedCost,
+	"NetUnblendedCost": types.MetricNetUnblendedCost,
+}
+
+// fetchForecast adds the projected cost of the given account as a separate lane,
+// flowing from the forecast root node to "<account> (forecast)"
+func fetchForecast(accountName string, linkedAccountID string, svc costExplorerAPI) error {
+	infof("Fetching forecast for %s", accountName)
+
+	// Forecasts must start today at the earliest
+	start := time.Now().UTC()
+	end := start.AddDate(0, 0, forecastDays)
+
+	input := &costexplorer.GetCostForecastInput{
+		TimePeriod: &types.DateInterval{
+			Start: aws.String(start.Format(time.DateOnly)),
+			End:   aws.String(end.Format(time.DateOnly)),
+		},
+		Granularity: types.GranularityMonthly,
+		Metric:      forecastMetrics[globalConfig.Metric],
+		Filter:      combineFilters(linkedAccountFilters(linkedAccountID)),
+	}
+
+	result, err := svc.GetCostForecast(runContext, input)
+	if err != nil {
+		return fmt.Errorf("failed to get cost forecast: %w", err)
+	}
+	if result.Total == nil || result.Total.Amount == nil {
+		warnf("No forecast available for %s", accountName)
+		return nil
+	}
+
+	amount, err := strconv.ParseFloat(*result.Total.Amount, 64)
+	if err != nil {
+		return fmt.Errorf("failed to parse forecast amount: %w", err)
+	}
+	addResult(forecastNode, fmt.Sprintf("%s (forecast)", accountName), roundCost(amount))
+	return nil
+}
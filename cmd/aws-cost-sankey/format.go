@@ -0,0 +1,132 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"strings"
+
+	"github.com/go-echarts/go-echarts/v2/opts"
+	isocurrency "golang.org/x/text/currency"
+	"golang.org/x/text/language"
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// Locale of separators unless configured otherwise
+const defaultLocale = "en-US"
+
+// Decimals kept of fetched costs unless configured otherwise, i.e. cents
+const defaultPrecision = 2
+
+type NumberFormatConfig struct {
+	Locale    string `yaml:"locale"`
+	Symbol    string `yaml:"symbol"`
+	Decimals  *int   `yaml:"decimals"`
+	Precision *int   `yaml:"precision"`
+}
+
+// roundCost rounds a fetched cost to the configured precision, so that small line items are kept while
+// floating point noise of the data sources is not. Display rounding is configured by decimals instead.
+func roundCost(cost float64) float64 {
+	precision := defaultPrecision
+	if globalConfig.NumberFormat.Precision != nil {
+		precision = *globalConfig.NumberFormat.Precision
+	}
+	scale := math.Pow10(precision)
+	return math.Round(cost*scale) / scale
+}
+
+// checkLocale fails on an unknown locale before any cost is fetched
+func checkLocale() error {
+	if locale := globalConfig.NumberFormat.Locale; locale != "" {
+		if _, err := language.Parse(locale); err != nil {
+			return fmt.Errorf("unknown locale %s: %v", locale, err)
+		}
+	}
+	return nil
+}
+
+// numberLocale returns the configured locale used for thousands and decimal separators, checked by checkLocale
+func numberLocale() language.Tag {
+	locale := globalConfig.NumberFormat.Locale
+	if locale == "" {
+		locale = defaultLocale
+	}
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return language.MustParse(defaultLocale)
+	}
+	return tag
+}
+
+// currencySymbol returns the configured symbol, or the symbol of the currency reported by the data source,
+// e.g. "$" for USD or "€" for EUR. Currencies without a known symbol are shown by their code.
+func currencySymbol() string {
+	if globalConfig.NumberFormat.Symbol != "" {
+		return globalConfig.NumberFormat.Symbol
+	}
+	unit, err := isocurrency.ParseISO(currency)
+	if err != nil {
+		return currency + " "
+	}
+	symbol := message.NewPrinter(numberLocale()).Sprint(isocurrency.NarrowSymbol(unit))
+	if symbol == unit.String() {
+		return symbol + " "
+	}
+	return symbol
+}
+
+// costDecimals returns the configured precision, or the given default of the output
+func costDecimals(decimals int) int {
+	if globalConfig.NumberFormat.Decimals != nil {
+		return *globalConfig.NumberFormat.Decimals
+	}
+	return decimals
+}
+
+// formatCost formats an amount for people to read, e.g. "$12,340" or "-€1.234,50".
+// Outputs meant to be read back or processed by other tools use formatAmount instead.
+func formatCost(amount float64, decimals int) string {
+	decimals = costDecimals(decimals)
+	sign := ""
+	if math.Round(amount*math.Pow10(decimals)) < 0 {
+		sign = "-"
+	}
+	text := message.NewPrinter(numberLocale()).Sprint(number.Decimal(math.Abs(amount), number.MinFractionDigits(decimals), number.MaxFractionDigits(decimals)))
+	return sign + currencySymbol() + text
+}
+
+// costFormatter returns an echarts formatter function for an echarts template such as "{c} {b}",
+// formatting the value {c} like formatCost in the browser
+func costFormatter(template string) string {
+	return string(opts.FuncOpts(fmt.Sprintf("function (params) { return %s; }", costTemplate(template))))
+}
+
+// costTemplate returns the JavaScript expression of a formatter template, with {b} and {c} replaced by the name and cost
+func costTemplate(template string) string {
+	js := jsString(template)
+	js = strings.ReplaceAll(js, "{b}", "' + params.name + '")
+	return strings.ReplaceAll(js, "{c}", "' + "+costExpression()+" + '")
+}
+
+// costExpression returns the JavaScript expression formatting params.value like formatCost
+func costExpression() string {
+	return fmt.Sprintf("(params.value < 0 ? '-' : '') + %s + new Intl.NumberFormat(%s, {minimumFractionDigits: %d, maximumFractionDigits: %d}).format(Math.abs(params.value))",
+		jsString(currencySymbol()), jsString(numberLocale().String()), costDecimals(0), costDecimals(0))
+}
+
+// percentOfParent returns the share of a link in the outgoing cost of its source, e.g. "37%"
+func percentOfParent(cost float64, parentTotal float64) string {
+	if parentTotal == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%.0f%%", cost/parentTotal*100)
+}
+
+// jsString quotes text as a JavaScript string. Functions end up JSON encoded in the page and stripped of newlines,
+// so single quotes and newlines are built from their character codes instead of being escaped.
+func jsString(text string) string {
+	text = strings.ReplaceAll(text, "'", "' + String.fromCharCode(39) + '")
+	text = strings.ReplaceAll(text, "\n", "' + String.fromCharCode(10) + '")
+	return "'" + text + "'"
+}
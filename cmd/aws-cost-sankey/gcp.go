@@ -0,0 +1,241 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/json"
+	"encoding/pem"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/fetch"
+)
+
+// GCPConfig locates the standard Cloud Billing export table in BigQuery
+type GCPConfig struct {
+	ProjectID       string `yaml:"projectId"`
+	Table           string `yaml:"table"`
+	Location        string `yaml:"location"`
+	CredentialsFile string `yaml:"credentialsFile"`
+	AccessToken     string `yaml:"accessToken"`
+}
+
+const (
+	bigQueryScope   = "https://www.googleapis.com/auth/bigquery.readonly"
+	bigQueryTimeout = 10 * time.Second
+)
+
+// Net cost including credits, broken down by project, service and SKU
+const gcpBillingQuery = `SELECT
+  IFNULL(project.name, '') AS project,
+  service.description AS service,
+  sku.description AS sku,
+  SUM(cost) + SUM(IFNULL((SELECT SUM(c.amount) FROM UNNEST(credits) c), 0)) AS cost,
+  currency
+FROM ` + "`%s`" + `
+WHERE usage_start_time >= TIMESTAMP('%s') AND usage_start_time < TIMESTAMP('%s')
+GROUP BY 1, 2, 3, 5`
+
+// gcpProvider provides the costs of the GCP billing export in BigQuery
+type gcpProvider struct{}
+
+// Fetch queries the GCP billing export and adds it below the "GCP" node
+func (gcpProvider) Fetch(ctx context.Context, period costgraph.Period, _ []fetch.Level) (costgraph.Flows, error) {
+	gcp := globalConfig.GCP
+	infof("Fetching data from BigQuery table %s", gcp.Table)
+
+	token, err := gcpAccessToken()
+	if err != nil {
+		return nil, err
+	}
+	query := fmt.Sprintf(gcpBillingQuery, gcp.Table, period.Start, period.End)
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"query":        query,
+		"useLegacySql": false,
+		"timeoutMs":    bigQueryTimeout.Milliseconds(),
+		"location":     gcp.Location,
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	response, err := bigQueryRequest(ctx, "POST", fmt.Sprintf("https://bigquery.googleapis.com/bigquery/v2/projects/%s/queries", gcp.ProjectID), token, requestBody)
+	if err != nil {
+		return nil, err
+	}
+	jobReference, _ := response["jobReference"].(map[string]interface{})
+	jobID, _ := jobReference["jobId"].(string)
+	location, _ := jobReference["location"].(string)
+
+	// Keep polling until the job completes, then follow the result pages
+	flows := make(costgraph.Flows)
+	for {
+		if complete, _ := response["jobComplete"].(bool); complete {
+			if err := addGCPRows(flows, response); err != nil {
+				return flows, err
+			}
+			pageToken, _ := response["pageToken"].(string)
+			if pageToken == "" {
+				break
+			}
+			response, err = bigQueryResults(ctx, gcp.ProjectID, jobID, location, pageToken, token)
+		} else {
+			response, err = bigQueryResults(ctx, gcp.ProjectID, jobID, location, "", token)
+		}
+		if err != nil {
+			return flows, err
+		}
+	}
+	return flows, nil
+}
+
+func addGCPRows(flows costgraph.Flows, response map[string]interface{}) error {
+	rows, _ := response["rows"].([]interface{})
+	for _, r := range rows {
+		fields, _ := r.(map[string]interface{})["f"].([]interface{})
+		values := make([]string, len(fields))
+		for i, field := range fields {
+			values[i], _ = field.(map[string]interface{})["v"].(string)
+		}
+		if len(values) < 5 {
+			return fmt.Errorf("unexpected BigQuery row: %v", values)
+		}
+
+		cost, err := strconv.ParseFloat(values[3], 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse cost: %v", err)
+		}
+		if cost, err = convertCost(cost, values[4]); err != nil {
+			return err
+		}
+		addPath(flows, append([]string{"GCP"}, values[:3]...), roundCost(cost))
+	}
+	return nil
+}
+
+func bigQueryResults(ctx context.Context, projectID string, jobID string, location string, pageToken string, token string) (map[string]interface{}, error) {
+	query := url.Values{}
+	query.Set("timeoutMs", strconv.FormatInt(bigQueryTimeout.Milliseconds(), 10))
+	if location != "" {
+		query.Set("location", location)
+	}
+	if pageToken != "" {
+		query.Set("pageToken", pageToken)
+	}
+	return bigQueryRequest(ctx, "GET", fmt.Sprintf("https://bigquery.googleapis.com/bigquery/v2/projects/%s/queries/%s?%s", projectID, jobID, query.Encode()), token, nil)
+}
+
+func bigQueryRequest(ctx context.Context, method string, endpoint string, token string, requestBody []byte) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, method, endpoint, bytes.NewBuffer(requestBody))
+	if err != nil {
+		return nil, fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", token))
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("BigQuery request failed with %s: %s", resp.Status, body)
+	}
+
+	var responseBody map[string]interface{}
+	if err := json.Unmarshal(body, &responseBody); err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %v", err)
+	}
+	return responseBody, nil
+}
+
+// gcpAccessToken returns the configured access token,
+// or exchanges a signed JWT of the service account for one
+func gcpAccessToken() (string, error) {
+	gcp := globalConfig.GCP
+	if gcp.AccessToken != "" {
+		return gcp.AccessToken, nil
+	}
+	if gcp.CredentialsFile == "" {
+		return "", fmt.Errorf("either accessToken or credentialsFile is required for GCP")
+	}
+
+	data, err := os.ReadFile(gcp.CredentialsFile)
+	if err != nil {
+		return "", fmt.Errorf("failed to read GCP credentials: %v", err)
+	}
+	var serviceAccount struct {
+		ClientEmail string `json:"client_email"`
+		PrivateKey  string `json:"private_key"`
+		TokenURI    string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(data, &serviceAccount); err != nil {
+		return "", fmt.Errorf("failed to decode GCP credentials: %v", err)
+	}
+
+	block, _ := pem.Decode([]byte(serviceAccount.PrivateKey))
+	if block == nil {
+		return "", fmt.Errorf("no private key in GCP credentials")
+	}
+	key, err := x509.ParsePKCS8PrivateKey(block.Bytes)
+	if err != nil {
+		return "", fmt.Errorf("failed to parse GCP private key: %v", err)
+	}
+	rsaKey, ok := key.(*rsa.PrivateKey)
+	if !ok {
+		return "", fmt.Errorf("GCP private key is not an RSA key")
+	}
+
+	now := time.Now()
+	header, _ := json.Marshal(map[string]string{"alg": "RS256", "typ": "JWT"})
+	claims, _ := json.Marshal(map[string]interface{}{
+		"iss":   serviceAccount.ClientEmail,
+		"scope": bigQueryScope,
+		"aud":   serviceAccount.TokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	unsigned := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(unsigned))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, rsaKey, crypto.SHA256, digest[:])
+	if err != nil {
+		return "", fmt.Errorf("failed to sign GCP token request: %v", err)
+	}
+	assertion := unsigned + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", assertion)
+	resp, err := http.Post(serviceAccount.TokenURI, "application/x-www-form-urlencoded", strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", fmt.Errorf("failed to request GCP access token: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var tokenResponse struct {
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.NewDecoder(resp.Body).Decode(&tokenResponse); err != nil || tokenResponse.AccessToken == "" {
+		return "", fmt.Errorf("failed to obtain GCP access token: %s", resp.Status)
+	}
+	return tokenResponse.AccessToken, nil
+}
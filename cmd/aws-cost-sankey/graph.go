@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+	"time"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/render"
+)
+
+// Currency of the cost data as reported by the data source
+var currency = "USD"
+
+// buildGraph returns the JSON graph of the costs along with the period and details of the run
+func buildGraph() costgraph.Graph {
+	graph := costgraph.New(results)
+	graph.Period = costgraph.Period{Start: globalConfig.StartDate, End: globalConfig.EndDate}
+	graph.Currency = currency
+	graph.Metric = globalConfig.Metric
+	graph.Threshold = globalConfig.Threshold
+	graph.Metadata = map[string]string{
+		"generator":   "aws-cost-sankey",
+		"generatedAt": time.Now().UTC().Format(time.RFC3339),
+		"granularity": globalConfig.Granularity,
+	}
+	graph.Comparison = graphComparison()
+	// Costs converted to the reporting currency keep their source currencies
+	if len(sourceCurrencies) > 0 {
+		graph.Metadata["sourceCurrencies"], graph.Metadata["exchangeRates"] = exchangeMetadata()
+	}
+	return graph
+}
+
+// validateGraph stops before rendering if the costs contain a cycle, which renderers can't lay out.
+// Cycles come from malformed input files or nodes of the same name on different levels.
+func validateGraph() error {
+	if cycle := results.FindCycle(); cycle != nil {
+		return fmt.Errorf("cycle in cost graph: %s. Rename one of the nodes to break it", strings.Join(cycle, " -> "))
+	}
+	return nil
+}
+
+// generateJSON writes the graph to the output file, or to stdout when the output file is -
+func generateJSON(outputFile string) error {
+	infof("Generating JSON output...")
+
+	var buf bytes.Buffer
+	if err := render.JSON(&buf, buildGraph()); err != nil {
+		return fmt.Errorf("failed to render graph: %w", err)
+	}
+	if outputFile == stdioName {
+		buf.WriteByte('\n')
+	}
+	if err := writeOutputFile(outputFile, buf.Bytes()); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+func isJSONInput(inputFile string) bool {
+	return strings.HasSuffix(inputFile, ".json") || (inputFile == stdioName && stdinFormat() == "json")
+}
+
+// readJSONData reads links from a JSON graph.
+// The period and currency of the graph are used unless configured otherwise.
+func readJSONData(inputFile string) error {
+	infof("Reading JSON graph from %s", inputFile)
+
+	data, err := readInputFile(inputFile)
+	if err != nil {
+		return err
+	}
+
+	graph, err := costgraph.Parse(data)
+	if err != nil {
+		return err
+	}
+	if err := convertLinks(map[string]map[string]map[string]float64{graph.Currency: graph.Flows()}); err != nil {
+		return err
+	}
+	if globalConfig.StartDate == "" && globalConfig.EndDate == "" {
+		globalConfig.StartDate = graph.Period.Start
+		globalConfig.EndDate = graph.Period.End
+	}
+	if graph.Currency != "" && globalConfig.Exchange.Currency == "" {
+		currency = graph.Currency
+	}
+	return nil
+}
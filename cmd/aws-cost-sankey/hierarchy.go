@@ -0,0 +1,227 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+	"sync"
+
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+
+	"aws-costexplorer/pkg/fetch"
+)
+
+const (
+	LevelAccount      = fetch.LevelAccount
+	LevelTag          = fetch.LevelTag
+	LevelDimension    = fetch.LevelDimension
+	LevelCostCategory = fetch.LevelCostCategory
+)
+
+// Suffix of the nodes of untagged or uncategorized costs, e.g. "acct1-unknown"
+const unknownSuffix = "-unknown"
+
+var defaultHierarchy = []string{"account", "tag:environment", "dimension:SERVICE"}
+
+// Levels of the diagram below the root: the fetched hierarchy with the region and usage type of -r and -d, and the
+// team level if any. Set by setupRun.
+var hierarchyLevels []Level
+
+// Level is a single level of the sankey diagram below the "all" root node
+type Level struct {
+	Type string
+	Key  string
+}
+
+func (l Level) String() string {
+	if l.Type == LevelAccount {
+		return l.Type
+	}
+	// Levels inserted after fetching, e.g. teams, have no type
+	if l.Type == "" {
+		return l.Key
+	}
+	return fmt.Sprintf("%s:%s", l.Type, l.Key)
+}
+
+// title returns the level without its type, e.g. "environment" for "tag:environment"
+func (l Level) title() string {
+	if l.Type == LevelAccount {
+		return l.Type
+	}
+	return l.Key
+}
+
+// parseHierarchy parses level specs such as "account", "tag:environment", "costCategory:team" or "dimension:SERVICE".
+// In dev mode the SERVICE dimension is replaced by USAGE_TYPE.
+func parseHierarchy(spec []string, devMode bool) ([]Level, error) {
+	if len(spec) == 0 {
+		spec = defaultHierarchy
+	}
+
+	hierarchy := make([]Level, 0, len(spec))
+	for _, s := range spec {
+		if s == LevelAccount {
+			hierarchy = append(hierarchy, Level{Type: LevelAccount})
+			continue
+		}
+
+		levelType, key, ok := strings.Cut(s, ":")
+		if !ok || key == "" {
+			return nil, fmt.Errorf("invalid hierarchy level: %s", s)
+		}
+		switch levelType {
+		case LevelTag, LevelCostCategory:
+		case LevelDimension:
+			key = strings.ToUpper(key)
+			if devMode && key == string(types.DimensionService) {
+				key = string(types.DimensionUsageType)
+			}
+		default:
+			return nil, fmt.Errorf("unknown hierarchy level type: %s", levelType)
+		}
+		hierarchy = append(hierarchy, Level{Type: levelType, Key: key})
+	}
+
+	return hierarchy, nil
+}
+
+// applyRegion adds the REGION dimension to the hierarchy.
+// "level" inserts it right above the service level, "replace" shows it instead of the service level.
+// If the hierarchy has no service level, region is appended as the last level.
+func applyRegion(hierarchy []Level, mode string) ([]Level, error) {
+	if mode == "" {
+		return hierarchy, nil
+	}
+	if mode != "level" && mode != "replace" {
+		return nil, fmt.Errorf("unknown region mode: %s", mode)
+	}
+
+	region := Level{Type: LevelDimension, Key: string(types.DimensionRegion)}
+	for i, level := range hierarchy {
+		if level.Type != LevelDimension || (level.Key != string(types.DimensionService) && level.Key != string(types.DimensionUsageType)) {
+			continue
+		}
+		result := append([]Level{}, hierarchy[:i]...)
+		result = append(result, region)
+		if mode == "level" {
+			result = append(result, level)
+		}
+		return append(result, hierarchy[i+1:]...), nil
+	}
+	return append(hierarchy, region), nil
+}
+
+// fetchLevels returns the hierarchy as the levels of pkg/fetch
+func fetchLevels(hierarchy []Level) []fetch.Level {
+	levels := make([]fetch.Level, 0, len(hierarchy))
+	for _, level := range hierarchy {
+		levels = append(levels, fetch.Level(level))
+	}
+	return levels
+}
+
+// nodeName turns a group key into a sankey node name.
+// Tag and cost category values below an account are prefixed with the account, see accountNode.
+// Untagged or uncategorized costs are attributed to "<parent>-unknown".
+func (l Level) nodeName(groupKey string, parent string, account string) string {
+	if l.Type == LevelTag || l.Type == LevelCostCategory {
+		if value := tagValue(groupKey); value != "" {
+			return accountNode(account, value)
+		}
+		return unknownNode(parent)
+	}
+	return groupKey
+}
+
+// unknownNode returns the node of untagged or uncategorized costs below the parent
+func unknownNode(parent string) string {
+	return parent + unknownSuffix
+}
+
+func isUnknownNode(node string) bool {
+	return strings.HasSuffix(node, unknownSuffix)
+}
+
+// accountNode returns the name of a tag or cost category node of an account, e.g. "acct1/prod", so that
+// environments of the same name in different accounts aren't merged unless mergeAcrossAccounts is set
+func accountNode(account string, name string) string {
+	if account == "" || globalConfig.MergeAcrossAccounts {
+		return name
+	}
+	return fmt.Sprintf("%s/%s", account, name)
+}
+
+// Names a node name was placed under at each depth, and the title of each depth, so that names used on several
+// levels aren't merged
+var (
+	nodeLevelsMu sync.Mutex
+	nodeLevels   = map[string]map[int]string{"all": {0: "all"}}
+	levelTitles  = make(map[int]string)
+)
+
+// levelNode returns the name of a node at the given depth. A name already placed at another depth,
+// e.g. a service named like an environment, gets the title of its level appended, e.g. "EC2 (SERVICE)".
+// Accounts are fetched concurrently, so separateLevels settles which level keeps the name once all are fetched.
+func levelNode(name string, depth int, title string) string {
+	nodeLevelsMu.Lock()
+	defer nodeLevelsMu.Unlock()
+
+	levelTitles[depth] = title
+	placed, ok := nodeLevels[name]
+	if !ok {
+		placed = make(map[int]string)
+		nodeLevels[name] = placed
+	}
+	if node, ok := placed[depth]; ok {
+		return node
+	}
+	node := name
+	if len(placed) > 0 {
+		node = fmt.Sprintf("%s (%s)", name, title)
+	}
+	placed[depth] = node
+	return node
+}
+
+// separateLevels gives the name of nodes placed on several levels to the shallowest level and the title of their
+// level to the deeper ones, whichever account placed them first, so that aliases, colors and budgets of the name
+// always apply to the same node
+func separateLevels() {
+	nodeLevelsMu.Lock()
+	defer nodeLevelsMu.Unlock()
+
+	renames := make(map[string]string)
+	for name, placed := range nodeLevels {
+		if len(placed) < 2 {
+			continue
+		}
+		shallowest := -1
+		for depth := range placed {
+			if shallowest < 0 || depth < shallowest {
+				shallowest = depth
+			}
+		}
+		for depth, node := range placed {
+			want := name
+			if depth != shallowest {
+				want = fmt.Sprintf("%s (%s)", name, levelTitles[depth])
+			}
+			if node != want {
+				renames[node] = want
+				placed[depth] = want
+			}
+		}
+	}
+	if len(renames) > 0 {
+		renameNodes(renames)
+	}
+}
+
+// Tag and cost category group keys are returned as "key$value"
+func tagValue(groupKey string) string {
+	return fetch.TagValue(groupKey)
+}
+
+func combineFilters(filters []types.Expression) *types.Expression {
+	return fetch.CombineFilters(filters)
+}
@@ -0,0 +1,24 @@
+package main
+
+import (
+	"testing"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+func TestSeparateLevelsKeepsNameOnShallowestLevel(t *testing.T) {
+	setupFetchTest(t, Config{})
+	// The service is placed before the environment of the same name, as a concurrent account may do
+	service := levelNode("EC2", 2, "SERVICE")
+	addCost(results, "acct1", service, 10)
+	environment := levelNode("EC2", 1, "environment")
+	addCost(results, "all", environment, 20)
+	addCost(results, environment, levelNode("AWS Lambda", 2, "SERVICE"), 20)
+	separateLevels()
+
+	checkResults(t, costgraph.Flows{
+		"all":   {"EC2": 20},
+		"acct1": {"EC2 (SERVICE)": 10},
+		"EC2":   {"AWS Lambda": 20},
+	})
+}
@@ -0,0 +1,202 @@
+package main
+
+import (
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	_ "modernc.org/sqlite"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Number of earlier periods used by anomaly detection and forecasts unless configured otherwise
+const defaultHistoryPeriods = 6
+
+// Schema of the history store. Each run is appended with its period, and its flows refer to the run.
+// Flows of the whole period have an empty bucket, flows of time buckets carry the start of the bucket.
+const historySchema = `
+CREATE TABLE IF NOT EXISTS runs (
+	id           INTEGER PRIMARY KEY AUTOINCREMENT,
+	run_at       TEXT NOT NULL,
+	period_start TEXT NOT NULL,
+	period_end   TEXT NOT NULL,
+	metric       TEXT NOT NULL,
+	granularity  TEXT NOT NULL,
+	currency     TEXT NOT NULL
+);
+CREATE TABLE IF NOT EXISTS flows (
+	run_id       INTEGER NOT NULL REFERENCES runs(id),
+	bucket       TEXT NOT NULL,
+	source       TEXT NOT NULL,
+	target       TEXT NOT NULL,
+	source_level TEXT NOT NULL,
+	target_level TEXT NOT NULL,
+	amount       REAL NOT NULL
+);
+CREATE INDEX IF NOT EXISTS flows_run ON flows(run_id);
+CREATE INDEX IF NOT EXISTS runs_period ON runs(period_start, period_end);
+`
+
+// appendHistory appends the flows of this run to the SQLite history file, creating it if needed.
+// The file can also be queried from DuckDB through its sqlite extension.
+func appendHistory(historyFile string) error {
+	infof("Appending run to history %s", historyFile)
+
+	db, err := openHistory(historyFile)
+	if err != nil {
+		return err
+	}
+	defer db.Close()
+
+	tx, err := db.Begin()
+	if err != nil {
+		return fmt.Errorf("failed to start transaction: %v", err)
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`INSERT INTO runs (run_at, period_start, period_end, metric, granularity, currency) VALUES (?, ?, ?, ?, ?, ?)`,
+		time.Now().UTC().Format(time.RFC3339), globalConfig.StartDate, globalConfig.EndDate, globalConfig.Metric, globalConfig.Granularity, currency)
+	if err != nil {
+		return fmt.Errorf("failed to insert run: %v", err)
+	}
+	runID, err := result.LastInsertId()
+	if err != nil {
+		return fmt.Errorf("failed to insert run: %v", err)
+	}
+
+	stmt, err := tx.Prepare(`INSERT INTO flows (run_id, bucket, source, target, source_level, target_level, amount) VALUES (?, ?, ?, ?, ?, ?, ?)`)
+	if err != nil {
+		return fmt.Errorf("failed to prepare statement: %v", err)
+	}
+	defer stmt.Close()
+
+	insertFlows := func(bucket string, data map[string]map[string]float64) error {
+		depths := costgraph.Flows(data).Depths()
+		for parent, children := range data {
+			for child, cost := range children {
+				if _, err := stmt.Exec(runID, bucket, parent, child, metricsLevel(depths[parent]), metricsLevel(depths[child]), cost); err != nil {
+					return fmt.Errorf("failed to insert flow: %v", err)
+				}
+			}
+		}
+		return nil
+	}
+	if err := insertFlows("", results); err != nil {
+		return err
+	}
+	for _, bucket := range sortedBuckets() {
+		if err := insertFlows(bucket, bucketResults[bucket]); err != nil {
+			return err
+		}
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("failed to commit history: %v", err)
+	}
+	return nil
+}
+
+// openHistory opens the SQLite history file, creating it and its schema if needed
+func openHistory(historyFile string) (*sql.DB, error) {
+	db, err := sql.Open("sqlite", historyFile)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open history: %v", err)
+	}
+	if _, err := db.Exec(historySchema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("failed to create history schema: %v", err)
+	}
+	return db, nil
+}
+
+// earlierHistory returns the latest runs of the given number of periods ending before this run, most recent first,
+// with their flows, as compared by anomaly detection and forecasts
+func earlierHistory(historyFile string, periods int) ([]int64, map[string]map[string]map[int64]float64, error) {
+	db, err := openHistory(historyFile)
+	if err != nil {
+		return nil, nil, err
+	}
+	defer db.Close()
+
+	runIDs, err := earlierRuns(db, periods)
+	if err != nil || len(runIDs) == 0 {
+		return nil, nil, err
+	}
+	flows, err := runFlows(db, runIDs)
+	return runIDs, flows, err
+}
+
+// earlierRuns returns the latest run of each of the given number of periods ending before this run, most recent first.
+// Only runs with the same metric, granularity and currency are comparable.
+func earlierRuns(db *sql.DB, periods int) ([]int64, error) {
+	rows, err := db.Query(`SELECT MAX(id) FROM runs WHERE metric = ? AND granularity = ? AND currency = ? AND period_end <= ?
+		GROUP BY period_start, period_end ORDER BY period_start DESC LIMIT ?`,
+		globalConfig.Metric, globalConfig.Granularity, currency, globalConfig.StartDate, periods)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %v", err)
+	}
+	defer rows.Close()
+
+	var runIDs []int64
+	for rows.Next() {
+		var runID int64
+		if err := rows.Scan(&runID); err != nil {
+			return nil, fmt.Errorf("failed to read history: %v", err)
+		}
+		runIDs = append(runIDs, runID)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %v", err)
+	}
+	return runIDs, nil
+}
+
+// runPeriods returns the start of the period of each run
+func runPeriods(db *sql.DB, runIDs []int64) (map[int64]string, error) {
+	periods := make(map[int64]string)
+	for _, runID := range runIDs {
+		var start string
+		if err := db.QueryRow(`SELECT period_start FROM runs WHERE id = ?`, runID).Scan(&start); err != nil {
+			return nil, fmt.Errorf("failed to read history: %v", err)
+		}
+		periods[runID] = start
+	}
+	return periods, nil
+}
+
+// runFlows returns the flows of the whole period of the given runs, keyed by source, target and run
+func runFlows(db *sql.DB, runIDs []int64) (map[string]map[string]map[int64]float64, error) {
+	args := make([]interface{}, 0, len(runIDs))
+	for _, runID := range runIDs {
+		args = append(args, runID)
+	}
+	placeholders := strings.TrimSuffix(strings.Repeat("?, ", len(runIDs)), ", ")
+	rows, err := db.Query(`SELECT run_id, source, target, amount FROM flows WHERE bucket = '' AND run_id IN (`+placeholders+`)`, args...)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query history: %v", err)
+	}
+	defer rows.Close()
+
+	flows := make(map[string]map[string]map[int64]float64)
+	for rows.Next() {
+		var runID int64
+		var source, target string
+		var amount float64
+		if err := rows.Scan(&runID, &source, &target, &amount); err != nil {
+			return nil, fmt.Errorf("failed to read history: %v", err)
+		}
+		if _, ok := flows[source]; !ok {
+			flows[source] = make(map[string]map[int64]float64)
+		}
+		if _, ok := flows[source][target]; !ok {
+			flows[source][target] = make(map[int64]float64)
+		}
+		flows[source][target][runID] += amount
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read history: %v", err)
+	}
+	return flows, nil
+}
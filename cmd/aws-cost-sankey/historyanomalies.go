@@ -0,0 +1,154 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"strings"
+)
+
+// HistoryAnomalyConfig flags flows that deviate from their trailing average in the history file,
+// by more than a number of standard deviations, a percentage, or either when both are set
+type HistoryAnomalyConfig struct {
+	Periods    int     `yaml:"periods"`
+	Deviations float64 `yaml:"deviations"`
+	Percent    float64 `yaml:"percent"`
+}
+
+func (c HistoryAnomalyConfig) enabled() bool {
+	return c.Deviations > 0 || c.Percent > 0
+}
+
+type flowAnomaly struct {
+	source, target string
+	current        float64
+	mean           float64
+	stddev         float64
+	periods        int
+}
+
+// Flows deviating from their trailing average, ordered by the size of the deviation
+var flowAnomalies []flowAnomaly
+
+// validateHistoryAnomalies checks the anomaly options before any cost is fetched
+func validateHistoryAnomalies() error {
+	config := &globalConfig.HistoryAnomalies
+	if config.Periods < 0 || config.Deviations < 0 || config.Percent < 0 {
+		return fmt.Errorf("historyAnomalies periods, deviations and percent can't be negative")
+	}
+	if !config.enabled() {
+		return nil
+	}
+	if globalConfig.HistoryFile == "" {
+		return fmt.Errorf("historyAnomalies requires a historyFile")
+	}
+	if config.Periods == 0 {
+		config.Periods = defaultHistoryPeriods
+	}
+	return nil
+}
+
+// detectHistoryAnomalies compares the flows of this run with their average over the latest runs of earlier periods
+// with the same metric, granularity and currency. Flows missing from a period count as zero.
+// It runs before this run is appended so that the average only covers earlier periods.
+func detectHistoryAnomalies(historyFile string) error {
+	config := globalConfig.HistoryAnomalies
+	infof("Detecting anomalies against %d periods of %s", config.Periods, historyFile)
+
+	runIDs, history, err := earlierHistory(historyFile, config.Periods)
+	if err != nil {
+		return err
+	}
+	if len(runIDs) == 0 {
+		warnf("No earlier periods in %s, skipping anomaly detection", historyFile)
+		return nil
+	}
+
+	flowAnomalies = nil
+	periods := len(runIDs)
+	check := func(source string, target string) {
+		current := results[source][target]
+		var mean, variance float64
+		for _, runID := range runIDs {
+			mean += history[source][target][runID]
+		}
+		mean /= float64(periods)
+		for _, runID := range runIDs {
+			variance += math.Pow(history[source][target][runID]-mean, 2)
+		}
+		stddev := math.Sqrt(variance / float64(periods))
+
+		// Flows below the threshold in both periods are noise
+		delta := math.Abs(current - mean)
+		if math.Max(current, mean) < globalConfig.Threshold || delta < filterEpsilon {
+			return
+		}
+		byDeviations := config.Deviations > 0 && stddev > 0 && delta > config.Deviations*stddev
+		byPercent := config.Percent > 0 && (mean == 0 || delta/math.Abs(mean)*100 > config.Percent)
+		if byDeviations || byPercent {
+			flowAnomalies = append(flowAnomalies, flowAnomaly{source, target, current, mean, stddev, periods})
+		}
+	}
+	for source, targets := range results {
+		for target := range targets {
+			check(source, target)
+		}
+	}
+	for source, targets := range history {
+		for target := range targets {
+			if _, ok := results[source][target]; !ok {
+				check(source, target)
+			}
+		}
+	}
+
+	sort.Slice(flowAnomalies, func(i, j int) bool {
+		di, dj := math.Abs(flowAnomalies[i].current-flowAnomalies[i].mean), math.Abs(flowAnomalies[j].current-flowAnomalies[j].mean)
+		if di != dj {
+			return di > dj
+		}
+		if flowAnomalies[i].source != flowAnomalies[j].source {
+			return flowAnomalies[i].source < flowAnomalies[j].source
+		}
+		return flowAnomalies[i].target < flowAnomalies[j].target
+	})
+	return nil
+}
+
+// describe returns the deviation of the flow, e.g. "$1,200.00 vs average $700.00 over 6 periods (+71%, 3.2σ)"
+func (a flowAnomaly) describe() string {
+	var change []string
+	if a.mean != 0 {
+		change = append(change, fmt.Sprintf("%+.0f%%", (a.current-a.mean)/math.Abs(a.mean)*100))
+	}
+	if a.stddev != 0 {
+		change = append(change, fmt.Sprintf("%.1fσ", (a.current-a.mean)/a.stddev))
+	}
+	text := fmt.Sprintf("%s vs average %s over %d periods", formatCost(a.current, 2), formatCost(a.mean, 2), a.periods)
+	if len(change) > 0 {
+		text += fmt.Sprintf(" (%s)", strings.Join(change, ", "))
+	}
+	return text
+}
+
+// historyAnomalyReport describes each flow deviating from its trailing average on a separate line
+func historyAnomalyReport() []string {
+	lines := make([]string, 0, len(flowAnomalies))
+	for _, a := range flowAnomalies {
+		lines = append(lines, fmt.Sprintf("Flow anomaly %s > %s: %s", a.source, a.target, a.describe()))
+	}
+	return lines
+}
+
+// anomalyNotes returns the deviation of each flagged link for the tooltips, keyed by "source > target"
+func anomalyNotes() map[string]string {
+	notes := make(map[string]string)
+	for _, a := range flowAnomalies {
+		source := a.source
+		if globalConfig.Totals && source == "all" {
+			source = totalNode
+		}
+		notes[source+" > "+a.target] = "Anomaly: " + a.describe()
+	}
+	return notes
+}
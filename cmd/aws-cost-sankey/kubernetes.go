@@ -0,0 +1,158 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/fetch"
+)
+
+// KubernetesConfig points to the OpenCost or Kubecost API of a cluster
+// whose allocations are attached below the service node of the cluster in the given environment
+type KubernetesConfig struct {
+	Environment string `yaml:"environment"`
+	Service     string `yaml:"service"`
+	Endpoint    string `yaml:"endpoint"`
+	Type        string `yaml:"type"`
+}
+
+// Services the cluster cost is billed under, in order of preference, unless the service node is configured
+var clusterServices = []string{"Amazon Elastic Compute Cloud - Compute", "Amazon Elastic Container Service for Kubernetes"}
+
+// Allocation API paths of each supported type
+var allocationPaths = map[string]string{
+	"opencost": "/allocation/compute",
+	"kubecost": "/model/allocation",
+}
+
+// kubernetesProvider provides the allocations of a cluster from its OpenCost or Kubecost API
+type kubernetesProvider struct {
+	cluster KubernetesConfig
+}
+
+// Fetch attaches the cluster allocations as "<environment>/<namespace>" and "<environment>/<namespace>/<workload>"
+// nodes below the service of the cluster in the results, so names don't collide across clusters and the cost of the
+// environment isn't counted twice
+func (p kubernetesProvider) Fetch(_ context.Context, period costgraph.Period, _ []fetch.Level) (costgraph.Flows, error) {
+	cluster := p.cluster
+	infof("Fetching Kubernetes allocations for %s from %s", cluster.Environment, cluster.Endpoint)
+
+	service, err := clusterServiceNode(cluster)
+	if err != nil {
+		return nil, err
+	}
+
+	clusterType := cluster.Type
+	if clusterType == "" {
+		clusterType = "opencost"
+	}
+	path, ok := allocationPaths[clusterType]
+	if !ok {
+		return nil, fmt.Errorf("unknown Kubernetes cost API type: %s", cluster.Type)
+	}
+
+	query := url.Values{}
+	query.Set("window", fmt.Sprintf("%sT00:00:00Z,%sT00:00:00Z", period.Start, period.End))
+	query.Set("aggregate", "namespace,controller")
+	query.Set("accumulate", "true")
+
+	resp, err := httpGet(fmt.Sprintf("%s%s?%s", strings.TrimSuffix(cluster.Endpoint, "/"), path, query.Encode()))
+	if err != nil {
+		return nil, fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read response body: %v", err)
+	}
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("allocation request failed with %s: %s", resp.Status, body)
+	}
+
+	var responseBody struct {
+		Data []map[string]struct {
+			Properties struct {
+				Namespace  string `json:"namespace"`
+				Controller string `json:"controller"`
+			} `json:"properties"`
+			TotalCost float64 `json:"totalCost"`
+		} `json:"data"`
+	}
+	if err := json.Unmarshal(body, &responseBody); err != nil {
+		return nil, fmt.Errorf("failed to decode response body: %v", err)
+	}
+
+	flows := make(costgraph.Flows)
+	var total float64
+	for _, allocations := range responseBody.Data {
+		for name, allocation := range allocations {
+			namespace := allocation.Properties.Namespace
+			if namespace == "" {
+				// Idle and unallocated costs have no namespace
+				namespace = name
+			}
+			workload := allocation.Properties.Controller
+			if workload == "" {
+				workload = "unknown"
+			}
+
+			cost := roundCost(allocation.TotalCost)
+			namespaceNode := fmt.Sprintf("%s/%s", cluster.Environment, namespace)
+			flows.Add(service, namespaceNode, cost)
+			flows.Add(namespaceNode, fmt.Sprintf("%s/%s", namespaceNode, workload), cost)
+			total += cost
+		}
+	}
+	if serviceCost := results[cluster.Environment][service]; total > serviceCost {
+		warnf("Kubernetes allocations of %s total %s, more than the %s of %s", cluster.Environment, formatCost(total, 2), formatCost(serviceCost, 2), service)
+	}
+	return flows, nil
+}
+
+// clusterServiceNode returns the service node below the environment that the cluster cost is billed under. The
+// node must have no children but the namespaces of clusters, which the allocations would otherwise count twice.
+func clusterServiceNode(cluster KubernetesConfig) (string, error) {
+	children := results[cluster.Environment]
+	if len(children) == 0 {
+		return "", fmt.Errorf("no costs found for environment %s", cluster.Environment)
+	}
+	candidates := clusterServices
+	if cluster.Service != "" {
+		candidates = []string{cluster.Service}
+	}
+	for _, candidate := range candidates {
+		// Services named like another level get the title of their level appended, e.g. "EC2 (SERVICE)"
+		for _, node := range []string{candidate, candidate + " (SERVICE)"} {
+			if _, ok := children[node]; !ok {
+				continue
+			}
+			if brokenDown(node) {
+				return "", fmt.Errorf("service %s of %s is broken down further, set the service of the cluster to a node without children", node, cluster.Environment)
+			}
+			return node, nil
+		}
+	}
+	return "", fmt.Errorf("no %s below %s, set the service of the cluster", strings.Join(candidates, " or "), cluster.Environment)
+}
+
+// brokenDown reports whether a node has children other than the namespaces of clusters, e.g. of other environments
+// sharing the service node
+func brokenDown(node string) bool {
+	for child := range results[node] {
+		clusterNode := false
+		for _, cluster := range globalConfig.Kubernetes {
+			clusterNode = clusterNode || strings.HasPrefix(child, cluster.Environment+"/")
+		}
+		if !clusterNode {
+			return true
+		}
+	}
+	return false
+}
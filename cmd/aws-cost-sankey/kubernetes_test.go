@@ -0,0 +1,33 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+func TestFetchKubernetesBelowService(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"data": [{"web/api": {"properties": {"namespace": "web", "controller": "api"}, "totalCost": 30}}]}`)
+	}))
+	defer server.Close()
+	setupRunTest(t, Config{}, costgraph.Flows{
+		"all":        {"acct1": 60},
+		"acct1":      {"acct1/prod": 60},
+		"acct1/prod": {"Amazon Elastic Compute Cloud - Compute": 40, "AWS Lambda": 20},
+	})
+
+	if err := fetchFrom(kubernetesProvider{KubernetesConfig{Environment: "acct1/prod", Endpoint: server.URL}}, hierarchyLevels); err != nil {
+		t.Fatalf("fetchFrom() = %v", err)
+	}
+	checkResults(t, costgraph.Flows{
+		"all":                                    {"acct1": 60},
+		"acct1":                                  {"acct1/prod": 60},
+		"acct1/prod":                             {"Amazon Elastic Compute Cloud - Compute": 40, "AWS Lambda": 20},
+		"Amazon Elastic Compute Cloud - Compute": {"acct1/prod/web": 30},
+		"acct1/prod/web":                         {"acct1/prod/web/api": 30},
+	})
+}
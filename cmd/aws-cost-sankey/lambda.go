@@ -0,0 +1,160 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Set by the Lambda provided runtime to the host of the Runtime API
+const lambdaRuntimeAPIEnv = "AWS_LAMBDA_RUNTIME_API"
+
+// Flags of the lambda command when started by the runtime, which passes no arguments, e.g. "-c configs/prod.yaml"
+const lambdaArgsEnv = "AWS_COST_SANKEY_ARGS"
+
+// Time kept before the deadline of an invocation to report a refresh that didn't complete
+const lambdaDeadlineMargin = 2 * time.Second
+
+// lambdaEvent is the input of an invocation. EventBridge scheduled events carry no period, so the period of the
+// config is refreshed, while EventBridge Scheduler can pass one, e.g. {"period": "last-month"}.
+type lambdaEvent struct {
+	Period string `json:"period"`
+}
+
+// lambdaResult is the response of an invocation
+type lambdaResult struct {
+	Start    string   `json:"start"`
+	End      string   `json:"end"`
+	Currency string   `json:"currency"`
+	Total    float64  `json:"total"`
+	Files    []string `json:"files"`
+}
+
+// lambdaArgs returns the arguments of the lambda command run by the runtime
+func lambdaArgs() []string {
+	return append([]string{"lambda"}, strings.Fields(os.Getenv(lambdaArgsEnv))...)
+}
+
+// runLambda answers invocations of the Runtime API until the function is shut down. Each invocation refreshes the
+// outputs like the schedule of serve: the costs are fetched, the files written to /tmp, published and notified.
+func runLambda() {
+	api := os.Getenv(lambdaRuntimeAPIEnv)
+	if api == "" {
+		log.Fatalf("lambda runs on the Lambda provided runtime, %s is not set", lambdaRuntimeAPIEnv)
+	}
+	if options.dryRun {
+		log.Fatalf("lambda fetches the costs on each invocation, print the requests of a run with -dry-run instead")
+	}
+	// Only /tmp is writable, and kept between invocations of the same instance
+	if os.Getenv("XDG_CACHE_HOME") == "" {
+		os.Setenv("XDG_CACHE_HOME", os.TempDir())
+	}
+
+	// Fail on config errors at startup, reported by Lambda as an init error. Invocations write the formats of the schedule.
+	options.format = defaultScheduleFormats
+	setupRun()
+	schedule := globalConfig.Schedule
+	validateRefresh(&schedule)
+	if !filepath.IsAbs(schedule.Output) {
+		schedule.Output = filepath.Join(os.TempDir(), schedule.Output)
+	}
+
+	endpoint := fmt.Sprintf("http://%s/2018-06-01/runtime/invocation/", api)
+	for {
+		err := lambdaInvocation(endpoint, func(ctx context.Context, payload []byte) (interface{}, error) {
+			return handleLambdaEvent(ctx, schedule, payload)
+		})
+		if err != nil {
+			log.Fatalf("failed to call the Lambda Runtime API: %v", err)
+		}
+	}
+}
+
+// handleLambdaEvent refreshes the outputs of the period of the event, or of the config
+func handleLambdaEvent(ctx context.Context, schedule ScheduleConfig, payload []byte) (interface{}, error) {
+	var event lambdaEvent
+	if err := json.Unmarshal(payload, &event); err != nil {
+		return nil, fmt.Errorf("invalid event: %v", err)
+	}
+	if event.Period != "" && !knownPeriod(event.Period) {
+		return nil, fmt.Errorf("unknown period %q", event.Period)
+	}
+	saved := options.period
+	defer func() { options.period = saved }()
+	if event.Period != "" {
+		options.period = event.Period
+	}
+
+	files, err := refresh(ctx, schedule)
+	if err != nil {
+		return nil, err
+	}
+	return lambdaResult{
+		Start:    globalConfig.StartDate,
+		End:      globalConfig.EndDate,
+		Currency: currency,
+		Total:    buildGraph().Total,
+		Files:    files,
+	}, nil
+}
+
+// lambdaInvocation waits for the next invocation, runs the handler until shortly before the deadline and posts its
+// response or error. Failures of the handler are reported to Lambda, only failures of the Runtime API are returned.
+func lambdaInvocation(endpoint string, handler func(ctx context.Context, payload []byte) (interface{}, error)) error {
+	// Waits as long as the function is idle
+	resp, err := http.Get(endpoint + "next")
+	if err != nil {
+		return err
+	}
+	payload, err := io.ReadAll(resp.Body)
+	resp.Body.Close()
+	if err != nil {
+		return err
+	}
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("next invocation answered %s: %s", resp.Status, payload)
+	}
+	requestID := resp.Header.Get("Lambda-Runtime-Aws-Request-Id")
+	infof("Invoked as %s", requestID)
+
+	ctx := context.Background()
+	if deadline, err := strconv.ParseInt(resp.Header.Get("Lambda-Runtime-Deadline-Ms"), 10, 64); err == nil {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithDeadline(ctx, time.UnixMilli(deadline).Add(-lambdaDeadlineMargin))
+		defer cancel()
+	}
+
+	result, err := handler(ctx, payload)
+	if err != nil {
+		errorf("Invocation %s failed: %v", requestID, err)
+		return postLambda(endpoint+requestID+"/error", map[string]string{"errorMessage": err.Error(), "errorType": "RefreshError"})
+	}
+	return postLambda(endpoint+requestID+"/response", result)
+}
+
+// postLambda posts the response or error of an invocation, which the Runtime API accepts with 202
+func postLambda(url string, body interface{}) error {
+	data, err := json.Marshal(body)
+	if err != nil {
+		return err
+	}
+	resp, err := http.Post(url, "application/json", bytes.NewReader(data))
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusAccepted {
+		message, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("%s answered %s: %s", url, resp.Status, message)
+	}
+	return nil
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"testing"
+	"time"
+)
+
+// fakeLambdaRuntime serves a single invocation of the Runtime API and records what the function posts
+func fakeLambdaRuntime(t *testing.T, event string, deadline time.Time) (endpoint string, posted map[string]string) {
+	t.Helper()
+	posted = make(map[string]string)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/2018-06-01/runtime/invocation/next" {
+			w.Header().Set("Lambda-Runtime-Aws-Request-Id", "req-1")
+			w.Header().Set("Lambda-Runtime-Deadline-Ms", strconv.FormatInt(deadline.UnixMilli(), 10))
+			io.WriteString(w, event)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		posted[r.URL.Path] = string(body)
+		w.WriteHeader(http.StatusAccepted)
+	}))
+	t.Cleanup(server.Close)
+	return server.URL + "/2018-06-01/runtime/invocation/", posted
+}
+
+func TestLambdaInvocation(t *testing.T) {
+	deadline := time.Now().Add(time.Minute)
+	endpoint, posted := fakeLambdaRuntime(t, `{"period": "last-month"}`, deadline)
+
+	err := lambdaInvocation(endpoint, func(ctx context.Context, payload []byte) (interface{}, error) {
+		if got, ok := ctx.Deadline(); !ok || !got.Before(deadline) {
+			t.Errorf("deadline = %v, want before %v", got, deadline)
+		}
+		var event lambdaEvent
+		json.Unmarshal(payload, &event)
+		return lambdaResult{Total: 160, Files: []string{event.Period + ".html"}}, nil
+	})
+	if err != nil {
+		t.Fatalf("lambdaInvocation() = %v", err)
+	}
+	if got, want := posted["/2018-06-01/runtime/invocation/req-1/response"], `{"start":"","end":"","currency":"","total":160,"files":["last-month.html"]}`; got != want {
+		t.Errorf("response = %s, want %s", got, want)
+	}
+}
+
+func TestLambdaInvocationError(t *testing.T) {
+	endpoint, posted := fakeLambdaRuntime(t, `{}`, time.Now().Add(time.Minute))
+
+	err := lambdaInvocation(endpoint, func(ctx context.Context, payload []byte) (interface{}, error) {
+		return nil, errors.New("failed to fetch 1 accounts or sources, no output written")
+	})
+	if err != nil {
+		t.Fatalf("lambdaInvocation() = %v, want the error reported to the runtime", err)
+	}
+	if got, want := posted["/2018-06-01/runtime/invocation/req-1/error"], `{"errorMessage":"failed to fetch 1 accounts or sources, no output written","errorType":"RefreshError"}`; got != want {
+		t.Errorf("error = %s, want %s", got, want)
+	}
+}
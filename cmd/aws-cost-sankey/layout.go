@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"sort"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/go-echarts/go-echarts/v2/types"
+)
+
+// LayoutConfig exposes the layout options of the echarts sankey series to untangle large diagrams.
+// See https://echarts.apache.org/en/option.html#series-sankey
+type LayoutConfig struct {
+	NodeAlign        string `yaml:"nodeAlign"`
+	NodeGap          int    `yaml:"nodeGap"`
+	NodeWidth        int    `yaml:"nodeWidth"`
+	Orient           string `yaml:"orient"`
+	LayoutIterations *int   `yaml:"layoutIterations"`
+	SortByValue      bool   `yaml:"sortByValue"`
+}
+
+// validateLayout checks the layout options before any cost is fetched
+func validateLayout() error {
+	layout := globalConfig.Layout
+	switch layout.NodeAlign {
+	case "", "justify", "left", "right":
+	default:
+		return fmt.Errorf("unknown layout nodeAlign: %s", layout.NodeAlign)
+	}
+	switch layout.Orient {
+	case "", "horizontal", "vertical":
+	default:
+		return fmt.Errorf("unknown layout orient: %s", layout.Orient)
+	}
+	if layout.NodeGap < 0 || layout.NodeWidth < 0 || (layout.LayoutIterations != nil && *layout.LayoutIterations < 0) {
+		return fmt.Errorf("layout nodeGap, nodeWidth and layoutIterations can't be negative")
+	}
+	return nil
+}
+
+// applyLayout sets the configured layout options on the sankey series. The options aren't part of
+// the go-echarts series, so they are merged into the chart right after it is initialized.
+func applyLayout(sankey *charts.Sankey) {
+	layout := globalConfig.Layout
+	series := make(map[string]interface{})
+	if layout.NodeAlign != "" {
+		series["nodeAlign"] = layout.NodeAlign
+	}
+	if layout.NodeGap > 0 {
+		series["nodeGap"] = layout.NodeGap
+	}
+	if layout.NodeWidth > 0 {
+		series["nodeWidth"] = layout.NodeWidth
+	}
+	if layout.Orient != "" {
+		series["orient"] = layout.Orient
+	}
+	if layout.LayoutIterations != nil {
+		series["layoutIterations"] = *layout.LayoutIterations
+	}
+	if layout.SortByValue {
+		// Without iterations, echarts keeps the nodes of each column in the order of the data
+		series["layoutIterations"] = 0
+	}
+	if len(series) == 0 {
+		return
+	}
+
+	options, err := json.Marshal(map[string]interface{}{"series": []interface{}{series}})
+	if err != nil {
+		log.Fatalf("failed to marshal layout: %v", err)
+	}
+	sankey.AddJSFuncStrs(types.FuncStr(fmt.Sprintf("%%MY_ECHARTS%%.setOption(%s);", options)))
+}
+
+// sortNodesByValue orders the nodes of each column by descending value, i.e. the larger of their
+// incoming and outgoing cost, so that the largest flows stay at the top
+func sortNodesByValue(nodes []opts.SankeyNode, data map[string]map[string]float64) {
+	values := make(map[string]float64)
+	incoming := make(map[string]float64)
+	for parent, children := range data {
+		for child, cost := range children {
+			values[parent] += cost
+			incoming[child] += cost
+		}
+	}
+	for node, cost := range incoming {
+		values[node] = max(values[node], cost)
+	}
+
+	sort.SliceStable(nodes, func(i, j int) bool {
+		if *nodes[i].Depth != *nodes[j].Depth {
+			return *nodes[i].Depth < *nodes[j].Depth
+		}
+		return values[nodes[i].Name] > values[nodes[j].Name]
+	})
+}
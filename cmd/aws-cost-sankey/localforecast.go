@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"time"
+)
+
+const (
+	forecastLinear = "linear"
+	forecastETS    = "ets"
+)
+
+// Smoothing factor of the exponential smoothing unless configured otherwise
+const defaultForecastSmoothing = 0.5
+
+// LocalForecastConfig projects the cost of this period from earlier periods of the history file, without Cost Explorer.
+// Levels are named like in timeSeries and default to all levels.
+type LocalForecastConfig struct {
+	Method    string   `yaml:"method"`
+	Periods   int      `yaml:"periods"`
+	Smoothing float64  `yaml:"smoothing"`
+	Levels    []string `yaml:"levels"`
+}
+
+type nodeForecast struct {
+	name      string
+	depth     int
+	actual    float64
+	projected float64
+}
+
+// Projected costs of the nodes of the forecast levels, by level and largest projection first
+var nodeForecasts []nodeForecast
+
+// Share of the period elapsed when the forecast was made, to tell whether the actual costs are on track
+var forecastElapsed float64
+
+// validateLocalForecast checks the forecast options before any cost is fetched
+func validateLocalForecast() error {
+	config := &globalConfig.LocalForecast
+	switch config.Method {
+	case "":
+		return nil
+	case forecastLinear, forecastETS:
+	default:
+		return fmt.Errorf("unknown localForecast method: %s", config.Method)
+	}
+	if globalConfig.HistoryFile == "" {
+		return fmt.Errorf("localForecast requires a historyFile")
+	}
+	if config.Periods < 0 {
+		return fmt.Errorf("localForecast periods can't be negative: %d", config.Periods)
+	}
+	if config.Periods == 0 {
+		config.Periods = defaultHistoryPeriods
+	}
+	if config.Smoothing < 0 || config.Smoothing > 1 {
+		return fmt.Errorf("localForecast smoothing must be between 0 and 1: %g", config.Smoothing)
+	}
+	if config.Smoothing == 0 {
+		config.Smoothing = defaultForecastSmoothing
+	}
+	return nil
+}
+
+// forecastLocally projects the cost of each node of the forecast levels for this period from the latest runs of
+// earlier periods, using a linear trend or exponential smoothing. Periods without the node count as zero.
+func forecastLocally(historyFile string) error {
+	config := globalConfig.LocalForecast
+	infof("Forecasting from %d periods of %s", config.Periods, historyFile)
+
+	runIDs, history, err := earlierHistory(historyFile, config.Periods)
+	if err != nil {
+		return err
+	}
+	if len(runIDs) == 0 {
+		warnf("No earlier periods in %s, skipping forecast", historyFile)
+		return nil
+	}
+
+	// Runs are returned most recent first, projections need them in chronological order
+	positions := make(map[int64]int)
+	for i, runID := range runIDs {
+		positions[runID] = len(runIDs) - 1 - i
+	}
+	series := func(node string) []float64 {
+		values := make([]float64, len(runIDs))
+		for _, targets := range history {
+			for runID, amount := range targets[node] {
+				values[positions[runID]] += amount
+			}
+		}
+		return values
+	}
+
+	levels := make(map[string]bool)
+	for _, level := range config.Levels {
+		levels[level] = true
+	}
+	actual := incomingCosts(results)
+	nodeForecasts = nil
+	for node, depth := range results.Depths() {
+		if depth == 0 || (len(levels) > 0 && !levels[levelName(depth)] && !levels[levelTitle(depth)]) {
+			continue
+		}
+		var projected float64
+		if config.Method == forecastETS {
+			projected = smoothedForecast(series(node), config.Smoothing)
+		} else {
+			projected = linearForecast(series(node))
+		}
+		if math.Max(projected, actual[node]) < globalConfig.Threshold {
+			continue
+		}
+		nodeForecasts = append(nodeForecasts, nodeForecast{node, depth, actual[node], projected})
+	}
+	sort.Slice(nodeForecasts, func(i, j int) bool {
+		if nodeForecasts[i].depth != nodeForecasts[j].depth {
+			return nodeForecasts[i].depth < nodeForecasts[j].depth
+		}
+		if nodeForecasts[i].projected != nodeForecasts[j].projected {
+			return nodeForecasts[i].projected > nodeForecasts[j].projected
+		}
+		return nodeForecasts[i].name < nodeForecasts[j].name
+	})
+	forecastElapsed, err = periodElapsed(time.Now().UTC())
+	return err
+}
+
+// linearForecast extends the least squares line through the values to the next period
+func linearForecast(values []float64) float64 {
+	n := float64(len(values))
+	if n < 2 {
+		return values[0]
+	}
+	var sumX, sumY, sumXY, sumXX float64
+	for i, y := range values {
+		x := float64(i)
+		sumX += x
+		sumY += y
+		sumXY += x * y
+		sumXX += x * x
+	}
+	slope := (n*sumXY - sumX*sumY) / (n*sumXX - sumX*sumX)
+	intercept := (sumY - slope*sumX) / n
+	return intercept + slope*n
+}
+
+// smoothedForecast returns the exponentially smoothed level of the values, weighting recent periods by the smoothing factor
+func smoothedForecast(values []float64, smoothing float64) float64 {
+	level := values[0]
+	for _, value := range values[1:] {
+		level = smoothing*value + (1-smoothing)*level
+	}
+	return level
+}
+
+// periodElapsed returns the share of the period elapsed at the given time, between 0 and 1
+func periodElapsed(now time.Time) (float64, error) {
+	parse := func(date string) (time.Time, error) {
+		t, err := time.Parse(time.DateOnly, date)
+		if err != nil {
+			if t, err = time.Parse(time.RFC3339, date); err != nil {
+				return time.Time{}, fmt.Errorf("failed to parse date %s: %v", date, err)
+			}
+		}
+		return t, nil
+	}
+	start, err := parse(globalConfig.StartDate)
+	if err != nil {
+		return 0, err
+	}
+	end, err := parse(globalConfig.EndDate)
+	if err != nil {
+		return 0, err
+	}
+	if !end.After(start) {
+		return 1, nil
+	}
+	return math.Min(1, math.Max(0, now.Sub(start).Seconds()/end.Sub(start).Seconds())), nil
+}
+
+// forecastStatus compares the actual cost with the share of the forecast expected by now, e.g. "52% of forecast, 48% elapsed"
+func forecastStatus(forecast nodeForecast) string {
+	if forecast.projected <= 0 {
+		return fmt.Sprintf("%.0f%% elapsed", forecastElapsed*100)
+	}
+	return fmt.Sprintf("%.0f%% of forecast, %.0f%% elapsed", forecast.actual/forecast.projected*100, forecastElapsed*100)
+}
+
+// localForecastReport lists the projection of each node for the text report
+func localForecastReport() []string {
+	lines := make([]string, 0, len(nodeForecasts))
+	for _, forecast := range nodeForecasts {
+		lines = append(lines, fmt.Sprintf("Forecast %s %s: %s projected, %s so far (%s)", levelTitle(forecast.depth), forecast.name,
+			formatCost(forecast.projected, 2), formatCost(forecast.actual, 2), forecastStatus(forecast)))
+	}
+	return lines
+}
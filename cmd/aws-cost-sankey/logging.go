@@ -0,0 +1,116 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"log/slog"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+	"time"
+)
+
+// Formats of the -log-format flag
+const (
+	LogFormatText = "text"
+	LogFormatJSON = "json"
+)
+
+// Messages below logLevel are dropped. Fatal errors, logged by the log package, are always written at error level
+var (
+	logLevel  = slog.LevelInfo
+	logFormat = LogFormatText
+	logger    *slog.Logger
+)
+
+// setupLogging sets the level and format of the log output to stderr from the -log-level and -log-format flags.
+// -quiet leaves out the progress and info messages unless a level is given.
+func setupLogging() {
+	level, format := options.logLevel, options.logFormat
+	if options.quiet && (level == "" || level == "info") {
+		level = "warn"
+	}
+	if level != "" {
+		if err := logLevel.UnmarshalText([]byte(level)); err != nil {
+			log.Fatalf("unknown log level %q, use debug, info, warn or error", level)
+		}
+	}
+	switch format {
+	case "", LogFormatText:
+		logFormat = LogFormatText
+		log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile | log.Lmsgprefix)
+		log.SetPrefix("ERROR ")
+		log.SetOutput(stderrWriter{})
+	case LogFormatJSON:
+		logFormat = LogFormatJSON
+		logger = slog.New(slog.NewJSONHandler(os.Stderr, &slog.HandlerOptions{
+			AddSource:   true,
+			Level:       logLevel,
+			ReplaceAttr: shortSource,
+		}))
+		log.SetFlags(0)
+		log.SetPrefix("")
+		log.SetOutput(fatalWriter{})
+	default:
+		log.Fatalf("unknown log format %q, use text or json", format)
+	}
+}
+
+func debugf(format string, args ...interface{}) { logf(slog.LevelDebug, format, args...) }
+func infof(format string, args ...interface{})  { logf(slog.LevelInfo, format, args...) }
+func warnf(format string, args ...interface{})  { logf(slog.LevelWarn, format, args...) }
+func errorf(format string, args ...interface{}) { logf(slog.LevelError, format, args...) }
+
+// logf writes a message at a level with the file and line of the caller of debugf, infof, warnf or errorf
+func logf(level slog.Level, format string, args ...interface{}) {
+	if level < logLevel {
+		return
+	}
+	message := strings.TrimSuffix(fmt.Sprintf(format, args...), "\n")
+	if logFormat == LogFormatJSON {
+		var pcs [1]uintptr
+		runtime.Callers(3, pcs[:])
+		record := slog.NewRecord(time.Now(), level, message, pcs[0])
+		_ = logger.Handler().Handle(context.Background(), record)
+		return
+	}
+	_ = textLogger.Output(3, fmt.Sprintf("%-5s %s", level, message))
+}
+
+// Text log output of leveled messages, formatted like the fatal errors of the log package
+var textLogger = log.New(stderrWriter{}, "", log.Ldate|log.Ltime|log.Lshortfile)
+
+// fatalWriter writes the messages of the log package, i.e. log.Fatalf, as JSON at error level
+type fatalWriter struct{}
+
+func (fatalWriter) Write(p []byte) (int, error) {
+	// The caller is the first frame outside the log package
+	var pc uintptr
+	pcs := make([]uintptr, 8)
+	frames := runtime.CallersFrames(pcs[:runtime.Callers(2, pcs)])
+	for {
+		frame, more := frames.Next()
+		if !strings.HasPrefix(frame.Function, "log.") {
+			pc = frame.PC
+			break
+		}
+		if !more {
+			break
+		}
+	}
+	record := slog.NewRecord(time.Now(), slog.LevelError, strings.TrimSuffix(string(p), "\n"), pc)
+	if err := logger.Handler().Handle(context.Background(), record); err != nil {
+		return 0, err
+	}
+	return len(p), nil
+}
+
+// shortSource logs the source of messages as file:line, like the text output
+func shortSource(groups []string, attr slog.Attr) slog.Attr {
+	if source, ok := attr.Value.Any().(*slog.Source); ok && attr.Key == slog.SourceKey {
+		return slog.String(slog.SourceKey, fmt.Sprintf("%s:%d", filepath.Base(source.File), source.Line))
+	}
+	return attr
+}
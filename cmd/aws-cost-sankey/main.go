@@ -1,377 +1,593 @@
 package main
 
 import (
-	"bytes"
-	"context"
-	"encoding/json"
-	"flag"
 	"fmt"
-	"io"
 	"log"
-	"math"
-	"net/http"
 	"os"
+	"slices"
 	"strconv"
 	"strings"
 
 	"github.com/aws/aws-sdk-go-v2/aws"
-	"github.com/aws/aws-sdk-go-v2/config"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
 	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
-	"github.com/go-echarts/go-echarts/v2/charts"
-	"github.com/go-echarts/go-echarts/v2/components"
-	"github.com/go-echarts/go-echarts/v2/opts"
-	"gopkg.in/yaml.v3"
+
+	"aws-costexplorer/pkg/costgraph"
 )
 
 type Config struct {
-	Accounts  []Account `yaml:"accounts"`
-	StartDate string    `yaml:"startDate"`
-	EndDate   string    `yaml:"endDate"`
-	Threshold float64   `yaml:"threshold"`
-	Height    string    `yaml:"height"`
-	Width     string    `yaml:"width"`
-	OpenAIKey string    `yaml:"openaiKey"`
-	Model     string    `yaml:"model"`
-	MaxTokens int       `yaml:"maxTokens"`
-	Prompt    string    `yaml:"prompt"`
+	Source              string                 `yaml:"source"`
+	Concurrency         int                    `yaml:"concurrency"`
+	ContinueOnError     bool                   `yaml:"continueOnError"`
+	Cache               CacheConfig            `yaml:"cache"`
+	HistoryFile         string                 `yaml:"historyFile"`
+	HistoryAnomalies    HistoryAnomalyConfig   `yaml:"historyAnomalies"`
+	LocalForecast       LocalForecastConfig    `yaml:"localForecast"`
+	MaxAttempts         int                    `yaml:"maxAttempts"`
+	MaxBackoff          int                    `yaml:"maxBackoff"`
+	CUR                 CURConfig              `yaml:"cur"`
+	Athena              AthenaConfig           `yaml:"athena"`
+	BillingConductor    BillingConductorConfig `yaml:"billingConductor"`
+	FOCUS               FOCUSConfig            `yaml:"focus"`
+	GCP                 GCPConfig              `yaml:"gcp"`
+	Kubernetes          []KubernetesConfig     `yaml:"kubernetes"`
+	CSV                 CSVConfig              `yaml:"csv"`
+	Accounts            []Account              `yaml:"accounts"`
+	AccountNames        map[string]string      `yaml:"accountNames"`
+	Aliases             map[string]string      `yaml:"aliases"`
+	Allocations         []AllocationRule       `yaml:"allocations"`
+	Teams               TeamsConfig            `yaml:"teams"`
+	Schedule            ScheduleConfig         `yaml:"schedule"`
+	Notify              NotifyConfig           `yaml:"notify"`
+	Publish             PublishConfig          `yaml:"publish"`
+	CloudWatch          CloudWatchConfig       `yaml:"cloudwatch"`
+	Slack               SlackConfig            `yaml:"slack"`
+	Email               EmailConfig            `yaml:"email"`
+	MSTeams             MSTeamsConfig          `yaml:"msteams"`
+	Webhooks            []WebhookConfig        `yaml:"webhooks"`
+	Include             map[string][]string    `yaml:"include"`
+	Exclude             map[string][]string    `yaml:"exclude"`
+	Organization        bool                   `yaml:"organization"`
+	OrganizationalUnits []string               `yaml:"organizationalUnits"`
+	Hierarchy           []string               `yaml:"hierarchy"`
+	MergeAcrossAccounts bool                   `yaml:"mergeAcrossAccounts"`
+	StartDate           string                 `yaml:"startDate"`
+	EndDate             string                 `yaml:"endDate"`
+	Period              string                 `yaml:"period"`
+	Granularity         string                 `yaml:"granularity"`
+	TimeBuckets         bool                   `yaml:"timeBuckets"`
+	TimeSeries          string                 `yaml:"timeSeries"`
+	TrendMonths         int                    `yaml:"trendMonths"`
+	Metric              string                 `yaml:"metric"`
+	RecordTypes         string                 `yaml:"recordTypes"`
+	NegativeCosts       string                 `yaml:"negativeCosts"`
+	Exchange            ExchangeConfig         `yaml:"exchange"`
+	Threshold           float64                `yaml:"threshold"`
+	Thresholds          map[string]float64     `yaml:"thresholds"`
+	ThresholdPercent    float64                `yaml:"thresholdPercent"`
+	CollapseOther       bool                   `yaml:"collapseOther"`
+	Totals              bool                   `yaml:"totals"`
+	LinkPercentages     bool                   `yaml:"linkPercentages"`
+	Colors              []ColorConfig          `yaml:"colors"`
+	ChartType           string                 `yaml:"chartType"`
+	Layout              LayoutConfig           `yaml:"layout"`
+	AccountCharts       bool                   `yaml:"accountCharts"`
+	AssetsDir           string                 `yaml:"assetsDir"`
+	FlowTable           bool                   `yaml:"flowTable"`
+	UntaggedReport      bool                   `yaml:"untaggedReport"`
+	Units               []UnitConfig           `yaml:"units"`
+	Height              string                 `yaml:"height"`
+	Title               string                 `yaml:"title"`
+	Subtitle            string                 `yaml:"subtitle"`
+	TooltipFormatter    string                 `yaml:"tooltipFormatter"`
+	LabelFormatter      string                 `yaml:"labelFormatter"`
+	NumberFormat        NumberFormatConfig     `yaml:"numberFormat"`
+	Width               string                 `yaml:"width"`
+	OpenAIKey           string                 `yaml:"openaiKey"`
+	OpenAIKeyFrom       string                 `yaml:"openaiKeyFrom"`
+	Model               string                 `yaml:"model"`
+	MaxTokens           int                    `yaml:"maxTokens"`
+	Prompt              string                 `yaml:"prompt"`
 }
 
 type Account struct {
-	Name   string `yaml:"name"`
-	Key    string `yaml:"key"`
-	Secret string `yaml:"secret"`
-	Token  string `yaml:"token"`
+	Name             string `yaml:"name"`
+	Provider         string `yaml:"provider"`
+	Key              string `yaml:"key"`
+	Secret           string `yaml:"secret"`
+	Token            string `yaml:"token"`
+	KeyFrom          string `yaml:"keyFrom"`
+	SecretFrom       string `yaml:"secretFrom"`
+	TokenFrom        string `yaml:"tokenFrom"`
+	Profile          string `yaml:"profile"`
+	SSOStartURL      string `yaml:"ssoStartUrl"`
+	SSORegion        string `yaml:"ssoRegion"`
+	SSOAccountID     string `yaml:"ssoAccountId"`
+	SSORoleName      string `yaml:"ssoRoleName"`
+	SSOSession       string `yaml:"ssoSession"`
+	RoleARN          string `yaml:"roleArn"`
+	ExternalID       string `yaml:"externalId"`
+	SessionName      string `yaml:"sessionName"`
+	TenantID         string `yaml:"tenantId"`
+	ClientID         string `yaml:"clientId"`
+	ClientSecret     string `yaml:"clientSecret"`
+	ClientSecretFrom string `yaml:"clientSecretFrom"`
+	SubscriptionID   string `yaml:"subscriptionId"`
 }
 
+// Number of accounts fetched at the same time unless configured otherwise
+const defaultConcurrency = 4
+
 var globalConfig Config
-var results = make(map[string]map[string]float64)
+var results = make(costgraph.Flows)
 
-func main() {
-	log.SetFlags(log.Ldate | log.Ltime | log.Lshortfile)
-
-	// Parse command line arguments
-	configFile := flag.String("c", "configs/configs.yaml", "(Optional) Path to the config file")
-	outputFile := flag.String("o", "output", "(Optional) Name of output file. Suffix will be determined by output format")
-	format := flag.String("f", "chart", "(Optional) Output format: \"text\", \"chart\" or \"text+ai\" (plaintext with OpenAI analysis)")
-	devMode := flag.Bool("d", false, "(Optional) Show UsageType instead of Service")
-	inputFile := flag.String("i", "", "(Optional) Input text file from which the cost data will be read.\nIf not provided, data will be fetched from AWS Cost Explorer API")
-	flag.Parse()
-
-	// Load config from file
-	data, err := os.ReadFile(*configFile)
-	if err != nil {
-		log.Fatalf("error: %v", err)
-	}
-	err = yaml.Unmarshal(data, &globalConfig)
-	if err != nil {
-		log.Fatalf("error: %v", err)
-	}
+// Costs per time bucket, keyed by the start of each period. Only populated when timeBuckets or timeSeries is enabled
+var bucketResults = make(map[string]map[string]map[string]float64)
 
-	// Load results from file if inputFile is provided
-	// Otherwise, fetch data from each account via AWS Cost Explorer API
-	if *inputFile != "" {
-		readData(*inputFile)
-	} else {
-		for _, account := range globalConfig.Accounts {
-			setEnvVar(account.Name, account.Key, account.Secret, account.Token)
-			fetchData(account.Name, *devMode)
-		}
-	}
+// Costs per fetched account, keyed by account name. Only populated when accountCharts is enabled
+var accountResults = make(map[string]map[string]map[string]float64)
 
-	// Generate output to file or text
-	var filename string
-	if *format == "text" || *format == "text+ai" {
-		filename = fmt.Sprintf("%s.txt", *outputFile)
-		generateText(filename)
-		if *format == "text+ai" {
-			analyze(filename)
-		}
-	} else if *format == "chart" {
-		filename = fmt.Sprintf("%s.html", *outputFile)
-		generateChart(filename)
-	} else {
-		log.Fatalf("unknown format: %s", *format)
+func main() {
+	setupLogging()
+
+	args := os.Args[1:]
+	// The Lambda provided runtime starts the bootstrap binary without arguments
+	if len(args) == 0 && os.Getenv(lambdaRuntimeAPIEnv) != "" {
+		args = lambdaArgs()
 	}
+	runCommand(args)
 }
 
-func setEnvVar(name string, key string, secret string, token string) {
-	log.Printf("Setting environment variables for %s\n", name)
+// run loads the config, fetches or reads the costs and generates the outputs selected by the options
+func run() {
+	startRunContext()
 
-	err := os.Setenv("AWS_ACCESS_KEY_ID", key)
-	if err != nil {
-		log.Fatalf("error setting AWS_ACCESS_KEY_ID: %v", err)
+	hierarchy := setupRun()
+	if options.dryRun {
+		printFetchPlan(hierarchy)
+		return
 	}
-	err = os.Setenv("AWS_SECRET_ACCESS_KEY", secret)
-	if err != nil {
-		log.Fatalf("error setting AWS_SECRET_ACCESS_KEY: %v", err)
+
+	// The period to compare with is loaded first, leaving the costs of the current period in the results
+	if options.compare != "" {
+		if options.compare == comparePrevious && options.inputFile != "" {
+			log.Fatalf("-compare previous fetches the preceding period, compare input files with -compare <file>")
+		}
+		if err := loadComparison(options.compare, func() error { return loadResults(hierarchy) }); err != nil {
+			log.Fatalf("%v", err)
+		}
 	}
-	err = os.Setenv("AWS_SESSION_TOKEN", token)
-	if err != nil {
-		log.Fatalf("error setting AWS_SESSION_TOKEN: %v", err)
+	if err := loadResults(hierarchy); err != nil {
+		checkCanceled()
+		log.Fatalf("%v", err)
 	}
-}
+	checkCanceled()
+	checkFetchFailures()
 
-func readData(inputFile string) {
-	log.Printf("Reading data from %s\n", inputFile)
-
-	data, err := os.ReadFile(inputFile)
-	if err != nil {
-		log.Fatalf("error: %v", err)
+	if options.metricsFile != "" {
+		writeMetricsFile(options.metricsFile)
 	}
-
-	lines := string(data)
-	for _, line := range strings.Split(lines, "\n") {
-		if line == "" {
-			continue
+	if options.cloudWatch {
+		if err := putCloudWatchMetrics(); err != nil {
+			log.Fatalf("failed to put CloudWatch metrics: %v", err)
 		}
-		parts := strings.Fields(line)
-		if len(parts) < 3 {
-			log.Fatalf("invalid line format: %s", line)
+	}
+	if globalConfig.HistoryAnomalies.enabled() {
+		if err := detectHistoryAnomalies(globalConfig.HistoryFile); err != nil {
+			log.Fatalf("%v", err)
 		}
-		parent := parts[0]
-		costStr := strings.Trim(parts[1], "[]")
-		cost, err := strconv.ParseFloat(costStr, 64)
-		if err != nil {
-			log.Fatalf("failed to parse cost: %v", err)
+	}
+	if globalConfig.LocalForecast.Method != "" {
+		if err := forecastLocally(globalConfig.HistoryFile); err != nil {
+			log.Fatalf("%v", err)
 		}
-		child := strings.Join(parts[2:], " ")
+	}
+	if globalConfig.HistoryFile != "" {
+		if err := appendHistory(globalConfig.HistoryFile); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
 
-		if _, ok := results[parent]; !ok {
-			results[parent] = make(map[string]float64)
+	// Generate each output from the same costs, so that several formats cost a single fetch
+	var files []string
+	for _, format := range outputFormatList(options.format) {
+		checkCanceled()
+		file, err := writeOutput(format)
+		if err != nil {
+			checkCanceled()
+			log.Fatalf("failed to write %s output: %v", format, err)
 		}
-		results[parent][child] = cost
+		files = append(files, file)
 	}
+	if options.publish {
+		if err := publishFiles(files); err != nil {
+			log.Fatalf("failed to publish: %v", err)
+		}
+	}
+	if err := sendNotifications(notifyList(options.notify), files); err != nil {
+		log.Fatalf("failed to notify: %v", err)
+	}
+	exitOnFetchFailures()
 }
 
-func fetchData(accountName string, devMode bool) {
-	log.Printf("Fetching data for %s\n", accountName)
-
-	// Region doesn't matter for cost explorer since its a global service
-	cfg, err := config.LoadDefaultConfig(context.TODO(), config.WithRegion("us-east-1"))
+// setupRun loads and validates the config, failing before any costs are fetched, and returns the hierarchy to fetch
+func setupRun() []Level {
+	// Load config from file, overridden by the environment and flags
+	if err := readConfig(options.configFile); err != nil {
+		log.Fatalf("%v", err)
+	}
+	hierarchy, err := setupConfig()
 	if err != nil {
-		log.Fatalf("unable to load SDK config, %v", err)
+		log.Fatalf("%v", err)
 	}
+	return hierarchy
+}
 
-	svc := costexplorer.NewFromConfig(cfg)
+// setupConfig applies the flags to the config read and validates it
+func setupConfig() ([]Level, error) {
+	if options.granularity != "" {
+		globalConfig.Granularity = options.granularity
+	}
+	globalConfig.Granularity = strings.ToUpper(globalConfig.Granularity)
+	switch globalConfig.Granularity {
+	case "":
+		globalConfig.Granularity = string(types.GranularityMonthly)
+	case string(types.GranularityMonthly), string(types.GranularityDaily), string(types.GranularityHourly):
+	default:
+		return nil, fmt.Errorf("unknown granularity: %s", globalConfig.Granularity)
+	}
 
-	var groupBy []types.GroupDefinition
-	if devMode {
-		groupBy = []types.GroupDefinition{
-			{Type: types.GroupDefinitionTypeTag, Key: aws.String("environment")},
-			{Type: types.GroupDefinitionTypeDimension, Key: aws.String("USAGE_TYPE")},
-		}
-	} else {
-		groupBy = []types.GroupDefinition{
-			{Type: types.GroupDefinitionTypeTag, Key: aws.String("environment")},
-			{Type: types.GroupDefinitionTypeDimension, Key: aws.String("SERVICE")},
-		}
+	switch globalConfig.Metric {
+	case "":
+		globalConfig.Metric = "AmortizedCost"
+	case "AmortizedCost", "BlendedCost", "UnblendedCost", "NetAmortizedCost", "NetUnblendedCost":
+	default:
+		return nil, fmt.Errorf("unknown metric: %s", globalConfig.Metric)
 	}
 
-	input := &costexplorer.GetCostAndUsageInput{
-		TimePeriod: &types.DateInterval{
-			Start: aws.String(globalConfig.StartDate),
-			End:   aws.String(globalConfig.EndDate),
-		},
-		Granularity: types.GranularityMonthly,
-		Metrics:     []string{"AmortizedCost"},
-		GroupBy:     groupBy,
+	if globalConfig.Source != "" && globalConfig.Source != "costexplorer" && globalConfig.Source != "cur" && globalConfig.Source != "athena" && globalConfig.Source != "billingconductor" {
+		return nil, fmt.Errorf("unknown source: %s", globalConfig.Source)
 	}
 
-	result, err := svc.GetCostAndUsage(context.TODO(), input)
-	if err != nil {
-		log.Fatalf("failed to get cost data: %v", err)
+	switch globalConfig.ChartType {
+	case "":
+		globalConfig.ChartType = ChartTypeSankey
+	case ChartTypeSankey, ChartTypeTreemap, ChartTypeSunburst:
+	default:
+		return nil, fmt.Errorf("unknown chart type: %s", globalConfig.ChartType)
 	}
 
-	prepareResults(accountName, result)
-}
+	if globalConfig.ThresholdPercent < 0 || globalConfig.ThresholdPercent > 100 {
+		return nil, fmt.Errorf("thresholdPercent must be between 0 and 100: %g", globalConfig.ThresholdPercent)
+	}
 
-func prepareResults(accountName string, result *costexplorer.GetCostAndUsageOutput) {
-	for _, resultByTime := range result.ResultsByTime {
-		log.Printf("Processing data for %s from %s to %s\n", accountName, *resultByTime.TimePeriod.Start, *resultByTime.TimePeriod.End)
+	// Levels are named by the checks below, e.g. of the CloudWatch levels
+	hierarchy, err := parseHierarchy(globalConfig.Hierarchy, options.devMode)
+	if err != nil {
+		return nil, err
+	}
+	if hierarchy, err = applyRegion(hierarchy, options.regionMode); err != nil {
+		return nil, err
+	}
+	hierarchyLevels = hierarchy
+	if !options.dryRun {
+		if err := loadTeams(); err != nil {
+			return nil, err
+		}
+	}
 
-		for _, group := range resultByTime.Groups {
-			environment := group.Keys[0]
-			service := group.Keys[1]
+	checks := []func() error{
+		resolvePeriod,
+		checkFormats,
+		checkStdout,
+		checkRecordReplay,
+		func() error { return checkNotify(options.notify) },
+		func() error { return checkPublish(options.publish) },
+		func() error { return checkCloudWatch(options.cloudWatch) },
+		validateLayout,
+		trendPeriod,
+		validateHistoryAnomalies,
+		validateLocalForecast,
+		validateAllocations,
+		validateUnits,
+		checkLocale,
+		compileColors,
+	}
+	for _, check := range checks {
+		if err := check(); err != nil {
+			return nil, err
+		}
+	}
 
-			// Prettify cluster name
-			if len(environment) > len("environment$") {
-				environment = environment[len("environment$"):]
-			} else {
-				environment = fmt.Sprintf("%s-unknown", accountName)
-			}
+	if globalConfig.Exchange.Currency != "" {
+		globalConfig.Exchange.Currency = strings.ToUpper(globalConfig.Exchange.Currency)
+		currency = globalConfig.Exchange.Currency
+	}
+	if globalConfig.Exchange.Source != "" && globalConfig.Exchange.Source != "ecb" {
+		return nil, fmt.Errorf("unknown exchange rate source: %s", globalConfig.Exchange.Source)
+	}
 
-			// Parse cost, round the fractions, and ignore those below threshold
-			amount := group.Metrics["AmortizedCost"].Amount
-			amountFloat64, err := strconv.ParseFloat(*amount, 32)
-			amountFloat64 = math.Round(amountFloat64)
-			if err != nil {
-				log.Fatalf("failed to parse amount: %v", err)
-			}
+	for _, account := range globalConfig.Accounts {
+		if account.Provider != "" && account.Provider != ProviderAWS && account.Provider != ProviderAzure {
+			return nil, fmt.Errorf("unknown provider %s for %s", account.Provider, account.Name)
+		}
+	}
 
-			// Aggregate costs by account
-			if _, ok := results["all"]; !ok {
-				results["all"] = make(map[string]float64)
-			}
-			results["all"][accountName] += amountFloat64
+	if globalConfig.RecordTypes != "" && globalConfig.RecordTypes != "branch" && globalConfig.RecordTypes != "net" {
+		return nil, fmt.Errorf("unknown record types mode: %s", globalConfig.RecordTypes)
+	}
 
-			// Aggregate costs by environment
-			if _, ok := results[accountName]; !ok {
-				results[accountName] = make(map[string]float64)
-			}
-			results[accountName][environment] += amountFloat64
+	if options.negative != "" {
+		globalConfig.NegativeCosts = options.negative
+	}
+	if globalConfig.NegativeCosts != "" && globalConfig.NegativeCosts != "branch" && globalConfig.NegativeCosts != "net" {
+		return nil, fmt.Errorf("unknown negative costs mode: %s", globalConfig.NegativeCosts)
+	}
 
-			// Aggregate costs by service within environment
-			if _, ok := results[environment]; !ok {
-				results[environment] = make(map[string]float64)
-			}
-			results[environment][service] += amountFloat64
-		}
+	if globalConfig.Concurrency == 0 {
+		globalConfig.Concurrency = defaultConcurrency
+	}
+	if globalConfig.Cache.TTL == 0 {
+		globalConfig.Cache.TTL = defaultCacheTTL
+	}
+	if globalConfig.MaxAttempts == 0 {
+		globalConfig.MaxAttempts = defaultMaxAttempts
+	}
+	if globalConfig.MaxBackoff == 0 {
+		globalConfig.MaxBackoff = defaultMaxBackoff
 	}
-}
 
-func generateText(outputFile string) {
-	log.Printf("Generating text output...")
+	return hierarchy, nil
+}
 
-	f, err := os.Create(outputFile)
+// fetchOrganization fetches the costs of the active accounts of the organization with the credentials of the
+// management account. Failing to list the accounts is reported like a failed account, as nothing can be fetched.
+func fetchOrganization(management Account, hierarchy []Level) error {
+	cfg, err := accountConfig(management)
 	if err != nil {
-		log.Fatalf("failed to open output file: %v", err)
+		return fmt.Errorf("failed to load credentials of management account: %w", err)
 	}
-	defer f.Close()
-
-	for parent, children := range results {
-		for child, cost := range children {
-			result := fmt.Sprintf("%s [%.2f] %s\n", parent, cost, child)
-			if _, err := f.WriteString(result); err != nil {
-				log.Fatalf("failed to write to output file: %v", err)
-			}
+	accounts, err := listOrganizationAccounts(cfg, globalConfig.OrganizationalUnits)
+	if err != nil {
+		return err
+	}
+	svc := costexplorer.NewFromConfig(cfg)
+	startProgress(len(accounts))
+	forEachConcurrently(len(accounts), globalConfig.Concurrency, func(i int) {
+		account := accounts[i]
+		accountStarted(aws.ToString(account.Name))
+		handleAccountError(aws.ToString(account.Name), fetchAccount(aws.ToString(account.Name), aws.ToString(account.Id), svc, hierarchy))
+		accountDone(aws.ToString(account.Name))
+	})
+	stopProgress()
+	if options.detectAnomalies {
+		handleAccountError(management.Name, fetchAnomalies(management.Name, svc))
+	}
+	if options.trackBudgets {
+		accountNames := make(map[string]string)
+		for _, account := range accounts {
+			accountNames[aws.ToString(account.Id)] = aws.ToString(account.Name)
 		}
+		return fetchBudgets(management.Name, cfg, "all", accountNames)
 	}
+	return nil
 }
 
-func generateChart(outputFile string) {
-	log.Printf("Generating chart output...")
-
-	sankeyNode := make([]opts.SankeyNode, 0)
-	sankeyLink := make([]opts.SankeyLink, 0)
+// fetchAccount fetches the costs of an account along with the optional breakdowns, stopping at the first error
+func fetchAccount(accountName string, linkedAccountID string, svc costExplorerAPI, hierarchy []Level) error {
+	if err := fetchData(accountName, linkedAccountID, svc, hierarchy); err != nil {
+		return err
+	}
+	if options.forecast {
+		if err := fetchForecast(accountName, linkedAccountID, svc); err != nil {
+			return err
+		}
+	}
+	if options.commitments {
+		if err := fetchCommitments(accountName, linkedAccountID, svc); err != nil {
+			return err
+		}
+	}
+	if options.resources != "" {
+		return fetchResources(accountName, linkedAccountID, svc, options.resources)
+	}
+	return nil
+}
 
-	// Add all links
-	for parent, children := range results {
-		for child, cost := range children {
-			if cost >= globalConfig.Threshold {
-				sankeyLink = append(sankeyLink, opts.SankeyLink{Source: parent, Target: child, Value: float32(cost)})
+// loadResults fetches or reads the costs of the configured period into the results
+func loadResults(hierarchy []Level) error {
+	// Load results from file if inputFile is provided
+	// Otherwise, fetch data from the Cost and Usage Report, Athena, Billing Conductor or from each account via AWS Cost Explorer API
+	if options.inputFile != "" {
+		if err := readInput(options.inputFile); err != nil {
+			return err
+		}
+	} else if globalConfig.Source == "cur" || globalConfig.Source == "athena" || globalConfig.Source == "billingconductor" {
+		// The first account, if any, provides the credentials to access the report
+		account := Account{Name: globalConfig.Source}
+		if len(globalConfig.Accounts) > 0 {
+			account = globalConfig.Accounts[0]
+		}
+		cfg, err := accountConfig(account)
+		switch {
+		case err != nil:
+			handleAccountError(account.Name, err)
+		case globalConfig.Source == "cur":
+			handleAccountError(globalConfig.Source, fetchFrom(curProvider{cfg}, hierarchy))
+		case globalConfig.Source == "athena":
+			handleAccountError(globalConfig.Source, fetchFrom(athenaProvider{cfg}, hierarchy))
+		default:
+			handleAccountError(globalConfig.Source, fetchFrom(billingConductorProvider{cfg}, hierarchy))
+		}
+	} else if globalConfig.Organization {
+		// The first account, if any, is used as the management account
+		management := Account{Name: "management"}
+		if len(globalConfig.Accounts) > 0 {
+			management = globalConfig.Accounts[0]
+		}
+		handleAccountError(management.Name, fetchOrganization(management, hierarchy))
+	} else {
+		awsAccounts := 0
+		for _, account := range globalConfig.Accounts {
+			if account.Provider == "" || account.Provider == ProviderAWS {
+				awsAccounts++
 			}
 		}
+		startProgress(awsAccounts)
+		forEachConcurrently(len(globalConfig.Accounts), globalConfig.Concurrency, func(i int) {
+			account := globalConfig.Accounts[i]
+			if account.Provider != "" && account.Provider != ProviderAWS {
+				return
+			}
+			accountStarted(account.Name)
+			defer accountDone(account.Name)
+			cfg, err := accountConfig(account)
+			if err != nil {
+				handleAccountError(account.Name, err)
+				return
+			}
+			svc := costexplorer.NewFromConfig(cfg)
+			err = fetchAccount(account.Name, "", svc, hierarchy)
+			if err == nil && options.detectAnomalies {
+				err = fetchAnomalies(account.Name, svc)
+			}
+			if err == nil && options.trackBudgets {
+				err = fetchBudgets(account.Name, cfg, account.Name, nil)
+			}
+			handleAccountError(account.Name, err)
+		})
+		stopProgress()
 	}
 
-	// Only add nodes that have links
-	for _, link := range sankeyLink {
-		var nodeName string
-		nodeName = link.Source.(string)
-		if !hasNode(nodeName, sankeyNode) {
-			sankeyNode = append(sankeyNode, opts.SankeyNode{Name: nodeName})
+	// Show friendly names instead of account IDs, using the first account to query Organizations
+	if options.inputFile == "" {
+		account := Account{Name: "default"}
+		if len(globalConfig.Accounts) > 0 {
+			account = globalConfig.Accounts[0]
 		}
-		nodeName = link.Target.(string)
-		if !hasNode(nodeName, sankeyNode) {
-			sankeyNode = append(sankeyNode, opts.SankeyNode{Name: nodeName})
+		if err := resolveAccountNames(account); err != nil {
+			return err
 		}
 	}
 
-	sankey := charts.NewSankey()
-	sankey.SetGlobalOptions(
-		charts.WithTitleOpts(opts.Title{
-			Title: "AWS Cost Analysis",
-		}),
-		charts.WithInitializationOpts(opts.Initialization{
-			Width:  globalConfig.Width,
-			Height: globalConfig.Height,
-			Theme:  "westeros",
-		}),
-	)
-
-	seriesName := fmt.Sprintf("%s-%s > $%.0f", globalConfig.StartDate, globalConfig.EndDate, globalConfig.Threshold)
-	sankey.AddSeries(seriesName, sankeyNode, sankeyLink, charts.WithLabelOpts(opts.Label{
-		Show:      opts.Bool(true),
-		FontSize:  12,
-		Formatter: "{c} {b}",
-	}))
-
-	page := components.NewPage()
-	page.AddCharts(sankey)
-
-	f, err := os.Create(outputFile)
-	if err != nil {
-		log.Fatalf("error: %v", err)
+	// Break down in-cluster spend of EKS environments
+	for _, cluster := range globalConfig.Kubernetes {
+		handleAccountError(cluster.Environment, fetchFrom(kubernetesProvider{cluster}, hierarchy))
 	}
-	page.Render(io.MultiWriter(f))
-}
 
-func hasNode(name string, nodes []opts.SankeyNode) bool {
-	for _, n := range nodes {
-		if n.Name == name {
-			return true
+	// Add Azure subscriptions and GCP billing data with a top-level node per cloud
+	var azureAccounts []Account
+	for _, account := range globalConfig.Accounts {
+		if account.Provider == ProviderAzure {
+			azureAccounts = append(azureAccounts, account)
 		}
 	}
-	return false
-}
-
-func analyze(filename string) {
-	log.Printf("Analyzing with OpenAI...")
-
-	data, err := os.ReadFile(filename)
-	if err != nil {
-		log.Fatalf("failed to read file: %v", err)
+	if len(azureAccounts) > 0 || globalConfig.GCP.Table != "" {
+		nestUnder("AWS")
 	}
-
-	requestBody, err := json.Marshal(map[string]interface{}{
-		"messages": []map[string]string{
-			{"role": "system", "content": globalConfig.Prompt},
-			{"role": "user", "content": string(data)},
-		},
-		"model":      globalConfig.Model,
-		"max_tokens": globalConfig.MaxTokens,
-	})
-
-	if err != nil {
-		log.Fatalf("failed to marshal request body: %v", err)
+	for _, account := range azureAccounts {
+		handleAccountError(account.Name, fetchFrom(azureProvider{account}, hierarchy))
+	}
+	if globalConfig.GCP.Table != "" {
+		handleAccountError("GCP", fetchFrom(gcpProvider{}, hierarchy))
 	}
 
-	req, err := http.NewRequest("POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(requestBody))
-	if err != nil {
-		log.Fatalf("failed to create request: %v", err)
+	// Merge FOCUS exports of other providers
+	if len(globalConfig.FOCUS.Files) > 0 {
+		handleAccountError("FOCUS", fetchFrom(focusProvider{}, hierarchy))
 	}
-	req.Header.Set("Content-Type", "application/json")
-	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", globalConfig.OpenAIKey))
 
-	client := &http.Client{}
-	resp, err := client.Do(req)
-	if err != nil {
-		log.Fatalf("failed to send request: %v", err)
+	// Rename verbose names, insert teams, allocate shared costs, drop filtered nodes and move negative costs before anything is written, so all outputs and the history agree
+	separateLevels()
+	applyAliases()
+	applyTeams()
+	applyAllocations()
+	if err := validateGraph(); err != nil {
+		return err
+	}
+	if err := applyFilters(); err != nil {
+		return err
 	}
-	defer resp.Body.Close()
+	applyNegativeCosts()
+	return nil
+}
 
-	var responseBody map[string]interface{}
-	body, err := io.ReadAll(resp.Body)
-	if err != nil {
-		log.Fatalf("failed to read response body: %v", err)
+// outputFormatList returns the formats of a comma separated -f, e.g. "chart,text,json", without duplicates. The
+// interactive terminal view comes last so that the files are written first.
+func outputFormatList(format string) []string {
+	var formats []string
+	tui := false
+	for _, f := range strings.Split(format, ",") {
+		f = strings.TrimSpace(f)
+		switch {
+		case f == "tui":
+			tui = true
+		case f != "" && !slices.Contains(formats, f):
+			formats = append(formats, f)
+		}
 	}
-	if err := json.Unmarshal(body, &responseBody); err != nil {
-		log.Fatalf("failed to decode response body: %v", err)
+	if tui {
+		formats = append(formats, "tui")
 	}
+	return formats
+}
 
-	choices, ok := responseBody["choices"].([]interface{})
-	if !ok || len(choices) == 0 {
-		log.Fatalf("no choices in response body")
+// checkFormats fails on unknown output formats and placeholders of the output file name before any costs are fetched
+func checkFormats() error {
+	if unknown := unknownPlaceholders(options.outputFile); len(unknown) > 0 {
+		return fmt.Errorf("unknown placeholder %s in output file name, use one of {%s}", unknown[0], strings.Join(outputPlaceholders, "}, {"))
+	}
+	formats := outputFormatList(options.format)
+	if len(formats) == 0 {
+		return fmt.Errorf("no output format given, e.g. -f chart or -f chart,text,json")
+	}
+	for _, format := range formats {
+		if _, ok := lookupOutputFormat(format); !ok {
+			return fmt.Errorf("unknown format: %s", format)
+		}
 	}
+	return nil
+}
 
-	message, ok := choices[0].(map[string]interface{})["message"].(map[string]interface{})
-	if !ok {
-		log.Fatalf("no message in first choice")
+// readInput reads the results from a JSON graph, CSV edge list or text file
+func readInput(inputFile string) error {
+	if isJSONInput(inputFile) {
+		return readJSONData(inputFile)
+	} else if isCSVInput(inputFile) {
+		return readCSVData(inputFile)
 	}
-	text, ok := message["content"].(string)
-	if !ok {
-		log.Fatalf("no content in message")
+	return readData(inputFile)
+}
+
+func readData(inputFile string) error {
+	infof("Reading data from %s", inputFile)
+
+	data, err := readInputFile(inputFile)
+	if err != nil {
+		return err
 	}
 
-	log.Printf("OpenAI analysis:\n%s", text)
+	lines := string(data)
+	for _, line := range strings.Split(lines, "\n") {
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		parts := strings.Fields(line)
+		if len(parts) < 3 {
+			return fmt.Errorf("invalid line format: %s", line)
+		}
+		parent := parts[0]
+		costStr := strings.Trim(parts[1], "[]")
+		cost, err := strconv.ParseFloat(costStr, 64)
+		if err != nil {
+			return fmt.Errorf("failed to parse cost: %v", err)
+		}
+		child := strings.Join(parts[2:], " ")
+
+		if _, ok := results[parent]; !ok {
+			results[parent] = make(map[string]float64)
+		}
+		results[parent][child] = cost
+	}
+	return nil
 }
@@ -0,0 +1,116 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// generateMarkdown writes a report with the totals per account and the top children of each node
+// below the accounts, e.g. the top services per environment. The diagram is written as a PNG image
+// next to the report and embedded by a relative link, followed by a Mermaid block rendered natively
+// by GitHub and GitLab.
+func generateMarkdown(outputFile string, imageFile string) error {
+	infof("Generating markdown output...")
+
+	f, err := os.Create(imageFile)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	err = writePNG(f)
+	f.Close()
+	if err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	mermaid, err := mermaidSankey()
+	if err != nil {
+		return err
+	}
+
+	graph := buildGraph()
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# %s\n\n", chartTitle())
+	if subtitle := chartSubtitle(); subtitle != "" {
+		fmt.Fprintf(&sb, "%s\n\n", subtitle)
+	}
+	fmt.Fprintf(&sb, "%s to %s, %s, total **%s**\n\n", globalConfig.StartDate, globalConfig.EndDate, globalConfig.Metric, formatCost(graph.Total, 2))
+	fmt.Fprintf(&sb, "![%s](%s)\n\n", chartTitle(), filepath.Base(imageFile))
+	fmt.Fprintf(&sb, "<details>\n<summary>Mermaid diagram</summary>\n\n```mermaid\n%s```\n\n</details>\n\n", mermaid)
+
+	accounts := sortedChildren("all")
+	fmt.Fprintf(&sb, "## Totals per %s\n\n", levelTitle(1))
+	fmt.Fprintf(&sb, "| %s | Cost | Share |\n|---|---:|---:|\n", markdownCell(levelTitle(1)))
+	for _, account := range accounts {
+		fmt.Fprintf(&sb, "| %s | %s | %s |\n", markdownCell(account.name), formatCost(account.cost, 2), percentOf(account.cost, graph.Total))
+	}
+
+	fmt.Fprintf(&sb, "\n## Top %d %s per %s\n", reportTopN, levelTitle(3), levelTitle(2))
+	for _, account := range accounts {
+		for _, group := range sortedChildren(account.name) {
+			children := sortedChildren(group.name)
+			if len(children) == 0 {
+				continue
+			}
+			fmt.Fprintf(&sb, "\n### %s / %s\n\n", markdownCell(account.name), markdownCell(group.name))
+			fmt.Fprintf(&sb, "| %s | Cost | Share |\n|---|---:|---:|\n", markdownCell(levelTitle(3)))
+			for i, child := range children {
+				if i == reportTopN {
+					break
+				}
+				fmt.Fprintf(&sb, "| %s | %s | %s |\n", markdownCell(child.name), formatCost(child.cost, 2), percentOf(child.cost, group.cost))
+			}
+		}
+	}
+
+	if rows := unitTable(); len(rows) > 0 {
+		fmt.Fprintf(&sb, "\n## Unit costs\n\n| Node | Cost | Units | Cost per unit |\n|---|---:|---:|---:|\n")
+		for _, row := range rows {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", markdownCell(row[0]), row[1], markdownCell(row[2]), row[3])
+		}
+	}
+
+	if globalConfig.UntaggedReport {
+		accounts, services, total := untaggedBreakdown(results)
+		fmt.Fprintf(&sb, "\n## Untagged costs\n\n")
+		fmt.Fprintf(&sb, "%s of %s untagged (%s)\n\n", formatCost(total.untagged, 2), formatCost(total.total, 2), percentOf(total.untagged, total.total))
+		for _, breakdown := range []struct {
+			title  string
+			spends []untaggedSpend
+		}{{levelTitle(1), accounts}, {"Service", services}} {
+			if len(breakdown.spends) == 0 {
+				continue
+			}
+			fmt.Fprintf(&sb, "| %s | Untagged | Total | Share |\n|---|---:|---:|---:|\n", markdownCell(breakdown.title))
+			for _, spend := range breakdown.spends {
+				fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", markdownCell(spend.name), formatCost(spend.untagged, 2), formatCost(spend.total, 2), percentOf(spend.untagged, spend.total))
+			}
+			fmt.Fprintf(&sb, "\n")
+		}
+		if trend := untaggedTrend(); len(trend) > 0 {
+			fmt.Fprintf(&sb, "| Period | Untagged | Total | Share |\n|---|---:|---:|---:|\n")
+			for _, period := range trend {
+				fmt.Fprintf(&sb, "| %s | %s | %s | %s |\n", period.name, formatCost(period.untagged, 2), formatCost(period.total, 2), percentOf(period.untagged, period.total))
+			}
+		}
+	}
+
+	if len(nodeForecasts) > 0 {
+		fmt.Fprintf(&sb, "\n## Forecast\n\n")
+		fmt.Fprintf(&sb, "| Level | Node | Projected | So far | Status |\n|---|---|---:|---:|---|\n")
+		for _, forecast := range nodeForecasts {
+			fmt.Fprintf(&sb, "| %s | %s | %s | %s | %s |\n", markdownCell(levelTitle(forecast.depth)), markdownCell(forecast.name),
+				formatCost(forecast.projected, 2), formatCost(forecast.actual, 2), forecastStatus(forecast))
+		}
+	}
+
+	if err := os.WriteFile(outputFile, []byte(sb.String()), 0644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// markdownCell escapes characters that would break a table cell
+func markdownCell(text string) string {
+	return strings.ReplaceAll(text, "|", "\\|")
+}
@@ -0,0 +1,31 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/render"
+)
+
+// mermaidSankey returns the visible links in Mermaid sankey-beta syntax
+func mermaidSankey() (string, error) {
+	var sb strings.Builder
+	if err := render.Mermaid(&sb, costgraph.Flows(visibleLinks(results))); err != nil {
+		return "", fmt.Errorf("failed to render Mermaid output: %w", err)
+	}
+	return sb.String(), nil
+}
+
+func generateMermaid(outputFile string) error {
+	infof("Generating Mermaid output...")
+
+	mermaid, err := mermaidSankey()
+	if err != nil {
+		return err
+	}
+	if err := writeOutputFile(outputFile, []byte(mermaid)); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,149 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Name of the branch of negative costs, e.g. credits and refunds, when negativeCosts is "branch"
+const creditsNode = "Credits"
+
+// Negative costs moved out of the diagram, keyed by the node they flowed into. Only populated when negativeCosts is set
+var negativeCosts = make(map[string]float64)
+
+// applyNegativeCosts removes negative links, which sankey diagrams can't show. "branch" moves their amount to a separate
+// Credits branch of the root and restores the costs of their parents, "net" subtracts it from the positive siblings
+// so that parents keep their net cost. Deeper links are handled first so that a parent turns positive once its
+// negative children are moved.
+func applyNegativeCosts() {
+	mode := globalConfig.NegativeCosts
+	handle := func(data map[string]map[string]float64, record bool) {
+		depths := costgraph.Flows(data).Depths()
+		var links []costgraph.Link
+		for parent, children := range data {
+			for child, cost := range children {
+				if cost < 0 {
+					links = append(links, costgraph.Link{Source: parent, Target: child, Value: cost})
+				}
+			}
+		}
+		if mode == "" {
+			if len(links) > 0 && record {
+				warnf("Found %d negative links, set negativeCosts to \"branch\" or \"net\" to render them", len(links))
+			}
+			return
+		}
+		sort.Slice(links, func(i, j int) bool {
+			if depths[links[i].Target] != depths[links[j].Target] {
+				return depths[links[i].Target] > depths[links[j].Target]
+			}
+			if links[i].Source != links[j].Source {
+				return links[i].Source < links[j].Source
+			}
+			return links[i].Target < links[j].Target
+		})
+
+		for _, link := range links {
+			cost, ok := data[link.Source][link.Target]
+			if !ok || cost >= 0 {
+				continue
+			}
+			delete(data[link.Source], link.Target)
+			if mode == "branch" {
+				addUp(data, link.Source, -cost)
+				addCost(data, "all", creditsNode, -cost)
+				addCost(data, creditsNode, creditNode(data, link.Target), -cost)
+			} else {
+				cost = -netNegative(data, link.Source, -cost)
+			}
+			if record && cost != 0 {
+				negativeCosts[link.Target] += cost
+			}
+		}
+		removeEmptyLinks(data)
+	}
+
+	handle(results, true)
+	for _, data := range bucketResults {
+		handle(data, false)
+	}
+	for _, data := range accountResults {
+		handle(data, false)
+	}
+}
+
+// creditNode returns the name of a node in the Credits branch, suffixed if the name is used elsewhere
+func creditNode(data map[string]map[string]float64, node string) string {
+	if _, ok := data[node]; ok || hasParent(data, node) {
+		return fmt.Sprintf("%s (credit)", node)
+	}
+	return node
+}
+
+// netNegative subtracts a negative amount from the positive children of the parent in proportion to their cost and
+// returns the amount netted. A parent without enough positive children is negative itself, and the rest is netted
+// when the link into the parent is handled.
+func netNegative(data map[string]map[string]float64, parent string, amount float64) float64 {
+	var positive float64
+	for _, cost := range data[parent] {
+		if cost > 0 {
+			positive += cost
+		}
+	}
+	netted := math.Min(amount, positive)
+	if positive == 0 {
+		return 0
+	}
+	for child, cost := range data[parent] {
+		if cost > 0 {
+			subtractDown(data, parent, child, netted*cost/positive)
+		}
+	}
+	return netted
+}
+
+// removeEmptyLinks removes links rounded to zero and nodes left without links
+func removeEmptyLinks(data map[string]map[string]float64) {
+	for parent, children := range data {
+		for child, cost := range children {
+			if math.Abs(cost) < filterEpsilon {
+				delete(children, child)
+			}
+		}
+		if len(children) == 0 {
+			delete(data, parent)
+		}
+	}
+}
+
+// negativeCostAnnotation summarizes the negative costs for the chart, e.g. "Credits -$120 shown separately"
+func negativeCostAnnotation() string {
+	var total float64
+	for _, cost := range negativeCosts {
+		total += cost
+	}
+	if total == 0 {
+		return ""
+	}
+	if globalConfig.NegativeCosts == "net" {
+		return fmt.Sprintf("%s %s netted", creditsNode, formatCost(total, 0))
+	}
+	return fmt.Sprintf("%s %s shown separately", creditsNode, formatCost(total, 0))
+}
+
+// negativeCostReport lists the negative costs for the text report
+func negativeCostReport() []string {
+	nodes := make([]string, 0, len(negativeCosts))
+	for node := range negativeCosts {
+		nodes = append(nodes, node)
+	}
+	sort.Strings(nodes)
+	lines := make([]string, 0, len(nodes))
+	for _, node := range nodes {
+		lines = append(lines, fmt.Sprintf("Negative cost %s: %s", node, formatCost(negativeCosts[node], 2)))
+	}
+	return lines
+}
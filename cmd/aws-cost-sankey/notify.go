@@ -0,0 +1,210 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"slices"
+	"sort"
+	"strings"
+	"time"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Number of top nodes and movers listed in notifications
+const notifyTopN = 5
+
+// NotifyConfig is shared by the notifiers. The link, e.g. to the chart hosted by serve or uploaded elsewhere, takes
+// placeholders like -o.
+type NotifyConfig struct {
+	Link string `yaml:"link"`
+}
+
+// notifier sends the summary of a run after its outputs are written, e.g. to a Slack channel
+type notifier struct {
+	name     string
+	validate func() error
+	send     func(summary runSummary) error
+}
+
+// Notifiers of -notify and schedule.notify
+var notifiers = []notifier{
+	{"slack", validateSlack, notifySlack},
+	{"email", validateEmail, notifyEmail},
+	{"msteams", validateMSTeams, notifyMSTeams},
+	{"webhook", validateWebhooks, notifyWebhooks},
+}
+
+func lookupNotifier(name string) (notifier, bool) {
+	for _, n := range notifiers {
+		if n.name == name {
+			return n, true
+		}
+	}
+	return notifier{}, false
+}
+
+func notifierNames() []string {
+	names := make([]string, 0, len(notifiers))
+	for _, n := range notifiers {
+		names = append(names, n.name)
+	}
+	return names
+}
+
+// notifyList returns the notifiers of a comma separated list, e.g. "slack", without duplicates
+func notifyList(list string) []string {
+	var names []string
+	for _, name := range strings.Split(list, ",") {
+		if name = strings.TrimSpace(name); name != "" && !slices.Contains(names, name) {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// checkNotify fails on unknown notifiers and missing settings before any costs are fetched
+func checkNotify(list string) error {
+	for _, name := range notifyList(list) {
+		n, ok := lookupNotifier(name)
+		if !ok {
+			return fmt.Errorf("unknown notifier %s, use one of %s", name, strings.Join(notifierNames(), ", "))
+		}
+		if err := n.validate(); err != nil {
+			return fmt.Errorf("%s notifications: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// runSummary is what notifications report of a run: the period, the total and largest nodes below the root, the
+// largest changes when compared, the AI analysis if any and the written files
+type runSummary struct {
+	Title     string
+	Start     string
+	End       string
+	Metric    string
+	Currency  string
+	Total     float64
+	Top       []costgraph.Node
+	Compared  string
+	Increases []mover
+	Decreases []mover
+	Analysis  string
+	Failures  []string
+	Files     []string
+	Link      string
+}
+
+// buildSummary summarizes the costs of the run and the written files
+func buildSummary(files []string) runSummary {
+	graph := buildGraph()
+	summary := runSummary{
+		Title:    chartTitle(),
+		Start:    globalConfig.StartDate,
+		End:      globalConfig.EndDate,
+		Metric:   globalConfig.Metric,
+		Currency: currency,
+		Total:    graph.Total,
+		Analysis: aiAnalysis,
+	}
+	for _, file := range files {
+		// Outputs written to stdout or the terminal
+		if file != "" && file != stdioName {
+			summary.Files = append(summary.Files, file)
+		}
+	}
+	for _, node := range graph.Nodes {
+		if node.Depth == 1 {
+			summary.Top = append(summary.Top, node)
+		}
+	}
+	sort.SliceStable(summary.Top, func(i, j int) bool { return summary.Top[i].Value > summary.Top[j].Value })
+	if len(summary.Top) > notifyTopN {
+		summary.Top = summary.Top[:notifyTopN]
+	}
+
+	if previousResults != nil {
+		summary.Compared = previousPeriod
+		summary.Increases, summary.Decreases = comparisonMovers()
+	} else if movers, first, _ := topMovers(); len(movers) > 0 {
+		// Changes between the first and last time bucket
+		summary.Compared = first
+		for _, m := range movers {
+			if m.last > m.first {
+				summary.Increases = append(summary.Increases, m)
+			} else {
+				summary.Decreases = append(summary.Decreases, m)
+			}
+		}
+	}
+	summary.Increases = firstMovers(summary.Increases)
+	summary.Decreases = firstMovers(summary.Decreases)
+
+	for _, failure := range fetchFailures {
+		summary.Failures = append(summary.Failures, failure.name)
+	}
+	if globalConfig.Notify.Link != "" {
+		summary.Link = expandOutputTemplate(globalConfig.Notify.Link, time.Now())
+	}
+	return summary
+}
+
+func firstMovers(movers []mover) []mover {
+	if len(movers) > notifyTopN {
+		return movers[:notifyTopN]
+	}
+	return movers
+}
+
+// lines returns the summary as plain text lines, e.g. for the fallback text of messages
+func (s runSummary) lines() []string {
+	lines := []string{
+		fmt.Sprintf("%s: %s %s from %s to %s", s.Title, s.Metric, formatCost(s.Total, 2), s.Start, s.End),
+	}
+	for _, node := range s.Top {
+		lines = append(lines, fmt.Sprintf("%s: %s", node.Name, formatCost(node.Value, 2)))
+	}
+	if s.Compared != "" {
+		lines = append(lines, fmt.Sprintf("Compared with %s", s.Compared))
+	}
+	for _, m := range append(append([]mover{}, s.Increases...), s.Decreases...) {
+		lines = append(lines, fmt.Sprintf("%s: %s to %s (%s)", m.name, formatCost(m.first, 2), formatCost(m.last, 2), formatChange(m)))
+	}
+	if len(s.Failures) > 0 {
+		lines = append(lines, fmt.Sprintf("Incomplete, failed to fetch %s", strings.Join(s.Failures, ", ")))
+	}
+	if s.Link != "" {
+		lines = append(lines, s.Link)
+	}
+	return lines
+}
+
+// formatChange returns the change of a mover with its sign, e.g. "+$120.00"
+func formatChange(m mover) string {
+	if m.last > m.first {
+		return "+" + formatCost(m.last-m.first, 2)
+	}
+	return formatCost(m.last-m.first, 2)
+}
+
+// sendNotifications sends the summary of the run to each notifier, returning the failures of all of them
+func sendNotifications(names []string, files []string) error {
+	if len(names) == 0 {
+		return nil
+	}
+	summary := buildSummary(files)
+	var errs []error
+	for _, name := range names {
+		n, ok := lookupNotifier(name)
+		if !ok {
+			errs = append(errs, fmt.Errorf("unknown notifier %s", name))
+			continue
+		}
+		infof("Sending %s notification...", name)
+		if err := n.send(summary); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %v", name, err))
+		}
+	}
+	return errors.Join(errs...)
+}
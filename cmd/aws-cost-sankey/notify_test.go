@@ -0,0 +1,45 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// twoAccounts returns the costs notified by the tests: two accounts of different size with one service each
+func twoAccounts() costgraph.Flows {
+	return costgraph.Flows{"all": {"acct1": 100, "acct2": 20}, "acct1": {"AWS Lambda": 100}, "acct2": {"AWS Lambda": 20}}
+}
+
+// testServer serves the requests of a test until it ends and returns its URL
+func testServer(t *testing.T, handler http.HandlerFunc) string {
+	t.Helper()
+	server := httptest.NewServer(handler)
+	t.Cleanup(server.Close)
+	return server.URL
+}
+
+// setGlobal sets a global, e.g. the URL of an API, until the test ends
+func setGlobal[T any](t *testing.T, global *T, value T) {
+	saved := *global
+	*global = value
+	t.Cleanup(func() { *global = saved })
+}
+
+func TestBuildSummary(t *testing.T) {
+	setupRunTest(t, Config{StartDate: "2024-10-01", EndDate: "2024-11-01"}, twoAccounts())
+
+	summary := buildSummary([]string{"chart.html", "", stdioName})
+	if summary.Total != 120 || len(summary.Top) != 2 || summary.Top[0].Name != "acct1" {
+		t.Errorf("summary = %+v, want the total and the accounts, largest first", summary)
+	}
+	if len(summary.Files) != 1 || summary.Files[0] != "chart.html" {
+		t.Errorf("files = %v, want only the written file", summary.Files)
+	}
+	if text := strings.Join(summary.lines(), "\n"); !strings.Contains(text, "$120.00 from 2024-10-01 to 2024-11-01") || !strings.Contains(text, "acct1: $100.00") {
+		t.Errorf("lines = %q, want the period, total and top accounts", text)
+	}
+}
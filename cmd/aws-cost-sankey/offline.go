@@ -0,0 +1,78 @@
+package main
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Host of the echarts library and themes referenced by the rendered pages
+const assetsHost = "https://go-echarts.github.io/go-echarts-assets/assets/"
+
+var scriptPattern = regexp.MustCompile(`<script src="(https?://[^"]+)"></script>`)
+
+// Set by the -offline flag to inline the scripts into the page
+var offlineMode bool
+
+// inlineAssets replaces the scripts loaded from the network by their content, so the page renders without internet access
+func inlineAssets(page string) (string, error) {
+	var err error
+	inlined := scriptPattern.ReplaceAllStringFunc(page, func(tag string) string {
+		url := scriptPattern.FindStringSubmatch(tag)[1]
+		asset, assetErr := offlineAsset(url)
+		if assetErr != nil {
+			err = assetErr
+			return tag
+		}
+		script := strings.ReplaceAll(string(asset), "</script", `<\/script`)
+		return fmt.Sprintf("<script>%s</script>", script)
+	})
+	return inlined, err
+}
+
+// offlineAsset returns the content of the asset at the given URL. Assets are read from assetsDir when configured,
+// e.g. on air-gapped networks, otherwise they are downloaded once and kept in the cache directory.
+func offlineAsset(url string) ([]byte, error) {
+	name := strings.TrimPrefix(url, assetsHost)
+	if name == url {
+		name = filepath.Base(url)
+	}
+
+	if globalConfig.AssetsDir != "" {
+		data, err := os.ReadFile(filepath.Join(globalConfig.AssetsDir, filepath.FromSlash(name)))
+		if err != nil {
+			return nil, fmt.Errorf("failed to read asset %s: %w", name, err)
+		}
+		return data, nil
+	}
+
+	cached := filepath.Join(cacheDir(), "assets", filepath.FromSlash(name))
+	if data, err := os.ReadFile(cached); err == nil {
+		return data, nil
+	}
+
+	infof("Downloading %s", url)
+	resp, err := httpGet(url)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download asset %s: %w", name, err)
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to download asset %s: %s", name, resp.Status)
+	}
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("failed to download asset %s: %w", name, err)
+	}
+
+	if err := os.MkdirAll(filepath.Dir(cached), 0755); err != nil {
+		warnf("Unable to cache asset %s: %v", name, err)
+	} else if err := os.WriteFile(cached, data, 0644); err != nil {
+		warnf("Unable to cache asset %s: %v", name, err)
+	}
+	return data, nil
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+)
+
+// Analysis of the report of the run, included in the ai formats and in notifications
+var aiAnalysis string
+
+// analyze returns the OpenAI analysis of a report
+func analyze(filename string) (string, error) {
+	infof("Analyzing with OpenAI...")
+
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return "", fmt.Errorf("failed to read file: %v", err)
+	}
+
+	requestBody, err := json.Marshal(map[string]interface{}{
+		"messages": []map[string]string{
+			{"role": "system", "content": globalConfig.Prompt},
+			{"role": "user", "content": string(data)},
+		},
+		"model":      globalConfig.Model,
+		"max_tokens": globalConfig.MaxTokens,
+	})
+
+	if err != nil {
+		return "", fmt.Errorf("failed to marshal request body: %v", err)
+	}
+
+	req, err := http.NewRequestWithContext(runContext, "POST", "https://api.openai.com/v1/chat/completions", bytes.NewBuffer(requestBody))
+	if err != nil {
+		return "", fmt.Errorf("failed to create request: %v", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", fmt.Sprintf("Bearer %s", globalConfig.OpenAIKey))
+
+	client := &http.Client{}
+	resp, err := client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to send request: %v", err)
+	}
+	defer resp.Body.Close()
+
+	var responseBody map[string]interface{}
+	body, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return "", fmt.Errorf("failed to read response body: %v", err)
+	}
+	if err := json.Unmarshal(body, &responseBody); err != nil {
+		return "", fmt.Errorf("failed to decode response body: %v", err)
+	}
+
+	choices, ok := responseBody["choices"].([]interface{})
+	if !ok || len(choices) == 0 {
+		return "", fmt.Errorf("no choices in response body")
+	}
+
+	message, ok := choices[0].(map[string]interface{})["message"].(map[string]interface{})
+	if !ok {
+		return "", fmt.Errorf("no message in first choice")
+	}
+	text, ok := message["content"].(string)
+	if !ok {
+		return "", fmt.Errorf("no content in message")
+	}
+
+	infof("OpenAI analysis:\n%s", text)
+	aiAnalysis = text
+	return text, nil
+}
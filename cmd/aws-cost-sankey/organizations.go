@@ -0,0 +1,170 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/organizations"
+	orgtypes "github.com/aws/aws-sdk-go-v2/service/organizations/types"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// listOrganizationAccounts returns all active accounts of the organization.
+// When organizational units are given, only accounts under those OUs (recursively) are returned.
+func listOrganizationAccounts(cfg aws.Config, organizationalUnits []string) ([]orgtypes.Account, error) {
+	if options.replay != "" {
+		var accounts []orgtypes.Account
+		if err := readRecording(recordedAccountsFile, &accounts); err != nil {
+			return nil, fmt.Errorf("failed to replay accounts of the organization: %w", err)
+		}
+		return accounts, nil
+	}
+	svc := organizations.NewFromConfig(cfg)
+
+	var accounts []orgtypes.Account
+	if len(organizationalUnits) == 0 {
+		infof("Listing all accounts in the organization")
+		paginator := organizations.NewListAccountsPaginator(svc, &organizations.ListAccountsInput{})
+		for paginator.HasMorePages() {
+			page, err := paginator.NextPage(runContext)
+			if err != nil {
+				return nil, fmt.Errorf("failed to list accounts: %w", err)
+			}
+			accounts = append(accounts, page.Accounts...)
+		}
+	} else {
+		for _, ou := range organizationalUnits {
+			ouAccounts, err := listAccountsForParent(svc, ou)
+			if err != nil {
+				return nil, err
+			}
+			accounts = append(accounts, ouAccounts...)
+		}
+	}
+
+	// Only keep active accounts, and avoid duplicates from overlapping OUs
+	active := make([]orgtypes.Account, 0, len(accounts))
+	seen := make(map[string]bool)
+	for _, account := range accounts {
+		id := aws.ToString(account.Id)
+		if account.Status != orgtypes.AccountStatusActive || seen[id] {
+			continue
+		}
+		seen[id] = true
+		active = append(active, account)
+	}
+	infof("Found %d active accounts", len(active))
+	if options.record != "" {
+		if err := writeRecording(recordedAccountsFile, active); err != nil {
+			return nil, err
+		}
+	}
+
+	return active, nil
+}
+
+func listAccountsForParent(svc *organizations.Client, parentID string) ([]orgtypes.Account, error) {
+	debugf("Listing accounts under %s", parentID)
+
+	var accounts []orgtypes.Account
+	accountPaginator := organizations.NewListAccountsForParentPaginator(svc, &organizations.ListAccountsForParentInput{
+		ParentId: aws.String(parentID),
+	})
+	for accountPaginator.HasMorePages() {
+		page, err := accountPaginator.NextPage(runContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list accounts for %s: %w", parentID, err)
+		}
+		accounts = append(accounts, page.Accounts...)
+	}
+
+	// Descend into nested organizational units
+	ouPaginator := organizations.NewListOrganizationalUnitsForParentPaginator(svc, &organizations.ListOrganizationalUnitsForParentInput{
+		ParentId: aws.String(parentID),
+	})
+	for ouPaginator.HasMorePages() {
+		page, err := ouPaginator.NextPage(runContext)
+		if err != nil {
+			return nil, fmt.Errorf("failed to list organizational units for %s: %w", parentID, err)
+		}
+		for _, ou := range page.OrganizationalUnits {
+			ouAccounts, err := listAccountsForParent(svc, aws.ToString(ou.Id))
+			if err != nil {
+				return nil, err
+			}
+			accounts = append(accounts, ouAccounts...)
+		}
+	}
+
+	return accounts, nil
+}
+
+var accountIDPattern = regexp.MustCompile(`^[0-9]{12}$`)
+
+// resolveAccountNames replaces nodes named after account IDs, e.g. from LINKED_ACCOUNT grouping, with friendly names.
+// Names come from the accountNames mapping of the config, otherwise from Organizations using the credentials of the given account.
+func resolveAccountNames(account Account) error {
+	names := make(map[string]string)
+	var svc *organizations.Client
+
+	// Names resolved from Organizations are recorded along with the Cost Explorer responses
+	recorded := make(map[string]string)
+	if options.replay != "" {
+		if err := readRecording(recordedNamesFile, &recorded); err != nil && !os.IsNotExist(err) {
+			return fmt.Errorf("failed to replay account names: %v", err)
+		}
+	}
+	for parent, children := range results {
+		for _, node := range append([]string{parent}, mapKeys(children)...) {
+			if _, ok := names[node]; ok || !accountIDPattern.MatchString(node) {
+				continue
+			}
+			if name, ok := globalConfig.AccountNames[node]; ok {
+				names[node] = name
+				continue
+			}
+			if options.replay != "" {
+				names[node] = node
+				if name, ok := recorded[node]; ok {
+					names[node] = name
+				}
+				continue
+			}
+
+			// Only the management account or a delegated administrator can describe accounts
+			if svc == nil {
+				cfg, err := accountConfig(account)
+				if err != nil {
+					warnf("Unable to resolve account names, keeping the IDs: %v", err)
+					return nil
+				}
+				svc = organizations.NewFromConfig(cfg)
+			}
+			result, err := svc.DescribeAccount(runContext, &organizations.DescribeAccountInput{AccountId: aws.String(node)})
+			if err != nil {
+				warnf("Unable to resolve name of account %s, keeping the ID: %v", node, err)
+				names[node] = node
+				continue
+			}
+			names[node] = aws.ToString(result.Account.Name)
+			recorded[node] = names[node]
+		}
+	}
+	if options.record != "" && len(recorded) > 0 {
+		if err := writeRecording(recordedNamesFile, recorded); err != nil {
+			return err
+		}
+	}
+
+	results.Rename(names)
+	for _, data := range bucketResults {
+		costgraph.Flows(data).Rename(names)
+	}
+	for _, data := range accountResults {
+		costgraph.Flows(data).Rename(names)
+	}
+	return nil
+}
@@ -0,0 +1,355 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+	"github.com/go-echarts/go-echarts/v2/types"
+
+	"aws-costexplorer/pkg/costgraph"
+	"aws-costexplorer/pkg/render"
+)
+
+func generateText(outputFile string) error {
+	infof("Generating text output...")
+
+	f, err := createOutputFile(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+
+	// Reports are written as comments so the file can still be read back as input
+	var comments []string
+	for _, report := range [][]string{
+		anomalyReport(),
+		commitmentReport,
+		budgetReport(),
+		exchangeReport(),
+		compareReport(),
+		historyAnomalyReport(),
+		localForecastReport(),
+		allocationReport,
+		untaggedReport(),
+		unitReport(),
+		negativeCostReport(),
+	} {
+		comments = append(comments, report...)
+	}
+	if err := render.Text(f, results, comments); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	return nil
+}
+
+func generateChart(outputFile string) error {
+	infof("Generating chart output...")
+
+	html, err := chartHTML()
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(outputFile, []byte(html), 0o644); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// chartHTML renders the page of the chart with the optional account, time series, trend and bucket charts
+func chartHTML() (string, error) {
+	page := components.NewPage()
+	page.SetPageTitle(chartTitle())
+	seriesName := fmt.Sprintf("%s-%s %s > %s", globalConfig.StartDate, globalConfig.EndDate, globalConfig.Metric, formatCost(globalConfig.Threshold, 0))
+	for _, annotation := range []string{recordTypeAnnotation(), negativeCostAnnotation()} {
+		if annotation != "" {
+			seriesName = fmt.Sprintf("%s (%s)", seriesName, annotation)
+		}
+	}
+	page.AddCharts(newChart(overviewChartID, chartTitle(), seriesName, results))
+
+	// One chart per account below the overview, linked from a navigation bar
+	var nav []navLink
+	if globalConfig.AccountCharts {
+		nav = addAccountCharts(page)
+	}
+
+	// Stacked bars of the selected level over time, answering when the costs were incurred
+	if globalConfig.TimeSeries != "" {
+		if bar := newTimeSeries(); bar != nil {
+			page.AddCharts(bar)
+		}
+	}
+
+	// One diagram with a timeline to scrub through the months of the trend
+	if globalConfig.TrendMonths > 0 {
+		if trend := newTrend(); trend != nil {
+			page.AddCharts(trend)
+		}
+	}
+
+	// One additional chart per time bucket, in chronological order
+	if globalConfig.TimeBuckets {
+		for _, bucket := range sortedBuckets() {
+			seriesName := fmt.Sprintf("%s %s > %s", bucket, globalConfig.Metric, formatCost(globalConfig.Threshold, 0))
+			page.AddCharts(newChart("", fmt.Sprintf("%s (%s)", chartTitle(), bucket), seriesName, bucketResults[bucket]))
+		}
+	}
+
+	var sb strings.Builder
+	if err := page.Render(&sb); err != nil {
+		return "", fmt.Errorf("failed to render chart: %w", err)
+	}
+	html := sb.String()
+	if len(nav) > 0 {
+		html = strings.Replace(html, "<body>", "<body>\n"+navBar(nav), 1)
+	}
+	if globalConfig.FlowTable {
+		table, err := flowTable()
+		if err != nil {
+			return "", err
+		}
+		html = strings.Replace(html, "</body>", table+"</body>", 1)
+	}
+	if offlineMode {
+		return inlineAssets(html)
+	}
+	return html, nil
+}
+
+// recordTypeAnnotation summarizes credits, refunds and taxes, e.g. "Credit -$120, Tax $30 netted"
+func recordTypeAnnotation() string {
+	recordTypes := make([]string, 0, len(recordTypeTotals))
+	for recordType := range recordTypeTotals {
+		recordTypes = append(recordTypes, recordType)
+	}
+	if len(recordTypes) == 0 {
+		return ""
+	}
+	sort.Strings(recordTypes)
+
+	parts := make([]string, 0, len(recordTypes))
+	for _, recordType := range recordTypes {
+		parts = append(parts, fmt.Sprintf("%s %s", recordType, formatCost(recordTypeTotals[recordType], 0)))
+	}
+
+	if globalConfig.RecordTypes == "net" {
+		return strings.Join(parts, ", ") + " netted"
+	}
+	return strings.Join(parts, ", ") + " shown separately"
+}
+
+// collectBuckets tells whether costs need to be kept per time bucket, either for a diagram per period, the time series or the trend
+func collectBuckets() bool {
+	return globalConfig.TimeBuckets || globalConfig.TimeSeries != "" || globalConfig.TrendMonths > 0
+}
+
+// sortedBuckets returns the time buckets in chronological order
+func sortedBuckets() []string {
+	buckets := make([]string, 0, len(bucketResults))
+	for bucket := range bucketResults {
+		buckets = append(buckets, bucket)
+	}
+	sort.Strings(buckets)
+	return buckets
+}
+
+func newSankey(chartID string, title string, seriesName string, data map[string]map[string]float64) *charts.Sankey {
+	visible := withTotalRoot(visibleLinks(data))
+	sankeyNode, sankeyLink := sankeyElements(visible)
+
+	sankey := charts.NewSankey()
+	sankey.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    title,
+			Subtitle: totalsSubtitle(visibleLinks(data)),
+		}),
+		charts.WithInitializationOpts(opts.Initialization{
+			ChartID: chartID,
+			Width:   globalConfig.Width,
+			Height:  globalConfig.Height,
+			Theme:   "westeros",
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: opts.Bool(true), Formatter: tooltipFormatter(sankeyTooltip(chartID, data))}),
+		chartToolbox(),
+	)
+
+	seriesOpts := []charts.SeriesOpts{charts.WithLabelOpts(opts.Label{
+		Show:      opts.Bool(true),
+		FontSize:  12,
+		Formatter: labelFormatter(costFormatter("{c} {b}")),
+	})}
+	if len(globalConfig.Colors) > 0 {
+		// Links take the color of their target so that flows into a category keep its color across charts
+		seriesOpts = append(seriesOpts, charts.WithLineStyleOpts(opts.LineStyle{Color: "target", Opacity: staticLinkOpacity}))
+	}
+	if globalConfig.LinkPercentages {
+		seriesOpts = append(seriesOpts, charts.WithSeriesOpts(func(s *charts.SingleSeries) {
+			s.EdgeLabel = map[string]interface{}{"show": true, "fontSize": 10, "formatter": linkFormatter(withTotalRoot(data))}
+		}))
+	}
+	if previousResults != nil && chartID == overviewChartID {
+		seriesOpts = append(seriesOpts, deltaLinks(sankeyLink))
+	}
+	sankey.AddSeries(seriesName, sankeyNode, sankeyLink, seriesOpts...)
+	applyLayout(sankey)
+
+	return sankey
+}
+
+// sankeyTooltip returns the default tooltip formatter of the overview, adding notes such as anomalies and unit costs
+func sankeyTooltip(chartID string, data map[string]map[string]float64) string {
+	if chartID != overviewChartID {
+		return costFormatter("{b}: {c}")
+	}
+	return notesTooltip("{b}: {c}", unitNotes(data), anomalyNotes())
+}
+
+// notesTooltip returns an echarts tooltip formatter appending notes to the tooltips of nodes, and of links keyed by "source > target"
+func notesTooltip(template string, nodeNotes map[string]string, linkNotes map[string]string) string {
+	if len(nodeNotes) == 0 && len(linkNotes) == 0 {
+		return costFormatter(template)
+	}
+	entries := func(notes map[string]string) string {
+		parts := make([]string, 0, len(notes))
+		for key, note := range notes {
+			parts = append(parts, fmt.Sprintf("%s: %s", jsString(key), jsString(note)))
+		}
+		sort.Strings(parts)
+		return strings.Join(parts, ", ")
+	}
+	return string(opts.FuncOpts(fmt.Sprintf("function (params) { var nodes = {%s}; var links = {%s}; var text = %s; "+
+		"var note = params.dataType === 'edge' ? links[params.data.source + ' > ' + params.data.target] : nodes[params.name]; "+
+		"return note ? text + '<br/>' + note : text; }", entries(nodeNotes), entries(linkNotes), costTemplate(template))))
+}
+
+// linkFormatter returns an echarts formatter labeling links with their cost and share of the source node, e.g. "$4,200 (37%)"
+func linkFormatter(data map[string]map[string]float64) string {
+	totals := make([]string, 0, len(data))
+	for parent, children := range data {
+		var total float64
+		for _, cost := range children {
+			total += cost
+		}
+		totals = append(totals, fmt.Sprintf("%s: %g", jsString(parent), total))
+	}
+	sort.Strings(totals)
+	return string(opts.FuncOpts(fmt.Sprintf("function (params) { var totals = {%s}; var total = totals[params.data.source]; "+
+		"return %s + (total ? ' (' + Math.round(params.value / total * 100) + '%%)' : ''); }", strings.Join(totals, ", "), costExpression())))
+}
+
+// chartTitle returns the configured title of charts and reports, with placeholders replaced
+func chartTitle() string {
+	if globalConfig.Title == "" {
+		return "AWS Cost Analysis"
+	}
+	return expandPlaceholders(globalConfig.Title)
+}
+
+// chartSubtitle returns the configured subtitle, e.g. a team name or the total spend
+func chartSubtitle() string {
+	return expandPlaceholders(globalConfig.Subtitle)
+}
+
+// expandPlaceholders replaces {start}, {end}, {metric}, {currency} and {total} with the values of this run
+func expandPlaceholders(text string) string {
+	if !strings.Contains(text, "{") {
+		return text
+	}
+	return strings.NewReplacer(
+		"{start}", globalConfig.StartDate,
+		"{end}", globalConfig.EndDate,
+		"{metric}", globalConfig.Metric,
+		"{currency}", currency,
+		"{total}", formatCost(buildGraph().Total, 0),
+	).Replace(text)
+}
+
+// labelFormatter returns the configured echarts label formatter, or the default of the chart type
+func labelFormatter(fallback string) string {
+	if globalConfig.LabelFormatter != "" {
+		return globalConfig.LabelFormatter
+	}
+	return fallback
+}
+
+// tooltipFormatter returns the configured echarts tooltip formatter, or the default of the chart type
+func tooltipFormatter(fallback string) types.FuncStr {
+	if globalConfig.TooltipFormatter != "" {
+		return types.FuncStr(globalConfig.TooltipFormatter)
+	}
+	return types.FuncStr(fallback)
+}
+
+// chartToolbox lets viewers download the chart as PNG, inspect the underlying numbers and restore the view
+func chartToolbox() charts.GlobalOpts {
+	return charts.WithToolboxOpts(opts.Toolbox{
+		Show: opts.Bool(true),
+		Feature: &opts.ToolBoxFeature{
+			SaveAsImage: &opts.ToolBoxFeatureSaveAsImage{Show: opts.Bool(true), Type: "png", Name: "aws-cost-sankey", Title: "Save as PNG"},
+			DataView:    &opts.ToolBoxFeatureDataView{Show: opts.Bool(true), Title: "Data", Lang: []string{"Data", "Close", "Refresh"}, BackgroundColor: "#fff"},
+			Restore:     &opts.ToolBoxFeatureRestore{Show: opts.Bool(true), Title: "Restore"},
+		},
+	})
+}
+
+// sankeyElements returns the nodes and links of the diagram. Only nodes that have links are added, placed at their
+// level of the hierarchy. echarts would otherwise move leaves such as credits to the last column.
+func sankeyElements(visible map[string]map[string]float64) ([]opts.SankeyNode, []opts.SankeyLink) {
+	sankeyNode := make([]opts.SankeyNode, 0)
+	sankeyLink := make([]opts.SankeyLink, 0)
+
+	// Add all links
+	for _, link := range costgraph.Flows(visible).Links() {
+		sankeyLink = append(sankeyLink, opts.SankeyLink{Source: link.Source, Target: link.Target, Value: float32(link.Value)})
+	}
+
+	depths := costgraph.Flows(visible).Depths()
+	for _, link := range sankeyLink {
+		var nodeName string
+		nodeName = link.Source.(string)
+		if !hasNode(nodeName, sankeyNode) {
+			sankeyNode = append(sankeyNode, newSankeyNode(nodeName, depths[nodeName]))
+		}
+		nodeName = link.Target.(string)
+		if !hasNode(nodeName, sankeyNode) {
+			sankeyNode = append(sankeyNode, newSankeyNode(nodeName, depths[nodeName]))
+		}
+	}
+	if globalConfig.Layout.SortByValue {
+		sortNodesByValue(sankeyNode, visible)
+	}
+	return sankeyNode, sankeyLink
+}
+
+func newSankeyNode(name string, depth int) opts.SankeyNode {
+	node := opts.SankeyNode{Name: name, Depth: &depth}
+	if color := nodeColor(name); color != "" {
+		node.ItemStyle = &opts.ItemStyle{Color: color}
+	}
+	return node
+}
+
+// highlightColor returns the color of nodes that need attention, or an empty string to use the theme color
+func highlightColor(name string) string {
+	if anomalousNodes[name] {
+		return anomalyColor
+	}
+	if isOverBudget(name) {
+		return overBudgetColor
+	}
+	return ""
+}
+
+func hasNode(name string, nodes []opts.SankeyNode) bool {
+	for _, n := range nodes {
+		if n.Name == name {
+			return true
+		}
+	}
+	return false
+}
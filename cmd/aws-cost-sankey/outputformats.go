@@ -0,0 +1,138 @@
+package main
+
+import (
+	"fmt"
+	"os"
+
+	"aws-costexplorer/pkg/render"
+)
+
+// outputFormat is an output format of -f, written to the output file name with the extension of the format
+type outputFormat struct {
+	name      string
+	extension string
+	stdout    bool // Can be written to stdout with -o -
+	generate  func(filename string) error
+}
+
+// Output formats of the command. They take precedence over the formats registered with the render package, which are
+// written from the JSON graph, see lookupOutputFormat.
+var commandFormats = []outputFormat{
+	{"text", ".txt", true, generateText},
+	{"chart", ".html", false, generateChart},
+	{"json", ".json", true, generateJSON},
+	{"csv", ".csv", false, func(filename string) error { return generateCSV(filename, outputFilename("-summary.csv")) }},
+	{"xlsx", ".xlsx", false, generateXLSX},
+	{"svg", ".svg", false, generateSVG},
+	{"png", ".png", false, generatePNG},
+	{"pdf", ".pdf", false, func(filename string) error { return generatePDF(filename, "") }},
+	{"markdown", ".md", false, func(filename string) error { return generateMarkdown(filename, outputFilename(".png")) }},
+	{"mermaid", ".mmd", true, generateMermaid},
+	{"tui", "", false, func(string) error { return generateTUI() }},
+	{"text+ai", ".txt", false, func(filename string) error {
+		if err := generateText(filename); err != nil {
+			return err
+		}
+		_, err := analyzeReport()
+		return err
+	}},
+	{"pdf+ai", ".pdf", false, func(filename string) error {
+		analysis, err := analyzeReport()
+		if err != nil {
+			return err
+		}
+		return generatePDF(filename, analysis)
+	}},
+}
+
+// lookupOutputFormat returns an output format of the command, or one registered with the render package
+func lookupOutputFormat(name string) (outputFormat, bool) {
+	if format, ok := lookupCommandFormat(name); ok {
+		return format, true
+	}
+	renderer, ok := render.Lookup(name)
+	if !ok {
+		return outputFormat{}, false
+	}
+	return outputFormat{name, renderer.Extension(), true, func(filename string) error {
+		infof("Generating %s output...", name)
+		return renderFile(filename, renderer)
+	}}, true
+}
+
+// outputFormatNames returns the names of the output formats of the command followed by the other registered formats
+func outputFormatNames() []string {
+	var names []string
+	for _, format := range commandFormats {
+		names = append(names, format.name)
+	}
+	for _, name := range render.Formats() {
+		if _, ok := lookupCommandFormat(name); !ok {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+func lookupCommandFormat(name string) (outputFormat, bool) {
+	for _, format := range commandFormats {
+		if format.name == name {
+			return format, true
+		}
+	}
+	return outputFormat{}, false
+}
+
+// stdoutFormatNames returns the names of the output formats that can be written to stdout
+func stdoutFormatNames() []string {
+	var names []string
+	for _, name := range outputFormatNames() {
+		if format, _ := lookupOutputFormat(name); format.stdout {
+			names = append(names, name)
+		}
+	}
+	return names
+}
+
+// renderFile writes the JSON graph of the costs to a file with a registered renderer
+func renderFile(filename string, renderer render.Renderer) error {
+	f, err := createOutputFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+
+	if err := renderer.Render(f, buildGraph()); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	return nil
+}
+
+// writeOutput generates the output of a format to a file named after -o, or to stdout, and returns the file name
+func writeOutput(name string) (string, error) {
+	format, ok := lookupOutputFormat(name)
+	if !ok {
+		return "", fmt.Errorf("unknown format: %s", name)
+	}
+	if format.extension == "" {
+		return "", format.generate("")
+	}
+	filename := outputFilename(format.extension)
+	if filename == stdioName {
+		return filename, format.generate(filename)
+	}
+
+	// Outputs are renamed once complete, so that interrupted runs don't leave half-written files
+	partial := partialFilename(filename)
+	setPartialFile(partial)
+	if err := format.generate(partial); err != nil {
+		removePartialFile()
+		return "", err
+	}
+	if err := os.Rename(partial, filename); err != nil {
+		removePartialFile()
+		return "", fmt.Errorf("failed to write output file: %v", err)
+	}
+	setPartialFile("")
+	return filename, nil
+}
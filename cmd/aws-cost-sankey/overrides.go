@@ -0,0 +1,176 @@
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+	"reflect"
+	"strings"
+	"unicode"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Prefix of environment variables overriding top-level config values, e.g. AWS_COST_SANKEY_START_DATE for startDate
+const envPrefix = "AWS_COST_SANKEY_"
+
+// configOverride replaces the value of a config key, e.g. "threshold" or "numberFormat.locale", with a YAML value
+type configOverride struct {
+	key   string
+	value *yaml.Node
+}
+
+// Config values set by flags, in the order given
+var flagOverrides []configOverride
+
+// overrideFlags add flags overriding config values, e.g. -start 2024-10-01 or -set numberFormat.locale=de-DE
+func overrideFlags(fs *flag.FlagSet) {
+	for _, override := range []struct{ name, key, usage string }{
+		{"start", "startDate", "(Optional) Start date YYYY-MM-DD. Overrides the config file"},
+		{"end", "endDate", "(Optional) End date YYYY-MM-DD, exclusive. Overrides the config file"},
+		{"metric", "metric", "(Optional) Cost metric, e.g. \"UnblendedCost\". Overrides the config file"},
+		{"threshold", "threshold", "(Optional) Hide links below this cost. Overrides the config file"},
+		{"width", "width", "(Optional) Width of the chart, e.g. \"1500px\". Overrides the config file"},
+		{"height", "height", "(Optional) Height of the chart, e.g. \"1300px\". Overrides the config file"},
+	} {
+		override := override
+		fs.Func(override.name, override.usage, func(value string) error {
+			flagOverrides = append(flagOverrides, configOverride{override.key, scalarNode(value)})
+			return nil
+		})
+	}
+	fs.Func("hierarchy", "(Optional) Comma separated levels, e.g. \"account,tag:environment,dimension:SERVICE\". Overrides the config file", func(value string) error {
+		levels := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, level := range strings.Split(value, ",") {
+			levels.Content = append(levels.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: strings.TrimSpace(level)})
+		}
+		flagOverrides = append(flagOverrides, configOverride{"hierarchy", levels})
+		return nil
+	})
+	fs.Func("set", "(Optional) Override any config value as key=value, e.g. \"numberFormat.locale=de-DE\" or \"totals=true\". Repeatable", func(value string) error {
+		key, text, ok := strings.Cut(value, "=")
+		if !ok || key == "" {
+			return fmt.Errorf("expected key=value: %s", value)
+		}
+		node, err := yamlValue(text)
+		if err != nil {
+			return err
+		}
+		flagOverrides = append(flagOverrides, configOverride{key, node})
+		return nil
+	})
+}
+
+// readConfig reads the config file into globalConfig, expanding references to environment variables and overriding
+// its values by environment variables and then by flags
+func readConfig(file string) error {
+	data, err := os.ReadFile(file)
+	if err != nil {
+		return fmt.Errorf("failed to read config: %v", err)
+	}
+	var doc yaml.Node
+	if err := yaml.Unmarshal(data, &doc); err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", file, err)
+	}
+	if len(doc.Content) == 0 {
+		doc = yaml.Node{Kind: yaml.DocumentNode, Content: []*yaml.Node{{Kind: yaml.MappingNode, Tag: "!!map"}}}
+	}
+	root := doc.Content[0]
+	if root.Kind != yaml.MappingNode {
+		return fmt.Errorf("config file %s is not a map of keys", file)
+	}
+
+	if err := expandEnv(root); err != nil {
+		return err
+	}
+	for _, key := range configKeys() {
+		name := envName(key)
+		text, ok := os.LookupEnv(name)
+		if !ok {
+			continue
+		}
+		node, err := yamlValue(text)
+		if err != nil {
+			return fmt.Errorf("failed to parse %s: %v", name, err)
+		}
+		setConfigValue(root, key, node)
+	}
+	for _, override := range flagOverrides {
+		setConfigValue(root, override.key, override.value)
+	}
+
+	if err := doc.Decode(&globalConfig); err != nil {
+		return fmt.Errorf("invalid config file %s: %v", file, err)
+	}
+	return resolveSecrets()
+}
+
+// configKeys returns the top-level keys of the config
+func configKeys() []string {
+	configType := reflect.TypeOf(Config{})
+	keys := make([]string, 0, configType.NumField())
+	for i := 0; i < configType.NumField(); i++ {
+		if key, _, _ := strings.Cut(configType.Field(i).Tag.Get("yaml"), ","); key != "" && key != "-" {
+			keys = append(keys, key)
+		}
+	}
+	return keys
+}
+
+// envName returns the environment variable of a config key, e.g. AWS_COST_SANKEY_START_DATE for startDate
+func envName(key string) string {
+	var sb strings.Builder
+	sb.WriteString(envPrefix)
+	for i, r := range key {
+		if unicode.IsUpper(r) && i > 0 {
+			sb.WriteByte('_')
+		}
+		sb.WriteRune(unicode.ToUpper(r))
+	}
+	return sb.String()
+}
+
+// setConfigValue sets a key such as "numberFormat.locale" of a mapping node, adding the maps on the way
+func setConfigValue(mapping *yaml.Node, key string, value *yaml.Node) {
+	name, rest, nested := strings.Cut(key, ".")
+	for i := 0; i+1 < len(mapping.Content); i += 2 {
+		if mapping.Content[i].Value != name {
+			continue
+		}
+		if !nested {
+			mapping.Content[i+1] = value
+			return
+		}
+		if mapping.Content[i+1].Kind != yaml.MappingNode {
+			mapping.Content[i+1] = &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+		}
+		setConfigValue(mapping.Content[i+1], rest, value)
+		return
+	}
+
+	keyNode := &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: name}
+	if !nested {
+		mapping.Content = append(mapping.Content, keyNode, value)
+		return
+	}
+	child := &yaml.Node{Kind: yaml.MappingNode, Tag: "!!map"}
+	mapping.Content = append(mapping.Content, keyNode, child)
+	setConfigValue(child, rest, value)
+}
+
+// yamlValue parses a value given on the command line or in the environment as YAML, e.g. "true", "[a, b]" or "{x: 1}"
+func yamlValue(text string) (*yaml.Node, error) {
+	var doc yaml.Node
+	if err := yaml.Unmarshal([]byte(text), &doc); err != nil {
+		return nil, err
+	}
+	if len(doc.Content) == 0 {
+		return scalarNode(text), nil
+	}
+	return doc.Content[0], nil
+}
+
+// scalarNode returns a value decoded like an unquoted YAML scalar, e.g. a number or a date
+func scalarNode(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
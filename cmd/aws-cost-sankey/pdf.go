@@ -0,0 +1,240 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"os"
+	"sort"
+
+	"github.com/go-pdf/fpdf"
+)
+
+// Number of rows listed in the breakdown and top movers tables
+const reportTopN = 10
+
+// generatePDF writes a paginated report with the diagram, a summary per account, the top movers
+// between the first and last time bucket and, if given, the AI analysis
+func generatePDF(outputFile string, analysis string) error {
+	infof("Generating PDF output...")
+
+	graph := buildGraph()
+
+	pdf := fpdf.New("L", "mm", "A4", "")
+	pdf.SetTitle(chartTitle(), true)
+	pdf.SetCreator("aws-cost-sankey", true)
+	pdf.SetAutoPageBreak(true, 15)
+	tr := pdf.UnicodeTranslatorFromDescriptor("")
+	pageWidth, pageHeight := pdf.GetPageSize()
+	left, top, right, _ := pdf.GetMargins()
+	contentWidth := pageWidth - left - right
+
+	heading := func(text string) {
+		pdf.SetFont("Helvetica", "B", 14)
+		pdf.CellFormat(0, 10, tr(text), "", 1, "", false, 0, "")
+	}
+	table := func(header []string, widths []float64, rows [][]string) {
+		pdf.SetFont("Helvetica", "B", 10)
+		pdf.SetFillColor(230, 230, 230)
+		for i, column := range header {
+			align := "L"
+			if i > 0 {
+				align = "R"
+			}
+			pdf.CellFormat(widths[i], 7, tr(column), "1", 0, align, true, 0, "")
+		}
+		pdf.Ln(-1)
+		pdf.SetFont("Helvetica", "", 10)
+		for _, row := range rows {
+			for i, value := range row {
+				align := "L"
+				if i > 0 {
+					align = "R"
+				}
+				pdf.CellFormat(widths[i], 6, tr(value), "1", 0, align, false, 0, "")
+			}
+			pdf.Ln(-1)
+		}
+		pdf.Ln(4)
+	}
+
+	// Diagram, scaled to fit the first page
+	pdf.AddPage()
+	pdf.SetFont("Helvetica", "B", 18)
+	pdf.CellFormat(0, 10, tr(chartTitle()), "", 1, "", false, 0, "")
+	pdf.SetFont("Helvetica", "", 11)
+	if subtitle := chartSubtitle(); subtitle != "" {
+		pdf.CellFormat(0, 7, tr(subtitle), "", 1, "", false, 0, "")
+	}
+	pdf.CellFormat(0, 7, tr(fmt.Sprintf("%s to %s, %s, total %s", globalConfig.StartDate, globalConfig.EndDate, globalConfig.Metric, formatCost(graph.Total, 2))), "", 1, "", false, 0, "")
+
+	var image bytes.Buffer
+	if err := writePNG(&image); err != nil {
+		return fmt.Errorf("failed to render diagram: %w", err)
+	}
+	info := pdf.RegisterImageOptionsReader("sankey", fpdf.ImageOptions{ImageType: "PNG"}, &image)
+	availableHeight := pageHeight - pdf.GetY() - top
+	imageWidth := math.Min(contentWidth, availableHeight*info.Width()/info.Height())
+	pdf.ImageOptions("sankey", left, pdf.GetY(), imageWidth, 0, false, fpdf.ImageOptions{ImageType: "PNG"}, 0, "")
+
+	// Accounts are the nodes below the root, each broken down into its largest children
+	pdf.AddPage()
+	heading("Summary per account")
+	children := sortedChildren("all")
+	rows := make([][]string, 0, len(children))
+	for _, child := range children {
+		rows = append(rows, []string{child.name, formatCost(child.cost, 2), percentOf(child.cost, graph.Total)})
+	}
+	table([]string{"Account", "Cost", "Share"}, []float64{contentWidth / 2, contentWidth / 4, contentWidth / 4}, rows)
+
+	for _, account := range children {
+		breakdown := sortedChildren(account.name)
+		if len(breakdown) == 0 {
+			continue
+		}
+		heading(account.name)
+		rows := make([][]string, 0, reportTopN)
+		for i, child := range breakdown {
+			if i == reportTopN {
+				break
+			}
+			rows = append(rows, []string{child.name, formatCost(child.cost, 2), percentOf(child.cost, account.cost)})
+		}
+		table([]string{"Top " + levelTitle(2), "Cost", "Share"}, []float64{contentWidth / 2, contentWidth / 4, contentWidth / 4}, rows)
+	}
+
+	if movers, first, last := topMovers(); len(movers) > 0 {
+		pdf.AddPage()
+		heading("Top movers")
+		rows := make([][]string, 0, len(movers))
+		for _, mover := range movers {
+			change := formatCost(mover.last-mover.first, 2)
+			if mover.last > mover.first {
+				change = "+" + change
+			}
+			rows = append(rows, []string{mover.name, formatCost(mover.first, 2), formatCost(mover.last, 2), change})
+		}
+		table([]string{"Node", first, last, "Change"}, []float64{contentWidth / 2, contentWidth / 6, contentWidth / 6, contentWidth / 6}, rows)
+	}
+
+	if rows := unitTable(); len(rows) > 0 {
+		pdf.AddPage()
+		heading("Unit costs")
+		table([]string{"Node", "Cost", "Units", "Cost per unit"}, []float64{contentWidth / 2, contentWidth / 6, contentWidth / 6, contentWidth / 6}, rows)
+	}
+
+	if globalConfig.UntaggedReport {
+		accounts, services, _ := untaggedBreakdown(results)
+		pdf.AddPage()
+		heading("Untagged costs")
+		widths := []float64{contentWidth / 2, contentWidth / 6, contentWidth / 6, contentWidth / 6}
+		untaggedRows := func(spends []untaggedSpend) [][]string {
+			rows := make([][]string, 0, len(spends))
+			for _, spend := range spends {
+				rows = append(rows, []string{spend.name, formatCost(spend.untagged, 2), formatCost(spend.total, 2), percentOf(spend.untagged, spend.total)})
+			}
+			return rows
+		}
+		table([]string{levelTitle(1), "Untagged", "Total", "Share"}, widths, untaggedRows(accounts))
+		table([]string{"Service", "Untagged", "Total", "Share"}, widths, untaggedRows(services))
+		if trend := untaggedTrend(); len(trend) > 0 {
+			table([]string{"Period", "Untagged", "Total", "Share"}, widths, untaggedRows(trend))
+		}
+	}
+
+	if len(nodeForecasts) > 0 {
+		pdf.AddPage()
+		heading("Forecast")
+		rows := make([][]string, 0, len(nodeForecasts))
+		for _, forecast := range nodeForecasts {
+			rows = append(rows, []string{forecast.name, formatCost(forecast.projected, 2), formatCost(forecast.actual, 2), forecastStatus(forecast)})
+		}
+		table([]string{"Node", "Projected", "So far", "Status"}, []float64{contentWidth * 3 / 8, contentWidth / 6, contentWidth / 6, contentWidth * 7 / 24}, rows)
+	}
+
+	if analysis != "" {
+		pdf.AddPage()
+		heading("Analysis")
+		pdf.SetFont("Helvetica", "", 10)
+		pdf.MultiCell(0, 5, tr(analysis), "", "", false)
+	}
+
+	if err := pdf.OutputFileAndClose(outputFile); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+type namedCost struct {
+	name string
+	cost float64
+}
+
+// sortedChildren returns the children of a node, largest first
+func sortedChildren(node string) []namedCost {
+	children := make([]namedCost, 0, len(results[node]))
+	for child, cost := range results[node] {
+		children = append(children, namedCost{child, cost})
+	}
+	sort.Slice(children, func(i, j int) bool {
+		if children[i].cost != children[j].cost {
+			return children[i].cost > children[j].cost
+		}
+		return children[i].name < children[j].name
+	})
+	return children
+}
+
+func percentOf(cost float64, total float64) string {
+	if total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%.1f%%", cost/total*100)
+}
+
+type mover struct {
+	name  string
+	first float64
+	last  float64
+}
+
+// topMovers returns the nodes with the largest change in cost between the first and last time bucket,
+// along with those buckets
+func topMovers() ([]mover, string, string) {
+	buckets := sortedBuckets()
+	if len(buckets) < 2 {
+		return nil, "", ""
+	}
+
+	first := incomingCosts(bucketResults[buckets[0]])
+	last := incomingCosts(bucketResults[buckets[len(buckets)-1]])
+
+	movers := make([]mover, 0, len(first)+len(last))
+	for name := range mergeKeys(first, last) {
+		movers = append(movers, mover{name, first[name], last[name]})
+	}
+	sortMovers(movers)
+	if len(movers) > reportTopN {
+		movers = movers[:reportTopN]
+	}
+	return movers, buckets[0], buckets[len(buckets)-1]
+}
+
+// analyzeReport writes the text report to a temporary file and returns the AI analysis of it. The analysis is made once
+// per run, and shared by the formats and notifications that include it.
+func analyzeReport() (string, error) {
+	if aiAnalysis != "" {
+		return aiAnalysis, nil
+	}
+	f, err := os.CreateTemp("", "aws-cost-sankey-*.txt")
+	if err != nil {
+		return "", fmt.Errorf("failed to create temporary file: %v", err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	if err := generateText(f.Name()); err != nil {
+		return "", err
+	}
+	return analyze(f.Name())
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"time"
+)
+
+// Relative periods of the last number of days, e.g. "last-30d"
+var lastDaysPattern = regexp.MustCompile(`^last-(\d+)d$`)
+
+// resolvePeriod replaces startDate and endDate with the dates of a relative period, resolved against today in UTC
+// so that scheduled runs don't need the dates rewritten. End dates are exclusive like those of Cost Explorer.
+func resolvePeriod() error {
+	if options.period != "" {
+		globalConfig.Period = options.period
+	}
+	if globalConfig.Period == "" {
+		return nil
+	}
+	start, end, err := periodDates(globalConfig.Period, time.Now().UTC())
+	if err != nil {
+		return err
+	}
+	globalConfig.StartDate = start.Format(time.DateOnly)
+	globalConfig.EndDate = end.Format(time.DateOnly)
+	infof("Resolved period %s to %s - %s", globalConfig.Period, globalConfig.StartDate, globalConfig.EndDate)
+	return nil
+}
+
+// knownPeriod reports whether periodDates accepts a relative period
+func knownPeriod(period string) bool {
+	switch period {
+	case "last-month", "mtd", "last-quarter":
+		return true
+	}
+	if match := lastDaysPattern.FindStringSubmatch(period); match != nil {
+		days, err := strconv.Atoi(match[1])
+		return err == nil && days > 0
+	}
+	_, err := time.Parse("2006-01", period)
+	return err == nil
+}
+
+// periodDates returns the start and exclusive end of a relative period: "last-month", "mtd" (including today),
+// "last-<n>d" (up to yesterday), "last-quarter" or a month such as "2024-10"
+func periodDates(period string, now time.Time) (time.Time, time.Time, error) {
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+	month := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC)
+	switch period {
+	case "last-month":
+		return month.AddDate(0, -1, 0), month, nil
+	case "mtd":
+		return month, today.AddDate(0, 0, 1), nil
+	case "last-quarter":
+		quarter := time.Date(now.Year(), now.Month()-(now.Month()-1)%3, 1, 0, 0, 0, 0, time.UTC)
+		return quarter.AddDate(0, -3, 0), quarter, nil
+	}
+	if match := lastDaysPattern.FindStringSubmatch(period); match != nil {
+		days, err := strconv.Atoi(match[1])
+		if err != nil || days == 0 {
+			return time.Time{}, time.Time{}, fmt.Errorf("invalid number of days in period %s", period)
+		}
+		return today.AddDate(0, 0, -days), today, nil
+	}
+	start, err := time.Parse("2006-01", period)
+	if err != nil {
+		return time.Time{}, time.Time{}, fmt.Errorf("unknown period %s: use last-month, mtd, last-<n>d, last-quarter or YYYY-MM", period)
+	}
+	return start, start.AddDate(0, 1, 0), nil
+}
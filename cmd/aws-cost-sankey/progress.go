@@ -0,0 +1,172 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/mattn/go-isatty"
+)
+
+// Interval at which the progress line on a terminal is redrawn
+const progressInterval = 100 * time.Millisecond
+
+var spinnerFrames = []string{"⠋", "⠙", "⠹", "⠸", "⠼", "⠴", "⠦", "⠧", "⠇", "⠏"}
+
+// progress tracks the accounts being fetched. On a terminal it redraws a status line on stderr, otherwise it logs a
+// line as each account is done, so that long runs don't go silent.
+type progress struct {
+	total    int
+	done     int
+	pages    int
+	start    time.Time
+	fetching map[string]int // Pages fetched per account in flight
+	frame    int
+	shown    bool
+	stop     chan struct{}
+	stopped  sync.WaitGroup
+}
+
+// The progress of the accounts being fetched, if any, and the lock of the progress line and log output on stderr
+var (
+	fetchProgress *progress
+	progressMu    sync.Mutex
+)
+
+// startProgress starts reporting the progress of fetching a number of accounts, unless -quiet is set
+func startProgress(total int) {
+	if options.quiet || total == 0 {
+		return
+	}
+	p := &progress{total: total, start: time.Now(), fetching: make(map[string]int)}
+	progressMu.Lock()
+	fetchProgress = p
+	progressMu.Unlock()
+
+	// JSON log lines are read by machines, so the status line is only drawn along text logs
+	if logFormat != LogFormatText || !isatty.IsTerminal(os.Stderr.Fd()) {
+		return
+	}
+	p.stop = make(chan struct{})
+	p.stopped.Add(1)
+	go func() {
+		defer p.stopped.Done()
+		ticker := time.NewTicker(progressInterval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-p.stop:
+				return
+			case <-ticker.C:
+				progressMu.Lock()
+				p.frame = (p.frame + 1) % len(spinnerFrames)
+				p.draw()
+				progressMu.Unlock()
+			}
+		}
+	}()
+}
+
+// stopProgress clears the progress line and logs how long fetching took
+func stopProgress() {
+	progressMu.Lock()
+	p := fetchProgress
+	fetchProgress = nil
+	progressMu.Unlock()
+	if p == nil {
+		return
+	}
+	if p.stop != nil {
+		close(p.stop)
+		p.stopped.Wait()
+		progressMu.Lock()
+		p.clear()
+		progressMu.Unlock()
+	}
+	infof("Fetched %d accounts, %d pages in %s", p.done, p.pages, time.Since(p.start).Round(time.Second))
+}
+
+// accountStarted marks an account as being fetched
+func accountStarted(accountName string) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if p := fetchProgress; p != nil {
+		p.fetching[accountName] = 0
+	}
+}
+
+// pageFetched counts a page of costs fetched for an account, whether from Cost Explorer or the cache
+func pageFetched(accountName string) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if p := fetchProgress; p != nil {
+		p.pages++
+		p.fetching[accountName]++
+	}
+}
+
+// accountDone marks an account as fetched, successfully or not
+func accountDone(accountName string) {
+	progressMu.Lock()
+	p := fetchProgress
+	if p == nil {
+		progressMu.Unlock()
+		return
+	}
+	p.done++
+	pages := p.fetching[accountName]
+	delete(p.fetching, accountName)
+	status := p.status()
+	terminal := p.stop != nil
+	progressMu.Unlock()
+
+	// The status line shows the progress on a terminal, elsewhere it is logged
+	if !terminal {
+		infof("Fetched %s in %d pages (%s)", accountName, pages, status)
+	}
+}
+
+// status describes the progress, e.g. "12/40 accounts, 57 pages, 1m20s"
+func (p *progress) status() string {
+	return fmt.Sprintf("%d/%d accounts, %d pages, %s", p.done, p.total, p.pages, time.Since(p.start).Round(time.Second))
+}
+
+// draw redraws the progress line with the accounts in flight. Must be called with progressMu held.
+func (p *progress) draw() {
+	names := make([]string, 0, len(p.fetching))
+	for name := range p.fetching {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	line := fmt.Sprintf("%s %s", spinnerFrames[p.frame], p.status())
+	if len(names) > 0 {
+		line += ": " + strings.Join(names, ", ")
+	}
+	fmt.Fprintf(os.Stderr, "\r\033[K%s", line)
+	p.shown = true
+}
+
+// clear removes the progress line so that other output starts at the beginning of the line. Must be called with
+// progressMu held.
+func (p *progress) clear() {
+	if p.shown {
+		fmt.Fprint(os.Stderr, "\r\033[K")
+		p.shown = false
+	}
+}
+
+// stderrWriter writes log messages to stderr, clearing the progress line first so that they don't mix with it.
+// The line is redrawn at the next tick.
+type stderrWriter struct{}
+
+func (stderrWriter) Write(data []byte) (int, error) {
+	progressMu.Lock()
+	defer progressMu.Unlock()
+	if p := fetchProgress; p != nil {
+		p.clear()
+	}
+	return os.Stderr.Write(data)
+}
@@ -0,0 +1,82 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+const metricsPrefix = "aws_cost_sankey"
+
+var invalidLabelChars = regexp.MustCompile(`[^a-zA-Z0-9_]`)
+
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func labelValue(value string) string {
+	return labelEscaper.Replace(value)
+}
+
+// metricsExposition returns the cost data as Prometheus gauges in the text exposition format.
+// Nodes and links are labeled with their hierarchy level, e.g. account, environment and service,
+// so that dashboards can filter by any level.
+func metricsExposition() string {
+	graph := buildGraph()
+	depths := make(map[string]int)
+	for _, node := range graph.Nodes {
+		depths[node.Name] = node.Depth
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "# HELP %s_info Period, metric and currency of the cost data.\n# TYPE %s_info gauge\n", metricsPrefix, metricsPrefix)
+	fmt.Fprintf(&sb, "%s_info{start=\"%s\",end=\"%s\",metric=\"%s\",currency=\"%s\"} 1\n", metricsPrefix,
+		labelValue(globalConfig.StartDate), labelValue(globalConfig.EndDate), labelValue(globalConfig.Metric), labelValue(currency))
+
+	fmt.Fprintf(&sb, "# HELP %s_total_cost Total cost of the period.\n# TYPE %s_total_cost gauge\n", metricsPrefix, metricsPrefix)
+	fmt.Fprintf(&sb, "%s_total_cost %g\n", metricsPrefix, graph.Total)
+
+	fmt.Fprintf(&sb, "# HELP %s_node_cost Cost of a node of the diagram.\n# TYPE %s_node_cost gauge\n", metricsPrefix, metricsPrefix)
+	for _, node := range graph.Nodes {
+		fmt.Fprintf(&sb, "%s_node_cost{level=\"%s\",node=\"%s\"} %g\n", metricsPrefix, metricsLevel(node.Depth), labelValue(node.Name), node.Value)
+	}
+
+	fmt.Fprintf(&sb, "# HELP %s_link_cost Cost flowing between two nodes of the diagram.\n# TYPE %s_link_cost gauge\n", metricsPrefix, metricsPrefix)
+	for _, link := range graph.Links {
+		fmt.Fprintf(&sb, "%s_link_cost{source=\"%s\",target=\"%s\",source_level=\"%s\",target_level=\"%s\"} %g\n", metricsPrefix,
+			labelValue(link.Source), labelValue(link.Target), metricsLevel(depths[link.Source]), metricsLevel(depths[link.Target]), link.Value)
+	}
+	return sb.String()
+}
+
+// metricsLevel returns the level of the given depth as a lower case identifier, e.g. "service" for "dimension:SERVICE"
+func metricsLevel(depth int) string {
+	if depth == 0 {
+		return "root"
+	}
+	return strings.ToLower(invalidLabelChars.ReplaceAllString(levelTitle(depth), "_"))
+}
+
+// writeMetricsFile writes the metrics for the textfile collector of the node exporter.
+// The file is replaced atomically so the collector never reads a partial file.
+func writeMetricsFile(metricsFile string) {
+	infof("Writing metrics to %s", metricsFile)
+
+	tmp, err := os.CreateTemp(filepath.Dir(metricsFile), filepath.Base(metricsFile)+".*")
+	if err != nil {
+		log.Fatalf("failed to create metrics file: %v", err)
+	}
+	if _, err := tmp.WriteString(metricsExposition()); err != nil {
+		log.Fatalf("failed to write metrics file: %v", err)
+	}
+	if err := tmp.Close(); err != nil {
+		log.Fatalf("failed to write metrics file: %v", err)
+	}
+	if err := os.Chmod(tmp.Name(), 0644); err != nil {
+		log.Fatalf("failed to write metrics file: %v", err)
+	}
+	if err := os.Rename(tmp.Name(), metricsFile); err != nil {
+		log.Fatalf("failed to write metrics file: %v", err)
+	}
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"mime"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/s3"
+	"github.com/aws/aws-sdk-go-v2/service/s3/types"
+)
+
+// Keys of the published files, dated so that earlier reports are kept
+const defaultPublishPrefix = "{month}/"
+
+// Content types of outputs not known to every system
+var publishContentTypes = map[string]string{
+	".csv":  "text/csv; charset=utf-8",
+	".md":   "text/markdown; charset=utf-8",
+	".mmd":  "text/plain; charset=utf-8",
+	".txt":  "text/plain; charset=utf-8",
+	".xlsx": "application/vnd.openxmlformats-officedocument.spreadsheetml.sheet",
+}
+
+// PublishConfig uploads the written files to an S3 bucket, e.g. to host a static dashboard behind CloudFront.
+// Files are uploaded under the dated prefix, and again under latest for a stable URL.
+type PublishConfig struct {
+	Bucket             string `yaml:"bucket"`
+	Prefix             string `yaml:"prefix"`
+	Latest             string `yaml:"latest"`
+	CacheControl       string `yaml:"cacheControl"`
+	LatestCacheControl string `yaml:"latestCacheControl"`
+	Public             bool   `yaml:"public"`
+	Region             string `yaml:"region"`
+	Endpoint           string `yaml:"endpoint"`
+}
+
+// checkPublish fails when publishing is requested without a bucket or with unknown placeholders
+func checkPublish(publish bool) error {
+	if !publish {
+		return nil
+	}
+	config := globalConfig.Publish
+	if config.Bucket == "" {
+		return fmt.Errorf("set publish bucket to publish the outputs")
+	}
+	for _, template := range []string{config.Prefix, config.Latest} {
+		if unknown := unknownPlaceholders(template); len(unknown) > 0 {
+			return fmt.Errorf("unknown placeholder %s in publish prefix, use one of {%s}", unknown[0], strings.Join(outputPlaceholders, "}, {"))
+		}
+	}
+	return nil
+}
+
+// publishKeys returns the keys a file is uploaded to, under the dated prefix and the latest prefix if any
+func publishKeys(filename string, now time.Time) []string {
+	config := globalConfig.Publish
+	name := filepath.Base(filename)
+	prefix := config.Prefix
+	if prefix == "" {
+		prefix = defaultPublishPrefix
+	}
+	keys := []string{path.Join(expandOutputTemplate(prefix, now), name)}
+	if config.Latest != "" {
+		keys = append(keys, path.Join(expandOutputTemplate(config.Latest, now), name))
+	}
+	return keys
+}
+
+// publishContentType returns the content type served for a file, so that browsers show the chart rather than download it
+func publishContentType(filename string) string {
+	extension := strings.ToLower(filepath.Ext(filename))
+	if contentType, ok := publishContentTypes[extension]; ok {
+		return contentType
+	}
+	if contentType := mime.TypeByExtension(extension); contentType != "" {
+		return contentType
+	}
+	return "application/octet-stream"
+}
+
+// publishFiles uploads the written files to the bucket, skipping outputs written to stdout or the terminal
+func publishFiles(files []string) error {
+	config := globalConfig.Publish
+	cfg := loadBaseConfig()
+	if config.Region != "" {
+		cfg.Region = config.Region
+	}
+	svc := s3.NewFromConfig(cfg, func(o *s3.Options) {
+		if config.Endpoint != "" {
+			// S3 compatible stores such as MinIO are addressed by path
+			o.BaseEndpoint = aws.String(config.Endpoint)
+			o.UsePathStyle = true
+		}
+	})
+
+	now := time.Now()
+	for _, filename := range files {
+		if filename == "" || filename == stdioName {
+			continue
+		}
+		data, err := os.ReadFile(filename)
+		if err != nil {
+			return err
+		}
+		for i, key := range publishKeys(filename, now) {
+			cacheControl := config.CacheControl
+			if i > 0 && config.LatestCacheControl != "" {
+				cacheControl = config.LatestCacheControl
+			}
+			input := &s3.PutObjectInput{
+				Bucket:      aws.String(config.Bucket),
+				Key:         aws.String(key),
+				Body:        bytes.NewReader(data),
+				ContentType: aws.String(publishContentType(filename)),
+			}
+			if cacheControl != "" {
+				input.CacheControl = aws.String(cacheControl)
+			}
+			if config.Public {
+				input.ACL = types.ObjectCannedACLPublicRead
+			}
+			if _, err := svc.PutObject(runContext, input); err != nil {
+				return fmt.Errorf("failed to publish %s to s3://%s/%s: %v", filename, config.Bucket, key, err)
+			}
+			infof("Published s3://%s/%s", config.Bucket, key)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestPublishFiles(t *testing.T) {
+	type upload struct{ path, contentType, cacheControl string }
+	var uploads []upload
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method != http.MethodPut {
+			t.Errorf("%s %s, want PUT", r.Method, r.URL.Path)
+		}
+		uploads = append(uploads, upload{r.URL.Path, r.Header.Get("Content-Type"), r.Header.Get("Cache-Control")})
+	}))
+	defer server.Close()
+	setupRunTest(t, Config{Publish: PublishConfig{Bucket: "costs", Latest: "latest", CacheControl: "max-age=86400", LatestCacheControl: "no-cache", Endpoint: server.URL}}, nil)
+	if err := checkPublish(true); err != nil {
+		t.Fatalf("checkPublish() = %v", err)
+	}
+
+	filename := filepath.Join(t.TempDir(), "chart.html")
+	if err := os.WriteFile(filename, []byte("<html></html>"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := publishFiles([]string{filename, "", stdioName}); err != nil {
+		t.Fatalf("publishFiles() = %v", err)
+	}
+	want := []upload{
+		{"/costs/2024-10/chart.html", "text/html; charset=utf-8", "max-age=86400"},
+		{"/costs/latest/chart.html", "text/html; charset=utf-8", "no-cache"},
+	}
+	if !reflect.DeepEqual(uploads, want) {
+		t.Errorf("uploads = %v, want %v", uploads, want)
+	}
+}
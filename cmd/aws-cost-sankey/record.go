@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+)
+
+// Files of -record holding the accounts of the organization and the names of accounts resolved from Organizations
+const (
+	recordedAccountsFile = "organization-accounts.json"
+	recordedNamesFile    = "account-names.json"
+)
+
+// recordedResponse is a Cost Explorer response written by -record along with its request, so that a recording can
+// be read for a bug report as well as replayed
+type recordedResponse struct {
+	Account  string                              `json:"account"`
+	Request  *costexplorer.GetCostAndUsageInput  `json:"request"`
+	Response *costexplorer.GetCostAndUsageOutput `json:"response"`
+}
+
+// checkRecordReplay fails on options that can't be recorded or replayed, and turns off the breakdowns fetched with
+// other Cost Explorer requests when replaying
+func checkRecordReplay() error {
+	if options.record == "" && options.replay == "" {
+		return nil
+	}
+	switch {
+	case options.record != "" && options.replay != "":
+		return fmt.Errorf("-record and -replay can't be used together")
+	case options.inputFile != "":
+		return fmt.Errorf("-record and -replay cover Cost Explorer responses, not input files")
+	case globalConfig.Source != "" && globalConfig.Source != "costexplorer":
+		return fmt.Errorf("-record and -replay cover Cost Explorer responses, not the %s source", globalConfig.Source)
+	}
+	if options.replay == "" {
+		return nil
+	}
+	if _, err := os.Stat(options.replay); err != nil {
+		return fmt.Errorf("failed to read recording: %v", err)
+	}
+	for _, option := range []struct {
+		flag    string
+		enabled *bool
+	}{{"-budgets", &options.trackBudgets}, {"-commitments", &options.commitments}, {"-anomalies", &options.detectAnomalies}, {"-forecast", &options.forecast}} {
+		if *option.enabled {
+			warnf("Leaving out %s, which isn't recorded", option.flag)
+			*option.enabled = false
+		}
+	}
+	if options.resources != "" {
+		warnf("Leaving out -resources, which isn't recorded")
+		options.resources = ""
+	}
+	return nil
+}
+
+// costAndUsage returns the response of a request, replayed from -replay, otherwise from the cache or Cost Explorer
+// and written to -record
+func costAndUsage(accountName string, svc costExplorerAPI, input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error) {
+	if options.replay != "" {
+		return replayCostAndUsage(accountName, input)
+	}
+	output, err := cachedCostAndUsage(accountName, svc, input)
+	if err == nil && options.record != "" {
+		err = writeRecording(recordFile(accountName, input), recordedResponse{accountName, input, output})
+	}
+	return output, err
+}
+
+// replayCostAndUsage returns the recorded response of a request
+func replayCostAndUsage(accountName string, input *costexplorer.GetCostAndUsageInput) (*costexplorer.GetCostAndUsageOutput, error) {
+	var recorded recordedResponse
+	if err := readRecording(recordFile(accountName, input), &recorded); err != nil {
+		return nil, fmt.Errorf("no recorded response from %s to %s, record the same config with -record: %w",
+			aws.ToString(input.TimePeriod.Start), aws.ToString(input.TimePeriod.End), err)
+	}
+	debugf("Replaying response for %s", accountName)
+	return recorded.Response, nil
+}
+
+// recordFile returns the name of the recording of a request, e.g. prod-2024-10-01-<key>.json. The key of the cache
+// tells apart requests of the same period, e.g. pages and groups.
+func recordFile(accountName string, input *costexplorer.GetCostAndUsageInput) string {
+	name := strings.NewReplacer("/", "-", "\\", "-", " ", "-").Replace(accountName)
+	return fmt.Sprintf("%s-%s-%s.json", name, aws.ToString(input.TimePeriod.Start), cacheKey(accountName, input)[:16])
+}
+
+// writeRecording writes a file of the -record directory
+func writeRecording(filename string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal recording: %v", err)
+	}
+	if err := os.MkdirAll(options.record, 0o700); err != nil {
+		return fmt.Errorf("failed to create recording directory: %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(options.record, filename), data, 0o600); err != nil {
+		return fmt.Errorf("failed to write recording: %v", err)
+	}
+	return nil
+}
+
+// readRecording reads a file of the -replay directory
+func readRecording(filename string, v interface{}) error {
+	data, err := os.ReadFile(filepath.Join(options.replay, filename))
+	if err != nil {
+		return err
+	}
+	return json.Unmarshal(data, v)
+}
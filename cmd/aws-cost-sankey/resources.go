@@ -0,0 +1,70 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+// Cost Explorer only keeps resource level data for the last 14 days
+const resourceLookbackDays = 14
+
+// fetchResources breaks the given service down to individual resources, added as leaf nodes of the service.
+// Resource level data must be enabled in the Cost Explorer settings of the account.
+func fetchResources(accountName string, linkedAccountID string, svc costExplorerAPI, service string) error {
+	infof("Fetching resources of %s for %s", service, accountName)
+
+	start := globalConfig.StartDate
+	earliest := time.Now().UTC().AddDate(0, 0, -resourceLookbackDays).Format(time.DateOnly)
+	if start < earliest {
+		warnf("Resource level data is limited to the last %d days, starting from %s", resourceLookbackDays, earliest)
+		start = earliest
+	}
+
+	// Resource level data requires a service filter
+	filters := append(linkedAccountFilters(linkedAccountID), types.Expression{
+		Dimensions: &types.DimensionValues{Key: types.DimensionService, Values: []string{service}},
+	})
+
+	input := &costexplorer.GetCostAndUsageWithResourcesInput{
+		TimePeriod: &types.DateInterval{
+			Start: aws.String(start),
+			End:   aws.String(globalConfig.EndDate),
+		},
+		Granularity: types.GranularityDaily,
+		Metrics:     []string{globalConfig.Metric},
+		GroupBy:     []types.GroupDefinition{{Type: types.GroupDefinitionTypeDimension, Key: aws.String(string(types.DimensionResourceId))}},
+		Filter:      combineFilters(filters),
+	}
+
+	for {
+		result, err := svc.GetCostAndUsageWithResources(runContext, input)
+		if err != nil {
+			return fmt.Errorf("failed to get resource cost data: %w", err)
+		}
+
+		for _, resultByTime := range result.ResultsByTime {
+			for _, group := range resultByTime.Groups {
+				amount := group.Metrics[globalConfig.Metric].Amount
+				if amount == nil {
+					continue
+				}
+				amountFloat64, err := strconv.ParseFloat(*amount, 64)
+				if err != nil {
+					return fmt.Errorf("failed to parse amount: %w", err)
+				}
+				addResult(service, group.Keys[0], roundCost(amountFloat64))
+			}
+		}
+
+		if result.NextPageToken == nil || *result.NextPageToken == "" {
+			break
+		}
+		input.NextPageToken = result.NextPageToken
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Outputs written on each scheduled refresh unless configured otherwise
+const defaultScheduleFormats = "chart,json"
+
+// ScheduleConfig refreshes the costs of the serve command on a cron schedule, e.g. "0 6 * * *" for 06:00 every day,
+// writing the outputs of the formats, running a command, e.g. to send them on, and notifying like -notify
+type ScheduleConfig struct {
+	Cron       string `yaml:"cron"`
+	TimeZone   string `yaml:"timeZone"`
+	Formats    string `yaml:"formats"`
+	Output     string `yaml:"output"`
+	Command    string `yaml:"command"`
+	Notify     string `yaml:"notify"`
+	Publish    bool   `yaml:"publish"`
+	CloudWatch bool   `yaml:"cloudwatch"`
+}
+
+// validateSchedule fails on an invalid cron expression, time zone, format or output file name before the server starts
+func validateSchedule() {
+	schedule := &globalConfig.Schedule
+	if schedule.Cron == "" {
+		return
+	}
+	if _, err := parseCron(schedule.Cron); err != nil {
+		log.Fatalf("invalid schedule: %v", err)
+	}
+	if _, err := time.LoadLocation(schedule.TimeZone); err != nil {
+		log.Fatalf("invalid schedule time zone %q: %v", schedule.TimeZone, err)
+	}
+	validateRefresh(schedule)
+}
+
+// validateRefresh fails on an invalid format or output file name of the refreshes, run on a schedule or by Lambda
+func validateRefresh(schedule *ScheduleConfig) {
+	if schedule.Formats == "" {
+		schedule.Formats = defaultScheduleFormats
+	}
+	for _, name := range outputFormatList(schedule.Formats) {
+		format, ok := lookupOutputFormat(name)
+		if !ok {
+			log.Fatalf("unknown schedule format: %s", name)
+		}
+		if format.extension == "" {
+			log.Fatalf("schedule writes files, not %s", name)
+		}
+	}
+	if schedule.Output == "" {
+		schedule.Output = "output"
+	}
+	if schedule.Output == stdioName {
+		log.Fatalf("schedule writes files, not to stdout")
+	}
+	if unknown := unknownPlaceholders(schedule.Output); len(unknown) > 0 {
+		log.Fatalf("unknown placeholder %s in schedule output, use one of {%s}", unknown[0], strings.Join(outputPlaceholders, "}, {"))
+	}
+	for _, err := range []error{checkNotify(schedule.Notify), checkPublish(schedule.Publish), checkCloudWatch(schedule.CloudWatch)} {
+		if err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+}
+
+// runSchedule refreshes the outputs at the times of the schedule until the context is done. A failed refresh is
+// logged and retried at the next time.
+func runSchedule(ctx context.Context, schedule ScheduleConfig) {
+	cron, err := parseCron(schedule.Cron)
+	if err != nil {
+		log.Fatalf("invalid schedule: %v", err)
+	}
+	location, err := time.LoadLocation(schedule.TimeZone)
+	if err != nil {
+		log.Fatalf("invalid schedule time zone %q: %v", schedule.TimeZone, err)
+	}
+
+	for {
+		next := cron.next(time.Now().In(location))
+		if next.IsZero() {
+			warnf("Schedule %q never runs", schedule.Cron)
+			return
+		}
+		infof("Next refresh at %s", next.Format(time.RFC3339))
+		timer := time.NewTimer(time.Until(next))
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return
+		case <-timer.C:
+		}
+		if _, err := refresh(ctx, schedule); err != nil {
+			errorf("Refresh failed: %v", err)
+		}
+	}
+}
+
+// refresh fetches the costs of the configured period and writes the outputs of the schedule, like a run. Requests
+// to the server wait until it is done. Returns the written files.
+func refresh(ctx context.Context, schedule ScheduleConfig) ([]string, error) {
+	serveMu.Lock()
+	defer serveMu.Unlock()
+	infof("Refreshing %s", schedule.Formats)
+
+	savedFormat, savedOutput := options.format, options.outputFile
+	defer func() {
+		options.format, options.outputFile = savedFormat, savedOutput
+	}()
+	options.format, options.outputFile = schedule.Formats, schedule.Output
+
+	var cancel context.CancelFunc
+	runContext, cancel = withTimeout(ctx)
+	defer cancel()
+
+	resetRun()
+	// The config file may have changed since the schedule started
+	if err := readConfig(options.configFile); err != nil {
+		return nil, err
+	}
+	hierarchy, err := setupConfig()
+	if err != nil {
+		return nil, err
+	}
+	err = loadResults(hierarchy)
+	if err := runContext.Err(); err != nil {
+		return nil, fmt.Errorf("stopped before the costs were loaded: %v", context.Cause(runContext))
+	}
+	if err != nil {
+		return nil, err
+	}
+	if len(fetchFailures) > 0 && !globalConfig.ContinueOnError {
+		reportFetchFailures()
+		return nil, fmt.Errorf("failed to fetch %d accounts or sources, no output written", len(fetchFailures))
+	}
+
+	if globalConfig.HistoryAnomalies.enabled() {
+		if err := detectHistoryAnomalies(globalConfig.HistoryFile); err != nil {
+			return nil, err
+		}
+	}
+	if globalConfig.LocalForecast.Method != "" {
+		if err := forecastLocally(globalConfig.HistoryFile); err != nil {
+			return nil, err
+		}
+	}
+	if globalConfig.HistoryFile != "" {
+		if err := appendHistory(globalConfig.HistoryFile); err != nil {
+			return nil, err
+		}
+	}
+	if schedule.CloudWatch {
+		if err := putCloudWatchMetrics(); err != nil {
+			return nil, err
+		}
+	}
+
+	var files []string
+	for _, format := range outputFormatList(options.format) {
+		if err := runContext.Err(); err != nil {
+			removePartialFile()
+			return nil, fmt.Errorf("stopped before all outputs were written: %v", context.Cause(runContext))
+		}
+		file, err := writeOutput(format)
+		if err != nil {
+			return nil, fmt.Errorf("failed to write %s output: %v", format, err)
+		}
+		files = append(files, file)
+	}
+	infof("Refreshed %s", strings.Join(files, ", "))
+
+	if schedule.Command != "" {
+		if err := runScheduleCommand(schedule.Command, files); err != nil {
+			return nil, err
+		}
+	}
+	if schedule.Publish {
+		if err := publishFiles(files); err != nil {
+			return nil, err
+		}
+	}
+	return files, sendNotifications(notifyList(schedule.Notify), files)
+}
+
+// runScheduleCommand runs the command of the schedule with sh, passing the written files as arguments, e.g.
+// "aws s3 cp \"$1\" s3://reports/", and the period and total cost as AWS_COST_SANKEY_START, AWS_COST_SANKEY_END,
+// AWS_COST_SANKEY_TOTAL and AWS_COST_SANKEY_CURRENCY
+func runScheduleCommand(command string, files []string) error {
+	cmd := exec.CommandContext(runContext, "sh", append([]string{"-c", command, "sh"}, files...)...)
+	cmd.Env = append(os.Environ(),
+		envPrefix+"START="+globalConfig.StartDate,
+		envPrefix+"END="+globalConfig.EndDate,
+		envPrefix+"TOTAL="+formatAmount(buildGraph().Total),
+		envPrefix+"CURRENCY="+currency,
+	)
+	cmd.Stdout = os.Stderr
+	cmd.Stderr = os.Stderr
+	if err := cmd.Run(); err != nil {
+		return fmt.Errorf("schedule command failed: %v", err)
+	}
+	return nil
+}
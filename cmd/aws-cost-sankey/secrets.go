@@ -0,0 +1,172 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/secretsmanager"
+	"github.com/aws/aws-sdk-go-v2/service/ssm"
+	"gopkg.in/yaml.v3"
+)
+
+// Secrets read from AWS, keyed by reference, so that accounts sharing a secret read it once
+var awsSecrets = make(map[string]string)
+
+// References to environment variables in config values, e.g. "${OPENAI_API_KEY}" or "${REGION:-us-east-1}"
+var envReferencePattern = regexp.MustCompile(`\$\{([A-Za-z_][A-Za-z0-9_]*)(:-([^}]*))?\}`)
+
+// expandEnv replaces references to environment variables in the values of a config node, failing on unset variables
+// without a default so that a missing secret is not silently sent as an empty string
+func expandEnv(node *yaml.Node) error {
+	if node.Kind == yaml.ScalarNode {
+		if !strings.Contains(node.Value, "${") {
+			return nil
+		}
+		var err error
+		node.Value = envReferencePattern.ReplaceAllStringFunc(node.Value, func(reference string) string {
+			match := envReferencePattern.FindStringSubmatch(reference)
+			if value, ok := os.LookupEnv(match[1]); ok {
+				return value
+			}
+			if match[2] == "" && err == nil {
+				err = fmt.Errorf("environment variable %s referenced in the config is not set", match[1])
+			}
+			return match[3]
+		})
+		// Unquoted values are resolved again, e.g. as numbers
+		if node.Style&(yaml.DoubleQuotedStyle|yaml.SingleQuotedStyle|yaml.LiteralStyle|yaml.FoldedStyle) == 0 {
+			node.Tag = ""
+		}
+		return err
+	}
+	for i, child := range node.Content {
+		// Keys of maps are left as they are
+		if node.Kind == yaml.MappingNode && i%2 == 0 {
+			continue
+		}
+		if err := expandEnv(child); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSecrets reads the secrets given by reference, e.g. "keyFrom: env:AWS_ACCESS_KEY_ID", into the config
+func resolveSecrets() error {
+	var err error
+	resolve := func(value *string, reference string) {
+		if reference != "" && err == nil {
+			*value, err = readSecret(reference)
+		}
+	}
+	for i := range globalConfig.Accounts {
+		account := &globalConfig.Accounts[i]
+		resolve(&account.Key, account.KeyFrom)
+		resolve(&account.Secret, account.SecretFrom)
+		resolve(&account.Token, account.TokenFrom)
+		resolve(&account.ClientSecret, account.ClientSecretFrom)
+	}
+	resolve(&globalConfig.OpenAIKey, globalConfig.OpenAIKeyFrom)
+	resolve(&globalConfig.Slack.WebhookURL, globalConfig.Slack.WebhookURLFrom)
+	resolve(&globalConfig.Slack.Token, globalConfig.Slack.TokenFrom)
+	resolve(&globalConfig.Email.SMTP.Password, globalConfig.Email.SMTP.PasswordFrom)
+	resolve(&globalConfig.MSTeams.WebhookURL, globalConfig.MSTeams.WebhookURLFrom)
+	for i := range globalConfig.Webhooks {
+		resolve(&globalConfig.Webhooks[i].URL, globalConfig.Webhooks[i].URLFrom)
+	}
+	return err
+}
+
+// readSecret returns the secret of a reference: "env:NAME" reads an environment variable, "file:PATH" a file,
+// e.g. a mounted Kubernetes or Docker secret, without the trailing newline, "secretsmanager:ID" a Secrets Manager
+// secret by name or ARN, optionally a field of a JSON secret as "secretsmanager:ID#field", and "ssm:NAME" an SSM
+// parameter by path or ARN, decrypting secure strings
+func readSecret(reference string) (string, error) {
+	source, name, _ := strings.Cut(reference, ":")
+	switch source {
+	case "env":
+		value, ok := os.LookupEnv(name)
+		if !ok {
+			return "", fmt.Errorf("environment variable %s of secret is not set", name)
+		}
+		return value, nil
+	case "file":
+		data, err := os.ReadFile(name)
+		if err != nil {
+			return "", fmt.Errorf("failed to read secret: %v", err)
+		}
+		return strings.TrimRight(string(data), "\r\n"), nil
+	case "secretsmanager", "ssm":
+		if value, ok := awsSecrets[reference]; ok {
+			return value, nil
+		}
+		var value string
+		var err error
+		if source == "ssm" {
+			value, err = readParameter(name)
+		} else {
+			value, err = readSecretsManager(name)
+		}
+		if err != nil {
+			return "", err
+		}
+		awsSecrets[reference] = value
+		return value, nil
+	default:
+		return "", fmt.Errorf("unknown secret reference %s: use env:NAME, file:PATH, secretsmanager:ID or ssm:NAME", reference)
+	}
+}
+
+// readSecretsManager returns the string of a Secrets Manager secret, or a field of it if the secret holds JSON
+func readSecretsManager(id string) (string, error) {
+	id, field, hasField := strings.Cut(id, "#")
+	svc := secretsmanager.NewFromConfig(secretsConfig(id))
+	output, err := svc.GetSecretValue(runContext, &secretsmanager.GetSecretValueInput{SecretId: aws.String(id)})
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from Secrets Manager: %v", id, err)
+	}
+	if output.SecretString == nil {
+		return "", fmt.Errorf("secret %s has no string value", id)
+	}
+	secret := *output.SecretString
+	if !hasField {
+		return secret, nil
+	}
+	var fields map[string]interface{}
+	if err := json.Unmarshal([]byte(secret), &fields); err != nil {
+		return "", fmt.Errorf("secret %s is not JSON: %v", id, err)
+	}
+	value, ok := fields[field]
+	if !ok {
+		return "", fmt.Errorf("secret %s has no field %s", id, field)
+	}
+	return fmt.Sprint(value), nil
+}
+
+// readParameter returns the value of an SSM parameter, decrypting secure strings
+func readParameter(name string) (string, error) {
+	svc := ssm.NewFromConfig(secretsConfig(name))
+	output, err := svc.GetParameter(runContext, &ssm.GetParameterInput{Name: aws.String(name), WithDecryption: aws.Bool(true)})
+	if err != nil {
+		return "", fmt.Errorf("failed to read %s from SSM: %v", name, err)
+	}
+	if output.Parameter == nil || output.Parameter.Value == nil {
+		return "", fmt.Errorf("parameter %s has no value", name)
+	}
+	return *output.Parameter.Value, nil
+}
+
+// secretsConfig returns the base config in the region of the ARN of the secret if given, or the configured region
+func secretsConfig(id string) aws.Config {
+	cfg := loadBaseConfig()
+	if parts := strings.Split(id, ":"); len(parts) > 3 && parts[0] == "arn" {
+		cfg.Region = parts[3]
+	} else {
+		cfg.Region = defaultRegion()
+	}
+	return cfg
+}
@@ -0,0 +1,244 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"os/signal"
+	"slices"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"gopkg.in/yaml.v3"
+
+	"aws-costexplorer/pkg/render"
+)
+
+// Time given to the requests in flight to complete when the server is stopped
+const shutdownTimeout = 10 * time.Second
+
+// Address the serve command listens on, e.g. ":8080" or "127.0.0.1:8080"
+var serveAddr string
+
+// The costs are kept in globals, so requests are served one at a time. Cached Cost Explorer responses keep repeated
+// requests for the same period free and fast.
+var serveMu sync.Mutex
+
+// serve answers /chart, /data.json and /health until interrupted, fetching or reading the costs on each request, and
+// refreshes the outputs of the schedule if configured
+func serve() {
+	if options.inputFile == stdioName {
+		log.Fatalf("serve reads the input file on each request, not from stdin")
+	}
+	if options.dryRun {
+		log.Fatalf("serve fetches the costs on each request, print the requests of a run with -dry-run instead")
+	}
+	options.format = "chart"
+
+	// Fail on config errors at startup rather than on the first request
+	setupRun()
+	validateSchedule()
+
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	if globalConfig.Schedule.Cron != "" {
+		go runSchedule(ctx, globalConfig.Schedule)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("/health", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintln(w, "ok")
+	})
+	mux.HandleFunc("/chart", func(w http.ResponseWriter, r *http.Request) {
+		serveCosts(w, r, "text/html; charset=utf-8", func() ([]byte, error) {
+			html, err := chartHTML()
+			return []byte(html), err
+		})
+	})
+	mux.HandleFunc("/data.json", func(w http.ResponseWriter, r *http.Request) {
+		serveCosts(w, r, "application/json", func() ([]byte, error) {
+			var buf bytes.Buffer
+			if err := render.JSON(&buf, buildGraph()); err != nil {
+				return nil, err
+			}
+			buf.WriteByte('\n')
+			return buf.Bytes(), nil
+		})
+	})
+
+	server := &http.Server{Addr: serveAddr, Handler: mux}
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), shutdownTimeout)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	infof("Serving the chart on http://%s/chart", displayAddr(serveAddr))
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		log.Fatalf("failed to serve: %v", err)
+	}
+	infof("Stopped serving")
+}
+
+// withTimeout returns the context of a request or refresh, canceled after -timeout
+func withTimeout(parent context.Context) (context.Context, context.CancelFunc) {
+	if options.timeout > 0 {
+		return context.WithTimeout(parent, options.timeout)
+	}
+	return context.WithCancel(parent)
+}
+
+// displayAddr returns the address to open in a browser, e.g. localhost:8080 for ":8080"
+func displayAddr(addr string) string {
+	if strings.HasPrefix(addr, ":") {
+		return "localhost" + addr
+	}
+	return addr
+}
+
+// serveCosts loads the costs selected by the query parameters and replies with the rendered body.
+// Invalid parameters are answered with 400, config errors with 500, unreadable inputs and failed accounts with 502,
+// the latter unless continueOnError is set, and requests canceled by the client or exceeding -timeout with 503.
+func serveCosts(w http.ResponseWriter, r *http.Request, contentType string, body func() ([]byte, error)) {
+	query := r.URL.Query()
+	overrides, period, err := queryOverrides(query)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	serveMu.Lock()
+	defer serveMu.Unlock()
+	infof("Serving %s", r.URL)
+
+	// The parameters of the request override the config like flags, for this request only
+	savedOverrides, savedPeriod := flagOverrides, options.period
+	defer func() {
+		flagOverrides, options.period = savedOverrides, savedPeriod
+	}()
+	flagOverrides = append(slices.Clone(flagOverrides), overrides...)
+	if period != "" {
+		options.period = period
+	} else if query.Get("start") != "" || query.Get("end") != "" {
+		options.period = ""
+	}
+
+	var cancel context.CancelFunc
+	runContext, cancel = withTimeout(r.Context())
+	defer cancel()
+
+	resetRun()
+	if err := readConfig(options.configFile); err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	hierarchy, err := setupConfig()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	err = loadResults(hierarchy)
+	if err := runContext.Err(); err != nil {
+		http.Error(w, fmt.Sprintf("stopped before the costs were loaded: %v", err), http.StatusServiceUnavailable)
+		return
+	}
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadGateway)
+		return
+	}
+	if len(fetchFailures) > 0 && !globalConfig.ContinueOnError {
+		var sb strings.Builder
+		fmt.Fprintf(&sb, "failed to fetch %d accounts or sources:\n", len(fetchFailures))
+		for _, failure := range fetchFailures {
+			fmt.Fprintf(&sb, "  %s: %v\n", failure.name, failure.err)
+		}
+		http.Error(w, sb.String(), http.StatusBadGateway)
+		return
+	}
+
+	data, err := body()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", contentType)
+	w.Write(data)
+}
+
+// queryOverrides validates the query parameters and returns the config values they override, and the relative period:
+// start and end dates YYYY-MM-DD, period like -period, threshold, and account as comma separated names or patterns
+// of the account level, like include.account
+func queryOverrides(query url.Values) ([]configOverride, string, error) {
+	var overrides []configOverride
+	start, end := query.Get("start"), query.Get("end")
+	for _, date := range []struct{ name, key, value string }{{"start", "startDate", start}, {"end", "endDate", end}} {
+		if date.value == "" {
+			continue
+		}
+		if _, err := time.Parse(time.DateOnly, date.value); err != nil {
+			return nil, "", fmt.Errorf("invalid %s date %q, use YYYY-MM-DD", date.name, date.value)
+		}
+		overrides = append(overrides, configOverride{date.key, scalarNode(date.value)})
+	}
+	if start != "" && end != "" && start >= end {
+		return nil, "", fmt.Errorf("start date %s is not before end date %s", start, end)
+	}
+	if start != "" || end != "" {
+		// Dates replace the relative period of the config file
+		overrides = append(overrides, configOverride{"period", scalarNode("")})
+	}
+
+	period := query.Get("period")
+	if period != "" && (start != "" || end != "") {
+		return nil, "", fmt.Errorf("give either a period or start and end dates")
+	}
+	if period != "" && !knownPeriod(period) {
+		return nil, "", fmt.Errorf("unknown period %q, use last-month, mtd, last-<n>d, last-quarter or YYYY-MM", period)
+	}
+
+	if threshold := query.Get("threshold"); threshold != "" {
+		if value, err := strconv.ParseFloat(threshold, 64); err != nil || value < 0 {
+			return nil, "", fmt.Errorf("invalid threshold %q, use a cost of at least 0", threshold)
+		}
+		overrides = append(overrides, configOverride{"threshold", scalarNode(threshold)})
+	}
+
+	if accounts := query.Get("account"); accounts != "" {
+		patterns := &yaml.Node{Kind: yaml.SequenceNode, Tag: "!!seq"}
+		for _, account := range strings.Split(accounts, ",") {
+			account = strings.TrimSpace(account)
+			if err := checkPattern(account); err != nil {
+				return nil, "", fmt.Errorf("invalid account pattern %q: %v", account, err)
+			}
+			patterns.Content = append(patterns.Content, &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: account})
+		}
+		overrides = append(overrides, configOverride{"include.account", patterns})
+	}
+	return overrides, period, nil
+}
+
+// resetRun clears the config and the costs of the previous request
+func resetRun() {
+	globalConfig = Config{}
+	currency = "USD"
+	resetResults()
+	previousResults = nil
+	nodeLevels = map[string]map[int]string{"all": {0: "all"}}
+	levelTitles = make(map[int]string)
+	fetchFailures = nil
+	aiAnalysis = ""
+	nodeTeams = make(map[string]string)
+	teamDepth = 0
+	// Rates are looked up again, as the ECB publishes them daily
+	appliedRates = make(map[string]float64)
+	ecbRates = nil
+}
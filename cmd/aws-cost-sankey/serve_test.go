@@ -0,0 +1,92 @@
+package main
+
+import (
+	"context"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestQueryOverrides(t *testing.T) {
+	for _, tt := range []struct {
+		query string
+		keys  []string
+		err   bool
+	}{
+		{"", nil, false},
+		{"start=2024-10-01&end=2024-11-01", []string{"startDate", "endDate", "period"}, false},
+		{"period=last-30d&threshold=5", []string{"threshold"}, false},
+		{"account=prod,/^data-/", []string{"include.account"}, false},
+		{"start=2024-11-01&end=2024-10-01", nil, true},
+		{"start=2024-10", nil, true},
+		{"period=last-0d", nil, true},
+		{"period=mtd&end=2024-11-01", nil, true},
+		{"threshold=-1", nil, true},
+		{"account=/[/", nil, true},
+	} {
+		query, err := url.ParseQuery(tt.query)
+		if err != nil {
+			t.Fatal(err)
+		}
+		overrides, _, err := queryOverrides(query)
+		if (err != nil) != tt.err {
+			t.Errorf("queryOverrides(%q) error = %v, want error %v", tt.query, err, tt.err)
+			continue
+		}
+		var keys []string
+		for _, override := range overrides {
+			keys = append(keys, override.key)
+		}
+		if len(keys) != len(tt.keys) {
+			t.Errorf("queryOverrides(%q) keys = %v, want %v", tt.query, keys, tt.keys)
+			continue
+		}
+		for i := range keys {
+			if keys[i] != tt.keys[i] {
+				t.Errorf("queryOverrides(%q) keys = %v, want %v", tt.query, keys, tt.keys)
+				break
+			}
+		}
+	}
+}
+
+func TestRefreshReturnsConfigError(t *testing.T) {
+	saved, savedInput, savedContext := options.configFile, options.inputFile, runContext
+	defer func() { options.configFile, options.inputFile, runContext = saved, savedInput, savedContext }()
+
+	for _, tt := range []struct {
+		config, input, want string
+	}{
+		{"startDate: [\n", "", "failed to parse config file"},
+		{"hierarchy: [\"tags:environment\"]\n", "", "unknown hierarchy level type: tags"},
+		{"startDate: \"2024-10-01\"\nendDate: \"2024-11-01\"\n", "missing.txt", "missing.txt"},
+	} {
+		dir := t.TempDir()
+		options.configFile = filepath.Join(dir, "config.yaml")
+		if err := os.WriteFile(options.configFile, []byte(tt.config), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		options.inputFile = ""
+		if tt.input != "" {
+			options.inputFile = filepath.Join(dir, tt.input)
+		}
+
+		_, err := refresh(context.Background(), ScheduleConfig{Formats: "json", Output: filepath.Join(dir, "output")})
+		if err == nil || !strings.Contains(err.Error(), tt.want) {
+			t.Errorf("refresh() = %v, want an error containing %q", err, tt.want)
+		}
+	}
+}
+
+func TestResetRunClearsTeamsAndRates(t *testing.T) {
+	nodeTeams["prod"] = "payments"
+	teamDepth = 2
+	appliedRates["EUR"] = 1.08
+	ecbRates = map[string]float64{"USD": 1.08}
+	resetRun()
+	if len(nodeTeams) != 0 || teamDepth != 0 || len(appliedRates) != 0 || ecbRates != nil {
+		t.Errorf("resetRun() kept teams %v at depth %d, applied rates %v and ECB rates %v", nodeTeams, teamDepth, appliedRates, ecbRates)
+	}
+}
@@ -0,0 +1,194 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+)
+
+// Base URL of the Slack Web API, replaced by tests
+var slackAPI = "https://slack.com/api/"
+
+// Slack truncates the text of a section beyond this length
+const slackSectionLimit = 3000
+
+// SlackConfig posts the summary of a run through an incoming webhook, or as a bot with a token, which also uploads
+// a PNG snapshot of the diagram to the thread of the message. The token needs the chat:write and files:write scopes.
+type SlackConfig struct {
+	WebhookURL     string `yaml:"webhookUrl"`
+	WebhookURLFrom string `yaml:"webhookUrlFrom"`
+	Token          string `yaml:"token"`
+	TokenFrom      string `yaml:"tokenFrom"`
+	Channel        string `yaml:"channel"`
+}
+
+func validateSlack() error {
+	slack := globalConfig.Slack
+	switch {
+	case slack.Token != "" && slack.Channel == "":
+		return fmt.Errorf("slack token needs a channel ID, e.g. C0123456789")
+	case slack.Token == "" && slack.WebhookURL == "":
+		return fmt.Errorf("set slack webhookUrl, or token and channel")
+	}
+	return nil
+}
+
+// notifySlack posts the summary, uploading the snapshot if posted as a bot
+func notifySlack(summary runSummary) error {
+	message := map[string]interface{}{
+		"text":   strings.Join(summary.lines(), "\n"),
+		"blocks": slackBlocks(summary),
+	}
+	slack := globalConfig.Slack
+	if slack.Token == "" {
+		return postJSON(slack.WebhookURL, nil, message)
+	}
+
+	message["channel"] = slack.Channel
+	var posted struct {
+		Channel string `json:"channel"`
+		TS      string `json:"ts"`
+	}
+	if err := callSlack("chat.postMessage", message, &posted); err != nil {
+		return err
+	}
+	return uploadSlackSnapshot(posted.Channel, posted.TS)
+}
+
+// slackBlocks lays out the summary as Block Kit blocks
+func slackBlocks(summary runSummary) []map[string]interface{} {
+	section := func(text string) map[string]interface{} {
+		if runes := []rune(text); len(runes) > slackSectionLimit {
+			text = string(runes[:slackSectionLimit-1]) + "…"
+		}
+		return map[string]interface{}{"type": "section", "text": map[string]string{"type": "mrkdwn", "text": text}}
+	}
+
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "*%s* %s from %s to %s", slackEscape(formatCost(summary.Total, 2)), slackEscape(summary.Metric), summary.Start, summary.End)
+	for _, node := range summary.Top {
+		fmt.Fprintf(&sb, "\n• %s: %s", slackEscape(node.Name), slackEscape(formatCost(node.Value, 2)))
+	}
+	blocks := []map[string]interface{}{
+		{"type": "header", "text": map[string]string{"type": "plain_text", "text": summary.Title}},
+		section(sb.String()),
+	}
+
+	if summary.Compared != "" {
+		sb.Reset()
+		fmt.Fprintf(&sb, "*Compared with %s*", slackEscape(summary.Compared))
+		for _, m := range append(append([]mover{}, summary.Increases...), summary.Decreases...) {
+			fmt.Fprintf(&sb, "\n• %s: %s to %s (%s)", slackEscape(m.name), slackEscape(formatCost(m.first, 2)), slackEscape(formatCost(m.last, 2)), slackEscape(formatChange(m)))
+		}
+		blocks = append(blocks, section(sb.String()))
+	}
+	if summary.Analysis != "" {
+		blocks = append(blocks, section("*Analysis*\n"+slackEscape(summary.Analysis)))
+	}
+	if len(summary.Failures) > 0 {
+		blocks = append(blocks, section(":warning: Incomplete, failed to fetch "+slackEscape(strings.Join(summary.Failures, ", "))))
+	}
+	if summary.Link != "" {
+		blocks = append(blocks, section(fmt.Sprintf("<%s|Open the chart>", summary.Link)))
+	}
+	return blocks
+}
+
+// slackEscape escapes the characters that Slack reads as markup
+func slackEscape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
+
+// callSlack calls a method of the Web API with a JSON body and decodes the response into result
+func callSlack(method string, request interface{}, result interface{}) error {
+	body, err := json.Marshal(request)
+	if err != nil {
+		return err
+	}
+	return decodeSlack(method, "application/json; charset=utf-8", bytes.NewReader(body), result)
+}
+
+// uploadSlackSnapshot uploads the PNG of the diagram to the thread of a message, as a URL is requested, the file is
+// posted to it and the upload is completed
+func uploadSlackSnapshot(channel string, ts string) error {
+	var buf bytes.Buffer
+	if err := writePNG(&buf); err != nil {
+		return fmt.Errorf("failed to render snapshot: %v", err)
+	}
+
+	var upload struct {
+		UploadURL string `json:"upload_url"`
+		FileID    string `json:"file_id"`
+	}
+	form := url.Values{"filename": {"costs.png"}, "length": {strconv.Itoa(buf.Len())}}
+	if err := decodeSlack("files.getUploadURLExternal", "application/x-www-form-urlencoded", strings.NewReader(form.Encode()), &upload); err != nil {
+		return err
+	}
+	resp, err := slackRequest(upload.UploadURL, "image/png", &buf)
+	if err != nil {
+		return err
+	}
+	if resp.status != http.StatusOK {
+		return fmt.Errorf("snapshot upload failed with %d: %s", resp.status, resp.body)
+	}
+
+	return callSlack("files.completeUploadExternal", map[string]interface{}{
+		"files":      []map[string]string{{"id": upload.FileID, "title": chartTitle()}},
+		"channel_id": channel,
+		"thread_ts":  ts,
+	}, nil)
+}
+
+// decodeSlack posts to a Web API method, which answers with "ok" false and the error on failure
+func decodeSlack(method string, contentType string, body io.Reader, result interface{}) error {
+	resp, err := slackRequest(slackAPI+method, contentType, body)
+	if err != nil {
+		return err
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(resp.body, &status); err != nil {
+		return fmt.Errorf("%s answered %d: %s", method, resp.status, resp.body)
+	}
+	if !status.OK {
+		return fmt.Errorf("%s failed: %s", method, status.Error)
+	}
+	if result != nil {
+		return json.Unmarshal(resp.body, result)
+	}
+	return nil
+}
+
+type slackResponse struct {
+	status int
+	body   []byte
+}
+
+// slackRequest posts a body, authorized by the token if any, and reads the response
+func slackRequest(endpoint string, contentType string, body io.Reader) (slackResponse, error) {
+	req, err := http.NewRequestWithContext(runContext, http.MethodPost, endpoint, body)
+	if err != nil {
+		return slackResponse{}, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	if token := globalConfig.Slack.Token; token != "" && strings.HasPrefix(endpoint, slackAPI) {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return slackResponse{}, err
+	}
+	defer resp.Body.Close()
+	data, err := io.ReadAll(resp.Body)
+	if err != nil {
+		return slackResponse{}, err
+	}
+	return slackResponse{resp.StatusCode, data}, nil
+}
@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNotifySlackUploadsSnapshot(t *testing.T) {
+	setupRunTest(t, Config{Slack: SlackConfig{Token: "xoxb-test", Channel: "C0123456789"}}, twoAccounts())
+
+	var calls []string
+	var message map[string]interface{}
+	url := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		calls = append(calls, r.URL.Path)
+		body, _ := io.ReadAll(r.Body)
+		if r.URL.Path != "/upload" && r.Header.Get("Authorization") != "Bearer xoxb-test" {
+			t.Errorf("%s not authorized by the token", r.URL.Path)
+		}
+		switch r.URL.Path {
+		case "/api/chat.postMessage":
+			json.Unmarshal(body, &message)
+			io.WriteString(w, `{"ok": true, "channel": "C0123456789", "ts": "1700000000.000100"}`)
+		case "/api/files.getUploadURLExternal":
+			io.WriteString(w, `{"ok": true, "upload_url": "`+"http://"+r.Host+`/upload", "file_id": "F1"}`)
+		case "/upload":
+			if !strings.HasPrefix(string(body), "\x89PNG") {
+				t.Errorf("uploaded file is not a PNG")
+			}
+		case "/api/files.completeUploadExternal":
+			if !strings.Contains(string(body), `"thread_ts":"1700000000.000100"`) {
+				t.Errorf("snapshot not posted to the thread of the message: %s", body)
+			}
+			io.WriteString(w, `{"ok": true}`)
+		default:
+			http.NotFound(w, r)
+		}
+	})
+	setGlobal(t, &slackAPI, url+"/api/")
+
+	if err := sendNotifications([]string{"slack"}, nil); err != nil {
+		t.Fatalf("sendNotifications() = %v", err)
+	}
+	if len(calls) != 4 {
+		t.Fatalf("calls = %v, want the message and the 3 steps of the upload", calls)
+	}
+	if message["channel"] != "C0123456789" {
+		t.Errorf("channel = %v, want the configured channel", message["channel"])
+	}
+	if blocks, _ := message["blocks"].([]interface{}); len(blocks) == 0 {
+		t.Errorf("message has no blocks")
+	}
+}
+
+func TestNotifySlackError(t *testing.T) {
+	setupFetchTest(t, Config{Slack: SlackConfig{Token: "xoxb-test", Channel: "C0123456789"}})
+	url := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, `{"ok": false, "error": "channel_not_found"}`)
+	})
+	setGlobal(t, &slackAPI, url+"/api/")
+
+	err := sendNotifications([]string{"slack"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "channel_not_found") {
+		t.Errorf("sendNotifications() = %v, want channel_not_found", err)
+	}
+}
@@ -0,0 +1,158 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/credentials/ssocreds"
+	"github.com/aws/aws-sdk-go-v2/service/sso"
+	"github.com/aws/aws-sdk-go-v2/service/ssooidc"
+	ssooidctypes "github.com/aws/aws-sdk-go-v2/service/ssooidc/types"
+)
+
+const deviceCodeGrantType = "urn:ietf:params:oauth:grant-type:device_code"
+
+// ssoToken mirrors the token cache file written by `aws sso login`
+// so tokens are shared between this tool and the AWS CLI
+type ssoToken struct {
+	StartURL              string    `json:"startUrl"`
+	Region                string    `json:"region"`
+	AccessToken           string    `json:"accessToken"`
+	ExpiresAt             time.Time `json:"expiresAt"`
+	ClientID              string    `json:"clientId,omitempty"`
+	ClientSecret          string    `json:"clientSecret,omitempty"`
+	RegistrationExpiresAt time.Time `json:"registrationExpiresAt,omitempty"`
+	RefreshToken          string    `json:"refreshToken,omitempty"`
+}
+
+// ssoCredentials returns a credentials provider for an IAM Identity Center account.
+// The device authorization flow is triggered when the cached SSO token is missing or expired.
+func ssoCredentials(account Account, cfg aws.Config) (aws.CredentialsProvider, error) {
+	cfg.Region = account.SSORegion
+
+	// sso-session based tokens are cached by session name, legacy ones by start URL
+	cacheKey := account.SSOSession
+	if cacheKey == "" {
+		cacheKey = account.SSOStartURL
+	}
+	tokenFile, err := ssocreds.StandardCachedTokenFilepath(cacheKey)
+	if err != nil {
+		return nil, fmt.Errorf("failed to resolve SSO token cache: %w", err)
+	}
+
+	token, err := loadSSOToken(tokenFile)
+	if err != nil || time.Now().Add(time.Minute).After(token.ExpiresAt) {
+		infof("SSO token for %s is missing or expired, starting device authorization", account.SSOStartURL)
+		if token, err = ssoLogin(ssooidc.NewFromConfig(cfg), account); err != nil {
+			return nil, err
+		}
+		if err := storeSSOToken(tokenFile, token); err != nil {
+			return nil, err
+		}
+	}
+
+	return aws.NewCredentialsCache(ssocreds.New(sso.NewFromConfig(cfg), account.SSOAccountID, account.SSORoleName, account.SSOStartURL, func(o *ssocreds.Options) {
+		o.CachedTokenFilepath = tokenFile
+	})), nil
+}
+
+func ssoLogin(client *ssooidc.Client, account Account) (ssoToken, error) {
+	ctx := runContext
+
+	registration, err := client.RegisterClient(ctx, &ssooidc.RegisterClientInput{
+		ClientName: aws.String(defaultSessionName),
+		ClientType: aws.String("public"),
+	})
+	if err != nil {
+		return ssoToken{}, fmt.Errorf("failed to register SSO client: %w", err)
+	}
+
+	authorization, err := client.StartDeviceAuthorization(ctx, &ssooidc.StartDeviceAuthorizationInput{
+		ClientId:     registration.ClientId,
+		ClientSecret: registration.ClientSecret,
+		StartUrl:     aws.String(account.SSOStartURL),
+	})
+	if err != nil {
+		return ssoToken{}, fmt.Errorf("failed to start SSO device authorization: %w", err)
+	}
+
+	// Printed whatever the log level, as the login waits for it
+	fmt.Fprintf(os.Stderr, "Open the following URL in a browser and confirm code %s to continue:\n%s\n",
+		aws.ToString(authorization.UserCode), aws.ToString(authorization.VerificationUriComplete))
+
+	interval := time.Duration(authorization.Interval) * time.Second
+	if interval == 0 {
+		interval = 5 * time.Second
+	}
+	deadline := time.Now().Add(time.Duration(authorization.ExpiresIn) * time.Second)
+
+	for time.Now().Before(deadline) {
+		select {
+		case <-ctx.Done():
+			return ssoToken{}, ctx.Err()
+		case <-time.After(interval):
+		}
+
+		result, err := client.CreateToken(ctx, &ssooidc.CreateTokenInput{
+			ClientId:     registration.ClientId,
+			ClientSecret: registration.ClientSecret,
+			DeviceCode:   authorization.DeviceCode,
+			GrantType:    aws.String(deviceCodeGrantType),
+		})
+		if err != nil {
+			var pending *ssooidctypes.AuthorizationPendingException
+			var slowDown *ssooidctypes.SlowDownException
+			if errors.As(err, &pending) {
+				continue
+			}
+			if errors.As(err, &slowDown) {
+				interval += 5 * time.Second
+				continue
+			}
+			return ssoToken{}, fmt.Errorf("failed to create SSO token: %w", err)
+		}
+
+		infof("SSO login succeeded for %s", account.SSOStartURL)
+		return ssoToken{
+			StartURL:              account.SSOStartURL,
+			Region:                account.SSORegion,
+			AccessToken:           aws.ToString(result.AccessToken),
+			ExpiresAt:             time.Now().Add(time.Duration(result.ExpiresIn) * time.Second).UTC(),
+			ClientID:              aws.ToString(registration.ClientId),
+			ClientSecret:          aws.ToString(registration.ClientSecret),
+			RegistrationExpiresAt: time.Unix(registration.ClientSecretExpiresAt, 0).UTC(),
+			RefreshToken:          aws.ToString(result.RefreshToken),
+		}, nil
+	}
+
+	return ssoToken{}, errors.New("SSO device authorization expired before it was confirmed")
+}
+
+func loadSSOToken(filename string) (ssoToken, error) {
+	var token ssoToken
+	data, err := os.ReadFile(filename)
+	if err != nil {
+		return token, err
+	}
+	err = json.Unmarshal(data, &token)
+	return token, err
+}
+
+func storeSSOToken(filename string, token ssoToken) error {
+	data, err := json.Marshal(token)
+	if err != nil {
+		return fmt.Errorf("failed to marshal SSO token: %w", err)
+	}
+	if err := os.MkdirAll(filepath.Dir(filename), 0700); err != nil {
+		return fmt.Errorf("failed to create SSO token cache: %w", err)
+	}
+	if err := os.WriteFile(filename, data, 0600); err != nil {
+		return fmt.Errorf("failed to write SSO token cache: %w", err)
+	}
+	return nil
+}
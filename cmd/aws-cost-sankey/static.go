@@ -0,0 +1,346 @@
+package main
+
+import (
+	"bufio"
+	"fmt"
+	"html"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/png"
+	"io"
+	"math"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+
+	"golang.org/x/image/font"
+	"golang.org/x/image/font/basicfont"
+	"golang.org/x/image/math/fixed"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Colors of the westeros theme used by the HTML chart
+var staticPalette = []string{"#516b91", "#59c4e6", "#edafda", "#93b7e3", "#a5e7f0", "#cbb0e3"}
+
+const (
+	staticMargin      = 20.0
+	staticTitleHeight = 40.0
+	staticNodeWidth   = 16.0
+	staticNodePadding = 8.0
+	staticLinkOpacity = 0.35
+
+	// Links thinner than this are not labeled when linkPercentages is enabled
+	staticLinkLabelHeight = 12.0
+)
+
+type layoutNode struct {
+	Name  string
+	Depth int
+	Value float64
+	Color string
+	X, Y  float64
+	H     float64
+	in    float64
+	out   float64
+}
+
+type layoutLink struct {
+	Source *layoutNode
+	Target *layoutNode
+	Value  float64
+	Color  string
+	SY, TY float64
+	H      float64
+}
+
+// layoutSankey positions the nodes in columns by depth and stacks the links along the nodes,
+// mirroring the layout of the HTML chart so that images can be rendered without a browser
+func layoutSankey(data map[string]map[string]float64, width float64, height float64) ([]*layoutNode, []*layoutLink) {
+	filtered := make(map[string]map[string]float64)
+	for parent, children := range withTotalRoot(visibleLinks(data)) {
+		for child, cost := range children {
+			if cost > 0 {
+				addCost(filtered, parent, child, cost)
+			}
+		}
+	}
+
+	nodes := make(map[string]*layoutNode)
+	var links []*layoutLink
+	depths := costgraph.Flows(filtered).Depths()
+	maxDepth := 0
+	for name, depth := range depths {
+		nodes[name] = &layoutNode{Name: name, Depth: depth}
+		maxDepth = max(maxDepth, depth)
+	}
+	for parent, children := range filtered {
+		for child, cost := range children {
+			links = append(links, &layoutLink{Source: nodes[parent], Target: nodes[child], Value: cost})
+			nodes[parent].out += cost
+			nodes[child].in += cost
+		}
+	}
+
+	// Nodes are stacked per column, largest first
+	columns := make([][]*layoutNode, maxDepth+1)
+	for _, node := range nodes {
+		node.Value = math.Max(node.in, node.out)
+		columns[node.Depth] = append(columns[node.Depth], node)
+	}
+	scale := math.Inf(1)
+	for _, column := range columns {
+		sort.Slice(column, func(i, j int) bool {
+			if column[i].Value != column[j].Value {
+				return column[i].Value > column[j].Value
+			}
+			return column[i].Name < column[j].Name
+		})
+		var total float64
+		for _, node := range column {
+			total += node.Value
+		}
+		available := height - staticTitleHeight - 2*staticMargin - staticNodePadding*float64(len(column)-1)
+		if total > 0 {
+			scale = math.Min(scale, available/total)
+		}
+	}
+	if math.IsInf(scale, 1) || scale < 0 {
+		scale = 0
+	}
+
+	step := 0.0
+	if maxDepth > 0 {
+		step = (width - 2*staticMargin - staticNodeWidth) / float64(maxDepth)
+	}
+	colorIndex := 0
+	for depth, column := range columns {
+		y := staticTitleHeight + staticMargin
+		for _, node := range column {
+			node.X = staticMargin + float64(depth)*step
+			node.Y = y
+			node.H = node.Value * scale
+			node.Color = nodeColor(node.Name)
+			if node.Color == "" {
+				node.Color = staticPalette[colorIndex%len(staticPalette)]
+				colorIndex++
+			}
+			y += node.H + staticNodePadding
+		}
+	}
+
+	// Links leave and enter nodes in the vertical order of the nodes on the other end
+	sort.Slice(links, func(i, j int) bool {
+		if links[i].Target.Y != links[j].Target.Y {
+			return links[i].Target.Y < links[j].Target.Y
+		}
+		return links[i].Source.Y < links[j].Source.Y
+	})
+	offsets := make(map[*layoutNode]float64)
+	for _, link := range links {
+		link.Color = link.Source.Color
+		if len(globalConfig.Colors) > 0 {
+			link.Color = link.Target.Color
+		}
+		link.H = link.Value * scale
+		link.SY = link.Source.Y + offsets[link.Source]
+		offsets[link.Source] += link.H
+	}
+	sort.SliceStable(links, func(i, j int) bool { return links[i].Source.Y < links[j].Source.Y })
+	incoming := make(map[*layoutNode]float64)
+	for _, link := range links {
+		link.TY = link.Target.Y + incoming[link.Target]
+		incoming[link.Target] += link.H
+	}
+
+	result := make([]*layoutNode, 0, len(nodes))
+	for _, column := range columns {
+		result = append(result, column...)
+	}
+	return result, links
+}
+
+// chartSize parses the configured chart size, e.g. "1500px"
+func chartSize(size string, fallback float64) float64 {
+	value, err := strconv.ParseFloat(strings.TrimSuffix(strings.TrimSpace(size), "px"), 64)
+	if err != nil || value <= 0 {
+		return fallback
+	}
+	return value
+}
+
+func staticTitle() string {
+	return fmt.Sprintf("%s %s-%s %s > %s", chartTitle(), globalConfig.StartDate, globalConfig.EndDate, globalConfig.Metric, formatCost(globalConfig.Threshold, 0))
+}
+
+type linkLabel struct {
+	x, y float64
+	text string
+}
+
+// linkLabels returns the cost and share of the source node of links thick enough to be labeled,
+// placed at the middle of each link, when linkPercentages is enabled
+func linkLabels(links []*layoutLink) []linkLabel {
+	if !globalConfig.LinkPercentages {
+		return nil
+	}
+	data := withTotalRoot(results)
+	labels := make([]linkLabel, 0, len(links))
+	for _, link := range links {
+		if link.H < staticLinkLabelHeight {
+			continue
+		}
+		x := (link.Source.X + staticNodeWidth + link.Target.X) / 2
+		y := (link.SY+link.TY)/2 + link.H/2
+		labels = append(labels, linkLabel{x, y, fmt.Sprintf("%s (%s)", formatCost(link.Value, 0), percentOfParent(link.Value, outgoingCost(data, link.Source.Name)))})
+	}
+	return labels
+}
+
+// outgoingCost returns the total cost flowing out of the node, including links below the threshold
+func outgoingCost(data map[string]map[string]float64, name string) float64 {
+	var total float64
+	for _, cost := range data[name] {
+		total += cost
+	}
+	return total
+}
+
+func staticLabel(node *layoutNode) string {
+	return fmt.Sprintf("%s %s", formatCost(node.Value, 0), node.Name)
+}
+
+func generateSVG(outputFile string) error {
+	infof("Generating SVG output...")
+
+	width := chartSize(globalConfig.Width, 1500)
+	height := chartSize(globalConfig.Height, 1300)
+	nodes, links := layoutSankey(results, width, height)
+
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+	w := bufio.NewWriter(f)
+
+	fmt.Fprintf(w, `<svg xmlns="http://www.w3.org/2000/svg" width="%.0f" height="%.0f" viewBox="0 0 %.0f %.0f" font-family="sans-serif" font-size="12">`+"\n", width, height, width, height)
+	fmt.Fprintf(w, `<rect width="100%%" height="100%%" fill="#ffffff"/>`+"\n")
+	fmt.Fprintf(w, `<text x="%.0f" y="%.0f" font-size="16" font-weight="bold">%s</text>`+"\n", staticMargin, staticTitleHeight/2+6, html.EscapeString(staticTitle()))
+
+	for _, link := range links {
+		x0 := link.Source.X + staticNodeWidth
+		x1 := link.Target.X
+		mid := (x0 + x1) / 2
+		fmt.Fprintf(w, `<path d="M%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f L%.1f,%.1f C%.1f,%.1f %.1f,%.1f %.1f,%.1f Z" fill="%s" fill-opacity="%.2f"/>`+"\n",
+			x0, link.SY, mid, link.SY, mid, link.TY, x1, link.TY,
+			x1, link.TY+link.H, mid, link.TY+link.H, mid, link.SY+link.H, x0, link.SY+link.H,
+			link.Color, staticLinkOpacity)
+	}
+	for _, link := range linkLabels(links) {
+		fmt.Fprintf(w, `<text x="%.1f" y="%.1f" text-anchor="middle" dominant-baseline="middle" font-size="10">%s</text>`+"\n", link.x, link.y, html.EscapeString(link.text))
+	}
+	for _, node := range nodes {
+		fmt.Fprintf(w, `<rect x="%.1f" y="%.1f" width="%.0f" height="%.1f" fill="%s"/>`+"\n", node.X, node.Y, staticNodeWidth, math.Max(node.H, 1), node.Color)
+
+		// Labels of the last column are placed on the left so they stay within the canvas
+		x, anchor := node.X+staticNodeWidth+4, "start"
+		if node.X+staticNodeWidth+staticMargin >= width {
+			x, anchor = node.X-4, "end"
+		}
+		fmt.Fprintf(w, `<text x="%.1f" y="%.1f" text-anchor="%s" dominant-baseline="middle">%s</text>`+"\n", x, node.Y+node.H/2, anchor, html.EscapeString(staticLabel(node)))
+	}
+	fmt.Fprintln(w, "</svg>")
+
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	return nil
+}
+
+func generatePNG(outputFile string) error {
+	infof("Generating PNG output...")
+
+	f, err := os.Create(outputFile)
+	if err != nil {
+		return fmt.Errorf("failed to open output file: %w", err)
+	}
+	defer f.Close()
+	if err := writePNG(f); err != nil {
+		return fmt.Errorf("failed to write to output file: %w", err)
+	}
+	return nil
+}
+
+// writePNG writes the diagram as a PNG image
+func writePNG(w io.Writer) error {
+	img, err := renderPNG()
+	if err != nil {
+		return err
+	}
+	return png.Encode(w, img)
+}
+
+// renderPNG rasterizes the diagram using the configured chart size
+func renderPNG() (*image.RGBA, error) {
+	width := chartSize(globalConfig.Width, 1500)
+	height := chartSize(globalConfig.Height, 1300)
+	nodes, links := layoutSankey(results, width, height)
+
+	img := image.NewRGBA(image.Rect(0, 0, int(width), int(height)))
+	draw.Draw(img, img.Bounds(), image.White, image.Point{}, draw.Src)
+
+	// Links are drawn column by column, easing between the source and target positions like a bezier curve
+	for _, link := range links {
+		c, err := parseHexColor(link.Color)
+		if err != nil {
+			return nil, err
+		}
+		c.A = uint8(math.Round(255 * staticLinkOpacity))
+		fill := image.NewUniform(c)
+		x0 := link.Source.X + staticNodeWidth
+		x1 := link.Target.X
+		for x := math.Floor(x0); x < x1; x++ {
+			u := (x - x0) / (x1 - x0)
+			top := link.SY + (link.TY-link.SY)*u*u*(3-2*u)
+			draw.Draw(img, image.Rect(int(x), int(math.Round(top)), int(x)+1, int(math.Round(top+link.H))), fill, image.Point{}, draw.Over)
+		}
+	}
+
+	drawer := &font.Drawer{Dst: img, Src: image.Black, Face: basicfont.Face7x13}
+	drawText := func(x float64, y float64, text string) {
+		drawer.Dot = fixed.P(int(x), int(y))
+		drawer.DrawString(text)
+	}
+	drawText(staticMargin, staticTitleHeight/2+6, staticTitle())
+	for _, link := range linkLabels(links) {
+		drawText(link.x-float64(font.MeasureString(basicfont.Face7x13, link.text).Round())/2, link.y+4, link.text)
+	}
+
+	for _, node := range nodes {
+		c, err := parseHexColor(node.Color)
+		if err != nil {
+			return nil, err
+		}
+		rect := image.Rect(int(node.X), int(node.Y), int(node.X+staticNodeWidth), int(node.Y+math.Max(node.H, 1)))
+		draw.Draw(img, rect, image.NewUniform(c), image.Point{}, draw.Src)
+
+		label := staticLabel(node)
+		x := node.X + staticNodeWidth + 4
+		if node.X+staticNodeWidth+staticMargin >= width {
+			x = node.X - 4 - float64(font.MeasureString(basicfont.Face7x13, label).Round())
+		}
+		drawText(x, node.Y+node.H/2+4, label)
+	}
+	return img, nil
+}
+
+func parseHexColor(hex string) (color.NRGBA, error) {
+	c := color.NRGBA{A: 255}
+	if _, err := fmt.Sscanf(hex, "#%02x%02x%02x", &c.R, &c.G, &c.B); err != nil {
+		return c, fmt.Errorf("invalid color %s: %w", hex, err)
+	}
+	return c, nil
+}
@@ -0,0 +1,111 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+)
+
+// Name of the input or output file reading from stdin or writing to stdout, e.g. -i - or -o -
+const stdioName = "-"
+
+// stdinData holds stdin once read, since it can only be read once but its format is detected before it is parsed
+var (
+	stdinData []byte
+	stdinErr  error
+)
+
+// readStdin returns everything read from stdin
+func readStdin() ([]byte, error) {
+	if stdinData == nil && stdinErr == nil {
+		stdinData, stdinErr = io.ReadAll(os.Stdin)
+		if stdinErr != nil {
+			stdinErr = fmt.Errorf("failed to read stdin: %v", stdinErr)
+		}
+	}
+	return stdinData, stdinErr
+}
+
+// stdinFormat detects the format of flow data on stdin: "json" for a JSON graph, "text" for lines of
+// "parent [cost] child", otherwise "csv". A failed read is reported by the reader of the format.
+func stdinFormat() string {
+	data, _ := readStdin()
+	data = bytes.TrimSpace(data)
+	if json.Valid(data) && bytes.HasPrefix(data, []byte("{")) {
+		return "json"
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		if fields := strings.Fields(line); len(fields) >= 3 && strings.HasPrefix(fields[1], "[") && strings.HasSuffix(fields[1], "]") {
+			return "text"
+		}
+		break
+	}
+	return "csv"
+}
+
+// readInputFile returns the content of an input file, or of stdin for -
+func readInputFile(filename string) ([]byte, error) {
+	if filename == stdioName {
+		return readStdin()
+	}
+	return os.ReadFile(filename)
+}
+
+// openInputFile opens an input file, or stdin for -
+func openInputFile(filename string) (io.ReadCloser, error) {
+	if filename == stdioName {
+		data, err := readStdin()
+		return io.NopCloser(bytes.NewReader(data)), err
+	}
+	return os.Open(filename)
+}
+
+// checkStdout fails if -o - is given for a format that can't be written to stdout, or for several formats
+func checkStdout() error {
+	if options.outputFile != stdioName {
+		return nil
+	}
+	formats := outputFormatList(options.format)
+	if len(formats) > 1 {
+		return fmt.Errorf("-o - writes a single format to stdout, not %s", strings.Join(formats, ", "))
+	}
+	for _, format := range formats {
+		if outputFormat, ok := lookupOutputFormat(format); ok && !outputFormat.stdout {
+			return fmt.Errorf("-o - writes %s to stdout, not %s", strings.Join(stdoutFormatNames(), ", "), format)
+		}
+	}
+	return nil
+}
+
+// createOutputFile creates an output file, or returns stdout for -
+func createOutputFile(filename string) (io.WriteCloser, error) {
+	if filename == stdioName {
+		return nopWriteCloser{os.Stdout}, nil
+	}
+	return os.Create(filename)
+}
+
+// writeOutputFile writes an output file, or stdout for -
+func writeOutputFile(filename string, data []byte) error {
+	if filename == stdioName {
+		_, err := os.Stdout.Write(data)
+		return err
+	}
+	return os.WriteFile(filename, data, 0644)
+}
+
+// nopWriteCloser leaves stdout open when the output is closed
+type nopWriteCloser struct {
+	io.Writer
+}
+
+func (nopWriteCloser) Close() error {
+	return nil
+}
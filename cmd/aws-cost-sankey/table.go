@@ -0,0 +1,146 @@
+package main
+
+import (
+	"compress/gzip"
+	"encoding/csv"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+// readTable calls handle for each row of a CSV, gzipped CSV or parquet file, stopping at the first error.
+// Rows are keyed by column name. Nested parquet columns are keyed by their dot separated path.
+func readTable(filename string, handle func(row map[string]string) error) error {
+	if strings.HasSuffix(filename, ".parquet") {
+		return readParquet(filename, handle)
+	}
+	return readCSV(filename, handle)
+}
+
+func readCSV(filename string, handle func(row map[string]string) error) error {
+	f, err := openInputFile(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer f.Close()
+
+	var r io.Reader = f
+	if strings.HasSuffix(filename, ".gz") {
+		gz, err := gzip.NewReader(f)
+		if err != nil {
+			return fmt.Errorf("failed to decompress %s: %w", filename, err)
+		}
+		defer gz.Close()
+		r = gz
+	}
+
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return fmt.Errorf("failed to read header of %s: %w", filename, err)
+	}
+
+	for {
+		record, err := reader.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+		row := make(map[string]string, len(header))
+		for i, column := range header {
+			if i < len(record) {
+				row[column] = record[i]
+			}
+		}
+		if err := handle(row); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func readParquet(filename string, handle func(row map[string]string) error) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return fmt.Errorf("failed to open %s: %w", filename, err)
+	}
+	defer f.Close()
+
+	stat, err := f.Stat()
+	if err != nil {
+		return fmt.Errorf("failed to stat %s: %w", filename, err)
+	}
+	file, err := parquet.OpenFile(f, stat.Size())
+	if err != nil {
+		return fmt.Errorf("failed to open parquet file %s: %w", filename, err)
+	}
+
+	columns := file.Schema().Columns()
+	names := make([]string, len(columns))
+	types := make([]parquet.Type, len(columns))
+	for i, path := range columns {
+		names[i] = strings.Join(path, ".")
+		if leaf, ok := file.Schema().Lookup(path...); ok {
+			types[i] = leaf.Node.Type()
+		}
+	}
+
+	reader := parquet.NewReader(file)
+	defer reader.Close()
+
+	rows := make([]parquet.Row, 128)
+	for {
+		n, err := reader.ReadRows(rows)
+		for _, values := range rows[:n] {
+			row := make(map[string]string, len(names))
+			for _, value := range values {
+				if value.IsNull() || value.Column() < 0 || value.Column() >= len(names) {
+					continue
+				}
+				row[names[value.Column()]] = parquetString(value, types[value.Column()])
+			}
+			if err := handle(row); err != nil {
+				return err
+			}
+		}
+		if errors.Is(err, io.EOF) {
+			break
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", filename, err)
+		}
+	}
+	return nil
+}
+
+// parquetString formats a value like the same column of a CSV report, e.g. timestamps as RFC 3339 rather than numbers
+func parquetString(value parquet.Value, typ parquet.Type) string {
+	// Value.String formats doubles with single precision
+	if value.Kind() == parquet.Double {
+		return strconv.FormatFloat(value.Double(), 'f', -1, 64)
+	}
+	if typ != nil && value.Kind() == parquet.Int64 {
+		if logical := typ.LogicalType(); logical != nil && logical.Timestamp != nil {
+			var t time.Time
+			switch unit := logical.Timestamp.Unit; {
+			case unit.Millis != nil:
+				t = time.UnixMilli(value.Int64())
+			case unit.Micros != nil:
+				t = time.UnixMicro(value.Int64())
+			default:
+				t = time.Unix(0, value.Int64())
+			}
+			return t.UTC().Format(time.RFC3339)
+		}
+	}
+	return value.String()
+}
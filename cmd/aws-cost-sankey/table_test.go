@@ -0,0 +1,32 @@
+package main
+
+import (
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/parquet-go/parquet-go"
+)
+
+func TestReadParquetTimestamps(t *testing.T) {
+	type lineItem struct {
+		UsageStartDate time.Time `parquet:"line_item_usage_start_date,timestamp(millisecond)"`
+		UnblendedCost  float64   `parquet:"line_item_unblended_cost"`
+	}
+	filename := filepath.Join(t.TempDir(), "report.parquet")
+	start := time.Date(2024, 10, 31, 23, 0, 0, 0, time.UTC)
+	if err := parquet.WriteFile(filename, []lineItem{{start, 1.25}}); err != nil {
+		t.Fatal(err)
+	}
+
+	var rows []map[string]string
+	if err := readTable(filename, func(row map[string]string) error {
+		rows = append(rows, row)
+		return nil
+	}); err != nil {
+		t.Fatalf("readTable() = %v", err)
+	}
+	if len(rows) != 1 || rows[0]["line_item_usage_start_date"] != "2024-10-31T23:00:00Z" || rows[0]["line_item_unblended_cost"] != "1.25" {
+		t.Errorf("rows = %v, want the timestamp as RFC 3339", rows)
+	}
+}
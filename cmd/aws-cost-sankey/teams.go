@@ -0,0 +1,133 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Name of the inserted level and of the team of nodes missing from the mapping unless configured otherwise
+const (
+	defaultTeamTitle    = "team"
+	defaultUnmappedTeam = "Unassigned"
+)
+
+// TeamsConfig inserts a level of teams or cost centers above a level of the hierarchy, e.g. environments.
+// The file maps node names to teams, either as a YAML map or a CSV file with node and team columns.
+type TeamsConfig struct {
+	File     string `yaml:"file"`
+	Level    string `yaml:"level"`
+	Title    string `yaml:"title"`
+	Unmapped string `yaml:"unmapped"`
+}
+
+// Team of each node of the mapped level, and the depth of that level before the team level is inserted
+var (
+	nodeTeams = make(map[string]string)
+	teamDepth int
+)
+
+// loadTeams reads the team mapping and inserts the team level into the hierarchy, so that levels are still named
+// correctly, e.g. by thresholds, filters and reports. Costs are fetched with the hierarchy parsed before.
+func loadTeams() error {
+	teams := &globalConfig.Teams
+	if teams.File == "" {
+		return nil
+	}
+	if teams.Level == "" {
+		return fmt.Errorf("teams needs the level mapped to teams, e.g. environment")
+	}
+	if teams.Title == "" {
+		teams.Title = defaultTeamTitle
+	}
+	if teams.Unmapped == "" {
+		teams.Unmapped = defaultUnmappedTeam
+	}
+
+	index := slices.IndexFunc(hierarchyLevels, func(level Level) bool {
+		return level.String() == teams.Level || level.title() == teams.Level
+	})
+	if index < 0 {
+		return fmt.Errorf("teams level %s is not in the hierarchy", teams.Level)
+	}
+	teamDepth = index + 1
+	hierarchyLevels = slices.Insert(slices.Clone(hierarchyLevels), index, Level{Key: teams.Title})
+
+	if strings.HasSuffix(teams.File, ".yaml") || strings.HasSuffix(teams.File, ".yml") {
+		data, err := os.ReadFile(teams.File)
+		if err != nil {
+			return fmt.Errorf("failed to read teams: %v", err)
+		}
+		if err := yaml.Unmarshal(data, &nodeTeams); err != nil {
+			return fmt.Errorf("failed to parse teams: %v", err)
+		}
+	} else {
+		err := readTable(teams.File, func(row map[string]string) error {
+			if row["node"] == "" || row["team"] == "" {
+				return fmt.Errorf("missing node or team column in row: %v", row)
+			}
+			nodeTeams[row["node"]] = row["team"]
+			return nil
+		})
+		if err != nil {
+			return fmt.Errorf("failed to read teams: %v", err)
+		}
+	}
+	infof("Loaded %d team mappings from %s", len(nodeTeams), teams.File)
+	return nil
+}
+
+// applyTeams inserts the team of each node of the mapped level between the node and its parent
+func applyTeams() {
+	if globalConfig.Teams.File == "" {
+		return
+	}
+	insertTeams(results)
+	for _, data := range bucketResults {
+		insertTeams(data)
+	}
+	for _, data := range accountResults {
+		insertTeams(data)
+	}
+}
+
+func insertTeams(data map[string]map[string]float64) {
+	depths := costgraph.Flows(data).Depths()
+	moved := make(map[string]map[string]float64)
+	for parent, children := range data {
+		for child, cost := range children {
+			if depths[child] == teamDepth {
+				addCost(moved, parent, child, cost)
+			}
+		}
+	}
+	for parent, children := range moved {
+		for child, cost := range children {
+			team := teamNode(depths, child)
+			lowerLink(data, parent, child, cost)
+			addCost(data, parent, team, cost)
+			addCost(data, team, child, cost)
+		}
+	}
+}
+
+// teamNode returns the team of a node, looking up account namespaced nodes such as "acct1/prod" by their value too.
+// Teams named like another node are suffixed with the level title so they are not merged with that node.
+func teamNode(depths map[string]int, node string) string {
+	team, ok := nodeTeams[node]
+	if !ok {
+		_, value, found := strings.Cut(node, "/")
+		if team, ok = nodeTeams[value]; !found || !ok {
+			team = globalConfig.Teams.Unmapped
+		}
+	}
+	if _, exists := depths[team]; exists {
+		return fmt.Sprintf("%s (%s)", team, globalConfig.Teams.Title)
+	}
+	return team
+}
@@ -0,0 +1,77 @@
+package main
+
+import (
+	"fmt"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// visibleLinks returns the links at or above their threshold. With collapseOther, the links below the threshold
+// are summed up in an "Other" child per parent so that the children still add up to their parent.
+func visibleLinks(data map[string]map[string]float64) map[string]map[string]float64 {
+	depths := costgraph.Flows(data).Depths()
+	visible := make(map[string]map[string]float64)
+	for parent, children := range data {
+		var total float64
+		for _, cost := range children {
+			total += cost
+		}
+
+		var other float64
+		for child, cost := range children {
+			if cost >= levelThreshold(depths[child]) && cost >= total*globalConfig.ThresholdPercent/100 {
+				addCost(visible, parent, child, cost)
+			} else {
+				other += cost
+			}
+		}
+		if globalConfig.CollapseOther && other > 0 {
+			addCost(visible, parent, otherNodeName(parent), other)
+		}
+	}
+	return reachableLinks(visible, data)
+}
+
+// reachableLinks drops the links of nodes that are only reached through hidden links,
+// so that they don't show up as roots of their own
+func reachableLinks(visible map[string]map[string]float64, data map[string]map[string]float64) map[string]map[string]float64 {
+	var queue []string
+	for parent := range data {
+		if !hasParent(data, parent) {
+			queue = append(queue, parent)
+		}
+	}
+	reachable := make(map[string]map[string]float64)
+	visited := make(map[string]bool)
+	for len(queue) > 0 {
+		parent := queue[0]
+		queue = queue[1:]
+		if visited[parent] {
+			continue
+		}
+		visited[parent] = true
+		for child, cost := range visible[parent] {
+			addCost(reachable, parent, child, cost)
+			queue = append(queue, child)
+		}
+	}
+	return reachable
+}
+
+// levelThreshold returns the threshold of links into the level at the given depth.
+// Levels are matched by name or title, e.g. "dimension:SERVICE" or "SERVICE", like timeSeries.
+func levelThreshold(depth int) float64 {
+	if threshold, ok := globalConfig.Thresholds[levelName(depth)]; ok {
+		return threshold
+	}
+	if threshold, ok := globalConfig.Thresholds[levelTitle(depth)]; ok {
+		return threshold
+	}
+	return globalConfig.Threshold
+}
+
+// otherNodeName returns the name of the node collecting the small flows of a parent.
+// Names are unique per parent since the diagram merges nodes of the same name.
+func otherNodeName(parent string) string {
+	return fmt.Sprintf("%s (%s)", otherSeries, parent)
+}
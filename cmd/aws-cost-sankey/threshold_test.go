@@ -0,0 +1,20 @@
+package main
+
+import (
+	"testing"
+)
+
+func TestLevelThresholdOfRegionLevel(t *testing.T) {
+	setupFetchTest(t, Config{Threshold: 1, Thresholds: map[string]float64{"REGION": 50}})
+	hierarchy, err := applyRegion(hierarchyLevels, "replace")
+	if err != nil {
+		t.Fatalf("applyRegion() = %v", err)
+	}
+	hierarchyLevels = hierarchy
+	if got := levelName(3); got != "dimension:REGION" {
+		t.Errorf("levelName(3) = %s, want dimension:REGION", got)
+	}
+	if got := levelThreshold(3); got != 50 {
+		t.Errorf("levelThreshold(3) = %g, want the threshold of REGION", got)
+	}
+}
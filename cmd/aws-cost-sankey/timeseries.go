@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+// Name of the series that sums up the nodes beyond the largest ones
+const otherSeries = "Other"
+
+// newTimeSeries returns stacked bars of the nodes of the configured level per time bucket,
+// or nil if the level is not found or no time buckets were fetched
+func newTimeSeries() *charts.Bar {
+	buckets := sortedBuckets()
+	if len(buckets) == 0 {
+		warnf("No time buckets to show as time series")
+		return nil
+	}
+
+	// Nodes of the level across the whole period, largest first
+	depths := results.Depths()
+	totals := make(map[string]float64)
+	for _, children := range results {
+		for child, cost := range children {
+			if levelName(depths[child]) == globalConfig.TimeSeries || levelTitle(depths[child]) == globalConfig.TimeSeries {
+				totals[child] += cost
+			}
+		}
+	}
+	if len(totals) == 0 {
+		warnf("No nodes found at level %s", globalConfig.TimeSeries)
+		return nil
+	}
+	nodes := make([]string, 0, len(totals))
+	for node := range totals {
+		nodes = append(nodes, node)
+	}
+	sort.Slice(nodes, func(i, j int) bool {
+		if totals[nodes[i]] != totals[nodes[j]] {
+			return totals[nodes[i]] > totals[nodes[j]]
+		}
+		return nodes[i] < nodes[j]
+	})
+
+	// Keep the largest nodes as their own series and stack the rest as "Other"
+	series := make(map[string]string)
+	for i, node := range nodes {
+		if i < reportTopN {
+			series[node] = node
+		} else {
+			series[node] = otherSeries
+		}
+	}
+	if len(nodes) > reportTopN {
+		nodes = append(nodes[:reportTopN], otherSeries)
+	}
+
+	values := make(map[string][]float64)
+	for _, node := range nodes {
+		values[node] = make([]float64, len(buckets))
+	}
+	for i, bucket := range buckets {
+		for _, children := range bucketResults[bucket] {
+			for child, cost := range children {
+				if name, ok := series[child]; ok {
+					values[name][i] += cost
+				}
+			}
+		}
+	}
+
+	bar := charts.NewBar()
+	bar.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title: fmt.Sprintf("AWS Cost by %s", levelTitle(depths[nodes[0]])),
+		}),
+		charts.WithInitializationOpts(opts.Initialization{
+			Width:  globalConfig.Width,
+			Height: globalConfig.Height,
+			Theme:  "westeros",
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: opts.Bool(true), Trigger: "axis"}),
+		charts.WithLegendOpts(opts.Legend{Show: opts.Bool(true), Type: "scroll", Top: "bottom"}),
+		chartToolbox(),
+	)
+	bar.SetXAxis(buckets)
+	for _, node := range nodes {
+		data := make([]opts.BarData, 0, len(buckets))
+		for _, value := range values[node] {
+			data = append(data, opts.BarData{Value: fmt.Sprintf("%.2f", value)})
+		}
+		bar.AddSeries(node, data, charts.WithBarChartOpts(opts.BarChart{Stack: "total"}))
+	}
+	return bar
+}
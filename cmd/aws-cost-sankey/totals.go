@@ -0,0 +1,75 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Name of the root node shown when totals is enabled
+const totalNode = "Total"
+
+// withTotalRoot returns the data with a single "Total" root node. The "all" root is shown as "Total",
+// and input files with several roots get a "Total" node above them.
+func withTotalRoot(data map[string]map[string]float64) map[string]map[string]float64 {
+	if !globalConfig.Totals {
+		return data
+	}
+
+	var roots []string
+	for parent := range data {
+		if !hasParent(data, parent) {
+			roots = append(roots, parent)
+		}
+	}
+	result := make(map[string]map[string]float64)
+	for parent, children := range data {
+		name := parent
+		if len(roots) == 1 && parent == "all" {
+			name = totalNode
+		}
+		for child, cost := range children {
+			addCost(result, name, child, cost)
+		}
+	}
+	if len(roots) > 1 {
+		for _, root := range roots {
+			for _, cost := range data[root] {
+				addCost(result, totalNode, root, cost)
+			}
+		}
+	}
+	return result
+}
+
+// levelTotals returns the total of each level below the root, e.g. "account $1,200 · environment $1,150"
+func levelTotals(data map[string]map[string]float64) string {
+	totals := make(map[int]float64)
+	maxDepth := 0
+	depths := costgraph.Flows(data).Depths()
+	for _, children := range data {
+		for child, cost := range children {
+			totals[depths[child]] += cost
+			maxDepth = max(maxDepth, depths[child])
+		}
+	}
+
+	parts := make([]string, 0, maxDepth)
+	for depth := 1; depth <= maxDepth; depth++ {
+		parts = append(parts, fmt.Sprintf("%s %s", levelTitle(depth), formatCost(totals[depth], 0)))
+	}
+	return strings.Join(parts, " · ")
+}
+
+// totalsSubtitle appends the level totals of the data to the configured subtitle when totals is enabled
+func totalsSubtitle(data map[string]map[string]float64) string {
+	subtitle := chartSubtitle()
+	if !globalConfig.Totals {
+		return subtitle
+	}
+	if subtitle != "" {
+		subtitle += "\n"
+	}
+	return subtitle + levelTotals(data)
+}
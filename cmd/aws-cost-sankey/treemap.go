@@ -0,0 +1,166 @@
+package main
+
+import (
+	"math"
+	"sort"
+
+	"github.com/go-echarts/go-echarts/v2/charts"
+	"github.com/go-echarts/go-echarts/v2/components"
+	"github.com/go-echarts/go-echarts/v2/opts"
+)
+
+// Chart types of the HTML output. Treemaps and sunbursts show the same hierarchy without crossing links
+const (
+	ChartTypeSankey   = "sankey"
+	ChartTypeTreemap  = "treemap"
+	ChartTypeSunburst = "sunburst"
+)
+
+// costTree is a node of the hierarchy. Nodes with several parents are repeated under each of them
+type costTree struct {
+	name     string
+	cost     float64
+	children []costTree
+}
+
+// newChart renders the data with the configured chart type, generating an ID when it is empty
+func newChart(chartID string, title string, seriesName string, data map[string]map[string]float64) components.Charter {
+	switch globalConfig.ChartType {
+	case ChartTypeTreemap:
+		return newTreemap(chartID, title, seriesName, data)
+	case ChartTypeSunburst:
+		return newSunburst(chartID, title, seriesName, data)
+	default:
+		return newSankey(chartID, title, seriesName, data)
+	}
+}
+
+func newTreemap(chartID string, title string, seriesName string, data map[string]map[string]float64) *charts.TreeMap {
+	var convert func(nodes []costTree) []opts.TreeMapNode
+	convert = func(nodes []costTree) []opts.TreeMapNode {
+		converted := make([]opts.TreeMapNode, 0, len(nodes))
+		for _, node := range nodes {
+			converted = append(converted, opts.TreeMapNode{Name: node.name, Value: int(math.Round(node.cost)), Children: convert(node.children)})
+		}
+		return converted
+	}
+
+	treemap := charts.NewTreeMap()
+	treemap.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    title,
+			Subtitle: chartSubtitle(),
+		}),
+		charts.WithInitializationOpts(opts.Initialization{
+			ChartID: chartID,
+			Width:   globalConfig.Width,
+			Height:  globalConfig.Height,
+			Theme:   "westeros",
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: opts.Bool(true), Formatter: tooltipFormatter(costFormatter("{b}: {c}"))}),
+		chartToolbox(),
+	)
+	treemap.AddSeries(seriesName, convert(costTrees(data)), charts.WithTreeMapOpts(opts.TreeMapChart{
+		Roam:       opts.Bool(false),
+		UpperLabel: &opts.UpperLabel{Show: opts.Bool(true)},
+		Top:        "60",
+	}), charts.WithLabelOpts(opts.Label{
+		Show:      opts.Bool(true),
+		FontSize:  12,
+		Formatter: labelFormatter(costFormatter("{b}\n{c}")),
+	}))
+	return treemap
+}
+
+func newSunburst(chartID string, title string, seriesName string, data map[string]map[string]float64) *charts.Sunburst {
+	var convert func(nodes []costTree) []*opts.SunBurstData
+	convert = func(nodes []costTree) []*opts.SunBurstData {
+		converted := make([]*opts.SunBurstData, 0, len(nodes))
+		for _, node := range nodes {
+			converted = append(converted, &opts.SunBurstData{Name: node.name, Value: node.cost, Children: convert(node.children)})
+		}
+		return converted
+	}
+
+	roots := make([]opts.SunBurstData, 0)
+	for _, node := range convert(costTrees(data)) {
+		roots = append(roots, *node)
+	}
+
+	sunburst := charts.NewSunburst()
+	sunburst.SetGlobalOptions(
+		charts.WithTitleOpts(opts.Title{
+			Title:    title,
+			Subtitle: chartSubtitle(),
+		}),
+		charts.WithInitializationOpts(opts.Initialization{
+			ChartID: chartID,
+			Width:   globalConfig.Width,
+			Height:  globalConfig.Height,
+			Theme:   "westeros",
+		}),
+		charts.WithTooltipOpts(opts.Tooltip{Show: opts.Bool(true), Formatter: tooltipFormatter(costFormatter("{b}: {c}"))}),
+		chartToolbox(),
+	)
+	sunburst.AddSeries(seriesName, roots, charts.WithSunburstOpts(opts.SunburstChart{
+		Animation: opts.Bool(true),
+	}), charts.WithLabelOpts(opts.Label{
+		Show:      opts.Bool(true),
+		FontSize:  10,
+		Formatter: labelFormatter("{b}"),
+	}))
+	return sunburst
+}
+
+// costTrees returns the hierarchy below the roots of the data, largest first, keeping the visible links.
+// A single root such as "all" is left out since it would only wrap the whole chart.
+func costTrees(data map[string]map[string]float64) []costTree {
+	visible := visibleLinks(data)
+	var build func(name string, cost float64, ancestors map[string]bool) costTree
+	build = func(name string, cost float64, ancestors map[string]bool) costTree {
+		node := costTree{name: name, cost: cost}
+		if ancestors[name] {
+			return node
+		}
+		ancestors[name] = true
+		for child, childCost := range visible[name] {
+			node.children = append(node.children, build(child, childCost, ancestors))
+		}
+		delete(ancestors, name)
+		sortCostTrees(node.children)
+		return node
+	}
+
+	children := make(map[string]bool)
+	for _, nodes := range data {
+		for child := range nodes {
+			children[child] = true
+		}
+	}
+	var roots []costTree
+	for parent, nodes := range data {
+		if children[parent] {
+			continue
+		}
+		var total float64
+		for _, cost := range nodes {
+			total += cost
+		}
+		roots = append(roots, build(parent, total, make(map[string]bool)))
+	}
+	sortCostTrees(roots)
+
+	if len(roots) == 1 {
+		return roots[0].children
+	}
+	return roots
+}
+
+func sortCostTrees(nodes []costTree) {
+	sort.Slice(nodes, func(i, j int) bool {
+		if nodes[i].cost != nodes[j].cost {
+			return nodes[i].cost > nodes[j].cost
+		}
+		return nodes[i].name < nodes[j].name
+	})
+}
@@ -0,0 +1,108 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"github.com/go-echarts/go-echarts/v2/charts"
+	echartstypes "github.com/go-echarts/go-echarts/v2/types"
+)
+
+const trendChartID = "trend"
+
+// Space kept below the diagram for the timeline
+const trendTimelineHeight = 70
+
+// trendPeriod checks the trend options and widens the period to the last trendMonths months up to the end date,
+// e.g. 2024-05-01 to 2024-11-01 for 6 months. An end date within a month includes that month.
+func trendPeriod() error {
+	months := globalConfig.TrendMonths
+	if months < 0 {
+		return fmt.Errorf("trendMonths can't be negative: %d", months)
+	}
+	if months == 0 {
+		return nil
+	}
+	if globalConfig.Granularity != string(types.GranularityMonthly) {
+		return fmt.Errorf("trendMonths requires MONTHLY granularity: %s", globalConfig.Granularity)
+	}
+	if globalConfig.ChartType != ChartTypeSankey {
+		return fmt.Errorf("trendMonths is only supported by the sankey chart type: %s", globalConfig.ChartType)
+	}
+
+	end, err := time.Parse(time.DateOnly, globalConfig.EndDate)
+	if err != nil {
+		return fmt.Errorf("failed to parse end date %s: %v", globalConfig.EndDate, err)
+	}
+	start := time.Date(end.Year(), end.Month(), 1, 0, 0, 0, 0, time.UTC)
+	if end.Day() == 1 {
+		start = start.AddDate(0, -months, 0)
+	} else {
+		start = start.AddDate(0, -(months - 1), 0)
+	}
+	globalConfig.StartDate = start.Format(time.DateOnly)
+	return nil
+}
+
+// newTrend returns a sankey diagram with a timeline below it to scrub through the months of the trend.
+// go-echarts has no timeline, so the timeline and the diagram of each month are set once the chart is initialized.
+func newTrend() *charts.Sankey {
+	buckets := sortedBuckets()
+	if len(buckets) == 0 {
+		return nil
+	}
+	last := buckets[len(buckets)-1]
+	seriesName := fmt.Sprintf("%s %s > %s", last, globalConfig.Metric, formatCost(globalConfig.Threshold, 0))
+	sankey := newSankey(trendChartID, trendTitle(last), seriesName, bucketResults[last])
+
+	options := make([]interface{}, 0, len(buckets))
+	for _, bucket := range buckets {
+		data := bucketResults[bucket]
+		nodes, links := sankeyElements(withTotalRoot(visibleLinks(data)))
+		series := map[string]interface{}{
+			"name":  fmt.Sprintf("%s %s > %s", bucket, globalConfig.Metric, formatCost(globalConfig.Threshold, 0)),
+			"data":  nodes,
+			"links": links,
+		}
+		if globalConfig.LinkPercentages {
+			series["edgeLabel"] = map[string]interface{}{"show": true, "fontSize": 10, "formatter": linkFormatter(withTotalRoot(data))}
+		}
+		options = append(options, map[string]interface{}{
+			"title":  map[string]interface{}{"text": trendTitle(bucket), "subtext": totalsSubtitle(visibleLinks(data))},
+			"series": []interface{}{series},
+		})
+	}
+	timeline := map[string]interface{}{
+		"baseOption": map[string]interface{}{
+			"timeline": map[string]interface{}{
+				"axisType":     "category",
+				"data":         buckets,
+				"currentIndex": len(buckets) - 1,
+				"playInterval": 2000,
+				"left":         "5%",
+				"right":        "5%",
+				"bottom":       10,
+			},
+			"series": []interface{}{map[string]interface{}{"bottom": trendTimelineHeight}},
+		},
+		"options": options,
+	}
+
+	// Formatters contain comparisons, which must not be escaped like HTML
+	var buf bytes.Buffer
+	encoder := json.NewEncoder(&buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(timeline); err != nil {
+		log.Fatalf("failed to marshal trend: %v", err)
+	}
+	sankey.AddJSFuncStrs(echartstypes.FuncStr(fmt.Sprintf("%%MY_ECHARTS%%.setOption(%s);", bytes.TrimSpace(buf.Bytes()))))
+	return sankey
+}
+
+func trendTitle(bucket string) string {
+	return fmt.Sprintf("%s (%s)", chartTitle(), bucket)
+}
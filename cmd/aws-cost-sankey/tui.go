@@ -0,0 +1,201 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	tea "github.com/charmbracelet/bubbletea"
+	"github.com/charmbracelet/lipgloss"
+)
+
+const (
+	tuiBarWidth  = 30
+	tuiNameWidth = 40
+)
+
+var (
+	tuiTitleStyle    = lipgloss.NewStyle().Bold(true)
+	tuiCursorStyle   = lipgloss.NewStyle().Reverse(true)
+	tuiBarStyle      = lipgloss.NewStyle().Foreground(lipgloss.Color(staticPalette[0]))
+	tuiHighlightBar  = lipgloss.NewStyle().Foreground(lipgloss.Color(anomalyColor))
+	tuiHelpStyle     = lipgloss.NewStyle().Faint(true)
+	tuiExpandedMark  = "▾"
+	tuiCollapsedMark = "▸"
+)
+
+// A visible line of the tree. Nodes reachable from several parents appear under each of them,
+// so rows are identified by their path from the root.
+type tuiRow struct {
+	path        string
+	name        string
+	cost        float64
+	depth       int
+	hasChildren bool
+}
+
+type tuiModel struct {
+	expanded map[string]bool
+	rows     []tuiRow
+	cursor   int
+	offset   int
+	height   int
+	maxCost  float64
+}
+
+// generateTUI shows the costs as a collapsible tree in the terminal, with bars proportional to spend
+func generateTUI() error {
+	m := &tuiModel{expanded: make(map[string]bool), height: 24}
+	for _, root := range rootNodes() {
+		m.maxCost = max(m.maxCost, root.cost)
+		m.expanded[root.name] = true
+	}
+	m.refresh()
+
+	if _, err := tea.NewProgram(m, tea.WithAltScreen()).Run(); err != nil {
+		return fmt.Errorf("failed to run terminal UI: %w", err)
+	}
+	return nil
+}
+
+// rootNodes returns the nodes without parents with their outgoing cost, largest first
+func rootNodes() []namedCost {
+	children := make(map[string]bool)
+	for _, nodes := range results {
+		for child := range nodes {
+			children[child] = true
+		}
+	}
+	var roots []namedCost
+	for parent, nodes := range results {
+		if children[parent] {
+			continue
+		}
+		var total float64
+		for _, cost := range nodes {
+			total += cost
+		}
+		roots = append(roots, namedCost{parent, total})
+	}
+	sort.Slice(roots, func(i, j int) bool {
+		if roots[i].cost != roots[j].cost {
+			return roots[i].cost > roots[j].cost
+		}
+		return roots[i].name < roots[j].name
+	})
+	return roots
+}
+
+// refresh rebuilds the visible rows from the expanded paths
+func (m *tuiModel) refresh() {
+	m.rows = m.rows[:0]
+	var visit func(node namedCost, path string, depth int, ancestors map[string]bool)
+	visit = func(node namedCost, path string, depth int, ancestors map[string]bool) {
+		children := sortedChildren(node.name)
+		m.rows = append(m.rows, tuiRow{path: path, name: node.name, cost: node.cost, depth: depth, hasChildren: len(children) > 0})
+		if !m.expanded[path] || ancestors[node.name] {
+			return
+		}
+		ancestors[node.name] = true
+		for _, child := range children {
+			visit(child, path+"\x00"+child.name, depth+1, ancestors)
+		}
+		delete(ancestors, node.name)
+	}
+	for _, root := range rootNodes() {
+		visit(root, root.name, 0, make(map[string]bool))
+	}
+	m.cursor = min(m.cursor, len(m.rows)-1)
+}
+
+func (m *tuiModel) Init() tea.Cmd {
+	return nil
+}
+
+func (m *tuiModel) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
+	switch msg := msg.(type) {
+	case tea.WindowSizeMsg:
+		m.height = msg.Height
+	case tea.KeyMsg:
+		if msg.String() == "q" || msg.String() == "ctrl+c" || msg.String() == "esc" {
+			return m, tea.Quit
+		}
+		if len(m.rows) == 0 {
+			return m, nil
+		}
+		switch msg.String() {
+		case "up", "k":
+			m.cursor = max(m.cursor-1, 0)
+		case "down", "j":
+			m.cursor = min(m.cursor+1, len(m.rows)-1)
+		case "enter", " ":
+			row := m.rows[m.cursor]
+			m.expanded[row.path] = !m.expanded[row.path]
+			m.refresh()
+		case "right", "l":
+			m.expanded[m.rows[m.cursor].path] = true
+			m.refresh()
+		case "left", "h":
+			// Collapse the node, or jump to its parent if it is already collapsed
+			row := m.rows[m.cursor]
+			target := row.path
+			if !m.expanded[row.path] {
+				if i := strings.LastIndex(row.path, "\x00"); i >= 0 {
+					target = row.path[:i]
+				}
+			}
+			m.expanded[target] = false
+			m.refresh()
+			for i, r := range m.rows {
+				if r.path == target {
+					m.cursor = i
+				}
+			}
+		}
+	}
+
+	// Keep the cursor within the visible window
+	visible := max(m.height-4, 1)
+	if m.cursor < m.offset {
+		m.offset = m.cursor
+	} else if m.cursor >= m.offset+visible {
+		m.offset = m.cursor - visible + 1
+	}
+	return m, nil
+}
+
+func (m *tuiModel) View() string {
+	var sb strings.Builder
+	sb.WriteString(tuiTitleStyle.Render(fmt.Sprintf("%s %s-%s %s", chartTitle(), globalConfig.StartDate, globalConfig.EndDate, globalConfig.Metric)))
+	sb.WriteString("\n\n")
+
+	visible := max(m.height-4, 1)
+	for i := m.offset; i < len(m.rows) && i < m.offset+visible; i++ {
+		row := m.rows[i]
+		mark := " "
+		if row.hasChildren {
+			mark = tuiCollapsedMark
+			if m.expanded[row.path] {
+				mark = tuiExpandedMark
+			}
+		}
+		name := truncate(strings.Repeat("  ", row.depth)+mark+" "+row.name, tuiNameWidth)
+		line := fmt.Sprintf("%s%s %14s ", name, strings.Repeat(" ", max(tuiNameWidth-lipgloss.Width(name), 0)), formatCost(row.cost, 2))
+		if i == m.cursor {
+			line = tuiCursorStyle.Render(line)
+		}
+
+		barStyle := tuiBarStyle
+		if highlightColor(row.name) != "" {
+			barStyle = tuiHighlightBar
+		}
+		width := 0
+		if m.maxCost > 0 {
+			width = int(row.cost / m.maxCost * tuiBarWidth)
+		}
+		sb.WriteString(line + barStyle.Render(strings.Repeat("█", max(width, 0))) + "\n")
+	}
+
+	sb.WriteString("\n" + tuiHelpStyle.Render("↑/↓ move • enter toggle • ←/→ collapse/expand • q quit"))
+	return sb.String()
+}
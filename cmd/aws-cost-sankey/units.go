@@ -0,0 +1,141 @@
+package main
+
+import (
+	"fmt"
+	"math"
+	"sort"
+
+	"golang.org/x/text/message"
+	"golang.org/x/text/number"
+)
+
+// UnitConfig divides the cost of nodes by a business metric, e.g. the monthly active users or requests of each
+// environment. Values cover the whole period, periods optionally hold the values of each time bucket.
+type UnitConfig struct {
+	Name    string                        `yaml:"name"`
+	Values  map[string]float64            `yaml:"values"`
+	Periods map[string]map[string]float64 `yaml:"periods"`
+}
+
+type unitCost struct {
+	node  string
+	unit  string
+	cost  float64
+	count float64
+}
+
+func (u unitCost) perUnit() float64 {
+	return u.cost / u.count
+}
+
+// formatPerUnit formats the cost per unit with at least two significant digits, e.g. "$0.0012"
+func (u unitCost) formatPerUnit() string {
+	decimals := 2
+	if perUnit := math.Abs(u.perUnit()); perUnit > 0 && perUnit < 1 {
+		decimals = max(decimals, 1-int(math.Floor(math.Log10(perUnit))))
+	}
+	return formatCost(u.perUnit(), decimals)
+}
+
+// formatCount formats the number of units like costs, e.g. "120,000 users"
+func (u unitCost) formatCount() string {
+	count := message.NewPrinter(numberLocale()).Sprint(number.Decimal(u.count))
+	return fmt.Sprintf("%s %ss", count, u.unit)
+}
+
+// describe returns the cost per unit, e.g. "$0.0012 per user (120,000 users)"
+func (u unitCost) describe() string {
+	return fmt.Sprintf("%s per %s (%s)", u.formatPerUnit(), u.unit, u.formatCount())
+}
+
+// validateUnits checks the unit metrics before any cost is fetched
+func validateUnits() error {
+	for _, unit := range globalConfig.Units {
+		if unit.Name == "" {
+			return fmt.Errorf("unit metric without name")
+		}
+		check := func(values map[string]float64) error {
+			for node, count := range values {
+				if count < 0 {
+					return fmt.Errorf("%s of %s can't be negative: %g", unit.Name, node, count)
+				}
+			}
+			return nil
+		}
+		if err := check(unit.Values); err != nil {
+			return err
+		}
+		for _, values := range unit.Periods {
+			if err := check(values); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// unitCosts returns the cost per unit of the nodes with a value, in the order of the units and by node name.
+// Period is a time bucket, or empty for the whole period.
+func unitCosts(data map[string]map[string]float64, period string) []unitCost {
+	incoming := incomingCosts(data)
+	var costs []unitCost
+	for _, unit := range globalConfig.Units {
+		values := unit.Values
+		if period != "" {
+			values = unit.Periods[period]
+		}
+		nodes := make([]string, 0, len(values))
+		for node := range values {
+			nodes = append(nodes, node)
+		}
+		sort.Strings(nodes)
+		for _, node := range nodes {
+			cost, ok := incoming[node]
+			if !ok {
+				cost = outgoingCost(data, node)
+			}
+			if values[node] == 0 || cost == 0 {
+				continue
+			}
+			costs = append(costs, unitCost{node, unit.Name, cost, values[node]})
+		}
+	}
+	return costs
+}
+
+// unitReport lists the cost per unit of the period and of each time bucket with values
+func unitReport() []string {
+	var lines []string
+	for _, cost := range unitCosts(results, "") {
+		lines = append(lines, fmt.Sprintf("Unit cost %s: %s", cost.node, cost.describe()))
+	}
+	for _, bucket := range sortedBuckets() {
+		for _, cost := range unitCosts(bucketResults[bucket], bucket) {
+			lines = append(lines, fmt.Sprintf("Unit cost %s %s: %s", bucket, cost.node, cost.describe()))
+		}
+	}
+	return lines
+}
+
+// unitNotes returns the costs per unit of each node for the tooltips
+func unitNotes(data map[string]map[string]float64) map[string]string {
+	notes := make(map[string]string)
+	for _, cost := range unitCosts(data, "") {
+		if note, ok := notes[cost.node]; ok {
+			notes[cost.node] = note + "<br/>" + cost.describe()
+		} else {
+			notes[cost.node] = cost.describe()
+		}
+	}
+	return notes
+}
+
+// unitTable returns the rows of the unit costs for the markdown and PDF reports
+func unitTable() [][]string {
+	costs := unitCosts(results, "")
+	rows := make([][]string, 0, len(costs))
+	for _, cost := range costs {
+		rows = append(rows, []string{cost.node, formatCost(cost.cost, 2), cost.formatCount(), cost.formatPerUnit()})
+	}
+	return rows
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// untaggedSpend is the part of the cost of a node that flows through "<parent>-unknown" nodes
+type untaggedSpend struct {
+	name     string
+	untagged float64
+	total    float64
+}
+
+// untaggedBreakdown splits the untagged cost per node of the first level, e.g. accounts, and per leaf, e.g. services.
+// Costs flowing through nodes of several parents are attributed in proportion to the links into those nodes.
+func untaggedBreakdown(data map[string]map[string]float64) ([]untaggedSpend, []untaggedSpend, untaggedSpend) {
+	// Share of the cost of each node coming from each first level node, and share of it that is untagged
+	origins := make(map[string]map[string]float64)
+	untaggedShare := make(map[string]float64)
+	incoming := make(map[string]float64)
+	incomingOrigins := make(map[string]map[string]float64)
+	incomingUntagged := make(map[string]float64)
+	depths := costgraph.Flows(data).Depths()
+	finalize := func(node string) {
+		if _, ok := origins[node]; ok {
+			return
+		}
+		origins[node] = make(map[string]float64)
+		if depths[node] <= 1 {
+			origins[node][node] = 1
+		} else if incoming[node] != 0 {
+			for origin, cost := range incomingOrigins[node] {
+				origins[node][origin] = cost / incoming[node]
+			}
+			untaggedShare[node] = incomingUntagged[node] / incoming[node]
+		}
+		if isUnknownNode(node) {
+			untaggedShare[node] = 1
+		}
+	}
+
+	accounts := make(map[string]*untaggedSpend)
+	leaves := make(map[string]*untaggedSpend)
+	var total untaggedSpend
+	for _, link := range costgraph.Flows(data).Links() {
+		finalize(link.Source)
+		incoming[link.Target] += link.Value
+		incomingUntagged[link.Target] += link.Value * untaggedShare[link.Source]
+		if _, ok := incomingOrigins[link.Target]; !ok {
+			incomingOrigins[link.Target] = make(map[string]float64)
+		}
+		for origin, share := range origins[link.Source] {
+			incomingOrigins[link.Target][origin] += link.Value * share
+		}
+		if len(data[link.Target]) > 0 {
+			continue
+		}
+
+		// Leaves account for all costs once
+		untagged := link.Value * untaggedShare[link.Source]
+		if isUnknownNode(link.Target) {
+			untagged = link.Value
+		}
+		if _, ok := leaves[link.Target]; !ok {
+			leaves[link.Target] = &untaggedSpend{name: link.Target}
+		}
+		leaves[link.Target].untagged += untagged
+		leaves[link.Target].total += link.Value
+		for origin, share := range origins[link.Source] {
+			if depths[origin] == 0 {
+				origin = link.Target
+			}
+			if _, ok := accounts[origin]; !ok {
+				accounts[origin] = &untaggedSpend{name: origin}
+			}
+			accounts[origin].untagged += untagged * share
+			accounts[origin].total += link.Value * share
+		}
+		total.untagged += untagged
+		total.total += link.Value
+	}
+	return sortedUntagged(accounts), sortedUntagged(leaves), total
+}
+
+// sortedUntagged orders the nodes by untagged cost, largest first, leaving out nodes without untagged cost
+func sortedUntagged(spends map[string]*untaggedSpend) []untaggedSpend {
+	result := make([]untaggedSpend, 0, len(spends))
+	for _, spend := range spends {
+		if spend.untagged >= filterEpsilon {
+			result = append(result, *spend)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].untagged != result[j].untagged {
+			return result[i].untagged > result[j].untagged
+		}
+		return result[i].name < result[j].name
+	})
+	return result
+}
+
+// untaggedTrend returns the untagged cost of the earlier periods of the history and of each time bucket, or of this period, oldest first
+func untaggedTrend() []untaggedSpend {
+	var trend []untaggedSpend
+	if globalConfig.HistoryFile != "" {
+		history, err := untaggedHistory(globalConfig.HistoryFile)
+		if err != nil {
+			warnf("Leaving out the earlier periods of the untagged trend: %v", err)
+		}
+		trend = append(trend, history...)
+	}
+	for _, bucket := range sortedBuckets() {
+		_, _, total := untaggedBreakdown(bucketResults[bucket])
+		total.name = bucket
+		trend = append(trend, total)
+	}
+	if len(bucketResults) == 0 && len(trend) > 0 {
+		_, _, total := untaggedBreakdown(results)
+		total.name = globalConfig.StartDate
+		trend = append(trend, total)
+	}
+	return trend
+}
+
+// untaggedHistory returns the untagged cost of the earlier periods of the history, oldest first
+func untaggedHistory(historyFile string) ([]untaggedSpend, error) {
+	db, err := openHistory(historyFile)
+	if err != nil {
+		return nil, err
+	}
+	defer db.Close()
+	runIDs, err := earlierRuns(db, defaultHistoryPeriods)
+	if err != nil {
+		return nil, err
+	}
+	periods, err := runPeriods(db, runIDs)
+	if err != nil {
+		return nil, err
+	}
+	history, err := runFlows(db, runIDs)
+	if err != nil {
+		return nil, err
+	}
+	var trend []untaggedSpend
+	for i := len(runIDs) - 1; i >= 0; i-- {
+		data := make(map[string]map[string]float64)
+		for source, targets := range history {
+			for target, runs := range targets {
+				if cost, ok := runs[runIDs[i]]; ok {
+					addCost(data, source, target, cost)
+				}
+			}
+		}
+		_, _, total := untaggedBreakdown(data)
+		total.name = periods[runIDs[i]]
+		trend = append(trend, total)
+	}
+	return trend, nil
+}
+
+// untaggedReport quantifies untagged costs per account and service along with the trend, to drive tagging cleanup
+func untaggedReport() []string {
+	if !globalConfig.UntaggedReport {
+		return nil
+	}
+	accounts, services, total := untaggedBreakdown(results)
+	lines := []string{fmt.Sprintf("Untagged %s of %s (%s)", formatCost(total.untagged, 2), formatCost(total.total, 2), percentOf(total.untagged, total.total))}
+	for _, spend := range accounts {
+		lines = append(lines, fmt.Sprintf("Untagged %s %s: %s of %s (%s)", levelTitle(1), spend.name,
+			formatCost(spend.untagged, 2), formatCost(spend.total, 2), percentOf(spend.untagged, spend.total)))
+	}
+	for i, spend := range services {
+		if i == reportTopN {
+			break
+		}
+		lines = append(lines, fmt.Sprintf("Untagged %s: %s of %s (%s)", spend.name,
+			formatCost(spend.untagged, 2), formatCost(spend.total, 2), percentOf(spend.untagged, spend.total)))
+	}
+	if trend := untaggedTrend(); len(trend) > 0 {
+		parts := make([]string, 0, len(trend))
+		for _, period := range trend {
+			parts = append(parts, fmt.Sprintf("%s %s", period.name, percentOf(period.untagged, period.total)))
+		}
+		lines = append(lines, "Untagged trend: "+strings.Join(parts, ", "))
+	}
+	return lines
+}
@@ -0,0 +1,240 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"regexp"
+	"slices"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+	"golang.org/x/text/language"
+)
+
+// Cost Explorer returns the last 14 months of cost data unless multi-year data is enabled, and hourly data of the
+// last 14 days
+const (
+	costExplorerLookbackMonths = 14
+	hourlyLookbackDays         = 14
+)
+
+// Characters allowed in AWS tag keys, and the chart sizes go-echarts understands, e.g. "1500px" or "100%"
+var (
+	tagKeyPattern    = regexp.MustCompile(`^[\p{L}\p{Z}\p{N}_.:/=+\-@]{1,128}$`)
+	chartSizePattern = regexp.MustCompile(`^\d+(\.\d+)?(px|%)$`)
+)
+
+// validateConfig prints all problems of the config that would otherwise stop a run, often only after some costs
+// were fetched or with a raw Cost Explorer ValidationException, and fails if there are any
+func validateConfig() {
+	problems := configProblems(time.Now().UTC())
+	if len(problems) > 0 {
+		for _, problem := range problems {
+			fmt.Printf("error: %s\n", problem)
+		}
+		log.Fatalf("%d problems found in %s", len(problems), options.configFile)
+	}
+
+	// Options checked when a run starts, stopping at the first problem, with the defaults of a run
+	if options.granularity != "" {
+		globalConfig.Granularity = options.granularity
+	}
+	globalConfig.Granularity = strings.ToUpper(globalConfig.Granularity)
+	if globalConfig.Granularity == "" {
+		globalConfig.Granularity = string(types.GranularityMonthly)
+	}
+	if globalConfig.ChartType == "" {
+		globalConfig.ChartType = ChartTypeSankey
+	}
+	for _, check := range []func() error{validateLayout, trendPeriod, validateHistoryAnomalies, validateLocalForecast, validateAllocations, validateUnits, compileColors} {
+		if err := check(); err != nil {
+			log.Fatalf("%v", err)
+		}
+	}
+	validateSchedule()
+	fmt.Printf("%s is valid\n", options.configFile)
+}
+
+// configProblems returns the problems of the dates, thresholds, accounts, hierarchy and output options
+func configProblems(now time.Time) []string {
+	var problems []string
+	add := func(format string, args ...interface{}) {
+		problems = append(problems, fmt.Sprintf(format, args...))
+	}
+
+	// Dates, as resolved from a relative period
+	start, startErr := time.Parse(time.DateOnly, globalConfig.StartDate)
+	if startErr != nil {
+		add("startDate %q is not a date YYYY-MM-DD, e.g. 2024-10-01, and no period is set", globalConfig.StartDate)
+	}
+	end, endErr := time.Parse(time.DateOnly, globalConfig.EndDate)
+	if endErr != nil {
+		add("endDate %q is not a date YYYY-MM-DD, e.g. 2024-11-01, and no period is set", globalConfig.EndDate)
+	}
+	granularity := strings.ToUpper(globalConfig.Granularity)
+	if options.granularity != "" {
+		granularity = strings.ToUpper(options.granularity)
+	}
+	if startErr == nil && endErr == nil {
+		if !start.Before(end) {
+			add("startDate %s must be before endDate %s, which is exclusive", globalConfig.StartDate, globalConfig.EndDate)
+		}
+		fetched := options.inputFile == "" && (globalConfig.Source == "" || globalConfig.Source == "costexplorer")
+		today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, time.UTC)
+		lookback := time.Date(now.Year(), now.Month(), 1, 0, 0, 0, 0, time.UTC).AddDate(0, -(costExplorerLookbackMonths - 1), 0)
+		if fetched && start.Before(lookback) {
+			add("startDate %s is before %s: Cost Explorer only returns the last %d months unless multi-year data is enabled",
+				globalConfig.StartDate, lookback.Format(time.DateOnly), costExplorerLookbackMonths)
+		}
+		if fetched && granularity == string(types.GranularityHourly) && start.Before(today.AddDate(0, 0, -hourlyLookbackDays)) {
+			add("startDate %s is more than %d days ago: Cost Explorer only returns hourly data of the last %d days",
+				globalConfig.StartDate, hourlyLookbackDays, hourlyLookbackDays)
+		}
+	}
+
+	switch granularity {
+	case "", string(types.GranularityMonthly), string(types.GranularityDaily), string(types.GranularityHourly):
+	default:
+		add("granularity %q must be MONTHLY, DAILY or HOURLY", granularity)
+	}
+	switch globalConfig.Metric {
+	case "", "AmortizedCost", "BlendedCost", "UnblendedCost", "NetAmortizedCost", "NetUnblendedCost":
+	default:
+		add("metric %q must be AmortizedCost, BlendedCost, UnblendedCost, NetAmortizedCost or NetUnblendedCost", globalConfig.Metric)
+	}
+	switch globalConfig.Source {
+	case "", "costexplorer", "cur", "athena", "billingconductor":
+	default:
+		add("source %q must be costexplorer, cur, athena or billingconductor", globalConfig.Source)
+	}
+
+	// Thresholds
+	if globalConfig.Threshold < 0 {
+		add("threshold %g can't be negative", globalConfig.Threshold)
+	}
+	if globalConfig.ThresholdPercent < 0 || globalConfig.ThresholdPercent > 100 {
+		add("thresholdPercent %g must be between 0 and 100", globalConfig.ThresholdPercent)
+	}
+	hierarchy := globalConfig.Hierarchy
+	if len(hierarchy) == 0 {
+		hierarchy = defaultHierarchy
+	}
+	flagLevels := []string{"REGION", "dimension:REGION", "USAGE_TYPE", "dimension:USAGE_TYPE"}
+	for level, threshold := range globalConfig.Thresholds {
+		// The region and usage type levels are added by -r and -d
+		if !slices.Contains(flagLevels, level) && !slices.ContainsFunc(hierarchy, func(name string) bool {
+			_, key, _ := strings.Cut(name, ":")
+			return name == level || key == level
+		}) {
+			add("thresholds level %q is not in the hierarchy %v", level, hierarchy)
+		}
+		if threshold < 0 {
+			add("thresholds of %s can't be negative: %g", level, threshold)
+		}
+	}
+
+	// Hierarchy
+	for _, level := range hierarchy {
+		if level == LevelAccount {
+			continue
+		}
+		levelType, key, ok := strings.Cut(level, ":")
+		if !ok || key == "" {
+			add("hierarchy level %q must be account or <type>:<key>, e.g. tag:environment", level)
+			continue
+		}
+		switch levelType {
+		case LevelTag, LevelCostCategory:
+			if !tagKeyPattern.MatchString(key) {
+				add("hierarchy %s key %q must be 1 to 128 letters, numbers, spaces or _.:/=+-@", levelType, key)
+			}
+		case LevelDimension:
+			if !slices.Contains(types.Dimension("").Values(), types.Dimension(strings.ToUpper(key))) {
+				add("hierarchy dimension %q is not a Cost Explorer dimension, e.g. SERVICE, REGION or USAGE_TYPE", key)
+			}
+		default:
+			add("hierarchy level %q has unknown type %q, use tag, costCategory or dimension", level, levelType)
+		}
+	}
+
+	// Accounts
+	names := make(map[string]bool)
+	for i, account := range globalConfig.Accounts {
+		name := account.Name
+		if name == "" {
+			name = fmt.Sprintf("#%d", i+1)
+			add("account %s has no name", name)
+		} else if names[name] {
+			add("account %s is listed more than once", name)
+		}
+		names[name] = true
+		switch account.Provider {
+		case "", ProviderAWS:
+			if (account.Key == "") != (account.Secret == "") {
+				add("account %s needs both key and secret, or neither", name)
+			}
+			if account.SSOStartURL != "" && (account.SSORegion == "" || account.SSOAccountID == "" || account.SSORoleName == "") {
+				add("account %s needs ssoRegion, ssoAccountId and ssoRoleName along with ssoStartUrl", name)
+			}
+			if account.RoleARN != "" && !strings.HasPrefix(account.RoleARN, "arn:") {
+				add("account %s roleArn %q is not an ARN, e.g. arn:aws:iam::123456789012:role/billing-read", name, account.RoleARN)
+			}
+		case ProviderAzure:
+			if account.TenantID == "" || account.ClientID == "" || account.ClientSecret == "" || account.SubscriptionID == "" {
+				add("account %s needs tenantId, clientId, clientSecret and subscriptionId", name)
+			}
+		default:
+			add("account %s has unknown provider %q, use aws or azure", name, account.Provider)
+		}
+	}
+
+	// Output
+	formats := outputFormatList(options.format)
+	if len(formats) == 0 {
+		add("no output format given, e.g. -f chart or -f chart,text,json")
+	}
+	for _, format := range formats {
+		outputFormat, ok := lookupOutputFormat(format)
+		if !ok {
+			add("output format %q must be one of %s", format, strings.Join(outputFormatNames(), ", "))
+		}
+		if ok && options.outputFile == stdioName && !outputFormat.stdout {
+			add("output format %s can't be written to stdout, -o - writes %s", format, strings.Join(stdoutFormatNames(), ", "))
+		}
+		if (format == "text+ai" || format == "pdf+ai") && globalConfig.OpenAIKey == "" {
+			add("output format %s needs openaiKey", format)
+		}
+	}
+	for _, placeholder := range unknownPlaceholders(options.outputFile) {
+		add("output file name %q has unknown placeholder %s, use one of {%s}", options.outputFile, placeholder, strings.Join(outputPlaceholders, "}, {"))
+	}
+	if options.outputFile == stdioName && len(formats) > 1 {
+		add("-o - writes a single format to stdout, not %s", strings.Join(formats, ", "))
+	}
+	switch globalConfig.ChartType {
+	case "", ChartTypeSankey, ChartTypeTreemap, ChartTypeSunburst:
+	default:
+		add("chartType %q must be sankey, treemap or sunburst", globalConfig.ChartType)
+	}
+	for key, size := range map[string]string{"height": globalConfig.Height, "width": globalConfig.Width} {
+		if size != "" && !chartSizePattern.MatchString(size) {
+			add("%s %q must be in px or %%, e.g. \"1500px\"", key, size)
+		}
+	}
+	if locale := globalConfig.NumberFormat.Locale; locale != "" {
+		if _, err := language.Parse(locale); err != nil {
+			add("numberFormat locale %q is unknown, e.g. en-US or de-DE", locale)
+		}
+	}
+	if mode := globalConfig.RecordTypes; mode != "" && mode != "branch" && mode != "net" {
+		add("recordTypes %q must be branch or net", mode)
+	}
+	if mode := globalConfig.NegativeCosts; mode != "" && mode != "branch" && mode != "net" {
+		add("negativeCosts %q must be branch or net", mode)
+	}
+	if source := globalConfig.Exchange.Source; source != "" && source != "ecb" {
+		add("exchange source %q must be ecb", source)
+	}
+	return problems
+}
@@ -0,0 +1,191 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// MSTeamsConfig posts the summary of a run as an Adaptive Card to a Microsoft Teams webhook, e.g. of a Workflows app.
+// Named apart from teams, which maps costs to teams.
+type MSTeamsConfig struct {
+	WebhookURL     string `yaml:"webhookUrl"`
+	WebhookURLFrom string `yaml:"webhookUrlFrom"`
+}
+
+// WebhookConfig posts the summary and the JSON graph of a run to a URL, e.g. to trigger automations on fresh costs.
+// Headers can carry credentials, e.g. "Authorization: Bearer ${TOKEN}".
+type WebhookConfig struct {
+	URL     string            `yaml:"url"`
+	URLFrom string            `yaml:"urlFrom"`
+	Headers map[string]string `yaml:"headers"`
+}
+
+func validateMSTeams() error {
+	if globalConfig.MSTeams.WebhookURL == "" {
+		return fmt.Errorf("set msteams webhookUrl")
+	}
+	return nil
+}
+
+func validateWebhooks() error {
+	if len(globalConfig.Webhooks) == 0 {
+		return fmt.Errorf("add a webhook with a url")
+	}
+	for i, webhook := range globalConfig.Webhooks {
+		if webhook.URL == "" {
+			return fmt.Errorf("webhook %d has no url", i+1)
+		}
+	}
+	return nil
+}
+
+// webhookPayload is the JSON posted to webhooks. Field names follow the JSON graph, which is included as is.
+type webhookPayload struct {
+	Event      string           `json:"event"`
+	Title      string           `json:"title"`
+	Period     costgraph.Period `json:"period"`
+	Metric     string           `json:"metric"`
+	Currency   string           `json:"currency"`
+	Total      float64          `json:"total"`
+	Top        []costgraph.Node `json:"top"`
+	Comparison *webhookChanges  `json:"comparison,omitempty"`
+	Analysis   string           `json:"analysis,omitempty"`
+	Failures   []string         `json:"failures,omitempty"`
+	Files      []string         `json:"files,omitempty"`
+	Link       string           `json:"link,omitempty"`
+	Graph      costgraph.Graph  `json:"graph"`
+}
+
+type webhookChanges struct {
+	Compared  string             `json:"compared"`
+	Increases []costgraph.Change `json:"increases"`
+	Decreases []costgraph.Change `json:"decreases"`
+}
+
+// notifyWebhooks posts the summary and the graph to each webhook, stopping at the first failure
+func notifyWebhooks(summary runSummary) error {
+	payload := webhookPayload{
+		Event:    "costs.updated",
+		Title:    summary.Title,
+		Period:   costgraph.Period{Start: summary.Start, End: summary.End},
+		Metric:   summary.Metric,
+		Currency: summary.Currency,
+		Total:    summary.Total,
+		Top:      summary.Top,
+		Analysis: summary.Analysis,
+		Failures: summary.Failures,
+		Files:    summary.Files,
+		Link:     summary.Link,
+		Graph:    buildGraph(),
+	}
+	if summary.Compared != "" {
+		payload.Comparison = &webhookChanges{
+			Compared:  summary.Compared,
+			Increases: webhookMovers(summary.Increases),
+			Decreases: webhookMovers(summary.Decreases),
+		}
+	}
+	for _, webhook := range globalConfig.Webhooks {
+		if err := postJSON(webhook.URL, webhook.Headers, payload); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func webhookMovers(movers []mover) []costgraph.Change {
+	changes := make([]costgraph.Change, 0, len(movers))
+	for _, m := range movers {
+		changes = append(changes, costgraph.Change{Name: m.name, Previous: m.first, Current: m.last, Delta: m.last - m.first})
+	}
+	return changes
+}
+
+// notifyMSTeams posts the summary as an Adaptive Card
+func notifyMSTeams(summary runSummary) error {
+	text := func(text string, attributes map[string]interface{}) map[string]interface{} {
+		block := map[string]interface{}{"type": "TextBlock", "text": text, "wrap": true}
+		for key, value := range attributes {
+			block[key] = value
+		}
+		return block
+	}
+	facts := func(facts [][2]string) map[string]interface{} {
+		list := make([]map[string]string, 0, len(facts))
+		for _, fact := range facts {
+			list = append(list, map[string]string{"title": fact[0], "value": fact[1]})
+		}
+		return map[string]interface{}{"type": "FactSet", "facts": list}
+	}
+
+	body := []map[string]interface{}{
+		text(summary.Title, map[string]interface{}{"size": "Large", "weight": "Bolder"}),
+		text(fmt.Sprintf("**%s** %s from %s to %s", formatCost(summary.Total, 2), summary.Metric, summary.Start, summary.End), nil),
+	}
+	if len(summary.Top) > 0 {
+		var top [][2]string
+		for _, node := range summary.Top {
+			top = append(top, [2]string{node.Name, formatCost(node.Value, 2)})
+		}
+		body = append(body, facts(top))
+	}
+	if summary.Compared != "" {
+		var changes [][2]string
+		for _, m := range append(append([]mover{}, summary.Increases...), summary.Decreases...) {
+			changes = append(changes, [2]string{m.name, fmt.Sprintf("%s to %s (%s)", formatCost(m.first, 2), formatCost(m.last, 2), formatChange(m))})
+		}
+		body = append(body, text("Compared with "+summary.Compared, map[string]interface{}{"weight": "Bolder", "spacing": "Medium"}), facts(changes))
+	}
+	if summary.Analysis != "" {
+		body = append(body, text("Analysis", map[string]interface{}{"weight": "Bolder", "spacing": "Medium"}), text(summary.Analysis, nil))
+	}
+	if len(summary.Failures) > 0 {
+		body = append(body, text(fmt.Sprintf("Incomplete, failed to fetch %s", strings.Join(summary.Failures, ", ")), map[string]interface{}{"color": "Attention"}))
+	}
+
+	card := map[string]interface{}{
+		"$schema": "http://adaptivecards.io/schemas/adaptive-card.json",
+		"type":    "AdaptiveCard",
+		"version": "1.4",
+		"body":    body,
+	}
+	if summary.Link != "" {
+		card["actions"] = []map[string]string{{"type": "Action.OpenUrl", "title": "Open the chart", "url": summary.Link}}
+	}
+	return postJSON(globalConfig.MSTeams.WebhookURL, nil, map[string]interface{}{
+		"type":        "message",
+		"attachments": []map[string]interface{}{{"contentType": "application/vnd.microsoft.card.adaptive", "content": card}},
+	})
+}
+
+// postJSON posts a payload to a webhook, failing on any status but 2xx
+func postJSON(url string, headers map[string]string, payload interface{}) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(runContext, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	for key, value := range headers {
+		req.Header.Set(key, value)
+	}
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		data, _ := io.ReadAll(io.LimitReader(resp.Body, 1024))
+		return fmt.Errorf("webhook answered %s: %s", resp.Status, data)
+	}
+	return nil
+}
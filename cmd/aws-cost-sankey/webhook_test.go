@@ -0,0 +1,48 @@
+package main
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+	"testing"
+)
+
+func TestNotifyWebhooks(t *testing.T) {
+	var payload webhookPayload
+	var authorization string
+	url := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		authorization = r.Header.Get("Authorization")
+		json.NewDecoder(r.Body).Decode(&payload)
+	})
+	setupRunTest(t, Config{Webhooks: []WebhookConfig{{URL: url, Headers: map[string]string{"Authorization": "Bearer test"}}}}, twoAccounts())
+
+	if err := sendNotifications([]string{"webhook"}, nil); err != nil {
+		t.Fatalf("sendNotifications() = %v", err)
+	}
+	if authorization != "Bearer test" {
+		t.Errorf("Authorization = %q, want the configured header", authorization)
+	}
+	if payload.Event != "costs.updated" || payload.Total != 120 {
+		t.Errorf("payload = %+v, want the event and total", payload)
+	}
+	if len(payload.Graph.Links) != 4 {
+		t.Errorf("payload links = %v, want the graph", payload.Graph.Links)
+	}
+}
+
+func TestNotifyMSTeamsError(t *testing.T) {
+	url := testServer(t, func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !strings.Contains(string(body), "application/vnd.microsoft.card.adaptive") {
+			t.Errorf("body = %s, want an Adaptive Card", body)
+		}
+		http.Error(w, "throttled", http.StatusTooManyRequests)
+	})
+	setupFetchTest(t, Config{MSTeams: MSTeamsConfig{WebhookURL: url}})
+
+	err := sendNotifications([]string{"msteams"}, nil)
+	if err == nil || !strings.Contains(err.Error(), "429") {
+		t.Errorf("sendNotifications() = %v, want the status", err)
+	}
+}
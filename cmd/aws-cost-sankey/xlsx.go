@@ -0,0 +1,198 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/xuri/excelize/v2"
+)
+
+// Excel limits sheet names to 31 characters
+const maxSheetName = 31
+
+// generateXLSX writes a workbook with a summary sheet, a raw edge sheet formatted as a table for pivoting,
+// and one sheet per account and per environment listing their children
+func generateXLSX(outputFile string) error {
+	infof("Generating XLSX output...")
+
+	graph := buildGraph()
+	f := excelize.NewFile()
+	defer f.Close()
+
+	amountStyle, err := f.NewStyle(&excelize.Style{NumFmt: 4})
+	if err != nil {
+		return fmt.Errorf("failed to create style: %w", err)
+	}
+	headerStyle, err := f.NewStyle(&excelize.Style{Font: &excelize.Font{Bold: true}})
+	if err != nil {
+		return fmt.Errorf("failed to create style: %w", err)
+	}
+
+	usedNames := make(map[string]bool)
+	writeSheet := func(name string, header []string, rows [][]interface{}) (string, error) {
+		sheet := sheetName(name, usedNames)
+		if _, err := f.NewSheet(sheet); err != nil {
+			return "", fmt.Errorf("failed to create sheet %s: %w", sheet, err)
+		}
+		if err := f.SetSheetRow(sheet, "A1", &header); err != nil {
+			return "", fmt.Errorf("failed to write sheet %s: %w", sheet, err)
+		}
+		for i, row := range rows {
+			cell, _ := excelize.CoordinatesToCellName(1, i+2)
+			if err := f.SetSheetRow(sheet, cell, &row); err != nil {
+				return "", fmt.Errorf("failed to write sheet %s: %w", sheet, err)
+			}
+		}
+
+		last, _ := excelize.ColumnNumberToName(len(header))
+		if err := f.SetCellStyle(sheet, "A1", last+"1", headerStyle); err != nil {
+			return "", fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+		}
+		if err := f.SetColWidth(sheet, "A", "A", 40); err != nil {
+			return "", fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+		}
+		if err := f.SetColWidth(sheet, "B", last, 16); err != nil {
+			return "", fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+		}
+		if err := f.SetPanes(sheet, &excelize.Panes{Freeze: true, YSplit: 1, TopLeftCell: "A2", ActivePane: "bottomLeft"}); err != nil {
+			return "", fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+		}
+		return sheet, nil
+	}
+
+	// Summary of every node per level, with data bars to spot the largest ones
+	var summary [][]interface{}
+	for _, node := range graph.Nodes {
+		if node.Depth == 0 {
+			continue
+		}
+		summary = append(summary, []interface{}{levelTitle(node.Depth), node.Name, node.Value, shareOf(node.Value, graph.Total)})
+	}
+	sheet, err := writeSheet("Summary", []string{"Level", "Node", "Cost", "Share"}, summary)
+	if err != nil {
+		return err
+	}
+	lastRow := len(summary) + 1
+	if err := f.SetCellStyle(sheet, "C2", fmt.Sprintf("C%d", lastRow), amountStyle); err != nil {
+		return fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+	}
+	percentStyle, err := f.NewStyle(&excelize.Style{NumFmt: 10})
+	if err != nil {
+		return fmt.Errorf("failed to create style: %w", err)
+	}
+	if err := f.SetCellStyle(sheet, "D2", fmt.Sprintf("D%d", lastRow), percentStyle); err != nil {
+		return fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+	}
+	if err := f.SetConditionalFormat(sheet, fmt.Sprintf("C2:C%d", lastRow), []excelize.ConditionalFormatOptions{
+		{Type: "data_bar", Criteria: "=", MinType: "min", MaxType: "max", BarColor: "#638EC6"},
+	}); err != nil {
+		return fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+	}
+
+	// Raw links as a table, ready for pivoting
+	edges := make([][]interface{}, 0, len(graph.Links))
+	depths := make(map[string]int)
+	for _, node := range graph.Nodes {
+		depths[node.Name] = node.Depth
+	}
+	for _, link := range graph.Links {
+		edges = append(edges, []interface{}{link.Source, link.Target, levelTitle(depths[link.Target]), link.Value})
+	}
+	if sheet, err = writeSheet("Edges", []string{"Source", "Target", "Level", "Cost"}, edges); err != nil {
+		return err
+	}
+	if err := f.SetCellStyle(sheet, "D2", fmt.Sprintf("D%d", len(edges)+1), amountStyle); err != nil {
+		return fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+	}
+	if len(edges) > 0 {
+		if err := f.AddTable(sheet, &excelize.Table{Range: fmt.Sprintf("A1:D%d", len(edges)+1), Name: "Edges", StyleName: "TableStyleMedium2"}); err != nil {
+			return fmt.Errorf("failed to add table: %w", err)
+		}
+	}
+
+	// One sheet per account and per environment, i.e. the first two levels below the root
+	writeBreakdown := func(node namedCost) error {
+		children := sortedChildren(node.name)
+		if len(children) == 0 {
+			return nil
+		}
+		rows := make([][]interface{}, 0, len(children))
+		for _, child := range children {
+			rows = append(rows, []interface{}{child.name, child.cost, shareOf(child.cost, node.cost)})
+		}
+		sheet, err := writeSheet(node.name, []string{node.name, "Cost", "Share"}, rows)
+		if err != nil {
+			return err
+		}
+		if err := f.SetCellStyle(sheet, "B2", fmt.Sprintf("B%d", len(rows)+1), amountStyle); err != nil {
+			return fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+		}
+		if err := f.SetCellStyle(sheet, "C2", fmt.Sprintf("C%d", len(rows)+1), percentStyle); err != nil {
+			return fmt.Errorf("failed to format sheet %s: %w", sheet, err)
+		}
+		return nil
+	}
+	accounts := sortedChildren("all")
+	for _, account := range accounts {
+		if err := writeBreakdown(account); err != nil {
+			return err
+		}
+	}
+	seen := make(map[string]bool)
+	for _, account := range accounts {
+		for _, environment := range sortedChildren(account.name) {
+			if !seen[environment.name] {
+				seen[environment.name] = true
+				if err := writeBreakdown(environment); err != nil {
+					return err
+				}
+			}
+		}
+	}
+
+	// Drop the default sheet now that the summary exists
+	if err := f.DeleteSheet("Sheet1"); err != nil {
+		return fmt.Errorf("failed to delete default sheet: %w", err)
+	}
+	f.SetActiveSheet(0)
+	if err := f.SaveAs(outputFile); err != nil {
+		return fmt.Errorf("failed to write output file: %w", err)
+	}
+	return nil
+}
+
+// sheetName returns a unique valid sheet name for the given node
+func sheetName(name string, used map[string]bool) string {
+	name = strings.Map(func(r rune) rune {
+		if strings.ContainsRune(`[]:*?/\`, r) {
+			return '_'
+		}
+		return r
+	}, name)
+	if name == "" || name == "Sheet1" {
+		name = "_" + name
+	}
+
+	candidate := truncate(name, maxSheetName)
+	for i := 2; used[strings.ToLower(candidate)]; i++ {
+		suffix := fmt.Sprintf(" (%d)", i)
+		candidate = truncate(name, maxSheetName-len(suffix)) + suffix
+	}
+	used[strings.ToLower(candidate)] = true
+	return candidate
+}
+
+func truncate(text string, length int) string {
+	runes := []rune(text)
+	if len(runes) > length {
+		return string(runes[:length])
+	}
+	return text
+}
+
+func shareOf(cost float64, total float64) float64 {
+	if total == 0 {
+		return 0
+	}
+	return cost / total
+}
@@ -0,0 +1,157 @@
+// Package costgraph is the model of the cost data: flows of cost from parent to child nodes, e.g. from an account to
+// its environments and services, and the JSON graph they are exchanged as.
+package costgraph
+
+import (
+	"sort"
+)
+
+// Root is the node above the top level of the hierarchy, e.g. the accounts. It is not rendered.
+const Root = "all"
+
+// Flows holds the cost of each link, keyed by parent and then by child node
+type Flows map[string]map[string]float64
+
+// Add adds cost to the link from parent to child
+func (f Flows) Add(parent string, child string, cost float64) {
+	if _, ok := f[parent]; !ok {
+		f[parent] = make(map[string]float64)
+	}
+	f[parent][child] += cost
+}
+
+// Merge adds the cost of each link of other
+func (f Flows) Merge(other Flows) {
+	for parent, children := range other {
+		for child, cost := range children {
+			f.Add(parent, child, cost)
+		}
+	}
+}
+
+// Rename renames nodes in place, merging the costs of nodes that end up with the same name
+func (f Flows) Rename(names map[string]string) {
+	rename := func(node string) string {
+		if name, ok := names[node]; ok && name != "" {
+			return name
+		}
+		return node
+	}
+
+	renamed := make(Flows)
+	for parent, children := range f {
+		for child, cost := range children {
+			renamed.Add(rename(parent), rename(child), cost)
+		}
+	}
+	clear(f)
+	for parent, children := range renamed {
+		f[parent] = children
+	}
+}
+
+// Links returns the links ordered by the level of their source, then by descending cost and by name,
+// so that outputs can be diffed between runs
+func (f Flows) Links() []Link {
+	depths := f.Depths()
+	links := make([]Link, 0, len(f))
+	for parent, children := range f {
+		for child, cost := range children {
+			links = append(links, Link{Source: parent, Target: child, Value: cost})
+		}
+	}
+	sort.Slice(links, func(i, j int) bool {
+		a, b := links[i], links[j]
+		if depths[a.Source] != depths[b.Source] {
+			return depths[a.Source] < depths[b.Source]
+		}
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		if a.Source != b.Source {
+			return a.Source < b.Source
+		}
+		return a.Target < b.Target
+	})
+	return links
+}
+
+// Depths returns the column of each node, i.e. the length of the longest path from a root node
+func (f Flows) Depths() map[string]int {
+	depths := make(map[string]int)
+	for parent, children := range f {
+		depths[parent] += 0
+		for child := range children {
+			depths[child] += 0
+		}
+	}
+
+	// Relax until stable, bounded by the number of nodes in case of cycles
+	for i := 0; i < len(depths); i++ {
+		changed := false
+		for parent, children := range f {
+			for child := range children {
+				if depths[child] < depths[parent]+1 {
+					depths[child] = depths[parent] + 1
+					changed = true
+				}
+			}
+		}
+		if !changed {
+			break
+		}
+	}
+	return depths
+}
+
+// FindCycle returns a path of nodes leading back to its first node, e.g. ["a", "b", "a"], or nil if the flows have
+// no cycle. Nodes are visited in order so that the same cycle is reported on every run.
+func (f Flows) FindCycle() []string {
+	const (
+		visiting = 1
+		done     = 2
+	)
+	state := make(map[string]int)
+	var path []string
+	var visit func(node string) []string
+	visit = func(node string) []string {
+		state[node] = visiting
+		path = append(path, node)
+		children := make([]string, 0, len(f[node]))
+		for child := range f[node] {
+			children = append(children, child)
+		}
+		sort.Strings(children)
+		for _, child := range children {
+			switch state[child] {
+			case visiting:
+				for i, n := range path {
+					if n == child {
+						return append(append([]string{}, path[i:]...), child)
+					}
+				}
+			case 0:
+				if cycle := visit(child); cycle != nil {
+					return cycle
+				}
+			}
+		}
+		path = path[:len(path)-1]
+		state[node] = done
+		return nil
+	}
+
+	parents := make([]string, 0, len(f))
+	for parent := range f {
+		parents = append(parents, parent)
+	}
+	sort.Strings(parents)
+	for _, parent := range parents {
+		if state[parent] == 0 {
+			if cycle := visit(parent); cycle != nil {
+				return cycle
+			}
+		}
+	}
+	return nil
+}
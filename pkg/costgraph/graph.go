@@ -0,0 +1,132 @@
+package costgraph
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// Version is incremented on incompatible changes of the JSON graph format
+const Version = 1
+
+// Graph is the JSON interchange format of the cost data
+type Graph struct {
+	Version   int               `json:"version"`
+	Period    Period            `json:"period"`
+	Currency  string            `json:"currency"`
+	Metric    string            `json:"metric,omitempty"`
+	Threshold float64           `json:"threshold"`
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	Total     float64           `json:"total"`
+	Levels    []Level           `json:"levels,omitempty"`
+	Nodes     []Node            `json:"nodes"`
+	Links     []Link            `json:"links"`
+
+	// Largest changes since the compared period, only set when comparing
+	Comparison *Comparison `json:"comparison,omitempty"`
+}
+
+type Period struct {
+	Start string `json:"start"`
+	End   string `json:"end"`
+}
+
+// Level is a column of the diagram, counted from the root
+type Level struct {
+	Depth int     `json:"depth"`
+	Total float64 `json:"total"`
+	Nodes int     `json:"nodes"`
+}
+
+type Node struct {
+	Name  string  `json:"name"`
+	Depth int     `json:"depth"`
+	Value float64 `json:"value"`
+}
+
+type Link struct {
+	Source string  `json:"source"`
+	Target string  `json:"target"`
+	Value  float64 `json:"value"`
+}
+
+type Comparison struct {
+	Period    string   `json:"period"`
+	Increases []Change `json:"increases"`
+	Decreases []Change `json:"decreases"`
+}
+
+type Change struct {
+	Name     string  `json:"name"`
+	Previous float64 `json:"previous"`
+	Current  float64 `json:"current"`
+	Delta    float64 `json:"delta"`
+}
+
+// New returns the graph of the flows with its nodes, levels and total. The period, currency and other details of
+// the cost data are left to the caller.
+func New(flows Flows) Graph {
+	graph := Graph{
+		Version: Version,
+		Nodes:   make([]Node, 0),
+		Links:   flows.Links(),
+	}
+
+	// The value of a node is its incoming cost, or its outgoing cost for root nodes
+	incoming := make(map[string]float64)
+	outgoing := make(map[string]float64)
+	for _, link := range graph.Links {
+		outgoing[link.Source] += link.Value
+		incoming[link.Target] += link.Value
+	}
+
+	for name, depth := range flows.Depths() {
+		value, ok := incoming[name]
+		if !ok {
+			value = outgoing[name]
+			graph.Total += value
+		}
+		graph.Nodes = append(graph.Nodes, Node{Name: name, Depth: depth, Value: value})
+
+		for len(graph.Levels) <= depth {
+			graph.Levels = append(graph.Levels, Level{Depth: len(graph.Levels)})
+		}
+		graph.Levels[depth].Total += value
+		graph.Levels[depth].Nodes++
+	}
+
+	// Keep the output stable across runs, like the links
+	sort.Slice(graph.Nodes, func(i, j int) bool {
+		a, b := graph.Nodes[i], graph.Nodes[j]
+		if a.Depth != b.Depth {
+			return a.Depth < b.Depth
+		}
+		if a.Value != b.Value {
+			return a.Value > b.Value
+		}
+		return a.Name < b.Name
+	})
+
+	return graph
+}
+
+// Parse decodes a JSON graph, failing on graphs of a newer version
+func Parse(data []byte) (Graph, error) {
+	var graph Graph
+	if err := json.Unmarshal(data, &graph); err != nil {
+		return graph, fmt.Errorf("failed to decode graph: %w", err)
+	}
+	if graph.Version > Version {
+		return graph, fmt.Errorf("unsupported graph version %d, expected at most %d", graph.Version, Version)
+	}
+	return graph, nil
+}
+
+// Flows returns the flows of the links of the graph
+func (g Graph) Flows() Flows {
+	flows := make(Flows)
+	for _, link := range g.Links {
+		flows.Add(link.Source, link.Target, link.Value)
+	}
+	return flows
+}
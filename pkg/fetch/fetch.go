@@ -0,0 +1,267 @@
+// Package fetch requests costs from AWS Cost Explorer grouped by the levels of a hierarchy, splitting requests per
+// calendar month and following their pages until the results are exhausted, and aggregates them into cost flows.
+package fetch
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// CostExplorerAPI is the part of the Cost Explorer client used to fetch costs, satisfied by *costexplorer.Client
+type CostExplorerAPI interface {
+	GetCostAndUsage(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error)
+}
+
+// MonthlyPeriods splits the date range at the start of each calendar month.
+// Dates that can't be parsed are passed through as a single period for Cost Explorer to validate.
+func MonthlyPeriods(start string, end string) []*types.DateInterval {
+	startDate, errStart := time.Parse(time.DateOnly, start)
+	endDate, errEnd := time.Parse(time.DateOnly, end)
+	if errStart != nil || errEnd != nil {
+		return []*types.DateInterval{{Start: aws.String(start), End: aws.String(end)}}
+	}
+
+	var periods []*types.DateInterval
+	for startDate.Before(endDate) {
+		next := time.Date(startDate.Year(), startDate.Month()+1, 1, 0, 0, 0, 0, time.UTC)
+		if next.After(endDate) {
+			next = endDate
+		}
+		periods = append(periods, &types.DateInterval{
+			Start: aws.String(startDate.Format(time.DateOnly)),
+			End:   aws.String(next.Format(time.DateOnly)),
+		})
+		startDate = next
+	}
+	return periods
+}
+
+// Pages requests the costs of the period of the input one calendar month at a time, so that completed months can be
+// cached by the client, and passes every page of the responses to handle
+func Pages(ctx context.Context, client CostExplorerAPI, input *costexplorer.GetCostAndUsageInput, handle func(*costexplorer.GetCostAndUsageOutput) error) error {
+	if input.TimePeriod == nil {
+		return fmt.Errorf("missing time period")
+	}
+	for _, period := range MonthlyPeriods(aws.ToString(input.TimePeriod.Start), aws.ToString(input.TimePeriod.End)) {
+		monthly := *input
+		monthly.TimePeriod = period
+		monthly.NextPageToken = nil
+
+		// Cost Explorer paginates grouped results, keep fetching until NextPageToken is exhausted
+		for {
+			if err := ctx.Err(); err != nil {
+				return err
+			}
+			output, err := client.GetCostAndUsage(ctx, &monthly)
+			if err != nil {
+				return fmt.Errorf("failed to get cost data: %w", err)
+			}
+			if err := handle(output); err != nil {
+				return err
+			}
+			if aws.ToString(output.NextPageToken) == "" {
+				break
+			}
+			monthly.NextPageToken = output.NextPageToken
+		}
+	}
+	return nil
+}
+
+// Options of the costs fetched by Fetch
+type Options struct {
+	Period      costgraph.Period
+	Granularity types.Granularity
+	Metric      string
+	// Levels of the flows below the root node
+	Hierarchy []Level
+	// Name of the account, the node of account levels
+	Account string
+	// Filter of the costs, e.g. to a linked account of the organization
+	Filter *types.Expression
+
+	// Node returns the node of a group key at the given depth below the root, the key of account levels being the
+	// account. Defaults to the key, or the value of tags and cost categories and "<parent>-unknown" if untagged.
+	Node func(level Level, depth int, key string, parent string) string
+	// Convert returns the cost of an amount in the given unit, e.g. converted to another currency. Defaults to the
+	// amount.
+	Convert func(amount float64, unit string) (float64, error)
+	// RecordType groups the costs by record type as well if set, and returns the node of the costs of a record type
+	// shown as a separate branch of the account, or "" to add them along the hierarchy
+	RecordType func(recordType string, cost float64) string
+	// Buckets is filled with the flows of each time period of the granularity, keyed by its start date, if set
+	Buckets map[string]costgraph.Flows
+}
+
+// Fetch returns the costs of the period as flows from the root node along the levels of the hierarchy.
+// Since Cost Explorer limits the number of group definitions per request, deeper hierarchies are fetched by
+// splitting on the first level and fetching each of its values with a filter. The flows fetched before an error are
+// returned with it.
+func Fetch(ctx context.Context, client CostExplorerAPI, opts Options) (costgraph.Flows, error) {
+	if opts.Node == nil {
+		opts.Node = defaultNode
+	}
+	if opts.Convert == nil {
+		opts.Convert = func(amount float64, _ string) (float64, error) { return amount, nil }
+	}
+	var filters []types.Expression
+	if opts.Filter != nil {
+		filters = append(filters, *opts.Filter)
+	}
+
+	flows := make(costgraph.Flows)
+	err := opts.fetchGroups(ctx, client, flows, opts.GroupLevels(), filters, nil)
+	return flows, err
+}
+
+// GroupLevels returns the levels the costs are grouped by in Cost Explorer requests.
+// Record type is grouped by last so that it can be split off the group keys.
+func (o Options) GroupLevels() []Level {
+	levels := make([]Level, 0, len(o.Hierarchy)+1)
+	for _, level := range o.Hierarchy {
+		if level.Type != LevelAccount {
+			levels = append(levels, level)
+		}
+	}
+	if o.RecordType != nil {
+		levels = append(levels, Level{Type: LevelDimension, Key: string(types.DimensionRecordType)})
+	}
+	return levels
+}
+
+// Input returns the request of the costs of a period grouped by the given levels
+func (o Options) Input(period *types.DateInterval, levels []Level, filters []types.Expression) *costexplorer.GetCostAndUsageInput {
+	groupBy := make([]types.GroupDefinition, 0, len(levels))
+	for _, level := range levels {
+		groupBy = append(groupBy, level.GroupDefinition())
+	}
+	return &costexplorer.GetCostAndUsageInput{
+		TimePeriod:  period,
+		Granularity: o.Granularity,
+		Metrics:     []string{o.Metric},
+		GroupBy:     groupBy,
+		Filter:      CombineFilters(filters),
+	}
+}
+
+// fetchGroups adds the costs grouped by the given levels to flows.
+// prefix holds the group keys of levels that were already resolved by filtering.
+func (o Options) fetchGroups(ctx context.Context, client CostExplorerAPI, flows costgraph.Flows, levels []Level, filters []types.Expression, prefix []string) error {
+	period := &types.DateInterval{Start: aws.String(o.Period.Start), End: aws.String(o.Period.End)}
+	if len(levels) <= MaxGroupBy {
+		return Pages(ctx, client, o.Input(period, levels, filters), func(output *costexplorer.GetCostAndUsageOutput) error {
+			return o.addResults(flows, prefix, output)
+		})
+	}
+
+	var keys []string
+	seen := make(map[string]bool)
+	err := Pages(ctx, client, o.Input(period, levels[:1], filters), func(output *costexplorer.GetCostAndUsageOutput) error {
+		for _, resultByTime := range output.ResultsByTime {
+			for _, group := range resultByTime.Groups {
+				if !seen[group.Keys[0]] {
+					seen[group.Keys[0]] = true
+					keys = append(keys, group.Keys[0])
+				}
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return err
+	}
+
+	for _, key := range keys {
+		subFilters := append(append([]types.Expression{}, filters...), levels[0].Filter(key))
+		subPrefix := append(append([]string{}, prefix...), key)
+		if err := o.fetchGroups(ctx, client, flows, levels[1:], subFilters, subPrefix); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addResults aggregates the costs of a response along the hierarchy
+func (o Options) addResults(flows costgraph.Flows, prefix []string, output *costexplorer.GetCostAndUsageOutput) error {
+	for _, resultByTime := range output.ResultsByTime {
+		bucket := aws.ToString(resultByTime.TimePeriod.Start)
+		add := func(parent string, child string, cost float64) {
+			flows.Add(parent, child, cost)
+			if o.Buckets != nil {
+				if _, ok := o.Buckets[bucket]; !ok {
+					o.Buckets[bucket] = make(costgraph.Flows)
+				}
+				o.Buckets[bucket].Add(parent, child, cost)
+			}
+		}
+
+		groups := resultByTime.Groups
+		if len(groups) == 0 && resultByTime.Total != nil {
+			// Requests without group definitions only report the total
+			groups = []types.Group{{Metrics: resultByTime.Total}}
+		}
+
+		for _, group := range groups {
+			keys := append(append([]string{}, prefix...), group.Keys...)
+
+			metric := group.Metrics[o.Metric]
+			if metric.Amount == nil {
+				continue
+			}
+			amount, err := strconv.ParseFloat(*metric.Amount, 64)
+			if err != nil {
+				return fmt.Errorf("failed to parse amount: %w", err)
+			}
+			if amount, err = o.Convert(amount, aws.ToString(metric.Unit)); err != nil {
+				return err
+			}
+
+			if o.RecordType != nil {
+				recordType := keys[len(keys)-1]
+				keys = keys[:len(keys)-1]
+				if branch := o.RecordType(recordType, amount); branch != "" {
+					// Sankey links can't be negative. Credits and refunds don't add to the cost of the account, only
+					// taxes do.
+					if amount > 0 {
+						add(costgraph.Root, o.Account, amount)
+					}
+					add(o.Account, branch, math.Abs(amount))
+					continue
+				}
+			}
+
+			// Aggregate costs along each link of the hierarchy, starting from the root node
+			parent := costgraph.Root
+			for i, level := range o.Hierarchy {
+				key := o.Account
+				if level.Type != LevelAccount {
+					key, keys = keys[0], keys[1:]
+				}
+				node := o.Node(level, i+1, key, parent)
+				add(parent, node, amount)
+				parent = node
+			}
+		}
+	}
+	return nil
+}
+
+// defaultNode names nodes after their group key, or the value of tags and cost categories
+func defaultNode(level Level, _ int, key string, parent string) string {
+	if level.Type != LevelTag && level.Type != LevelCostCategory {
+		return key
+	}
+	if value := TagValue(key); value != "" {
+		return value
+	}
+	return parent + "-unknown"
+}
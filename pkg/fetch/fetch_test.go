@@ -0,0 +1,102 @@
+package fetch
+
+import (
+	"context"
+	"reflect"
+	"testing"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+func TestMonthlyPeriods(t *testing.T) {
+	var got [][2]string
+	for _, period := range MonthlyPeriods("2024-10-15", "2024-12-10") {
+		got = append(got, [2]string{aws.ToString(period.Start), aws.ToString(period.End)})
+	}
+	want := [][2]string{{"2024-10-15", "2024-11-01"}, {"2024-11-01", "2024-12-01"}, {"2024-12-01", "2024-12-10"}}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("MonthlyPeriods() = %v, want %v", got, want)
+	}
+}
+
+// pagedClient answers each month with two pages
+type pagedClient struct {
+	requests []string
+}
+
+func (c *pagedClient) GetCostAndUsage(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	token := aws.ToString(params.NextPageToken)
+	c.requests = append(c.requests, aws.ToString(params.TimePeriod.Start)+" "+token)
+	if token == "" {
+		return &costexplorer.GetCostAndUsageOutput{NextPageToken: aws.String("page2")}, nil
+	}
+	return &costexplorer.GetCostAndUsageOutput{}, nil
+}
+
+func TestPagesFollowsTokensPerMonth(t *testing.T) {
+	client := &pagedClient{}
+	input := &costexplorer.GetCostAndUsageInput{TimePeriod: &types.DateInterval{Start: aws.String("2024-10-01"), End: aws.String("2024-12-01")}}
+	pages := 0
+	err := Pages(context.Background(), client, input, func(*costexplorer.GetCostAndUsageOutput) error {
+		pages++
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Pages() = %v", err)
+	}
+	want := []string{"2024-10-01 ", "2024-10-01 page2", "2024-11-01 ", "2024-11-01 page2"}
+	if pages != 4 || !reflect.DeepEqual(client.requests, want) {
+		t.Errorf("pages = %d, requests = %v, want 4 pages of %v", pages, client.requests, want)
+	}
+}
+
+// environmentClient answers the costs of each environment, splitting requests grouped by more than two levels
+type environmentClient struct{}
+
+func (environmentClient) GetCostAndUsage(ctx context.Context, params *costexplorer.GetCostAndUsageInput, optFns ...func(*costexplorer.Options)) (*costexplorer.GetCostAndUsageOutput, error) {
+	result := types.ResultByTime{TimePeriod: params.TimePeriod}
+	if len(params.GroupBy) == 1 {
+		result.Groups = []types.Group{{Keys: []string{"environment$prod"}}, {Keys: []string{"environment$"}}}
+	} else {
+		amount := "1"
+		if tags := params.Filter.Tags; tags != nil && len(tags.Values) > 0 {
+			amount = "2"
+		}
+		result.Groups = []types.Group{{
+			Keys:    []string{"EC2", "us-east-1"},
+			Metrics: map[string]types.MetricValue{"UnblendedCost": {Amount: aws.String(amount), Unit: aws.String("USD")}},
+		}}
+	}
+	return &costexplorer.GetCostAndUsageOutput{ResultsByTime: []types.ResultByTime{result}}, nil
+}
+
+func TestFetchSplitsDeepHierarchies(t *testing.T) {
+	flows, err := Fetch(context.Background(), environmentClient{}, Options{
+		Period:  costgraph.Period{Start: "2024-10-01", End: "2024-11-01"},
+		Metric:  "UnblendedCost",
+		Account: "acct1",
+		Hierarchy: []Level{
+			{Type: LevelAccount},
+			{Type: LevelTag, Key: "environment"},
+			{Type: LevelDimension, Key: "SERVICE"},
+			{Type: LevelDimension, Key: "REGION"},
+		},
+	})
+	if err != nil {
+		t.Fatalf("Fetch() = %v", err)
+	}
+	want := costgraph.Flows{
+		"all":           {"acct1": 3},
+		"acct1":         {"prod": 2, "acct1-unknown": 1},
+		"prod":          {"EC2": 2},
+		"acct1-unknown": {"EC2": 1},
+		"EC2":           {"us-east-1": 3},
+	}
+	if !reflect.DeepEqual(flows, want) {
+		t.Errorf("Fetch() = %v, want %v", flows, want)
+	}
+}
@@ -0,0 +1,86 @@
+package fetch
+
+import (
+	"strings"
+
+	"github.com/aws/aws-sdk-go-v2/aws"
+	"github.com/aws/aws-sdk-go-v2/service/costexplorer/types"
+)
+
+// Types of hierarchy levels
+const (
+	LevelAccount      = "account"
+	LevelTag          = "tag"
+	LevelDimension    = "dimension"
+	LevelCostCategory = "costCategory"
+)
+
+// MaxGroupBy is the number of group definitions Cost Explorer accepts per request
+const MaxGroupBy = 2
+
+// Level is a level of the hierarchy below the root node, e.g. {Type: "tag", Key: "environment"} or
+// {Type: "dimension", Key: "SERVICE"}. Account levels have no key.
+type Level struct {
+	Type string
+	Key  string
+}
+
+// GroupDefinition returns the grouping of Cost Explorer requests by this level
+func (l Level) GroupDefinition() types.GroupDefinition {
+	switch l.Type {
+	case LevelTag:
+		return types.GroupDefinition{Type: types.GroupDefinitionTypeTag, Key: aws.String(l.Key)}
+	case LevelCostCategory:
+		return types.GroupDefinition{Type: types.GroupDefinitionTypeCostCategory, Key: aws.String(l.Key)}
+	default:
+		return types.GroupDefinition{Type: types.GroupDefinitionTypeDimension, Key: aws.String(l.Key)}
+	}
+}
+
+// Filter returns an expression matching the given group key of this level. The empty value of a tag or cost
+// category, i.e. untagged costs, matches costs without it.
+func (l Level) Filter(groupKey string) types.Expression {
+	switch l.Type {
+	case LevelTag:
+		value := TagValue(groupKey)
+		if value == "" {
+			return types.Expression{Tags: &types.TagValues{
+				Key:          aws.String(l.Key),
+				MatchOptions: []types.MatchOption{types.MatchOptionAbsent},
+			}}
+		}
+		return types.Expression{Tags: &types.TagValues{Key: aws.String(l.Key), Values: []string{value}}}
+	case LevelCostCategory:
+		value := TagValue(groupKey)
+		if value == "" {
+			return types.Expression{CostCategories: &types.CostCategoryValues{
+				Key:          aws.String(l.Key),
+				MatchOptions: []types.MatchOption{types.MatchOptionAbsent},
+			}}
+		}
+		return types.Expression{CostCategories: &types.CostCategoryValues{Key: aws.String(l.Key), Values: []string{value}}}
+	default:
+		return types.Expression{Dimensions: &types.DimensionValues{
+			Key:    types.Dimension(l.Key),
+			Values: []string{groupKey},
+		}}
+	}
+}
+
+// TagValue returns the value of a tag or cost category group key, e.g. "prod" for "environment$prod"
+func TagValue(groupKey string) string {
+	_, value, _ := strings.Cut(groupKey, "$")
+	return value
+}
+
+// CombineFilters returns an expression matching all of the filters, or nil if there are none
+func CombineFilters(filters []types.Expression) *types.Expression {
+	switch len(filters) {
+	case 0:
+		return nil
+	case 1:
+		return &filters[0]
+	default:
+		return &types.Expression{And: filters}
+	}
+}
@@ -0,0 +1,29 @@
+package fetch
+
+import (
+	"context"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// CostProvider returns the costs of a period as flows from the root node down the levels of the hierarchy. Other
+// data sources, e.g. Cost and Usage Reports, other clouds or files, are added by implementing it.
+type CostProvider interface {
+	Fetch(ctx context.Context, period costgraph.Period, hierarchy []Level) (costgraph.Flows, error)
+}
+
+// CostExplorer provides the costs of an account from AWS Cost Explorer
+type CostExplorer struct {
+	Client CostExplorerAPI
+
+	// Options of the requests, whose period and hierarchy are those passed to Fetch
+	Options Options
+}
+
+// Fetch returns the costs of the period along the hierarchy, see the Fetch function
+func (p CostExplorer) Fetch(ctx context.Context, period costgraph.Period, hierarchy []Level) (costgraph.Flows, error) {
+	opts := p.Options
+	opts.Period = period
+	opts.Hierarchy = hierarchy
+	return Fetch(ctx, p.Client, opts)
+}
@@ -0,0 +1,85 @@
+package render
+
+import (
+	"fmt"
+	"io"
+	"sort"
+	"sync"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Renderer writes a cost graph in an output format
+type Renderer interface {
+	// Extension of the files of the format, e.g. ".txt"
+	Extension() string
+	Render(w io.Writer, graph costgraph.Graph) error
+}
+
+// Func returns a renderer of files of the extension, calling render
+func Func(extension string, render func(w io.Writer, graph costgraph.Graph) error) Renderer {
+	return funcRenderer{extension, render}
+}
+
+type funcRenderer struct {
+	extension string
+	render    func(w io.Writer, graph costgraph.Graph) error
+}
+
+func (r funcRenderer) Extension() string {
+	return r.extension
+}
+
+func (r funcRenderer) Render(w io.Writer, graph costgraph.Graph) error {
+	return r.render(w, graph)
+}
+
+var (
+	renderersMu sync.RWMutex
+	renderers   = map[string]Renderer{
+		"text": Func(".txt", func(w io.Writer, graph costgraph.Graph) error {
+			return Text(w, graph.Flows(), nil)
+		}),
+		"json": Func(".json", JSON),
+		"mermaid": Func(".mmd", func(w io.Writer, graph costgraph.Graph) error {
+			return Mermaid(w, graph.Flows())
+		}),
+	}
+)
+
+// Register makes a renderer available by the name of its format, e.g. "html". It panics if the name is taken, since
+// formats are registered once when a program starts.
+func Register(name string, renderer Renderer) {
+	renderersMu.Lock()
+	defer renderersMu.Unlock()
+
+	if renderer == nil {
+		panic(fmt.Sprintf("render: nil renderer of format %s", name))
+	}
+	if _, ok := renderers[name]; ok {
+		panic(fmt.Sprintf("render: format %s registered twice", name))
+	}
+	renderers[name] = renderer
+}
+
+// Lookup returns the renderer of a format
+func Lookup(name string) (Renderer, bool) {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	renderer, ok := renderers[name]
+	return renderer, ok
+}
+
+// Formats returns the names of the registered formats in order
+func Formats() []string {
+	renderersMu.RLock()
+	defer renderersMu.RUnlock()
+
+	names := make([]string, 0, len(renderers))
+	for name := range renderers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,64 @@
+// Package render writes cost flows in the text formats of aws-cost-sankey. The HTML, image and document formats stay
+// with the command, which lays them out from its configuration.
+package render
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Text writes one "parent [cost] child" line per link, followed by the comments as "# " lines. The output can be read
+// back as input.
+func Text(w io.Writer, flows costgraph.Flows, comments []string) error {
+	for _, link := range flows.Links() {
+		if _, err := fmt.Fprintf(w, "%s [%.2f] %s\n", link.Source, link.Value, link.Target); err != nil {
+			return err
+		}
+	}
+	for _, comment := range comments {
+		if _, err := fmt.Fprintf(w, "# %s\n", comment); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// JSON writes the graph as indented JSON
+func JSON(w io.Writer, graph costgraph.Graph) error {
+	data, err := json.MarshalIndent(graph, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal graph: %w", err)
+	}
+	_, err = w.Write(data)
+	return err
+}
+
+// Mermaid writes the links with a positive cost in Mermaid sankey-beta syntax, which is CSV without a header
+func Mermaid(w io.Writer, flows costgraph.Flows) error {
+	if _, err := io.WriteString(w, "sankey-beta\n\n"); err != nil {
+		return err
+	}
+	for _, link := range flows.Links() {
+		if link.Value <= 0 {
+			continue
+		}
+		amount := strconv.FormatFloat(link.Value, 'f', 2, 64)
+		if _, err := fmt.Fprintf(w, "%s,%s,%s\n", mermaidField(link.Source), mermaidField(link.Target), amount); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// mermaidField quotes node names containing commas or quotes
+func mermaidField(name string) string {
+	if strings.ContainsAny(name, ",\"") {
+		return fmt.Sprintf("\"%s\"", strings.ReplaceAll(name, "\"", "\"\""))
+	}
+	return name
+}
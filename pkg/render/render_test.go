@@ -0,0 +1,86 @@
+package render
+
+import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"aws-costexplorer/pkg/costgraph"
+)
+
+// Run "go test ./pkg/render -update" to rewrite the golden files after an intended change of the output
+var update = flag.Bool("update", false, "rewrite the golden files")
+
+// testFlows has an untagged branch, a name that needs quoting in CSV and ties broken by name
+func testFlows() costgraph.Flows {
+	return costgraph.Flows{
+		"all":           {"acct1": 115.5, "acct2": 20},
+		"acct1":         {"acct1/prod": 100, "acct1-unknown": 15.5},
+		"acct2":         {"acct2/dev": 20},
+		"acct1/prod":    {"Amazon Elastic Compute Cloud - Compute": 80, "Amazon Simple Storage Service": 20},
+		"acct1-unknown": {"AWS Lambda": 15.5},
+		"acct2/dev":     {"Amazon Elastic Compute Cloud - Compute": 10, `Savings Plans for AWS Compute usage, "1yr"`: 10},
+	}
+}
+
+// checkGolden compares the output with testdata/<name>, or rewrites it with -update
+func checkGolden(t *testing.T, name string, got []byte) {
+	t.Helper()
+	golden := filepath.Join("testdata", name)
+	if *update {
+		if err := os.WriteFile(golden, got, 0o644); err != nil {
+			t.Fatalf("failed to update golden file: %v", err)
+		}
+	}
+	want, err := os.ReadFile(golden)
+	if err != nil {
+		t.Fatalf("failed to read golden file: %v", err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s, run with -update if intended:\n%s", golden, got)
+	}
+}
+
+func TestTextGolden(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Text(&buf, testFlows(), []string{"Compared with 2024-09-01-2024-10-01"}); err != nil {
+		t.Fatalf("Text() = %v", err)
+	}
+	checkGolden(t, "text.golden", buf.Bytes())
+}
+
+func TestJSONGolden(t *testing.T) {
+	graph := costgraph.New(testFlows())
+	graph.Period = costgraph.Period{Start: "2024-10-01", End: "2024-11-01"}
+	graph.Currency = "USD"
+	graph.Metric = "UnblendedCost"
+	graph.Threshold = 1
+
+	var buf bytes.Buffer
+	if err := JSON(&buf, graph); err != nil {
+		t.Fatalf("JSON() = %v", err)
+	}
+	checkGolden(t, "graph.json.golden", buf.Bytes())
+
+	// The graph reads back as the same flows
+	parsed, err := costgraph.Parse(buf.Bytes())
+	if err != nil {
+		t.Fatalf("Parse() = %v", err)
+	}
+	if got, want := parsed.Flows().Links(), testFlows().Links(); len(got) != len(want) {
+		t.Errorf("links read back = %d, want %d", len(got), len(want))
+	}
+}
+
+func TestMermaidQuotesNames(t *testing.T) {
+	var buf bytes.Buffer
+	if err := Mermaid(&buf, testFlows()); err != nil {
+		t.Fatalf("Mermaid() = %v", err)
+	}
+	want := `acct2/dev,"Savings Plans for AWS Compute usage, ""1yr""",10.00`
+	if !bytes.Contains(buf.Bytes(), []byte(want)) {
+		t.Errorf("Mermaid() = %s, want a line %s", buf.String(), want)
+	}
+}